@@ -14,7 +14,8 @@ teardown(){
     run in_container fake-waagent install
     echo "$output"
     [ "$status" -eq 0 ]
-    [[ "$output" = *event=installed* ]]
+    log="$(container_handler_log)"; echo "$log"
+    [[ "$log" = *event=installed* ]]
 
     diff="$(container_diff)"
     echo "$diff"
@@ -42,7 +43,8 @@ teardown(){
     echo "$output"
     [[ "$output" = *'applicationhealth-extension process terminated'* ]]
 
-    healthy_count="$(echo "$output" | grep -c 'state changed to healthy')"
+    log="$(container_handler_log)"; echo "$log"
+    healthy_count="$(echo "$log" | grep -c 'state changed to healthy')"
     echo "Enable count=$healthy_count"
     [ "$healthy_count" -eq 2 ]
 
@@ -58,7 +60,8 @@ teardown(){
    
     run start_container
     echo "$output"
-    [[ "$output" == *"json validation error: invalid public settings JSON: badElement"* ]]
+    log="$(container_handler_log)"; echo "$log"
+    [[ "$log" == *"json validation error: invalid public settings JSON: badElement"* ]]
 }
 
 @test "handler command: enable - failed tcp probe" {
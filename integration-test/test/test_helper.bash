@@ -46,6 +46,10 @@ container_read_file() { # reads the file at container path $1
     docker cp $TEST_CONTAINER:"$1" - | tar x --to-stdout
 } 
 
+container_handler_log() { # reads the log the handler wrote in the container
+    container_read_file /var/log/azure/applicationhealth-extension/handler.log
+}
+
 mk_certs() { # creates certs/{THUMBPRINT}.(crt|key) files under ./certs/ and prints THUMBPRINT
     set -eo pipefail
     mkdir -p "$certs_dir" && cd "$certs_dir" && rm -f "$certs_dir/*"
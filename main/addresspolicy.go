@@ -0,0 +1,145 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/go-kit/kit/log"
+	"github.com/pkg/errors"
+)
+
+const (
+	// addressPolicyAny connects to the addresses in turn until one succeeds.
+	addressPolicyAny = "any"
+	// addressPolicyAll requires every address to accept the connection.
+	addressPolicyAll = "all"
+	// addressPolicyFirst only connects to the first address.
+	addressPolicyFirst = "first"
+
+	probeAddressesSubstatusName = "AppHealthProbeAddresses"
+)
+
+var (
+	errAddressPolicyWithSshTunnel = errors.New("'addressPolicy' cannot be used together with 'sshTunnel', the relay resolves the probe target")
+
+	// probeAddresses records the address each probe target was last
+	// connected to when an address policy is configured.
+	probeAddresses = newAddressRecorder()
+)
+
+// addressRecorder records the address each probe target resolved to and was
+// connected to.
+type addressRecorder struct {
+	mu        sync.Mutex
+	addresses map[string]string
+}
+
+func newAddressRecorder() *addressRecorder {
+	return &addressRecorder{addresses: make(map[string]string)}
+}
+
+// record sets the address connected to for target and reports whether it
+// changed.
+func (r *addressRecorder) record(target, addr string) bool {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	changed := r.addresses[target] != addr
+	r.addresses[target] = addr
+	return changed
+}
+
+// message formats the recorded addresses as the substatus message, e.g.
+// "localhost:80=127.0.0.1:80".
+func (r *addressRecorder) message() string {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	var out []string
+	for target, addr := range r.addresses {
+		out = append(out, target+"="+addr)
+	}
+	sort.Strings(out)
+	return strings.Join(out, " ")
+}
+
+// addressPolicyDialer connects to a probe target resolving to several
+// addresses according to the configured policy.
+type addressPolicyDialer struct {
+	ctx       *log.Context
+	policy    string
+	allowlist *targetAllowlist
+	lookup    func(ctx context.Context, host string) ([]string, error)
+	recorder  *addressRecorder
+}
+
+func newAddressPolicyDialer(ctx *log.Context, policy string, allowlist *targetAllowlist) *addressPolicyDialer {
+	return &addressPolicyDialer{
+		ctx:       ctx,
+		policy:    policy,
+		allowlist: allowlist,
+		lookup:    net.DefaultResolver.LookupHost,
+		recorder:  probeAddresses,
+	}
+}
+
+func (d *addressPolicyDialer) dialContext(ctx context.Context, network, addr string) (net.Conn, error) {
+	host, port, err := net.SplitHostPort(addr)
+	if err != nil {
+		return nil, err
+	}
+	resolved, err := d.lookup(ctx, host)
+	if err != nil {
+		return nil, err
+	}
+	var ips []string
+	for _, ip := range resolved {
+		if matchesNetwork(network, ip) {
+			ips = append(ips, ip)
+		}
+	}
+	if len(ips) == 0 {
+		return nil, errors.Errorf("%s resolved to no address", host)
+	}
+	if d.policy == addressPolicyFirst {
+		ips = ips[:1]
+	}
+
+	var conns []net.Conn
+	var lastErr error
+	for _, ip := range ips {
+		conn, err := d.allowlist.dialAs(ctx, network, host, net.JoinHostPort(ip, port))
+		if err != nil {
+			if d.policy == addressPolicyAll {
+				closeAll(conns)
+				return nil, errors.Wrapf(err, "%s of %d addresses of %s", ip, len(ips), host)
+			}
+			lastErr = err
+			continue
+		}
+		conns = append(conns, conn)
+		if d.policy != addressPolicyAll {
+			break
+		}
+	}
+	if len(conns) == 0 {
+		return nil, lastErr
+	}
+
+	// the probe goes on with the first connection
+	closeAll(conns[1:])
+	chosen := conns[0].RemoteAddr().String()
+	if d.recorder.record(addr, chosen) {
+		d.ctx.Log("event", "probe target address changed", "target", addr, "address", chosen,
+			"policy", d.policy, "resolved", fmt.Sprint(ips))
+	}
+	return conns[0], nil
+}
+
+func closeAll(conns []net.Conn) {
+	for _, c := range conns {
+		c.Close()
+	}
+}
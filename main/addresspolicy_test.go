@@ -0,0 +1,81 @@
+package main
+
+import (
+	"context"
+	"net"
+	"strconv"
+	"testing"
+
+	"github.com/go-kit/kit/log"
+	"github.com/stretchr/testify/require"
+)
+
+// listenLoopback listens on 127.0.0.1 and 127.0.0.2 on the same port and
+// returns the port.
+func listenLoopback(t *testing.T) string {
+	l1, err := net.Listen("tcp", "127.0.0.1:0")
+	require.Nil(t, err)
+	t.Cleanup(func() { l1.Close() })
+	_, port, _ := net.SplitHostPort(l1.Addr().String())
+	l2, err := net.Listen("tcp", "127.0.0.2:"+port)
+	require.Nil(t, err)
+	t.Cleanup(func() { l2.Close() })
+	return port
+}
+
+func Test_addressPolicyDialer(t *testing.T) {
+	port := listenLoopback(t)
+	target := net.JoinHostPort("app", port)
+	dial := func(policy string, ips ...string) (string, error) {
+		d := newAddressPolicyDialer(log.NewContext(log.NewNopLogger()), policy, nil)
+		d.lookup = func(context.Context, string) ([]string, error) { return ips, nil }
+		d.recorder = newAddressRecorder()
+		conn, err := d.dialContext(context.Background(), "tcp", target)
+		if err != nil {
+			return "", err
+		}
+		conn.Close()
+		return d.recorder.message(), nil
+	}
+	down := "127.0.0.3" // nothing listening
+
+	msg, err := dial(addressPolicyAny, down, "127.0.0.2", "127.0.0.1")
+	require.Nil(t, err)
+	require.Equal(t, target+"=127.0.0.2:"+port, msg)
+
+	_, err = dial(addressPolicyAll, "127.0.0.1", down)
+	require.NotNil(t, err)
+	require.Contains(t, err.Error(), "127.0.0.3 of 2 addresses of app")
+	msg, err = dial(addressPolicyAll, "127.0.0.2", "127.0.0.1")
+	require.Nil(t, err)
+	require.Equal(t, target+"=127.0.0.2:"+port, msg)
+
+	_, err = dial(addressPolicyFirst, down, "127.0.0.1")
+	require.NotNil(t, err)
+	msg, err = dial(addressPolicyFirst, "127.0.0.1", down)
+	require.Nil(t, err)
+	require.Equal(t, target+"=127.0.0.1:"+port, msg)
+}
+
+func Test_addressPolicyDialer_allowlist(t *testing.T) {
+	port := listenLoopback(t)
+	allowlist, err := parseTargetAllowlist([]string{"10.0.0.0/8"})
+	require.Nil(t, err)
+	d := newAddressPolicyDialer(log.NewContext(log.NewNopLogger()), addressPolicyAny, allowlist)
+	d.lookup = func(context.Context, string) ([]string, error) { return []string{"192.0.2.1", "127.0.0.1"}, nil }
+	d.recorder = newAddressRecorder()
+
+	conn, err := d.dialContext(context.Background(), "tcp", "app:"+port)
+	require.Nil(t, err, "loopback is allowed")
+	conn.Close()
+	require.Equal(t, "app:"+port+"=127.0.0.1:"+port, d.recorder.message())
+}
+
+func Test_addressRecorder(t *testing.T) {
+	r := newAddressRecorder()
+	require.Equal(t, "", r.message())
+	require.True(t, r.record("b:80", "10.0.0.2:80"))
+	require.False(t, r.record("b:80", "10.0.0.2:80"))
+	require.True(t, r.record("a:"+strconv.Itoa(443), "[::1]:443"))
+	require.Equal(t, "a:443=[::1]:443 b:80=10.0.0.2:80", r.message())
+}
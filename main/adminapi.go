@@ -0,0 +1,108 @@
+package main
+
+import (
+	"encoding/json"
+	"io"
+	"net"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/go-kit/kit/log"
+	"github.com/pkg/errors"
+)
+
+const (
+	// defaultAdminHistorySize is the number of probe results returned by the
+	// admin API unless configured.
+	defaultAdminHistorySize = 20
+
+	adminTimeout = 10 * time.Second
+)
+
+// adminAPISettings configure the local admin HTTP API.
+type adminAPISettings struct {
+	Port        int `json:"port,int"`
+	HistorySize int `json:"historySize,int"`
+}
+
+// adminAPI returns the port the admin API listens on and the number of probe
+// results it returns, or a zero port if it is not enabled.
+func (s *handlerSettings) adminAPI() (port, historySize int) {
+	a := s.publicSettings.AdminAPI
+	if a == nil {
+		return 0, 0
+	}
+	if historySize = a.HistorySize; historySize == 0 {
+		historySize = defaultAdminHistorySize
+	}
+	return a.Port, historySize
+}
+
+// adminStatus is the JSON object returned by the admin API.
+type adminStatus struct {
+	stateDump
+	UptimeInSeconds int64 `json:"uptimeInSeconds"`
+
+	// Timings are the phases of the latest http probe of each target, at
+	// debug level only.
+	Timings map[string]phaseTiming `json:"timings,omitempty"`
+}
+
+// adminHandler serves the snapshot of the probe loop controlled by c.
+type adminHandler struct {
+	control     *loopControl
+	start       time.Time
+	historySize int
+}
+
+func (a *adminHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.URL.Path != "/" {
+		http.NotFound(w, r)
+		return
+	}
+	if r.Method != http.MethodGet {
+		w.Header().Set("Allow", http.MethodGet)
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	now := a.control.clock.Now()
+	d, ok := a.control.snapshot(now)
+	if !ok {
+		http.Error(w, "the probe loop has not started yet", http.StatusServiceUnavailable)
+		return
+	}
+	if over := len(d.History) - a.historySize; over > 0 {
+		d.History = d.History[over:]
+	}
+	b, err := json.Marshal(adminStatus{
+		stateDump:       d,
+		UptimeInSeconds: int64(now.Sub(a.start) / time.Second),
+		Timings:         probeTimings.snapshot(),
+	})
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	// no credential of the settings is served, wherever it appears
+	io.WriteString(w, secrets.redact(string(b))+"\n")
+}
+
+// startAdminServer serves the admin API on the loopback interface at port
+// until closed. start is the time the probe loop process started.
+func startAdminServer(ctx *log.Context, port, historySize int, c *loopControl, start time.Time) (*http.Server, error) {
+	l, err := net.Listen("tcp", net.JoinHostPort("127.0.0.1", strconv.Itoa(port)))
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to listen for the admin API")
+	}
+	srv := &http.Server{
+		Handler:      &adminHandler{control: c, start: start, historySize: historySize},
+		ReadTimeout:  adminTimeout,
+		WriteTimeout: adminTimeout,
+	}
+	go srv.Serve(l)
+	ctx.Log("event", "serving admin API", "address", l.Addr().String())
+	return srv, nil
+}
@@ -0,0 +1,116 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/go-kit/kit/log"
+	"github.com/stretchr/testify/require"
+)
+
+func Test_adminAPI(t *testing.T) {
+	port, historySize := (&handlerSettings{}).adminAPI()
+	require.Equal(t, 0, port)
+
+	port, historySize = (&handlerSettings{publicSettings: publicSettings{AdminAPI: &adminAPISettings{Port: 8090}}}).adminAPI()
+	require.Equal(t, 8090, port)
+	require.Equal(t, defaultAdminHistorySize, historySize)
+
+	_, historySize = (&handlerSettings{publicSettings: publicSettings{AdminAPI: &adminAPISettings{Port: 8090, HistorySize: 5}}}).adminAPI()
+	require.Equal(t, 5, historySize)
+}
+
+func Test_adminHandler(t *testing.T) {
+	start := time.Date(2017, 1, 1, 0, 0, 0, 0, time.UTC)
+	clk := newManualClock(start)
+	c := &loopControl{clock: clk}
+	h := &adminHandler{control: c, start: start, historySize: 2}
+
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, httptest.NewRequest("GET", "/", nil))
+	require.Equal(t, http.StatusServiceUnavailable, w.Code)
+
+	cfg := &handlerSettings{publicSettings{Protocol: "tcp", Port: 8080}, protectedSettings{SshPrivateKey: "secret key"}}
+	m := newMonitor(cfg, start, newExtensionMetrics(start, 0))
+	for i := 0; i < 3; i++ {
+		_, err := m.observe(start, Healthy)
+		require.Nil(t, err)
+	}
+	c.setMonitor(m)
+	clk.Advance(90 * time.Second)
+
+	w = httptest.NewRecorder()
+	h.ServeHTTP(w, httptest.NewRequest("GET", "/", nil))
+	require.Equal(t, http.StatusOK, w.Code)
+	require.Equal(t, "application/json", w.Header().Get("Content-Type"))
+	require.NotContains(t, w.Body.String(), "secret key")
+
+	var st adminStatus
+	require.Nil(t, json.Unmarshal(w.Body.Bytes(), &st))
+	require.Equal(t, Healthy, st.State)
+	require.Len(t, st.History, 2)
+	require.Equal(t, int64(90), st.UptimeInSeconds)
+	require.Equal(t, "tcp", st.Settings["protocol"])
+	require.Equal(t, redactedValue, st.Settings["sshPrivateKey"])
+
+	w = httptest.NewRecorder()
+	h.ServeHTTP(w, httptest.NewRequest("POST", "/", nil))
+	require.Equal(t, http.StatusMethodNotAllowed, w.Code)
+
+	w = httptest.NewRecorder()
+	h.ServeHTTP(w, httptest.NewRequest("GET", "/other", nil))
+	require.Equal(t, http.StatusNotFound, w.Code)
+}
+
+func Test_adminHandler_redactsRequestHeaders(t *testing.T) {
+	start := time.Date(2017, 1, 1, 0, 0, 0, 0, time.UTC)
+	clk := newManualClock(start)
+	c := &loopControl{clock: clk}
+	h := &adminHandler{control: c, start: start, historySize: 2}
+
+	cfg := &handlerSettings{publicSettings: publicSettings{Protocol: "http", Port: 8080, RequestHeaders: map[string]string{
+		"Authorization": "Bearer s3cr3t-t0ken",
+		"Accept":        "application/json",
+	}}}
+	c.setMonitor(newMonitor(cfg, start, newExtensionMetrics(start, 0)))
+
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, httptest.NewRequest("GET", "/", nil))
+	require.Equal(t, http.StatusOK, w.Code)
+	require.NotContains(t, w.Body.String(), "s3cr3t-t0ken")
+
+	var st adminStatus
+	require.Nil(t, json.Unmarshal(w.Body.Bytes(), &st))
+	headers := st.Settings["requestHeaders"].(map[string]interface{})
+	require.Equal(t, redactedValue, headers["Authorization"])
+	require.Equal(t, "application/json", headers["Accept"])
+}
+
+func Test_startAdminServer(t *testing.T) {
+	ctx := log.NewContext(log.NewNopLogger())
+	now := time.Now()
+	c := &loopControl{clock: newManualClock(now)}
+	c.setMonitor(newMonitor(&handlerSettings{}, now, newExtensionMetrics(now, 0)))
+
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	require.Nil(t, err)
+	port := l.Addr().(*net.TCPAddr).Port
+	l.Close()
+
+	srv, err := startAdminServer(ctx, port, defaultAdminHistorySize, c, now)
+	require.Nil(t, err)
+	defer srv.Close()
+
+	resp, err := http.Get(fmt.Sprintf("http://127.0.0.1:%d/", port))
+	require.Nil(t, err)
+	defer resp.Body.Close()
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+
+	_, err = startAdminServer(ctx, port, defaultAdminHistorySize, c, now)
+	require.NotNil(t, err)
+}
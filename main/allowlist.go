@@ -0,0 +1,106 @@
+package main
+
+import (
+	"context"
+	"net"
+	"regexp"
+	"strings"
+	"syscall"
+
+	"github.com/pkg/errors"
+)
+
+var (
+	errInvalidAllowedTarget = errors.New("'allowedTargets' entries must be CIDRs, IP addresses or hostnames")
+	errTargetNotAllowed     = errors.New("probe target is not in 'allowedTargets'")
+
+	hostnameRegexp = regexp.MustCompile(`^([a-zA-Z0-9]([a-zA-Z0-9-]{0,61}[a-zA-Z0-9])?\.)*[a-zA-Z0-9]([a-zA-Z0-9-]{0,61}[a-zA-Z0-9])?\.?$`)
+)
+
+// targetAllowlist restricts the hosts probes may connect to. Loopback
+// addresses are always allowed. A nil allowlist allows every target.
+type targetAllowlist struct {
+	nets  []*net.IPNet
+	hosts map[string]bool
+}
+
+// parseTargetAllowlist parses allowlist entries, each of which is a CIDR, an IP
+// address or a hostname.
+func parseTargetAllowlist(entries []string) (*targetAllowlist, error) {
+	a := &targetAllowlist{hosts: make(map[string]bool)}
+	for _, e := range entries {
+		if !strings.Contains(e, "/") && net.ParseIP(e) != nil {
+			if strings.Contains(e, ":") {
+				e += "/128"
+			} else {
+				e += "/32"
+			}
+		}
+		if _, n, err := net.ParseCIDR(e); err == nil {
+			a.nets = append(a.nets, n)
+			continue
+		}
+		if !hostnameRegexp.MatchString(e) {
+			return nil, errors.Wrapf(errInvalidAllowedTarget, "invalid entry %q", e)
+		}
+		a.hosts[strings.ToLower(strings.TrimSuffix(e, "."))] = true
+	}
+	return a, nil
+}
+
+// allowed reports whether connecting to ip, resolved from host, is allowed.
+func (a *targetAllowlist) allowed(host string, ip net.IP) bool {
+	if a == nil || ip.IsLoopback() {
+		return true
+	}
+	if a.hosts[strings.ToLower(strings.TrimSuffix(host, "."))] {
+		return true
+	}
+	for _, n := range a.nets {
+		if n.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// allowedHost reports whether host, a hostname or an IP address, is allowed
+// as such, without resolving it.
+func (a *targetAllowlist) allowedHost(host string) bool {
+	if a == nil {
+		return true
+	}
+	if ip := net.ParseIP(host); ip != nil {
+		return a.allowed(host, ip)
+	}
+	return a.hosts[strings.ToLower(strings.TrimSuffix(host, "."))]
+}
+
+// dialContext connects to addr, failing if the address it resolves to is not
+// allowed. The check is made on the resolved address right before connecting,
+// so it cannot be bypassed through DNS.
+func (a *targetAllowlist) dialContext(ctx context.Context, network, addr string) (net.Conn, error) {
+	host, _, err := net.SplitHostPort(addr)
+	if err != nil {
+		return nil, err
+	}
+	return a.dialAs(ctx, network, host, addr)
+}
+
+// dialAs connects to addr, an address host resolved to, failing if it is not
+// allowed for host.
+func (a *targetAllowlist) dialAs(ctx context.Context, network, host, addr string) (net.Conn, error) {
+	d := net.Dialer{
+		Control: func(network, address string, _ syscall.RawConn) error {
+			ipStr, _, err := net.SplitHostPort(address)
+			if err != nil {
+				return err
+			}
+			if !a.allowed(host, net.ParseIP(ipStr)) {
+				return errors.Wrapf(errTargetNotAllowed, "%s (%s)", host, ipStr)
+			}
+			return nil
+		},
+	}
+	return d.DialContext(ctx, network, addr)
+}
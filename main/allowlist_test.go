@@ -0,0 +1,58 @@
+package main
+
+import (
+	"context"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/require"
+)
+
+func Test_parseTargetAllowlist(t *testing.T) {
+	a, err := parseTargetAllowlist([]string{"10.1.0.0/16", "192.0.2.7", "fd00::/8", "backend.internal"})
+	require.Nil(t, err)
+	require.Len(t, a.nets, 3)
+	require.True(t, a.hosts["backend.internal"])
+
+	_, err = parseTargetAllowlist([]string{"10.1.0.0/33"})
+	require.Equal(t, errInvalidAllowedTarget, errors.Cause(err))
+	_, err = parseTargetAllowlist([]string{"not a host"})
+	require.Equal(t, errInvalidAllowedTarget, errors.Cause(err))
+}
+
+func Test_targetAllowlist_allowed(t *testing.T) {
+	a, err := parseTargetAllowlist([]string{"10.1.0.0/16", "192.0.2.7", "Backend.Internal."})
+	require.Nil(t, err)
+
+	require.True(t, a.allowed("localhost", net.ParseIP("127.0.0.1")), "loopback")
+	require.True(t, a.allowed("localhost", net.ParseIP("::1")), "loopback")
+	require.True(t, a.allowed("10.1.2.3", net.ParseIP("10.1.2.3")))
+	require.True(t, a.allowed("192.0.2.7", net.ParseIP("192.0.2.7")))
+	require.True(t, a.allowed("backend.internal", net.ParseIP("203.0.113.9")), "allowed by name")
+	require.False(t, a.allowed("192.0.2.8", net.ParseIP("192.0.2.8")))
+	require.False(t, a.allowed("other.internal", net.ParseIP("10.2.0.1")))
+
+	var none *targetAllowlist
+	require.True(t, none.allowed("other.internal", net.ParseIP("10.2.0.1")), "unrestricted")
+}
+
+func Test_targetAllowlist_dialContext(t *testing.T) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	require.Nil(t, err)
+	defer l.Close()
+
+	a, err := parseTargetAllowlist([]string{"10.1.0.0/16"})
+	require.Nil(t, err)
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	conn, err := a.dialContext(ctx, "tcp", l.Addr().String())
+	require.Nil(t, err)
+	conn.Close()
+
+	_, err = a.dialContext(ctx, "tcp", "192.0.2.1:80")
+	require.NotNil(t, err)
+	require.Contains(t, err.Error(), errTargetNotAllowed.Error())
+}
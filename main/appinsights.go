@@ -0,0 +1,278 @@
+package main
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/go-kit/kit/log"
+	"github.com/pkg/errors"
+)
+
+const (
+	defaultIngestionEndpoint = "https://dc.services.visualstudio.com/"
+
+	appInsightsTimeout = 10 * time.Second
+
+	// appInsightsFlushInterval is how often the queued telemetry is sent.
+	appInsightsFlushInterval = 15 * time.Second
+	// appInsightsQueueSize bounds the telemetry waiting to be sent, newer
+	// items are dropped while the ingestion endpoint is slow.
+	appInsightsQueueSize = 256
+	// appInsightsBatchSize is the number of items sent at once at most.
+	appInsightsBatchSize = 100
+
+	availabilityTestName = "ApplicationHealth"
+	stateChangeEventName = "HealthStateChanged"
+)
+
+var errConnectionStringWithoutKey = errors.New("'applicationInsights.connectionString' must contain an 'InstrumentationKey'")
+
+// applicationInsightsSettings configure the telemetry pushed to Application
+// Insights.
+type applicationInsightsSettings struct {
+	ConnectionString string `json:"connectionString"`
+}
+
+// applicationInsights returns the connection string telemetry is pushed with,
+// or "" if it is not.
+func (s *handlerSettings) applicationInsights() string {
+	if s.publicSettings.ApplicationInsights == nil {
+		return ""
+	}
+	return s.publicSettings.ApplicationInsights.ConnectionString
+}
+
+func (h handlerSettings) validateApplicationInsights() error {
+	if cs := h.applicationInsights(); cs != "" {
+		if _, _, err := parseConnectionString(cs); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// parseConnectionString returns the instrumentation key and the ingestion
+// endpoint of an Application Insights connection string, e.g.
+// "InstrumentationKey=...;IngestionEndpoint=https://...".
+func parseConnectionString(cs string) (iKey, endpoint string, _ error) {
+	endpoint = defaultIngestionEndpoint
+	for _, part := range strings.Split(cs, ";") {
+		kv := strings.SplitN(strings.TrimSpace(part), "=", 2)
+		if len(kv) != 2 {
+			continue
+		}
+		switch strings.ToLower(kv[0]) {
+		case "instrumentationkey":
+			iKey = kv[1]
+		case "ingestionendpoint":
+			endpoint = kv[1]
+		}
+	}
+	if iKey == "" {
+		return "", "", errConnectionStringWithoutKey
+	}
+	if !strings.HasSuffix(endpoint, "/") {
+		endpoint += "/"
+	}
+	return iKey, endpoint, nil
+}
+
+// appInsightsEnvelope is a telemetry item in the format of the Application
+// Insights ingestion API.
+type appInsightsEnvelope struct {
+	Name string            `json:"name"`
+	Time string            `json:"time"`
+	IKey string            `json:"iKey"`
+	Tags map[string]string `json:"tags"`
+	Data appInsightsData   `json:"data"`
+
+	endpoint string
+}
+
+type appInsightsData struct {
+	BaseType string      `json:"baseType"`
+	BaseData interface{} `json:"baseData"`
+}
+
+type availabilityData struct {
+	Ver         int    `json:"ver"`
+	ID          string `json:"id"`
+	Name        string `json:"name"`
+	Duration    string `json:"duration"`
+	Success     bool   `json:"success"`
+	RunLocation string `json:"runLocation"`
+	Message     string `json:"message"`
+}
+
+type eventData struct {
+	Ver        int               `json:"ver"`
+	Name       string            `json:"name"`
+	Properties map[string]string `json:"properties"`
+}
+
+// appInsightsClient sends telemetry to Application Insights in batches, in the
+// background so that the probe loop never waits on it.
+type appInsightsClient struct {
+	client *http.Client
+	vmName func() string
+	queue  chan appInsightsEnvelope
+	done   chan struct{}
+}
+
+// newAppInsightsClient starts sending telemetry until closed. vmName returns
+// the name of the VM the telemetry is attributed to.
+func newAppInsightsClient(ctx *log.Context, vmName func() string) *appInsightsClient {
+	c := &appInsightsClient{
+		client: &http.Client{Timeout: appInsightsTimeout},
+		vmName: vmName,
+		queue:  make(chan appInsightsEnvelope, appInsightsQueueSize),
+		done:   make(chan struct{}),
+	}
+	go c.run(ctx)
+	return c
+}
+
+// run sends the queued items at every flush interval, or as soon as a batch is
+// full, and the remaining ones once closed.
+func (c *appInsightsClient) run(ctx *log.Context) {
+	defer close(c.done)
+	ticker := time.NewTicker(appInsightsFlushInterval)
+	defer ticker.Stop()
+
+	var batch []appInsightsEnvelope
+	flush := func() {
+		if err := c.send(batch); err != nil {
+			ctx.Log("event", "failed to send telemetry to application insights", "items", len(batch), "error", err)
+		}
+		batch = nil
+	}
+	for {
+		select {
+		case e, ok := <-c.queue:
+			if !ok {
+				flush()
+				return
+			}
+			batch = append(batch, e)
+			if len(batch) >= appInsightsBatchSize {
+				flush()
+			}
+		case <-ticker.C:
+			flush()
+		}
+	}
+}
+
+// send posts the items to their ingestion endpoints.
+func (c *appInsightsClient) send(items []appInsightsEnvelope) error {
+	byEndpoint := make(map[string][]appInsightsEnvelope)
+	for _, e := range items {
+		byEndpoint[e.endpoint] = append(byEndpoint[e.endpoint], e)
+	}
+	for endpoint, items := range byEndpoint {
+		body, err := json.Marshal(items)
+		if err != nil {
+			return err
+		}
+		resp, err := c.client.Post(endpoint+"v2/track", "application/json", bytes.NewReader(body))
+		if err != nil {
+			return err
+		}
+		resp.Body.Close()
+		if resp.StatusCode != http.StatusOK {
+			return errors.Errorf("ingestion endpoint responded with %s", resp.Status)
+		}
+	}
+	return nil
+}
+
+// track queues an item of the type for the connection string cs.
+func (c *appInsightsClient) track(ctx *log.Context, cs, baseType string, t time.Time, baseData interface{}) {
+	iKey, endpoint, err := parseConnectionString(cs)
+	if err != nil {
+		return // validated with the settings
+	}
+	telemetryType := strings.TrimSuffix(baseType, "Data")
+	e := appInsightsEnvelope{
+		Name:     fmt.Sprintf("Microsoft.ApplicationInsights.%s.%s", strings.Replace(iKey, "-", "", -1), telemetryType),
+		Time:     t.UTC().Format(time.RFC3339Nano),
+		IKey:     iKey,
+		Tags:     map[string]string{"ai.cloud.roleInstance": c.vmName()},
+		Data:     appInsightsData{BaseType: baseType, BaseData: baseData},
+		endpoint: endpoint,
+	}
+	select {
+	case c.queue <- e:
+	default:
+		ctx.Log("event", "application insights telemetry dropped, too many pending", "type", telemetryType)
+	}
+}
+
+// availability queues the availability result of the state derived at t from
+// probes which took d. Results neither healthy nor unhealthy are not
+// reported, as they tell nothing of the availability of the application.
+func (c *appInsightsClient) availability(ctx *log.Context, cs string, state HealthStatus, t time.Time, d time.Duration) {
+	var success bool
+	switch state {
+	case Healthy, Degraded:
+		success = true
+	case Unhealthy:
+		success = false
+	default:
+		return
+	}
+	c.track(ctx, cs, "AvailabilityData", t, availabilityData{
+		Ver:         2,
+		ID:          newTelemetryID(),
+		Name:        availabilityTestName,
+		Duration:    formatTimeSpan(d),
+		Success:     success,
+		RunLocation: c.vmName(),
+		Message:     string(state),
+	})
+}
+
+// stateChange queues the custom event of the transition at t.
+func (c *appInsightsClient) stateChange(ctx *log.Context, cs string, from, to HealthStatus, t time.Time) {
+	c.track(ctx, cs, "EventData", t, eventData{
+		Ver:        2,
+		Name:       stateChangeEventName,
+		Properties: map[string]string{"oldState": string(from), "newState": string(to)},
+	})
+}
+
+// Close sends the queued telemetry, waiting for it at most the request
+// timeout.
+func (c *appInsightsClient) Close() {
+	close(c.queue)
+	select {
+	case <-c.done:
+	case <-time.After(appInsightsTimeout):
+	}
+}
+
+// formatTimeSpan formats d as the .NET TimeSpan expected by Application
+// Insights, e.g. "0.00:00:01.5000000".
+func formatTimeSpan(d time.Duration) string {
+	days := d / (24 * time.Hour)
+	d -= days * 24 * time.Hour
+	h := d / time.Hour
+	d -= h * time.Hour
+	m := d / time.Minute
+	d -= m * time.Minute
+	s := d / time.Second
+	d -= s * time.Second
+	return fmt.Sprintf("%d.%02d:%02d:%02d.%07d", days, h, m, s, d/100)
+}
+
+func newTelemetryID() string {
+	b := make([]byte, 16)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
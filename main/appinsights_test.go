@@ -0,0 +1,89 @@
+package main
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/go-kit/kit/log"
+	"github.com/stretchr/testify/require"
+)
+
+func Test_parseConnectionString(t *testing.T) {
+	iKey, endpoint, err := parseConnectionString("InstrumentationKey=00000000-0000-0000-0000-000000000001;IngestionEndpoint=https://westeurope-5.in.applicationinsights.azure.com")
+	require.Nil(t, err)
+	require.Equal(t, "00000000-0000-0000-0000-000000000001", iKey)
+	require.Equal(t, "https://westeurope-5.in.applicationinsights.azure.com/", endpoint)
+
+	_, endpoint, err = parseConnectionString("instrumentationkey=abc")
+	require.Nil(t, err)
+	require.Equal(t, defaultIngestionEndpoint, endpoint)
+
+	_, _, err = parseConnectionString("IngestionEndpoint=https://example.com/")
+	require.Equal(t, errConnectionStringWithoutKey, err)
+}
+
+func Test_validateApplicationInsights(t *testing.T) {
+	cfg := handlerSettings{publicSettings: publicSettings{ApplicationInsights: &applicationInsightsSettings{ConnectionString: "Endpoint=x"}}}
+	require.Equal(t, errConnectionStringWithoutKey, cfg.validateApplicationInsights())
+
+	cfg.publicSettings.ApplicationInsights.ConnectionString = "InstrumentationKey=abc"
+	require.Nil(t, cfg.validateApplicationInsights())
+}
+
+func Test_formatTimeSpan(t *testing.T) {
+	require.Equal(t, "0.00:00:01.5000000", formatTimeSpan(1500*time.Millisecond))
+	require.Equal(t, "1.02:03:04.0000050", formatTimeSpan(26*time.Hour+3*time.Minute+4*time.Second+5*time.Microsecond))
+}
+
+func Test_appInsightsClient(t *testing.T) {
+	var mu sync.Mutex
+	var items []map[string]interface{}
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		require.Equal(t, "/v2/track", r.URL.Path)
+		b, _ := ioutil.ReadAll(r.Body)
+		var batch []map[string]interface{}
+		json.Unmarshal(b, &batch)
+		mu.Lock()
+		items = append(items, batch...)
+		mu.Unlock()
+	}))
+	defer srv.Close()
+
+	ctx := log.NewContext(log.NewNopLogger())
+	cs := "InstrumentationKey=0000-01;IngestionEndpoint=" + srv.URL
+	now := time.Date(2026, 10, 15, 12, 0, 0, 0, time.UTC)
+	c := newAppInsightsClient(ctx, func() string { return "vm1" })
+	c.availability(ctx, cs, Healthy, now, 12*time.Millisecond)
+	c.availability(ctx, cs, Initializing, now, 0)
+	c.availability(ctx, cs, Unhealthy, now, time.Second)
+	c.stateChange(ctx, cs, Healthy, Unhealthy, now)
+	c.Close()
+
+	mu.Lock()
+	defer mu.Unlock()
+	require.Len(t, items, 3, "initializing not reported")
+	require.Equal(t, "Microsoft.ApplicationInsights.000001.Availability", items[0]["name"])
+	require.Equal(t, "0000-01", items[0]["iKey"])
+	require.Equal(t, "2026-10-15T12:00:00Z", items[0]["time"])
+	require.Equal(t, map[string]interface{}{"ai.cloud.roleInstance": "vm1"}, items[0]["tags"])
+	data := items[0]["data"].(map[string]interface{})
+	require.Equal(t, "AvailabilityData", data["baseType"])
+	base := data["baseData"].(map[string]interface{})
+	require.Equal(t, availabilityTestName, base["name"])
+	require.Equal(t, true, base["success"])
+	require.Equal(t, "0.00:00:00.0120000", base["duration"])
+	require.Equal(t, "vm1", base["runLocation"])
+
+	base = items[1]["data"].(map[string]interface{})["baseData"].(map[string]interface{})
+	require.Equal(t, false, base["success"])
+
+	require.Equal(t, "Microsoft.ApplicationInsights.000001.Event", items[2]["name"])
+	base = items[2]["data"].(map[string]interface{})["baseData"].(map[string]interface{})
+	require.Equal(t, stateChangeEventName, base["name"])
+	require.Equal(t, map[string]interface{}{"oldState": "healthy", "newState": "unhealthy"}, base["properties"])
+}
@@ -0,0 +1,296 @@
+package main
+
+import (
+	"encoding/json"
+	"sort"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+const (
+	readinessSubstatusName = "AppReadinessStatus"
+)
+
+const (
+	// policies deciding the VM-level health from the health of the applications
+	policyAll = "all" // healthy if every application is healthy
+	policyAny = "any" // healthy if at least one application is healthy
+)
+
+var (
+	errApplicationsWithTopLevelProbe = errors.New("'protocol', 'host', 'port', 'requestPath', 'command', 'runAsUser', 'commandEnvironment', 'captureCommandOutput', 'grpcService', 'udpPayload', 'udpExpectedResponse', 'icmpAddress', 'icmpCount', 'icmpTimeoutInMilliseconds', 'dnsName', 'filePath', 'fileMaxAgeInSeconds', 'systemdUnit', 'containerName', 'dockerSocket', 'pidFile', 'processPattern', 'passiveListenCheck', 'systemdSocket', 'portFile' and 'unixSocketPath' cannot be specified when using 'applications'")
+	errDuplicateApplicationName      = errors.New("'applications' must have unique names")
+	errPolicyRequiresApplications    = errors.New("'applicationsPolicy' cannot be specified unless 'applications' are configured")
+	errReadinessWithApplications     = errors.New("'readinessProbe' cannot be used together with 'applications'")
+	errLegacyFormatReadiness         = errors.New("'readinessProbe' cannot be used with the legacy 'statusFormatVersion' 1")
+	errOffsetExceedsInterval         = errors.New("'offsetInMilliseconds' must be less than the probe interval")
+	errIntervalShorterThanTopLevel   = errors.New("'intervalInSeconds' of a probe, an application or the readiness probe cannot be shorter than the top level 'intervalInSeconds'")
+)
+
+// applicationSettings configure an application monitored independently of the
+// other applications of the VM. Settings not given for the application are
+// inherited from the top level settings.
+type applicationSettings struct {
+	Name        string   `json:"name"`
+	Protocol    string   `json:"protocol"`
+	Host        string   `json:"host"`
+	Port        int      `json:"port,int"`
+	RequestPath string   `json:"requestPath"`
+	Command     []string `json:"command"`
+	GrpcService string   `json:"grpcService"`
+
+	RunAsUser            string   `json:"runAsUser"`
+	CommandEnvironment   []string `json:"commandEnvironment"`
+	CaptureCommandOutput bool     `json:"captureCommandOutput"`
+
+	UdpPayload          string `json:"udpPayload"`
+	UdpExpectedResponse string `json:"udpExpectedResponse"`
+
+	IcmpAddress               string `json:"icmpAddress"`
+	IcmpCount                 int    `json:"icmpCount,int"`
+	IcmpTimeoutInMilliseconds int    `json:"icmpTimeoutInMilliseconds,int"`
+	DnsName                   string `json:"dnsName"`
+	FilePath                  string `json:"filePath"`
+	FileMaxAgeInSeconds       int    `json:"fileMaxAgeInSeconds,int"`
+	SystemdUnit               string `json:"systemdUnit"`
+	ContainerName             string `json:"containerName"`
+	DockerSocket              string `json:"dockerSocket"`
+	PidFile                   string `json:"pidFile"`
+	ProcessPattern            string `json:"processPattern"`
+	PassiveListenCheck        bool   `json:"passiveListenCheck"`
+	SystemdSocket             string `json:"systemdSocket"`
+	PortFile                  string `json:"portFile"`
+	UnixSocketPath            string `json:"unixSocketPath"`
+	SubstatusName             string `json:"substatusName"`
+
+	RequestHeaders      map[string]string `json:"requestHeaders"`
+	HostHeader          string            `json:"hostHeader"`
+	FollowRedirects     bool              `json:"followRedirects"`
+	MaxRedirects        int               `json:"maxRedirects,int"`
+	HttpMethod          string            `json:"httpMethod"`
+	RequestBody         string            `json:"requestBody"`
+	ExpectedStatusCodes []interface{}     `json:"expectedStatusCodes"`
+	ResponseBodySchema  json.RawMessage   `json:"responseBodySchema"`
+	ResponseBodyRegex   string            `json:"responseBodyRegex"`
+	ResponseJsonPath    string            `json:"responseJsonPath"`
+	ExpectedValue       json.RawMessage   `json:"expectedValue"`
+
+	OffsetInMilliseconds int `json:"offsetInMilliseconds,int"`
+	Weight               int `json:"weight,int"`
+
+	ProbeTimeoutInSeconds int `json:"probeTimeoutInSeconds,int"`
+	NumberOfProbes        int `json:"numberOfProbes,int"`
+	HealthyThreshold      int `json:"healthyThreshold,int"`
+	IntervalInSeconds     int `json:"intervalInSeconds,int"`
+	GracePeriodInSeconds  int `json:"gracePeriodInSeconds,int"`
+}
+
+// offset returns the delay of the probe of the application after the start of
+// each probe interval.
+func (a applicationSettings) offset() time.Duration {
+	return time.Duration(a.OffsetInMilliseconds) * time.Millisecond
+}
+
+// settings returns the settings the application is monitored with, derived
+// from the top level settings.
+func (a applicationSettings) settings(parent *handlerSettings) handlerSettings {
+	s := *parent
+	s.publicSettings.Applications = nil
+	s.publicSettings.ApplicationsPolicy = ""
+	s.publicSettings.Probes = nil
+	s.publicSettings.Aggregation = ""
+	s.publicSettings.HealthyScoreThreshold = 0
+	s.publicSettings.ReadinessProbe = nil
+	s.publicSettings.Protocol = a.Protocol
+	s.publicSettings.Host = a.Host
+	s.publicSettings.Port = a.Port
+	s.publicSettings.RequestPath = a.RequestPath
+	s.publicSettings.Command = a.Command
+	s.publicSettings.RunAsUser = a.RunAsUser
+	s.publicSettings.CommandEnvironment = a.CommandEnvironment
+	s.publicSettings.CaptureCommandOutput = a.CaptureCommandOutput
+	s.publicSettings.GrpcService = a.GrpcService
+	s.publicSettings.UdpPayload = a.UdpPayload
+	s.publicSettings.UdpExpectedResponse = a.UdpExpectedResponse
+	s.publicSettings.IcmpAddress = a.IcmpAddress
+	s.publicSettings.IcmpCount = a.IcmpCount
+	s.publicSettings.IcmpTimeoutInMilliseconds = a.IcmpTimeoutInMilliseconds
+	s.publicSettings.DnsName = a.DnsName
+	s.publicSettings.FilePath = a.FilePath
+	s.publicSettings.FileMaxAgeInSeconds = a.FileMaxAgeInSeconds
+	s.publicSettings.SystemdUnit = a.SystemdUnit
+	s.publicSettings.ContainerName = a.ContainerName
+	s.publicSettings.DockerSocket = a.DockerSocket
+	s.publicSettings.PidFile = a.PidFile
+	s.publicSettings.ProcessPattern = a.ProcessPattern
+	s.publicSettings.PassiveListenCheck = a.PassiveListenCheck
+	s.publicSettings.SystemdSocket = a.SystemdSocket
+	s.publicSettings.PortFile = a.PortFile
+	s.publicSettings.UnixSocketPath = a.UnixSocketPath
+	s.publicSettings.SubstatusName = a.SubstatusName
+	if s.publicSettings.SubstatusName == "" {
+		s.publicSettings.SubstatusName = a.Name
+	}
+	s.publicSettings.AdditionalSubstatusNames = nil
+	a.applyHttpRequest(&s.publicSettings)
+	if a.ProbeTimeoutInSeconds != 0 {
+		s.publicSettings.ProbeTimeoutInSeconds = a.ProbeTimeoutInSeconds
+	}
+	if a.NumberOfProbes != 0 {
+		s.publicSettings.NumberOfProbes = a.NumberOfProbes
+	}
+	if a.HealthyThreshold != 0 {
+		s.publicSettings.HealthyThreshold = a.HealthyThreshold
+	}
+	if a.IntervalInSeconds != 0 {
+		s.publicSettings.IntervalInSeconds = a.IntervalInSeconds
+	}
+	if a.GracePeriodInSeconds != 0 {
+		s.publicSettings.GracePeriodInSeconds = a.GracePeriodInSeconds
+	}
+	return s
+}
+
+// applyHttpRequest sets the options of the requests of http probes given for
+// the application on p. Only http and https probes inherit the ones not given
+// from the top level, where they are defaults for those.
+func (a applicationSettings) applyHttpRequest(p *publicSettings) {
+	if a.Protocol != "http" && a.Protocol != "https" {
+		p.RequestHeaders, p.HostHeader, p.FollowRedirects, p.MaxRedirects = a.RequestHeaders, a.HostHeader, a.FollowRedirects, a.MaxRedirects
+		p.HttpMethod, p.RequestBody, p.ExpectedStatusCodes = a.HttpMethod, a.RequestBody, a.ExpectedStatusCodes
+		p.ResponseBodySchema, p.ResponseBodyRegex, p.ResponseJsonPath, p.ExpectedValue = a.ResponseBodySchema, a.ResponseBodyRegex, a.ResponseJsonPath, a.ExpectedValue
+		return
+	}
+	if a.RequestHeaders != nil {
+		p.RequestHeaders = a.RequestHeaders
+	}
+	if a.HostHeader != "" {
+		p.HostHeader = a.HostHeader
+	}
+	if a.FollowRedirects {
+		p.FollowRedirects = true
+	}
+	if a.MaxRedirects != 0 {
+		p.MaxRedirects = a.MaxRedirects
+	}
+	if a.HttpMethod != "" {
+		// the body of the top level method is not sent with another one
+		p.HttpMethod, p.RequestBody = a.HttpMethod, a.RequestBody
+	} else if a.RequestBody != "" {
+		p.RequestBody = a.RequestBody
+	}
+	if a.ExpectedStatusCodes != nil {
+		p.ExpectedStatusCodes = a.ExpectedStatusCodes
+	}
+	if len(a.ResponseBodySchema) != 0 {
+		p.ResponseBodySchema = a.ResponseBodySchema
+	}
+	if a.ResponseBodyRegex != "" {
+		p.ResponseBodyRegex = a.ResponseBodyRegex
+	}
+	if a.ResponseJsonPath != "" || len(a.ExpectedValue) != 0 {
+		p.ResponseJsonPath, p.ExpectedValue = a.ResponseJsonPath, a.ExpectedValue
+	}
+}
+
+// hasTopLevelProbe reports whether any setting of the top level probe is
+// specified.
+func (h handlerSettings) hasTopLevelProbe() bool {
+	p := h.publicSettings
+	return p.Protocol != "" || p.Host != "" || p.Port != 0 || p.RequestPath != "" || len(p.Command) != 0 ||
+		p.RunAsUser != "" || p.CommandEnvironment != nil || p.CaptureCommandOutput || p.GrpcService != "" || p.UdpPayload != "" || p.UdpExpectedResponse != "" ||
+		p.IcmpAddress != "" || p.IcmpCount != 0 || p.IcmpTimeoutInMilliseconds != 0 || p.DnsName != "" ||
+		p.FilePath != "" || p.FileMaxAgeInSeconds != 0 || p.SystemdUnit != "" ||
+		p.ContainerName != "" || p.DockerSocket != "" || p.PidFile != "" || p.ProcessPattern != "" || p.PassiveListenCheck || p.SystemdSocket != "" || p.PortFile != "" || p.UnixSocketPath != ""
+}
+
+// validateApplications makes logical validation of the applications and the
+// readiness probe.
+func (h handlerSettings) validateApplications() error {
+	if r := h.readinessProbe(); r != nil {
+		if len(h.applications()) != 0 {
+			return errReadinessWithApplications
+		}
+		if h.statusFormatVersion() == legacyStatusFormatVersion {
+			return errLegacyFormatReadiness
+		}
+		s := r.settings(&h)
+		if err := s.validate(); err != nil {
+			return errors.Wrap(err, "readiness probe")
+		}
+		if s.interval() < h.interval() {
+			return errors.Wrap(errIntervalShorterThanTopLevel, "readiness probe")
+		}
+		if r.offset() >= h.interval() {
+			return errors.Wrap(errOffsetExceedsInterval, "readiness probe")
+		}
+	}
+
+	apps := h.publicSettings.Applications
+	if len(apps) == 0 {
+		if h.publicSettings.ApplicationsPolicy != "" {
+			return errPolicyRequiresApplications
+		}
+		return nil
+	}
+
+	if h.hasTopLevelProbe() {
+		return errApplicationsWithTopLevelProbe
+	}
+	names := make(map[string]bool)
+	for _, a := range apps {
+		if names[a.Name] {
+			return errDuplicateApplicationName
+		}
+		names[a.Name] = true
+		s := a.settings(&h)
+		if err := s.validate(); err != nil {
+			return errors.Wrapf(err, "application %q", a.Name)
+		}
+		if s.interval() < h.interval() {
+			return errors.Wrapf(errIntervalShorterThanTopLevel, "application %q", a.Name)
+		}
+		if a.offset() >= h.interval() {
+			return errors.Wrapf(errOffsetExceedsInterval, "application %q", a.Name)
+		}
+	}
+	return nil
+}
+
+// staggered returns the indexes of the probes with the given offsets in the
+// order they are fired in each interval.
+func staggered(offsets []time.Duration) []int {
+	order := make([]int, len(offsets))
+	for i := range order {
+		order[i] = i
+	}
+	sort.SliceStable(order, func(i, j int) bool { return offsets[order[i]] < offsets[order[j]] })
+	return order
+}
+
+// aggregateHealth decides the VM-level health from the health of the
+// applications according to the policy.
+// A degraded application is better than an initializing one, which is better
+// than one of unknown health, and worse than a healthy one. An unhealthy
+// application is the worst.
+func aggregateHealth(policy string, states []HealthStatus) HealthStatus {
+	count := make(map[HealthStatus]int)
+	for _, s := range states {
+		count[s]++
+	}
+	if policy == policyAny {
+		for _, s := range []HealthStatus{Healthy, Degraded, Initializing, Unknown} {
+			if count[s] > 0 {
+				return s
+			}
+		}
+		return Unhealthy
+	}
+	for _, s := range []HealthStatus{Unhealthy, Unknown, Initializing, Degraded} {
+		if count[s] > 0 {
+			return s
+		}
+	}
+	return Healthy
+}
@@ -0,0 +1,233 @@
+package main
+
+import (
+	"testing"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/require"
+)
+
+func Test_applicationSettings_settings(t *testing.T) {
+	parent := &handlerSettings{publicSettings: publicSettings{
+		Locale:                   "de",
+		AdditionalSubstatusNames: []string{"Other"},
+		Applications:             []applicationSettings{{Name: "web"}},
+	}}
+
+	s := applicationSettings{Name: "web", Protocol: "http", Port: 8080, RequestPath: "health"}.settings(parent)
+	require.Equal(t, "http", s.protocol())
+	require.Equal(t, 8080, s.port())
+	require.Equal(t, "health", s.requestPath())
+	require.Equal(t, "de", s.locale(), "inherited")
+	require.Equal(t, []string{"web"}, s.substatusNames())
+	require.Nil(t, s.applications())
+
+	s = applicationSettings{Name: "web", SubstatusName: "WebHealth"}.settings(parent)
+	require.Equal(t, []string{"WebHealth"}, s.substatusNames())
+}
+
+func Test_handlerSettingsValidate_applications(t *testing.T) {
+	web := applicationSettings{Name: "web", Protocol: "http", RequestPath: "health"}
+	worker := applicationSettings{Name: "worker", Protocol: "tcp", Port: 9000}
+
+	require.Nil(t, handlerSettings{
+		publicSettings{Applications: []applicationSettings{web, worker}, ApplicationsPolicy: policyAny},
+		protectedSettings{},
+	}.validate())
+
+	require.Equal(t, errApplicationsWithTopLevelProbe, handlerSettings{
+		publicSettings{Protocol: "tcp", Port: 80, Applications: []applicationSettings{web}},
+		protectedSettings{},
+	}.validate())
+
+	require.Equal(t, errDuplicateApplicationName, handlerSettings{
+		publicSettings{Applications: []applicationSettings{web, web}},
+		protectedSettings{},
+	}.validate())
+
+	err := handlerSettings{
+		publicSettings{Applications: []applicationSettings{{Name: "worker", Protocol: "tcp"}}},
+		protectedSettings{},
+	}.validate()
+	require.Equal(t, errTcpConfigurationMustIncludePort, errors.Cause(err))
+
+	err = handlerSettings{
+		publicSettings{IntervalInSeconds: 10, Applications: []applicationSettings{{Name: "worker", Protocol: "tcp", Port: 9000, IntervalInSeconds: 5}}},
+		protectedSettings{},
+	}.validate()
+	require.Equal(t, errIntervalShorterThanTopLevel, errors.Cause(err))
+	require.Contains(t, err.Error(), `application "worker"`)
+
+	require.Equal(t, errPolicyRequiresApplications, handlerSettings{
+		publicSettings{ApplicationsPolicy: policyAll},
+		protectedSettings{},
+	}.validate())
+}
+
+func Test_aggregateHealth(t *testing.T) {
+	require.Equal(t, Healthy, aggregateHealth(policyAll, []HealthStatus{Healthy, Healthy}))
+	require.Equal(t, Unhealthy, aggregateHealth(policyAll, []HealthStatus{Healthy, Unhealthy}))
+	require.Equal(t, Healthy, aggregateHealth(policyAny, []HealthStatus{Healthy, Unhealthy}))
+	require.Equal(t, Unhealthy, aggregateHealth(policyAny, []HealthStatus{Unhealthy, Unhealthy}))
+}
+
+func Test_monitor_applications(t *testing.T) {
+	now := time.Now()
+	cfg := &handlerSettings{publicSettings: publicSettings{Applications: []applicationSettings{
+		{Name: "web", Protocol: "http", RequestPath: "health"},
+		{Name: "worker", Protocol: "tcp", Port: 9000, SubstatusName: "WorkerHealth"},
+	}}}
+	m := newMonitor(cfg, now, newExtensionMetrics(now, 0))
+	require.Len(t, m.groups, 2)
+
+	_, err := m.observe(now, Healthy)
+	require.NotNil(t, err, "one result per application")
+
+	st, err := m.observe(now, Healthy, Unhealthy)
+	require.Nil(t, err)
+	require.Equal(t, Unhealthy, st.state)
+	require.Len(t, st.substatuses, 4)
+	require.Equal(t, substatusName, st.substatuses[0].Name)
+	require.Equal(t, StatusError, st.substatuses[0].Status)
+	require.Equal(t, "web", st.substatuses[1].Name)
+	require.Equal(t, StatusSuccess, st.substatuses[1].Status)
+	require.Equal(t, "WorkerHealth", st.substatuses[2].Name)
+	require.Equal(t, StatusError, st.substatuses[2].Status)
+
+	cfg.publicSettings.ApplicationsPolicy = policyAny
+	require.Equal(t, Healthy, m.state())
+
+	h := m.history()
+	require.Len(t, h, 2)
+	require.Equal(t, "web", h[0].Application)
+	require.Equal(t, "worker", h[1].Application)
+}
+
+func Test_aggregateHealth_degraded(t *testing.T) {
+	require.Equal(t, Degraded, aggregateHealth(policyAll, []HealthStatus{Healthy, Degraded}))
+	require.Equal(t, Unhealthy, aggregateHealth(policyAll, []HealthStatus{Unhealthy, Degraded}))
+	require.Equal(t, Degraded, aggregateHealth(policyAny, []HealthStatus{Unhealthy, Degraded}))
+	require.Equal(t, Healthy, aggregateHealth(policyAny, []HealthStatus{Healthy, Degraded}))
+}
+
+func Test_aggregateHealth_initializing(t *testing.T) {
+	require.Equal(t, Initializing, aggregateHealth(policyAll, []HealthStatus{Healthy, Degraded, Initializing}))
+	require.Equal(t, Unhealthy, aggregateHealth(policyAll, []HealthStatus{Unhealthy, Initializing}))
+	require.Equal(t, Initializing, aggregateHealth(policyAny, []HealthStatus{Unhealthy, Initializing}))
+	require.Equal(t, Degraded, aggregateHealth(policyAny, []HealthStatus{Degraded, Initializing}))
+}
+
+func Test_aggregateHealth_unknown(t *testing.T) {
+	require.Equal(t, Unknown, aggregateHealth(policyAll, []HealthStatus{Healthy, Initializing, Unknown}))
+	require.Equal(t, Unhealthy, aggregateHealth(policyAll, []HealthStatus{Unhealthy, Unknown}))
+	require.Equal(t, Unknown, aggregateHealth(policyAny, []HealthStatus{Unhealthy, Unknown}))
+	require.Equal(t, Initializing, aggregateHealth(policyAny, []HealthStatus{Initializing, Unknown}))
+}
+
+func Test_handlerSettingsValidate_readinessProbe(t *testing.T) {
+	ready := &applicationSettings{Protocol: "http", Port: 8081, RequestPath: "ready"}
+
+	require.Nil(t, handlerSettings{
+		publicSettings{Protocol: "tcp", Port: 8080, ReadinessProbe: ready},
+		protectedSettings{},
+	}.validate())
+
+	require.Equal(t, errReadinessWithApplications, handlerSettings{
+		publicSettings{Applications: []applicationSettings{{Name: "web", Protocol: "http"}}, ReadinessProbe: ready},
+		protectedSettings{},
+	}.validate())
+
+	require.Equal(t, errLegacyFormatReadiness, handlerSettings{
+		publicSettings{Protocol: "tcp", Port: 8080, ReadinessProbe: ready, StatusFormatVersion: legacyStatusFormatVersion},
+		protectedSettings{},
+	}.validate())
+
+	err := handlerSettings{
+		publicSettings{Protocol: "tcp", Port: 8080, ReadinessProbe: &applicationSettings{Protocol: "tcp"}},
+		protectedSettings{},
+	}.validate()
+	require.Equal(t, errTcpConfigurationMustIncludePort, errors.Cause(err))
+
+	err = handlerSettings{
+		publicSettings{Protocol: "tcp", Port: 8080, IntervalInSeconds: 10, ReadinessProbe: &applicationSettings{Protocol: "tcp", Port: 8081, IntervalInSeconds: 5}},
+		protectedSettings{},
+	}.validate()
+	require.Equal(t, errIntervalShorterThanTopLevel, errors.Cause(err))
+	require.Contains(t, err.Error(), "readiness probe")
+}
+
+func Test_monitor_readiness(t *testing.T) {
+	now := time.Now()
+	cfg := &handlerSettings{publicSettings: publicSettings{
+		Protocol: "tcp", Port: 8080,
+		ReadinessProbe: &applicationSettings{Protocol: "http", Port: 8081, RequestPath: "ready"},
+	}}
+	m := newMonitor(cfg, now, newExtensionMetrics(now, 0))
+	require.Len(t, m.groups, 2)
+	require.True(t, m.groups[1].readiness)
+
+	// alive but not ready
+	st, err := m.observe(now, Healthy, Unhealthy)
+	require.Nil(t, err)
+	require.Equal(t, Healthy, st.state, "readiness does not affect health")
+	require.Len(t, st.substatuses, 3)
+	require.Equal(t, substatusName, st.substatuses[0].Name)
+	require.Equal(t, StatusSuccess, st.substatuses[0].Status)
+	require.Equal(t, readinessSubstatusName, st.substatuses[1].Name)
+	require.Equal(t, StatusTransitioning, st.substatuses[1].Status)
+	require.Equal(t, defaultMessages[msgNotReady], st.substatuses[1].FormattedMessage.Message)
+
+	st, err = m.observe(now.Add(time.Second), Healthy, Healthy)
+	require.Nil(t, err)
+	require.Equal(t, StatusSuccess, st.substatuses[1].Status)
+	require.Equal(t, defaultMessages[msgReady], st.substatuses[1].FormattedMessage.Message)
+}
+
+func Test_handlerSettingsValidate_offsetInMilliseconds(t *testing.T) {
+	web := applicationSettings{Name: "web", Protocol: "http", RequestPath: "health", OffsetInMilliseconds: 2500}
+	require.Nil(t, handlerSettings{
+		publicSettings{Applications: []applicationSettings{web}},
+		protectedSettings{},
+	}.validate())
+
+	web.OffsetInMilliseconds = 5000
+	err := handlerSettings{
+		publicSettings{Applications: []applicationSettings{web}},
+		protectedSettings{},
+	}.validate()
+	require.Equal(t, errOffsetExceedsInterval, errors.Cause(err))
+	require.Contains(t, err.Error(), `application "web"`)
+
+	err = handlerSettings{
+		publicSettings{Protocol: "tcp", Port: 80, ReadinessProbe: &applicationSettings{Protocol: "tcp", Port: 81, OffsetInMilliseconds: 10000}},
+		protectedSettings{},
+	}.validate()
+	require.Equal(t, errOffsetExceedsInterval, errors.Cause(err))
+}
+
+func Test_staggered(t *testing.T) {
+	require.Equal(t, []int{0}, staggered([]time.Duration{0}))
+	require.Equal(t, []int{1, 2, 0}, staggered([]time.Duration{2 * time.Second, 0, time.Second}))
+	require.Equal(t, []int{0, 2, 1}, staggered([]time.Duration{0, time.Second, 0}), "stable")
+}
+
+func Test_monitor_applicationGracePeriods(t *testing.T) {
+	now := time.Now()
+	cfg := &handlerSettings{publicSettings: publicSettings{GracePeriodInSeconds: 10, Applications: []applicationSettings{
+		{Name: "web", Protocol: "http", RequestPath: "health"},
+		{Name: "jvm", Protocol: "tcp", Port: 9000, GracePeriodInSeconds: 300},
+	}}}
+	m := newMonitor(cfg, now, newExtensionMetrics(now, 0))
+
+	st, err := m.observe(now.Add(time.Minute), Healthy, Unhealthy)
+	require.Nil(t, err)
+	require.Equal(t, StatusSuccess, st.substatuses[1].Status, "web found healthy")
+	require.Equal(t, StatusTransitioning, st.substatuses[2].Status, "jvm still within its own grace period")
+	require.Equal(t, Initializing, st.state)
+
+	st, err = m.observe(now.Add(time.Minute), Unhealthy, Healthy)
+	require.Nil(t, err)
+	require.Equal(t, StatusError, st.substatuses[1].Status, "web past the top level grace period")
+	require.Equal(t, StatusSuccess, st.substatuses[2].Status)
+}
@@ -0,0 +1,52 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	"github.com/pkg/errors"
+)
+
+// writeFileAtomic replaces the file at path with b so that readers see either
+// the previous or the new content in full, even across a crash or a power
+// loss: b is written to a temporary file flushed to disk before it is renamed
+// over path, and the rename is flushed as well.
+func writeFileAtomic(path string, b []byte, perm os.FileMode) error {
+	dir := filepath.Dir(path)
+	tmp, err := ioutil.TempFile(dir, filepath.Base(path))
+	if err != nil {
+		return errors.Wrap(err, "failed to create temporary file")
+	}
+	defer os.Remove(tmp.Name()) // left behind on failure only
+
+	if _, err := tmp.Write(b); err != nil {
+		tmp.Close()
+		return errors.Wrap(err, "failed to write temporary file")
+	}
+	if err := tmp.Chmod(perm); err != nil {
+		tmp.Close()
+		return errors.Wrap(err, "failed to set permissions of temporary file")
+	}
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		return errors.Wrap(err, "failed to flush temporary file")
+	}
+	if err := tmp.Close(); err != nil {
+		return errors.Wrap(err, "failed to close temporary file")
+	}
+	if err := os.Rename(tmp.Name(), path); err != nil {
+		return errors.Wrap(err, "failed to move temporary file")
+	}
+	return syncDir(dir)
+}
+
+// syncDir flushes the entries of dir to disk.
+func syncDir(dir string) error {
+	d, err := os.Open(dir)
+	if err != nil {
+		return errors.Wrap(err, "failed to open directory")
+	}
+	defer d.Close()
+	return errors.Wrap(d.Sync(), "failed to flush directory")
+}
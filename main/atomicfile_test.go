@@ -0,0 +1,43 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func Test_writeFileAtomic(t *testing.T) {
+	dir, err := ioutil.TempDir("", "")
+	require.Nil(t, err)
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "0.status")
+
+	require.Nil(t, writeFileAtomic(path, []byte("first"), 0644))
+	require.Nil(t, writeFileAtomic(path, []byte("second"), 0644))
+	requireFile(t, path, "second")
+	fi, err := os.Stat(path)
+	require.Nil(t, err)
+	require.Equal(t, os.FileMode(0644), fi.Mode().Perm())
+
+	files, err := ioutil.ReadDir(dir)
+	require.Nil(t, err)
+	require.Len(t, files, 1, "no temporary file left behind")
+}
+
+func Test_writeFileAtomic_fails(t *testing.T) {
+	dir, err := ioutil.TempDir("", "")
+	require.Nil(t, err)
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "0.status")
+	require.Nil(t, os.Mkdir(path, 0755)) // cannot be replaced by a file
+
+	err = writeFileAtomic(path, []byte("x"), 0644)
+	require.NotNil(t, err)
+	require.Contains(t, err.Error(), "failed to move temporary file")
+	files, err := ioutil.ReadDir(dir)
+	require.Nil(t, err)
+	require.Len(t, files, 1, "temporary file removed")
+}
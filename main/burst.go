@@ -0,0 +1,54 @@
+package main
+
+import (
+	"time"
+)
+
+// confirmationBurstSettings configure the probes fired in quick succession to
+// confirm a probe result contradicting the reported state.
+type confirmationBurstSettings struct {
+	Probes            int `json:"probes,int"`
+	IntervalInSeconds int `json:"intervalInSeconds,int"`
+}
+
+// burstSchedule decides the wait before the next probe: while a state change
+// is pending, up to the configured number of probes are fired at the burst
+// interval, then probing continues at the regular interval. A new burst is
+// only started once the pending change was confirmed or dismissed.
+type burstSchedule struct {
+	probes   int
+	interval time.Duration
+
+	left    int
+	started bool
+}
+
+// newBurstSchedule returns the schedule for the settings, or nil if bursts
+// are not configured.
+func newBurstSchedule(cfg *handlerSettings) *burstSchedule {
+	s := cfg.confirmationBurst()
+	if s == nil {
+		return nil
+	}
+	return &burstSchedule{probes: s.Probes, interval: time.Duration(s.IntervalInSeconds) * time.Second}
+}
+
+// wait returns the time to wait before the next probe, given whether a state
+// change is pending and the regular interval.
+func (b *burstSchedule) wait(pending bool, interval time.Duration) time.Duration {
+	if b == nil {
+		return interval
+	}
+	if !pending {
+		b.left, b.started = 0, false
+		return interval
+	}
+	if !b.started {
+		b.left, b.started = b.probes, true
+	}
+	if b.left > 0 {
+		b.left--
+		return b.interval
+	}
+	return interval
+}
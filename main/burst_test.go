@@ -0,0 +1,40 @@
+package main
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func Test_burstSchedule(t *testing.T) {
+	interval := 5 * time.Second
+	var none *burstSchedule
+	require.Equal(t, interval, none.wait(true, interval))
+
+	cfg := &handlerSettings{publicSettings: publicSettings{ConfirmationBurst: &confirmationBurstSettings{Probes: 2, IntervalInSeconds: 1}}}
+	b := newBurstSchedule(cfg)
+	require.Equal(t, interval, b.wait(false, interval))
+
+	// burst while the change is pending, then back to the regular interval
+	require.Equal(t, time.Second, b.wait(true, interval))
+	require.Equal(t, time.Second, b.wait(true, interval))
+	require.Equal(t, interval, b.wait(true, interval))
+
+	// a new burst once the change was settled
+	require.Equal(t, interval, b.wait(false, interval))
+	require.Equal(t, time.Second, b.wait(true, interval))
+}
+
+func Test_monitor_pendingChange(t *testing.T) {
+	now := time.Now()
+	m := newMonitor(&handlerSettings{}, now, newExtensionMetrics(now, 0))
+	m.groups[0].machine.numberOfProbes = 3
+	_, err := m.observe(now, Healthy)
+	require.Nil(t, err)
+	require.False(t, m.pendingChange())
+
+	_, err = m.observe(now, Unhealthy)
+	require.Nil(t, err)
+	require.True(t, m.pendingChange())
+}
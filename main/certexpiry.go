@@ -0,0 +1,94 @@
+package main
+
+import (
+	"crypto/tls"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/go-kit/kit/log"
+	"github.com/pkg/errors"
+)
+
+const (
+	certificateExpirySubstatusName = "AppHealthCertificateExpiry"
+)
+
+var (
+	errCertificateExpiryRequiresTls = errors.New("'reportCertificateExpiry' and 'certificateExpiryThresholdInDays' can only be specified when using 'https' or 'tls' protocol")
+
+	// certificateExpiries records when the server certificate of each
+	// target of https and tls probes expires.
+	certificateExpiries = newExpiryRecorder()
+)
+
+// expiryRecorder records when the certificate served by each probe target
+// expires.
+type expiryRecorder struct {
+	mu       sync.Mutex
+	expiries map[string]time.Time
+}
+
+func newExpiryRecorder() *expiryRecorder {
+	return &expiryRecorder{expiries: make(map[string]time.Time)}
+}
+
+func (r *expiryRecorder) record(target string, notAfter time.Time) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.expiries[target] = notAfter
+}
+
+// message formats the recorded expiries as the substatus message, e.g.
+// "localhost:443=2026-12-01T00:00:00Z (47 days)".
+func (r *expiryRecorder) message(now time.Time) string {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	var out []string
+	for target, notAfter := range r.expiries {
+		days := int(notAfter.Sub(now) / (24 * time.Hour))
+		out = append(out, fmt.Sprintf("%s=%s (%d days)", target, notAfter.UTC().Format(time.RFC3339), days))
+	}
+	sort.Strings(out)
+	return strings.Join(out, " ")
+}
+
+// checkCertificateExpiry records when the server certificate of the connection
+// to target expires and reports whether it is valid for longer than threshold,
+// which is not checked if 0.
+func checkCertificateExpiry(ctx *log.Context, target string, cs *tls.ConnectionState, threshold time.Duration) bool {
+	if len(cs.PeerCertificates) == 0 {
+		return true
+	}
+	notAfter := cs.PeerCertificates[0].NotAfter
+	certificateExpiries.record(target, notAfter)
+	if threshold != 0 && time.Until(notAfter) < threshold {
+		ctx.Log("event", "server certificate expires soon", "target", target, "notAfter", notAfter)
+		return false
+	}
+	return true
+}
+
+// certificateExpiryThreshold returns how long before its expiry the server
+// certificate of https and tls probes makes the application unhealthy, 0 if
+// it does not.
+func (s *handlerSettings) certificateExpiryThreshold() time.Duration {
+	return time.Duration(s.publicSettings.CertificateExpiryThresholdInDays) * 24 * time.Hour
+}
+
+// reportCertificateExpiry returns whether the expiry of the server
+// certificates is reported in a substatus.
+func (s *handlerSettings) reportCertificateExpiry() bool {
+	return s.publicSettings.ReportCertificateExpiry
+}
+
+// validateCertificateExpiry makes logical validation of the certificate
+// expiry settings.
+func (h handlerSettings) validateCertificateExpiry() error {
+	if (h.reportCertificateExpiry() || h.certificateExpiryThreshold() != 0) && !h.usesTLS() {
+		return errCertificateExpiryRequiresTls
+	}
+	return nil
+}
@@ -0,0 +1,73 @@
+package main
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/go-kit/kit/log"
+	"github.com/stretchr/testify/require"
+)
+
+func Test_expiryRecorder(t *testing.T) {
+	now := time.Date(2026, 10, 15, 12, 0, 0, 0, time.UTC)
+	r := newExpiryRecorder()
+	require.Equal(t, "", r.message(now))
+	r.record("localhost:443", now.Add(47*24*time.Hour+time.Hour))
+	r.record("localhost:8443", now.Add(-time.Hour))
+	require.Equal(t, "localhost:443=2026-12-01T13:00:00Z (47 days) localhost:8443=2026-10-15T11:00:00Z (0 days)", r.message(now))
+}
+
+func Test_checkCertificateExpiry(t *testing.T) {
+	defer func(r *expiryRecorder) { certificateExpiries = r }(certificateExpiries)
+	certificateExpiries = newExpiryRecorder()
+	ctx := log.NewContext(log.NewNopLogger())
+	cs := &tls.ConnectionState{PeerCertificates: []*x509.Certificate{{NotAfter: time.Now().Add(10 * 24 * time.Hour)}}}
+
+	require.True(t, checkCertificateExpiry(ctx, "localhost:443", cs, 0))
+	require.True(t, checkCertificateExpiry(ctx, "localhost:443", cs, 7*24*time.Hour))
+	require.False(t, checkCertificateExpiry(ctx, "localhost:443", cs, 14*24*time.Hour))
+	require.True(t, checkCertificateExpiry(ctx, "localhost:443", &tls.ConnectionState{}, 14*24*time.Hour))
+	require.Contains(t, certificateExpiries.message(time.Now()), "localhost:443=")
+}
+
+func Test_probes_certificateExpiry(t *testing.T) {
+	defer func(r *expiryRecorder) { certificateExpiries = r }(certificateExpiries)
+	certificateExpiries = newExpiryRecorder()
+	srv := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer srv.Close()
+	port := srv.Listener.Addr().(*net.TCPAddr).Port
+	// the test certificate expires in 2084
+	ctx := log.NewContext(log.NewNopLogger())
+	for _, protocol := range []string{"https", "tls"} {
+		cfg := &handlerSettings{publicSettings: publicSettings{Protocol: protocol, Port: port, CertificateExpiryThresholdInDays: 30}}
+		require.Nil(t, cfg.validate())
+		state, err := NewHealthProbe(ctx, cfg).evaluate(context.Background(), ctx)
+		require.Nil(t, err)
+		require.Equal(t, Healthy, state, protocol)
+	}
+	require.Contains(t, certificateExpiries.message(time.Now()), fmt.Sprintf("localhost:%d=2084-", port))
+
+	cfg := &handlerSettings{publicSettings: publicSettings{Protocol: "tls", Port: port}}
+	p := NewHealthProbe(ctx, cfg).(*TlsHealthProbe)
+	p.ExpiryThreshold = time.Until(srv.Certificate().NotAfter) + time.Hour
+	state, err := p.evaluate(context.Background(), ctx)
+	require.Nil(t, err)
+	require.Equal(t, Unhealthy, state)
+}
+
+func Test_handlerSettingsValidate_certificateExpiry(t *testing.T) {
+	require.Equal(t, 30*24*time.Hour, (&handlerSettings{publicSettings: publicSettings{CertificateExpiryThresholdInDays: 30}}).certificateExpiryThreshold())
+	require.Equal(t, errCertificateExpiryRequiresTls, handlerSettings{
+		publicSettings{Protocol: "http", ReportCertificateExpiry: true}, protectedSettings{},
+	}.validate())
+	require.Equal(t, errCertificateExpiryRequiresTls, handlerSettings{
+		publicSettings{Protocol: "tcp", Port: 443, CertificateExpiryThresholdInDays: 30}, protectedSettings{},
+	}.validate())
+}
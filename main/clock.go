@@ -0,0 +1,100 @@
+package main
+
+import (
+	"context"
+	"os"
+	"sync"
+	"time"
+)
+
+const (
+	// manualClockEnvVar makes the probe loop run on a manualClock, for
+	// deterministic end-to-end tests driving time through 'ctl advance'.
+	manualClockEnvVar = "APPLICATIONHEALTH_MANUAL_CLOCK"
+)
+
+// clock is the source of time of the probe loop. Sleep waits for d, returning
+// false if ctx was cancelled meanwhile.
+type clock interface {
+	Now() time.Time
+	Sleep(ctx context.Context, d time.Duration) bool
+}
+
+type realClock struct{}
+
+func (realClock) Now() time.Time { return time.Now() }
+
+func (realClock) Sleep(ctx context.Context, d time.Duration) bool {
+	t := time.NewTimer(d)
+	defer t.Stop()
+	select {
+	case <-t.C:
+		return true
+	case <-ctx.Done():
+		return false
+	}
+}
+
+// newClock returns the clock the probe loop runs on.
+func newClock() clock {
+	if os.Getenv(manualClockEnvVar) != "" {
+		return newManualClock(time.Now())
+	}
+	return realClock{}
+}
+
+// manualClock is a clock whose time only moves when advanced. Sleep blocks
+// until the clock was advanced past the wake-up time.
+type manualClock struct {
+	mu       sync.Mutex
+	cond     *sync.Cond
+	now      time.Time
+	sleeping int
+}
+
+func newManualClock(now time.Time) *manualClock {
+	c := &manualClock{now: now}
+	c.cond = sync.NewCond(&c.mu)
+	return c
+}
+
+func (c *manualClock) Now() time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.now
+}
+
+func (c *manualClock) Sleep(ctx context.Context, d time.Duration) bool {
+	// wake up the sleepers to notice the cancellation
+	stop := context.AfterFunc(ctx, func() {
+		c.mu.Lock()
+		defer c.mu.Unlock()
+		c.cond.Broadcast()
+	})
+	defer stop()
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	wake := c.now.Add(d)
+	c.sleeping++
+	for c.now.Before(wake) && ctx.Err() == nil {
+		c.cond.Wait()
+	}
+	c.sleeping--
+	return !c.now.Before(wake)
+}
+
+// sleepers returns the number of goroutines blocked in Sleep.
+func (c *manualClock) sleepers() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.sleeping
+}
+
+// Advance moves the time forward by d, waking up the sleepers due.
+func (c *manualClock) Advance(d time.Duration) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.now = c.now.Add(d)
+	c.cond.Broadcast()
+}
@@ -1,15 +1,17 @@
 package main
 
 import (
+	"context"
+	"fmt"
 	"os"
+	"path/filepath"
 	"time"
 
-	"github.com/Azure/azure-docker-extension/pkg/vmextension"
 	"github.com/go-kit/kit/log"
 	"github.com/pkg/errors"
 )
 
-type cmdFunc func(ctx *log.Context, hEnv vmextension.HandlerEnvironment, seqNum int) (msg string, err error)
+type cmdFunc func(runCtx context.Context, ctx *log.Context, hEnv HandlerEnvironment, seqNum int) (msg string, err error)
 type preFunc func(ctx *log.Context, seqNum int) error
 
 type cmd struct {
@@ -18,6 +20,7 @@ type cmd struct {
 	shouldReportStatus bool    // determines if running this should log to a .status file
 	pre                preFunc // executed before any status is reported
 	failExitCode       int     // exitCode to use when commands fail
+	standalone         bool    // runs without a handler environment and takes extra arguments
 }
 
 const (
@@ -25,25 +28,26 @@ const (
 )
 
 var (
-	cmdInstall   = cmd{install, "Install", false, nil, 52}
-	cmdEnable    = cmd{enable, "Enable", true, nil, 3}
-	cmdUninstall = cmd{uninstall, "Uninstall", false, nil, 3}
+	cmdInstall   = cmd{install, "Install", false, nil, 52, false}
+	cmdEnable    = cmd{enable, "Enable", true, nil, 3, false}
+	cmdUninstall = cmd{uninstall, "Uninstall", false, nil, 3, false}
+	cmdDisable   = cmd{disable, "Disable", true, nil, 3, false}
+	cmdUpdate    = cmd{update, "Update", true, nil, 3, false}
+	cmdSimulate  = cmd{simulate, "Simulate", false, nil, 1, true}
+	cmdCtl       = cmd{ctl, "Ctl", false, nil, 1, true}
 
 	cmds = map[string]cmd{
 		"install":   cmdInstall,
 		"uninstall": cmdUninstall,
 		"enable":    cmdEnable,
-		"update":    {noop, "Update", true, nil, 3},
-		"disable":   {noop, "Disable", true, nil, 3},
+		"update":    cmdUpdate,
+		"disable":   cmdDisable,
+		"simulate":  cmdSimulate,
+		"ctl":       cmdCtl,
 	}
 )
 
-func noop(ctx *log.Context, h vmextension.HandlerEnvironment, seqNum int) (string, error) {
-	ctx.Log("event", "noop")
-	return "", nil
-}
-
-func install(ctx *log.Context, h vmextension.HandlerEnvironment, seqNum int) (string, error) {
+func install(runCtx context.Context, ctx *log.Context, h HandlerEnvironment, seqNum int) (string, error) {
 	if err := os.MkdirAll(dataDir, 0755); err != nil {
 		return "", errors.Wrap(err, "failed to create data dir")
 	}
@@ -53,7 +57,7 @@ func install(ctx *log.Context, h vmextension.HandlerEnvironment, seqNum int) (st
 	return "", nil
 }
 
-func uninstall(ctx *log.Context, h vmextension.HandlerEnvironment, seqNum int) (string, error) {
+func uninstall(runCtx context.Context, ctx *log.Context, h HandlerEnvironment, seqNum int) (string, error) {
 	{ // a new context scope with path
 		ctx = ctx.With("path", dataDir)
 		ctx.Log("event", "removing data dir", "path", dataDir)
@@ -68,23 +72,31 @@ func uninstall(ctx *log.Context, h vmextension.HandlerEnvironment, seqNum int) (
 
 var (
 	stateChangeLogMap = map[HealthStatus]string{
-		Healthy:   "state changed to healthy",
-		Unhealthy: "state changed to unhealthy",
+		Healthy:      "state changed to healthy",
+		Unhealthy:    "state changed to unhealthy",
+		Degraded:     "state changed to degraded",
+		Initializing: "state changed to initializing",
+		Unknown:      "state changed to unknown",
 	}
 
 	healthStatusToStatusType = map[HealthStatus]StatusType{
-		Healthy:   StatusSuccess,
-		Unhealthy: StatusError,
+		Healthy:      StatusSuccess,
+		Unhealthy:    StatusError,
+		Degraded:     StatusSuccess,
+		Initializing: StatusTransitioning,
+		Unknown:      StatusTransitioning,
 	}
 
-	healthStatusToMessage = map[HealthStatus]string{
-		Healthy:   "Application found to be healthy",
-		Unhealthy: "Application found to be unhealthy",
+	healthStatusToMessage = map[HealthStatus]messageID{
+		Healthy:      msgHealthy,
+		Unhealthy:    msgUnhealthy,
+		Degraded:     msgDegraded,
+		Initializing: msgInitializing,
+		Unknown:      msgUnknown,
 	}
 )
 
 const (
-	statusMessage = "Successfully polling for application health"
 	substatusName = "AppHealthStatus"
 )
 
@@ -92,36 +104,114 @@ var (
 	errTerminated = errors.New("Application health process terminated")
 )
 
-func enable(ctx *log.Context, h vmextension.HandlerEnvironment, seqNum int) (string, error) {
+func enable(runCtx context.Context, ctx *log.Context, h HandlerEnvironment, seqNum int) (string, error) {
 	// parse the extension handler settings (not available prior to 'enable')
 	cfg, err := parseAndValidateSettings(ctx, h.HandlerEnvironment.ConfigFolder)
 	if err != nil {
 		return "", errors.Wrap(err, "failed to get configuration")
 	}
 
-	var prevState HealthStatus
-	probe := NewHealthProbe(ctx, &cfg)
-
-	for {
-		state, err := probe.evaluate(ctx)
+	if cfg.asyncEnable() && !isDetached() {
+		pid, err := startDetached()
 		if err != nil {
-			return "", errors.Wrap(err, "failed to evaluate health")
-		}
-
-		if shutdown {
-			return "", errTerminated
+			return "", errors.Wrap(err, "failed to start background probe loop")
 		}
+		ctx.Log("event", "started background probe loop", "pid", pid)
+		return fmt.Sprintf("probe loop running in background (pid %d)", pid), nil
+	}
 
-		if prevState != state {
-			ctx.Log("event", stateChangeLogMap[state])
-			prevState = state
+	lock, err := lockProbeLoop(ctx, probeLoopLockPath(), probeLoopPidPath(), stopTimeout+detachedStartupCheck)
+	if err != nil {
+		return "", errors.Wrap(err, "failed to take over the probe loop")
+	}
+	defer lock.Close()
+
+	clk := newClock()
+	metrics := newExtensionMetrics(clk.Now(), 0)
+	if err := writePidFile(probeLoopPidPath()); err != nil {
+		ctx.Log("event", "probe loop cannot be stopped by disable", "error", err)
+		metrics.internalError(clk.Now(), err)
+	} else {
+		defer removePidFile(probeLoopPidPath())
+	}
+	if metrics.restarts, err = recordStart(dataDir); err != nil {
+		ctx.Log("event", "failed to record probe loop start", "error", err)
+		metrics.internalError(clk.Now(), err)
+	}
+	metrics.configLoaded(clk.Now())
+	configureRedaction(&cfg)
+	configureLogLevel(ctx, &cfg)
+	configureLogRotation(ctx, &cfg)
+	configureSyslog(ctx, &cfg)
+	configureResolver(ctx, &cfg)
+
+	vm := newVMMetadataCache(imdsComputeURL)
+	vm.start(ctx)
+	defer vm.Close()
+	ctx = vm.logContext(ctx)
+
+	notifier := newWebhookNotifier(ctx, vmNameFunc(vm))
+	defer notifier.Close()
+	appInsights := newAppInsightsClient(ctx, vmNameFunc(vm))
+	defer appInsights.Close()
+	coalescer := newStatusCoalescer()
+	defer coalescer.Close()
+
+	control := &loopControl{clock: clk}
+	if srv, err := startControlServer(ctx, controlSocketPath(), control); err != nil {
+		ctx.Log("event", "control socket unavailable", "error", err)
+		metrics.internalError(clk.Now(), err)
+	} else {
+		defer srv.Close()
+	}
+	defer handleStateDumpSignal(ctx, control)()
+	if port, historySize := cfg.adminAPI(); port != 0 {
+		if srv, err := startAdminServer(ctx, port, historySize, control, clk.Now()); err != nil {
+			ctx.Log("event", "admin API unavailable", "error", err)
+			metrics.internalError(clk.Now(), err)
+		} else {
+			defer srv.Close()
 		}
+	}
 
-		reportStatusWithSubstatus(ctx, h, seqNum, StatusSuccess, "enable", statusMessage, healthStatusToStatusType[state], substatusName, healthStatusToMessage[state])
-		time.Sleep(5 * time.Second)
-
-		if shutdown {
-			return "", errTerminated
+	report := func(mon *monitor, st monitorStatus) error {
+		substatuses := st.substatuses
+		if item, ok := vm.substatus(); ok && mon.cfg.reportVMMetadata() {
+			substatuses = append(substatuses, item)
 		}
+		return coalescer.report(mon.cfg.minStatusWriteInterval(), func() error {
+			return reportStatusWithSubstatus(ctx, h, seqNum, mon.statusOpts, st.statusType, "enable", st.message, substatuses...)
+		})
+	}
+	loop := &probeLoop{
+		clock:       clk,
+		cfg:         cfg,
+		metrics:     metrics,
+		control:     control,
+		statePath:   filepath.Join(dataDir, healthStateFile),
+		journalPath: filepath.Join(dataDir, probeJournalFile),
+		loadSettings: func() (handlerSettings, error) {
+			return parseAndValidateSettings(ctx, h.HandlerEnvironment.ConfigFolder)
+		},
+		newProbes: func(cfg *handlerSettings) []HealthProbe { return NewHealthProbes(ctx, cfg) },
+		report:    report,
+		final:     report,
+		observed: func(cfg *handlerSettings, state HealthStatus, t time.Time, d time.Duration) {
+			if cs := cfg.applicationInsights(); cs != "" {
+				appInsights.availability(ctx, cs, state, t, d)
+			}
+		},
+		events:  newEventWriter(h.eventsFolder(), seqNum),
+		restart: restartSelf,
+		notify: func(cfg *handlerSettings, from, to HealthStatus, t time.Time) {
+			if url := cfg.webhookURL(); url != "" {
+				notifier.notify(ctx, url, from, to, t)
+			}
+			if cs := cfg.applicationInsights(); cs != "" {
+				appInsights.stateChange(ctx, cs, from, to, t)
+			}
+			runTransitionHook(runCtx, ctx, cfg, from, to)
+		},
 	}
+	return "", loop.run(runCtx, ctx)
 }
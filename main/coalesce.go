@@ -0,0 +1,80 @@
+package main
+
+import (
+	"sync"
+	"time"
+)
+
+// defaultMinStatusWriteInterval is the minimum time between two writes of the
+// status file by the probe loop.
+const defaultMinStatusWriteInterval = 5 * time.Second
+
+// minStatusWriteInterval returns the minimum time between two writes of the
+// status file.
+func (s *handlerSettings) minStatusWriteInterval() time.Duration {
+	if s.publicSettings.MinStatusWriteIntervalInSeconds == 0 {
+		return defaultMinStatusWriteInterval
+	}
+	return time.Duration(s.publicSettings.MinStatusWriteIntervalInSeconds) * time.Second
+}
+
+// statusCoalescer sits between the probe loop and the status file so that a
+// short probe interval does not rewrite the file more often than a minimum
+// interval: reports made within the interval of the previous write are held,
+// and only the latest of them is written once the interval elapsed, so that
+// rapid flaps in between never reach the agent.
+type statusCoalescer struct {
+	now       func() time.Time
+	afterFunc func(d time.Duration, f func()) *time.Timer
+
+	mu      sync.Mutex
+	last    time.Time
+	pending func() error
+	timer   *time.Timer
+}
+
+func newStatusCoalescer() *statusCoalescer {
+	return &statusCoalescer{now: time.Now, afterFunc: time.AfterFunc}
+}
+
+// report runs write, the write of a status report, now or once minInterval
+// elapsed since the previous write, unless replaced by a later report by then.
+// Errors of the writes held are not returned, write is expected to log them.
+func (c *statusCoalescer) report(minInterval time.Duration, write func() error) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	now := c.now()
+	if wait := minInterval - now.Sub(c.last); wait > 0 && !c.last.IsZero() {
+		c.pending = write
+		if c.timer == nil {
+			c.timer = c.afterFunc(wait, c.flush)
+		}
+		return nil
+	}
+	c.pending = nil
+	c.last = now
+	return write()
+}
+
+// flush writes the report held, if any.
+func (c *statusCoalescer) flush() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.timer != nil {
+		c.timer.Stop()
+		c.timer = nil
+	}
+	if c.pending == nil {
+		return
+	}
+	write := c.pending
+	c.pending = nil
+	c.last = c.now()
+	write()
+}
+
+// Close writes the report held, so that the latest status is not lost when the
+// probe loop terminates.
+func (c *statusCoalescer) Close() {
+	c.flush()
+}
@@ -0,0 +1,64 @@
+package main
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func Test_handlerSettings_minStatusWriteInterval(t *testing.T) {
+	require.Equal(t, defaultMinStatusWriteInterval, (&handlerSettings{}).minStatusWriteInterval())
+	cfg := &handlerSettings{publicSettings: publicSettings{MinStatusWriteIntervalInSeconds: 30}}
+	require.Equal(t, 30*time.Second, cfg.minStatusWriteInterval())
+}
+
+func Test_statusCoalescer(t *testing.T) {
+	now := time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+	var scheduled func()
+	var delay time.Duration
+	c := newStatusCoalescer()
+	c.now = func() time.Time { return now }
+	c.afterFunc = func(d time.Duration, f func()) *time.Timer {
+		delay, scheduled = d, f
+		return time.NewTimer(time.Hour)
+	}
+	var written []string
+	write := func(s string) func() error {
+		return func() error { written = append(written, s); return nil }
+	}
+
+	require.Nil(t, c.report(5*time.Second, write("healthy")))
+	require.Equal(t, []string{"healthy"}, written, "first report written at once")
+
+	now = now.Add(time.Second)
+	require.Nil(t, c.report(5*time.Second, write("unhealthy")))
+	now = now.Add(time.Second)
+	require.Nil(t, c.report(5*time.Second, write("healthy again")))
+	require.Equal(t, []string{"healthy"}, written, "held within the interval")
+	require.Equal(t, 4*time.Second, delay)
+
+	now = now.Add(3 * time.Second)
+	scheduled()
+	require.Equal(t, []string{"healthy", "healthy again"}, written, "only the latest written")
+
+	now = now.Add(5 * time.Second)
+	require.Nil(t, c.report(5*time.Second, write("unhealthy")))
+	require.Equal(t, []string{"healthy", "healthy again", "unhealthy"}, written)
+}
+
+func Test_statusCoalescer_Close(t *testing.T) {
+	now := time.Now()
+	c := newStatusCoalescer()
+	c.now = func() time.Time { return now }
+	var written int
+	write := func() error { written++; return nil }
+
+	require.Nil(t, c.report(time.Hour, write))
+	require.Nil(t, c.report(time.Hour, write))
+	require.Equal(t, 1, written)
+	c.Close()
+	require.Equal(t, 2, written, "held report written")
+	c.Close()
+	require.Equal(t, 2, written)
+}
@@ -0,0 +1,235 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/go-kit/kit/log"
+	"github.com/pkg/errors"
+)
+
+const (
+	// controlSocketFile is the name of the unix socket under dataDir the
+	// running probe loop accepts control commands on.
+	controlSocketFile = "control.sock"
+
+	controlTimeout = 10 * time.Second
+)
+
+var (
+	errCtlUsage = errors.New("usage: ctl state|pause|resume|reload|trace-on|trace-off|history|advance <duration>")
+)
+
+// controlSocketPath returns the path of the control socket.
+func controlSocketPath() string {
+	return filepath.Join(dataDir, controlSocketFile)
+}
+
+// controlResponse is the reply of the probe loop to a control command.
+type controlResponse struct {
+	Error   string        `json:"error,omitempty"`
+	State   HealthStatus  `json:"state,omitempty"`
+	Paused  bool          `json:"paused"`
+	Tracing bool          `json:"tracing"`
+	History []probeRecord `json:"history,omitempty"`
+}
+
+// loopControl is the state of the probe loop which can be inspected and
+// changed through the control socket while the loop is running.
+type loopControl struct {
+	mu      sync.Mutex
+	mon     *monitor
+	clock   clock
+	paused  bool
+	tracing bool
+	reload  bool
+	timing  loopTiming
+}
+
+// setMonitor sets the monitor of the probe loop queried by state and history.
+func (c *loopControl) setMonitor(m *monitor) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.mon = m
+}
+
+func (c *loopControl) isPaused() bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.paused
+}
+
+func (c *loopControl) isTracing() bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.tracing
+}
+
+// iterationDone records the timing of a probe loop iteration.
+func (c *loopControl) iterationDone(start time.Time, d time.Duration) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.timing.Iterations++
+	c.timing.LastStart, c.timing.LastDuration = start, d
+}
+
+// takeReload returns whether a reload of the settings was requested and
+// clears the request.
+func (c *loopControl) takeReload() bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	r := c.reload
+	c.reload = false
+	return r
+}
+
+// handle executes the control command and returns the response.
+func (c *loopControl) handle(command string) controlResponse {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	var resp controlResponse
+	command, arg := splitCommand(command)
+	switch command {
+	case "state":
+	case "pause":
+		c.paused = true
+	case "resume":
+		c.paused = false
+	case "reload":
+		c.reload = true
+	case "trace-on":
+		c.tracing = true
+	case "trace-off":
+		c.tracing = false
+	case "history":
+		if c.mon != nil {
+			resp.History = c.mon.history()
+		}
+	case "advance":
+		// only for tests running the loop on a manual clock
+		mc, ok := c.clock.(*manualClock)
+		d, err := time.ParseDuration(arg)
+		if !ok {
+			resp.Error = "the probe loop does not run on a manual clock"
+		} else if err != nil || d <= 0 {
+			resp.Error = fmt.Sprintf("invalid duration %q", arg)
+		} else {
+			mc.Advance(d)
+		}
+	default:
+		resp.Error = fmt.Sprintf("unknown command %q", command)
+	}
+	if c.mon != nil {
+		resp.State = c.mon.state()
+	}
+	resp.Paused, resp.Tracing = c.paused, c.tracing
+	return resp
+}
+
+// splitCommand splits a command line into the command and its argument.
+func splitCommand(line string) (command, arg string) {
+	parts := strings.SplitN(strings.TrimSpace(line), " ", 2)
+	if len(parts) == 2 {
+		return parts[0], strings.TrimSpace(parts[1])
+	}
+	return parts[0], ""
+}
+
+// controlServer serves control commands on a unix socket.
+type controlServer struct {
+	l net.Listener
+}
+
+// startControlServer listens on the unix socket at path, accessible by root
+// only, and serves the commands through c until closed.
+func startControlServer(ctx *log.Context, path string, c *loopControl) (*controlServer, error) {
+	os.Remove(path) // left behind by a previous process
+	l, err := net.Listen("unix", path)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to listen on control socket")
+	}
+	if err := os.Chmod(path, 0600); err != nil {
+		l.Close()
+		return nil, errors.Wrap(err, "failed to restrict control socket permissions")
+	}
+
+	go func() {
+		for {
+			conn, err := l.Accept()
+			if err != nil {
+				return // closed
+			}
+			go serveControlConn(ctx, conn, c)
+		}
+	}()
+	ctx.Log("event", "listening on control socket", "path", path)
+	return &controlServer{l}, nil
+}
+
+func (s *controlServer) Close() error {
+	return s.l.Close()
+}
+
+// serveControlConn reads a single command line from conn and writes back the
+// JSON response.
+func serveControlConn(ctx *log.Context, conn net.Conn, c *loopControl) {
+	defer conn.Close()
+	conn.SetDeadline(time.Now().Add(controlTimeout))
+
+	line, err := bufio.NewReader(conn).ReadString('\n')
+	if err != nil {
+		return
+	}
+	command := strings.TrimSpace(line)
+	ctx.Log("event", "control command", "command", command)
+	json.NewEncoder(conn).Encode(c.handle(command))
+}
+
+// controlRequest sends the command to the control socket at path and returns
+// the response.
+func controlRequest(path, command string) (resp controlResponse, _ error) {
+	conn, err := net.DialTimeout("unix", path, controlTimeout)
+	if err != nil {
+		return resp, errors.Wrap(err, "failed to connect to control socket, is enable running?")
+	}
+	defer conn.Close()
+	conn.SetDeadline(time.Now().Add(controlTimeout))
+
+	if _, err := fmt.Fprintln(conn, command); err != nil {
+		return resp, errors.Wrap(err, "failed to send command")
+	}
+	if err := json.NewDecoder(conn).Decode(&resp); err != nil {
+		return resp, errors.Wrap(err, "failed to read response")
+	}
+	if resp.Error != "" {
+		return resp, errors.New(resp.Error)
+	}
+	return resp, nil
+}
+
+// ctl sends the control command given as argument to the running probe loop
+// and prints the response.
+func ctl(runCtx context.Context, ctx *log.Context, h HandlerEnvironment, seqNum int) (string, error) {
+	if len(os.Args) < 3 || len(os.Args) > 4 {
+		return "", errCtlUsage
+	}
+	resp, err := controlRequest(controlSocketPath(), strings.Join(os.Args[2:], " "))
+	if err != nil {
+		return "", err
+	}
+	b, err := json.MarshalIndent(resp, "", "  ")
+	if err != nil {
+		return "", errors.Wrap(err, "failed to format response")
+	}
+	fmt.Println(string(b))
+	return "", nil
+}
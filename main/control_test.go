@@ -0,0 +1,76 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/go-kit/kit/log"
+	"github.com/stretchr/testify/require"
+)
+
+func Test_loopControl_handle(t *testing.T) {
+	c := &loopControl{}
+
+	resp := c.handle("pause")
+	require.True(t, resp.Paused)
+	require.True(t, c.isPaused())
+
+	resp = c.handle("resume")
+	require.False(t, resp.Paused)
+
+	resp = c.handle("trace-on")
+	require.True(t, resp.Tracing)
+	require.True(t, c.isTracing())
+	c.handle("trace-off")
+	require.False(t, c.isTracing())
+
+	require.False(t, c.takeReload())
+	c.handle("reload")
+	require.True(t, c.takeReload())
+	require.False(t, c.takeReload(), "reload request is cleared")
+
+	resp = c.handle("bogus")
+	require.Equal(t, `unknown command "bogus"`, resp.Error)
+}
+
+func Test_controlServer(t *testing.T) {
+	tmpDir, err := ioutil.TempDir("", "")
+	require.Nil(t, err)
+	defer os.RemoveAll(tmpDir)
+	path := filepath.Join(tmpDir, controlSocketFile)
+
+	now := time.Now()
+	mon := newMonitor(&handlerSettings{}, now, newExtensionMetrics(now, 0))
+	_, err = mon.observe(now, Unhealthy)
+	require.Nil(t, err)
+
+	c := &loopControl{mon: mon}
+	srv, err := startControlServer(log.NewContext(log.NewNopLogger()), path, c)
+	require.Nil(t, err)
+	defer srv.Close()
+
+	fi, err := os.Stat(path)
+	require.Nil(t, err)
+	require.Equal(t, os.FileMode(0600), fi.Mode().Perm())
+
+	resp, err := controlRequest(path, "state")
+	require.Nil(t, err)
+	require.Equal(t, Unhealthy, resp.State)
+
+	resp, err = controlRequest(path, "history")
+	require.Nil(t, err)
+	require.Len(t, resp.History, 1)
+
+	_, err = controlRequest(path, "bogus")
+	require.NotNil(t, err)
+	require.Contains(t, err.Error(), "unknown command")
+}
+
+func Test_controlRequest_notRunning(t *testing.T) {
+	_, err := controlRequest("/non-existing/control.sock", "state")
+	require.NotNil(t, err)
+	require.Contains(t, err.Error(), "is enable running?")
+}
@@ -0,0 +1,68 @@
+package main
+
+import (
+	"os"
+	"os/exec"
+	"syscall"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+const (
+	// detachedEnvVar is set in the environment of the background probe loop
+	// process started by an asynchronous enable.
+	detachedEnvVar = "APPLICATIONHEALTH_DETACHED"
+
+	// detachedStartupCheck is how long the handler watches the background
+	// process for an early exit before reporting enable as succeeded.
+	detachedStartupCheck = 2 * time.Second
+)
+
+// isDetached reports whether the running process is a background probe loop
+// started by startDetached.
+func isDetached() bool {
+	return os.Getenv(detachedEnvVar) != ""
+}
+
+// startDetached re-executes the running binary with the same arguments in a
+// new session so that the probe loop keeps running after the handler process
+// returns to the agent. The child shares stdout/stderr with the handler so its
+// logs end up in the same log file. Returns the pid of the child process.
+func startDetached() (int, error) {
+	self, err := os.Executable()
+	if err != nil {
+		return 0, errors.Wrap(err, "cannot locate the running executable")
+	}
+
+	c := exec.Command(self, os.Args[1:]...)
+	c.Env = append(os.Environ(), detachedEnvVar+"=1")
+	c.Stdout = os.Stdout
+	c.Stderr = os.Stderr
+	c.SysProcAttr = &syscall.SysProcAttr{Setsid: true}
+	if err := c.Start(); err != nil {
+		return 0, errors.Wrap(err, "failed to start process")
+	}
+
+	// make sure the loop survived its startup (e.g. settings still readable)
+	// before handing control back to the agent
+	exited := make(chan error, 1)
+	go func() { exited <- c.Wait() }()
+	select {
+	case err := <-exited:
+		return 0, errors.Errorf("background process exited prematurely: %v", err)
+	case <-time.After(detachedStartupCheck):
+	}
+	return c.Process.Pid, nil
+}
+
+// restartSelf replaces the running process with a fresh instance of the
+// running binary with the same arguments and environment. Returns only on
+// failure.
+func restartSelf() error {
+	self, err := os.Executable()
+	if err != nil {
+		return errors.Wrap(err, "cannot locate the running executable")
+	}
+	return errors.Wrap(syscall.Exec(self, os.Args, os.Environ()), "failed to restart process")
+}
@@ -0,0 +1,18 @@
+package main
+
+import (
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func Test_isDetached(t *testing.T) {
+	defer os.Unsetenv(detachedEnvVar)
+
+	os.Unsetenv(detachedEnvVar)
+	require.False(t, isDetached())
+
+	os.Setenv(detachedEnvVar, "1")
+	require.True(t, isDetached())
+}
@@ -0,0 +1,156 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"runtime"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/go-kit/kit/log"
+	"github.com/pkg/errors"
+)
+
+const (
+	// diagnosticsLogLines is the number of most recent log lines kept in
+	// memory to be included in crash diagnostics.
+	diagnosticsLogLines = 200
+
+	// diagnosticsFilesToKeep is the number of crash diagnostics files kept
+	// in dataDir; older ones are removed when a new one is written.
+	diagnosticsFilesToKeep = 5
+
+	diagnosticsFilePrefix = "crash-"
+)
+
+var (
+	// recentLogs holds the tail of the log output of this process.
+	recentLogs = newLogRing(diagnosticsLogLines)
+
+	// lastEvaluation is the most recent probe result of the enable loop.
+	lastEvaluation evaluationRecord
+)
+
+// logRing is an io.Writer keeping the last max lines written to it.
+type logRing struct {
+	mu    sync.Mutex
+	max   int
+	lines []string
+}
+
+func newLogRing(max int) *logRing {
+	return &logRing{max: max}
+}
+
+func (r *logRing) Write(p []byte) (int, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for _, l := range strings.Split(strings.TrimRight(string(p), "\n"), "\n") {
+		r.lines = append(r.lines, l)
+	}
+	if over := len(r.lines) - r.max; over > 0 {
+		r.lines = append([]string(nil), r.lines[over:]...)
+	}
+	return len(p), nil
+}
+
+func (r *logRing) String() string {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return strings.Join(r.lines, "\n")
+}
+
+// evaluationRecord describes a single probe evaluation.
+type evaluationRecord struct {
+	mu    sync.Mutex
+	time  time.Time
+	state HealthStatus
+	err   error
+}
+
+func (e *evaluationRecord) set(state HealthStatus, err error) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.time, e.state, e.err = time.Now().UTC(), state, err
+}
+
+func (e *evaluationRecord) String() string {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if e.time.IsZero() {
+		return "none"
+	}
+	s := fmt.Sprintf("%s state=%s", e.time.Format(time.RFC3339), e.state)
+	if e.err != nil {
+		s += fmt.Sprintf(" error=%q", e.err.Error())
+	}
+	return s
+}
+
+// writeDiagnostics writes a crash diagnostics file with the given reason, the
+// stack traces of all goroutines, build information, the last probe result and
+// the most recent log lines under dir. Returns the path of the written file.
+func writeDiagnostics(dir, reason string) (string, error) {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return "", errors.Wrap(err, "failed to create diagnostics dir")
+	}
+
+	var b bytes.Buffer
+	now := time.Now().UTC()
+	fmt.Fprintf(&b, "reason: %s\n", reason)
+	fmt.Fprintf(&b, "time: %s\n", now.Format(time.RFC3339))
+	fmt.Fprintf(&b, "build: %s %s/%s\n", DetailedVersionString(), runtime.GOOS, runtime.GOARCH)
+	fmt.Fprintf(&b, "pid: %d\n", os.Getpid())
+	fmt.Fprintf(&b, "last probe result: %s\n", lastEvaluation.String())
+	fmt.Fprintf(&b, "\n== goroutines ==\n%s\n", allStacks())
+	fmt.Fprintf(&b, "\n== last %d log lines ==\n%s\n", diagnosticsLogLines, recentLogs.String())
+
+	path := filepath.Join(dir, fmt.Sprintf("%s%s.log", diagnosticsFilePrefix, now.Format("20060102T150405Z")))
+	if err := ioutil.WriteFile(path, b.Bytes(), 0600); err != nil {
+		return "", errors.Wrap(err, "failed to write diagnostics file")
+	}
+	pruneDiagnostics(dir, diagnosticsFilesToKeep)
+	return path, nil
+}
+
+// pruneDiagnostics removes all but the newest keep crash diagnostics files.
+func pruneDiagnostics(dir string, keep int) {
+	files, err := filepath.Glob(filepath.Join(dir, diagnosticsFilePrefix+"*.log"))
+	if err != nil || len(files) <= keep {
+		return
+	}
+	sort.Strings(files) // timestamped names sort chronologically
+	for _, f := range files[:len(files)-keep] {
+		os.Remove(f)
+	}
+}
+
+// allStacks returns the stack traces of all goroutines.
+func allStacks() []byte {
+	buf := make([]byte, 1<<16)
+	for {
+		n := runtime.Stack(buf, true)
+		if n < len(buf) {
+			return buf[:n]
+		}
+		buf = make([]byte, 2*len(buf))
+	}
+}
+
+// dumpDiagnostics writes the crash diagnostics into dataDir and returns a
+// suffix referencing the file to be appended to the reported status message.
+// Failures are logged and result in an empty suffix.
+func dumpDiagnostics(ctx *log.Context, reason string) string {
+	path, err := writeDiagnostics(dataDir, reason)
+	if err != nil {
+		ctx.Log("event", "failed to write crash diagnostics", "error", err)
+		return ""
+	}
+	ctx.Log("event", "wrote crash diagnostics", "path", path)
+	return fmt.Sprintf(" (diagnostics: %s)", path)
+}
@@ -0,0 +1,64 @@
+package main
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func Test_logRing_keepsLastLines(t *testing.T) {
+	r := newLogRing(2)
+	fmt.Fprintln(r, "a")
+	fmt.Fprintln(r, "b")
+	fmt.Fprint(r, "c\nd\n")
+	require.Equal(t, "c\nd", r.String())
+}
+
+func Test_evaluationRecord(t *testing.T) {
+	var e evaluationRecord
+	require.Equal(t, "none", e.String())
+
+	e.set(Unhealthy, errUnableToConvertType)
+	require.Contains(t, e.String(), "state=unhealthy")
+	require.Contains(t, e.String(), `error="Unable to convert type"`)
+}
+
+func Test_writeDiagnostics(t *testing.T) {
+	tmpDir, err := ioutil.TempDir("", "")
+	require.Nil(t, err)
+	defer os.RemoveAll(tmpDir)
+
+	fmt.Fprintln(recentLogs, "event=something-happened")
+	path, err := writeDiagnostics(tmpDir, "test crash")
+	require.Nil(t, err)
+	require.Equal(t, tmpDir, filepath.Dir(path))
+
+	b, err := ioutil.ReadFile(path)
+	require.Nil(t, err)
+	require.Contains(t, string(b), "reason: test crash")
+	require.Contains(t, string(b), "Test_writeDiagnostics") // goroutine stacks
+	require.Contains(t, string(b), "event=something-happened")
+}
+
+func Test_pruneDiagnostics(t *testing.T) {
+	tmpDir, err := ioutil.TempDir("", "")
+	require.Nil(t, err)
+	defer os.RemoveAll(tmpDir)
+
+	for _, n := range []string{"crash-1.log", "crash-2.log", "crash-3.log", "other.log"} {
+		require.Nil(t, ioutil.WriteFile(filepath.Join(tmpDir, n), nil, 0600))
+	}
+	pruneDiagnostics(tmpDir, 2)
+
+	files, err := filepath.Glob(filepath.Join(tmpDir, "*"))
+	require.Nil(t, err)
+	require.Equal(t, []string{
+		filepath.Join(tmpDir, "crash-2.log"),
+		filepath.Join(tmpDir, "crash-3.log"),
+		filepath.Join(tmpDir, "other.log"),
+	}, files)
+}
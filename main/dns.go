@@ -0,0 +1,83 @@
+package main
+
+import (
+	"context"
+	"net"
+	"time"
+
+	"github.com/go-kit/kit/log"
+	"github.com/pkg/errors"
+)
+
+const (
+	// defaultDnsPort is the port of the DNS server unless specified.
+	defaultDnsPort = 53
+)
+
+var (
+	errDnsRequiresName              = errors.New("'dnsName' must be specified when using 'dns' protocol")
+	errDnsNameRequiresDns           = errors.New("'dnsName' can only be specified when using 'dns' protocol")
+	errDnsMustNotIncludeRequestPath = errors.New("'requestPath' cannot be specified when using 'dns' protocol")
+	errDnsNotTunneled               = errors.New("'dns' protocol cannot be used together with 'sshTunnel' or 'unixSocketPath'")
+)
+
+// DnsHealthProbe resolves a name against a DNS server and reports it healthy
+// if the name resolves to an address before the timeout.
+type DnsHealthProbe struct {
+	Server  string // host:port of the DNS server
+	Name    string
+	Dial    dialFunc
+	Timeout time.Duration
+}
+
+func (p *DnsHealthProbe) evaluate(probeCtx context.Context, ctx *log.Context) (HealthStatus, error) {
+	lookupCtx, cancel := context.WithTimeout(probeCtx, p.Timeout)
+	defer cancel()
+	dial := p.Dial
+	if dial == nil {
+		dial = (&net.Dialer{}).DialContext
+	}
+	r := &net.Resolver{
+		PreferGo:     true,
+		StrictErrors: true,
+		Dial: func(ctx context.Context, network, _ string) (net.Conn, error) {
+			// over udp, or tcp for truncated responses
+			return dial(ctx, network, p.Server)
+		},
+	}
+	if _, err := r.LookupHost(lookupCtx, p.Name); err != nil {
+		// NXDOMAIN, SERVFAIL, or no answer before the timeout
+		ctx.Log("event", "dns lookup failed", "name", p.Name, "error", err)
+		return Unhealthy, nil
+	}
+	return Healthy, nil
+}
+
+func (p *DnsHealthProbe) address() string {
+	return p.Server
+}
+
+// validateDns makes logical validation of the settings of the dns probe.
+func (h handlerSettings) validateDns() error {
+	if h.protocol() != "dns" {
+		if h.publicSettings.DnsName != "" {
+			return errDnsNameRequiresDns
+		}
+		return nil
+	}
+	if h.publicSettings.DnsName == "" {
+		return errDnsRequiresName
+	}
+	if h.sshTunnel() != nil || h.unixSocketPath() != "" {
+		return errDnsNotTunneled
+	}
+	if h.requestPath() != "" {
+		return errDnsMustNotIncludeRequestPath
+	}
+	return nil
+}
+
+// dnsName returns the name the dns probe resolves.
+func (s *handlerSettings) dnsName() string {
+	return s.publicSettings.DnsName
+}
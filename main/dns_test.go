@@ -0,0 +1,97 @@
+package main
+
+import (
+	"context"
+	"encoding/binary"
+	"net"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/go-kit/kit/log"
+	"github.com/stretchr/testify/require"
+)
+
+// serveDns answers the A queries for the names in records over udp until the
+// returned server is closed, and NXDOMAIN for any other name.
+func serveDns(t *testing.T, records map[string]net.IP) net.PacketConn {
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	require.Nil(t, err)
+	go func() {
+		buf := make([]byte, 512)
+		for {
+			n, from, err := conn.ReadFrom(buf)
+			if err != nil {
+				return
+			}
+			q := buf[:n]
+			// the question follows the 12 bytes header: labels, type and class
+			end := 12
+			var labels []string
+			for q[end] != 0 {
+				labels = append(labels, string(q[end+1:end+1+int(q[end])]))
+				end += 1 + int(q[end])
+			}
+			end += 5
+			name, qtype := strings.ToLower(strings.Join(labels, ".")), binary.BigEndian.Uint16(q[end-4:])
+
+			resp := append([]byte{}, q[:end]...)
+			ip, found := records[name]
+			binary.BigEndian.PutUint16(resp[2:], 0x8180) // response, recursion available
+			binary.BigEndian.PutUint16(resp[8:], 0)      // no authority records
+			binary.BigEndian.PutUint16(resp[10:], 0)     // no additional records
+			switch {
+			case !found:
+				resp[3] |= 3 // NXDOMAIN
+			case qtype == 1:
+				binary.BigEndian.PutUint16(resp[6:], 1)
+				resp = append(resp, 0xc0, 12, 0, 1, 0, 1, 0, 0, 0, 60, 0, 4)
+				resp = append(resp, ip.To4()...)
+			}
+			conn.WriteTo(resp, from)
+		}
+	}()
+	return conn
+}
+
+func Test_DnsHealthProbe(t *testing.T) {
+	srv := serveDns(t, map[string]net.IP{"app.contoso.test": net.ParseIP("10.0.1.4")})
+	defer srv.Close()
+	silent, err := net.ListenPacket("udp", "127.0.0.1:0")
+	require.Nil(t, err)
+	defer silent.Close()
+
+	ctx := log.NewContext(log.NewNopLogger())
+	for _, c := range []struct {
+		server, name string
+		expected     HealthStatus
+	}{
+		{srv.LocalAddr().String(), "app.contoso.test", Healthy},
+		{srv.LocalAddr().String(), "missing.contoso.test", Unhealthy},
+		{silent.LocalAddr().String(), "app.contoso.test", Unhealthy},
+	} {
+		p := &DnsHealthProbe{Server: c.server, Name: c.name, Timeout: 500 * time.Millisecond}
+		state, err := p.evaluate(context.Background(), ctx)
+		require.Nil(t, err)
+		require.Equal(t, c.expected, state, c.name)
+	}
+}
+
+func Test_NewHealthProbe_dns(t *testing.T) {
+	ctx := log.NewContext(log.NewNopLogger())
+	cfg := &handlerSettings{publicSettings: publicSettings{Protocol: "dns", Host: "10.0.0.53", DnsName: "app.contoso.test"}}
+	p := NewHealthProbe(ctx, cfg).(*DnsHealthProbe)
+	require.Equal(t, "10.0.0.53:53", p.Server)
+	require.Equal(t, defaultProbeTimeout, p.Timeout)
+}
+
+func Test_handlerSettingsValidate_dns(t *testing.T) {
+	validate := func(p publicSettings) error { return handlerSettings{p, protectedSettings{}}.validate() }
+	require.Nil(t, validate(publicSettings{Protocol: "dns", DnsName: "app.contoso.test"}))
+	require.Nil(t, validate(publicSettings{Protocol: "dns", Port: 5353, DnsName: "app.contoso.test"}))
+
+	require.Equal(t, errDnsRequiresName, validate(publicSettings{Protocol: "dns"}))
+	require.Equal(t, errDnsNameRequiresDns, validate(publicSettings{Protocol: "udp", Port: 53, UdpPayload: "cGluZw==", DnsName: "app.contoso.test"}))
+	require.Equal(t, errDnsNotTunneled, validate(publicSettings{Protocol: "dns", UnixSocketPath: "/run/dns.sock", DnsName: "app.contoso.test"}))
+	require.Equal(t, errDnsMustNotIncludeRequestPath, validate(publicSettings{Protocol: "dns", RequestPath: "health", DnsName: "app.contoso.test"}))
+}
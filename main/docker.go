@@ -0,0 +1,134 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/url"
+	"path/filepath"
+	"time"
+
+	"github.com/go-kit/kit/log"
+	"github.com/pkg/errors"
+)
+
+const (
+	// defaultDockerSocket is the unix socket of the Docker Engine API unless
+	// specified.
+	defaultDockerSocket = "/var/run/docker.sock"
+)
+
+var (
+	errDockerRequiresContainer = errors.New("'containerName' must be specified when using 'docker' protocol")
+	errContainerRequiresDocker = errors.New("'containerName' and 'dockerSocket' can only be specified when using 'docker' protocol")
+	errDockerSocketNotAbsolute = errors.New("'dockerSocket' must be an absolute path")
+	errDockerWithPort          = errors.New("'host', 'port', 'requestPath', 'systemdSocket', 'portFile' and 'unixSocketPath' cannot be specified when using 'docker' protocol")
+)
+
+// DockerHealthProbe inspects a container through the Docker Engine API and
+// reports the application healthy while the container is running and, if it
+// has a healthcheck, healthy.
+type DockerHealthProbe struct {
+	Socket     string
+	Container  string
+	HttpClient *http.Client
+}
+
+// NewDockerHealthProbe returns a probe inspecting container through the
+// Docker Engine API listening on socket.
+func NewDockerHealthProbe(socket, container string, timeout time.Duration) *DockerHealthProbe {
+	return &DockerHealthProbe{
+		Socket:    socket,
+		Container: container,
+		HttpClient: &http.Client{
+			Timeout:   timeout,
+			Transport: &http.Transport{DialContext: unixSocketDialer(socket)},
+		},
+	}
+}
+
+// containerState is the part of the container inspection of the Docker Engine
+// API the probe uses.
+type containerState struct {
+	State struct {
+		Status string
+		Health *struct {
+			Status string
+		}
+	}
+}
+
+func (p *DockerHealthProbe) evaluate(probeCtx context.Context, ctx *log.Context) (HealthStatus, error) {
+	req, err := http.NewRequestWithContext(probeCtx, http.MethodGet, "http://docker/containers/"+url.PathEscape(p.Container)+"/json", nil)
+	if err != nil {
+		return Unknown, err
+	}
+	resp, err := p.HttpClient.Do(req)
+	if err != nil {
+		return Unknown, errors.Wrap(err, "failed to query the docker engine")
+	}
+	defer resp.Body.Close()
+	switch resp.StatusCode {
+	case http.StatusOK:
+	case http.StatusNotFound:
+		ctx.Log("event", "container not found", "container", p.Container)
+		return Unhealthy, nil
+	default:
+		return Unknown, errors.Errorf("docker engine responded %s to the inspection of container %s", resp.Status, p.Container)
+	}
+
+	var c containerState
+	if err := json.NewDecoder(resp.Body).Decode(&c); err != nil {
+		return Unknown, errors.Wrap(err, "failed to decode the container inspection")
+	}
+	if c.State.Status != "running" {
+		ctx.Log("event", "container is not running", "container", p.Container, "state", c.State.Status)
+		return Unhealthy, nil
+	}
+	if c.State.Health == nil {
+		return Healthy, nil
+	}
+	switch c.State.Health.Status {
+	case "unhealthy":
+		ctx.Log("event", "container healthcheck failing", "container", p.Container)
+		return Unhealthy, nil
+	case "starting":
+		return Unknown, nil
+	}
+	return Healthy, nil
+}
+
+func (p *DockerHealthProbe) address() string {
+	return p.Container
+}
+
+// validateDocker makes logical validation of the settings of the docker
+// probe.
+func (h handlerSettings) validateDocker() error {
+	if h.protocol() != "docker" {
+		if h.publicSettings.ContainerName != "" || h.publicSettings.DockerSocket != "" {
+			return errContainerRequiresDocker
+		}
+		return nil
+	}
+	if h.publicSettings.ContainerName == "" {
+		return errDockerRequiresContainer
+	}
+	if s := h.publicSettings.DockerSocket; s != "" && !filepath.IsAbs(s) {
+		return errDockerSocketNotAbsolute
+	}
+	if h.publicSettings.Host != "" || h.port() != 0 || h.requestPath() != "" || h.systemdSocket() != "" || h.portFile() != "" || h.unixSocketPath() != "" {
+		return errDockerWithPort
+	}
+	return nil
+}
+
+// container returns the container inspected by the docker probe and the
+// socket of the Docker Engine API it is inspected through.
+func (s *handlerSettings) container() (name, socket string) {
+	socket = s.publicSettings.DockerSocket
+	if socket == "" {
+		socket = defaultDockerSocket
+	}
+	return s.publicSettings.ContainerName, socket
+}
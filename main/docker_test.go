@@ -0,0 +1,97 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/http"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/go-kit/kit/log"
+	"github.com/stretchr/testify/require"
+)
+
+// serveDocker serves the container inspection of a fake Docker Engine API on
+// a unix socket, responding with the body for each known container.
+func serveDocker(t *testing.T, containers map[string]string) string {
+	socket := filepath.Join(t.TempDir(), "docker.sock")
+	l, err := net.Listen("unix", socket)
+	require.Nil(t, err)
+	srv := &http.Server{Handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var name string
+		if _, err := fmt.Sscanf(r.URL.Path, "/containers/%s", &name); err != nil {
+			http.NotFound(w, r)
+			return
+		}
+		body, ok := containers[filepath.Dir(name)]
+		if !ok {
+			http.NotFound(w, r)
+			return
+		}
+		fmt.Fprint(w, body)
+	})}
+	go srv.Serve(l)
+	t.Cleanup(func() { srv.Close() })
+	return socket
+}
+
+func Test_DockerHealthProbe(t *testing.T) {
+	ctx := log.NewContext(log.NewNopLogger())
+	socket := serveDocker(t, map[string]string{
+		"web":      `{"State": {"Status": "running"}}`,
+		"checked":  `{"State": {"Status": "running", "Health": {"Status": "healthy"}}}`,
+		"failing":  `{"State": {"Status": "running", "Health": {"Status": "unhealthy"}}}`,
+		"starting": `{"State": {"Status": "running", "Health": {"Status": "starting"}}}`,
+		"exited":   `{"State": {"Status": "exited"}}`,
+		"garbage":  `{`,
+	})
+	probe := func(container string) (HealthStatus, error) {
+		return NewDockerHealthProbe(socket, container, time.Second).evaluate(context.Background(), ctx)
+	}
+	state := func(container string) HealthStatus {
+		s, err := probe(container)
+		require.Nil(t, err)
+		return s
+	}
+
+	require.Equal(t, Healthy, state("web"))
+	require.Equal(t, Healthy, state("checked"))
+	require.Equal(t, Unhealthy, state("failing"))
+	require.Equal(t, Unknown, state("starting"))
+	require.Equal(t, Unhealthy, state("exited"))
+	require.Equal(t, Unhealthy, state("missing"))
+
+	s, err := probe("garbage")
+	require.Equal(t, Unknown, s)
+	require.NotNil(t, err)
+
+	s, err = NewDockerHealthProbe(filepath.Join(t.TempDir(), "none.sock"), "web", time.Second).evaluate(context.Background(), ctx)
+	require.Equal(t, Unknown, s)
+	require.NotNil(t, err, "engine not running")
+}
+
+func Test_NewHealthProbe_docker(t *testing.T) {
+	ctx := log.NewContext(log.NewNopLogger())
+	p := NewHealthProbe(ctx, &handlerSettings{publicSettings: publicSettings{Protocol: "docker", ContainerName: "web"}})
+	require.IsType(t, &DockerHealthProbe{}, p)
+	require.Equal(t, "web", p.address())
+	require.Equal(t, defaultDockerSocket, p.(*DockerHealthProbe).Socket)
+
+	p = NewHealthProbe(ctx, &handlerSettings{publicSettings: publicSettings{Protocol: "docker", ContainerName: "web", DockerSocket: "/run/podman/podman.sock"}})
+	require.Equal(t, "/run/podman/podman.sock", p.(*DockerHealthProbe).Socket)
+}
+
+func Test_handlerSettingsValidate_docker(t *testing.T) {
+	validate := func(p publicSettings) error { return handlerSettings{p, protectedSettings{}}.validate() }
+
+	require.Nil(t, validate(publicSettings{Protocol: "docker", ContainerName: "web"}))
+	require.Nil(t, validate(publicSettings{Protocol: "docker", ContainerName: "web", DockerSocket: "/run/docker.sock"}))
+	require.Equal(t, errDockerRequiresContainer, validate(publicSettings{Protocol: "docker"}))
+	require.Equal(t, errDockerSocketNotAbsolute, validate(publicSettings{Protocol: "docker", ContainerName: "web", DockerSocket: "docker.sock"}))
+	require.Equal(t, errDockerWithPort, validate(publicSettings{Protocol: "docker", ContainerName: "web", Port: 80}))
+	require.Equal(t, errContainerRequiresDocker, validate(publicSettings{Protocol: "tcp", Port: 80, ContainerName: "web"}))
+	require.Equal(t, errContainerRequiresDocker, validate(publicSettings{Protocol: "tcp", Port: 80, DockerSocket: "/run/docker.sock"}))
+	require.Equal(t, errIPVersionUnsupported, validate(publicSettings{Protocol: "docker", ContainerName: "web", IPVersion: ipVersion4}))
+}
@@ -0,0 +1,103 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+const (
+	eventLevelInformational = "Informational"
+	eventLevelWarning       = "Warning"
+	eventLevelError         = "Error"
+
+	eventTaskStateChange  = "StateChange"
+	eventTaskProbeError   = "ProbeError"
+	eventTaskConfigReload = "ConfigReload"
+
+	// maxPendingEvents bounds the event files waiting for the guest agent to
+	// collect them, newer events are dropped beyond.
+	maxPendingEvents = 300
+)
+
+// extensionEvent is a telemetry event in the format collected by the guest
+// agent from the events folder.
+type extensionEvent struct {
+	Version     string `json:"Version"`
+	Timestamp   string `json:"Timestamp"`
+	TaskName    string `json:"TaskName"`
+	EventLevel  string `json:"EventLevel"`
+	Message     string `json:"Message"`
+	EventPid    string `json:"EventPid"`
+	EventTid    string `json:"EventTid"`
+	OperationId string `json:"OperationId"`
+}
+
+// eventWriter writes telemetry events to the events folder of the handler
+// environment. A nil eventWriter drops the events, for guest agents not
+// collecting them.
+type eventWriter struct {
+	dir         string
+	operationID string
+	now         func() time.Time
+}
+
+// newEventWriter returns a writer of the events of the operation to dir, or
+// nil if dir is empty.
+func newEventWriter(dir string, seqNum int) *eventWriter {
+	if dir == "" {
+		return nil
+	}
+	return &eventWriter{
+		dir:         dir,
+		operationID: strconv.Itoa(seqNum),
+		now:         time.Now,
+	}
+}
+
+// write writes an event to the events folder.
+func (w *eventWriter) write(level, task, message string) error {
+	if w == nil {
+		return nil
+	}
+	pending, err := ioutil.ReadDir(w.dir)
+	if err != nil {
+		return errors.Wrap(err, "failed to list events folder")
+	}
+	if len(pending) >= maxPendingEvents {
+		return errors.Errorf("%d events waiting for collection, event dropped", len(pending))
+	}
+
+	now := w.now().UTC()
+	b, err := json.Marshal([]extensionEvent{{
+		Version:     Version,
+		Timestamp:   now.Format(time.RFC3339Nano),
+		TaskName:    task,
+		EventLevel:  level,
+		Message:     message,
+		EventPid:    strconv.Itoa(os.Getpid()),
+		EventTid:    "0",
+		OperationId: w.operationID,
+	}})
+	if err != nil {
+		return errors.Wrap(err, "failed to marshal event")
+	}
+
+	// written aside first, the guest agent collects any .json file
+	path := filepath.Join(w.dir, fmt.Sprintf("%d.json", now.UnixNano()))
+	tmp := path + ".tmp"
+	if err := ioutil.WriteFile(tmp, b, 0644); err != nil {
+		return errors.Wrap(err, "failed to write event")
+	}
+	if err := os.Rename(tmp, path); err != nil {
+		os.Remove(tmp)
+		return errors.Wrap(err, "failed to write event")
+	}
+	return nil
+}
@@ -0,0 +1,65 @@
+package main
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func Test_newEventWriter(t *testing.T) {
+	require.Nil(t, newEventWriter("", 3))
+	var w *eventWriter
+	require.Nil(t, w.write(eventLevelInformational, eventTaskStateChange, "dropped"))
+}
+
+func Test_eventWriter_write(t *testing.T) {
+	dir, err := ioutil.TempDir("", "")
+	require.Nil(t, err)
+	defer os.RemoveAll(dir)
+
+	w := newEventWriter(dir, 3)
+	w.now = func() time.Time { return time.Date(2026, 10, 15, 12, 0, 0, 0, time.UTC) }
+	require.Nil(t, w.write(eventLevelWarning, eventTaskStateChange, "state changed from healthy to unhealthy"))
+
+	files, err := filepath.Glob(filepath.Join(dir, "*"))
+	require.Nil(t, err)
+	require.Len(t, files, 1)
+	require.True(t, strings.HasSuffix(files[0], ".json"))
+	b, err := ioutil.ReadFile(files[0])
+	require.Nil(t, err)
+	var events []extensionEvent
+	require.Nil(t, json.Unmarshal(b, &events))
+	require.Len(t, events, 1)
+	require.Equal(t, extensionEvent{
+		Version:     Version,
+		Timestamp:   "2026-10-15T12:00:00Z",
+		TaskName:    eventTaskStateChange,
+		EventLevel:  eventLevelWarning,
+		Message:     "state changed from healthy to unhealthy",
+		EventPid:    events[0].EventPid,
+		EventTid:    "0",
+		OperationId: "3",
+	}, events[0])
+}
+
+func Test_eventWriter_write_pendingLimit(t *testing.T) {
+	dir, err := ioutil.TempDir("", "")
+	require.Nil(t, err)
+	defer os.RemoveAll(dir)
+
+	w := newEventWriter(dir, 0)
+	n := 0
+	w.now = func() time.Time { n++; return time.Unix(0, int64(n)) }
+	for i := 0; i < maxPendingEvents; i++ {
+		require.Nil(t, w.write(eventLevelInformational, eventTaskConfigReload, "reloaded configuration"))
+	}
+	err = w.write(eventLevelInformational, eventTaskConfigReload, "reloaded configuration")
+	require.NotNil(t, err)
+	require.Contains(t, err.Error(), "event dropped")
+}
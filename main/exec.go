@@ -0,0 +1,186 @@
+package main
+
+import (
+	"context"
+	"os"
+	"os/exec"
+	"os/user"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/go-kit/kit/log"
+	"github.com/pkg/errors"
+)
+
+const (
+	// maxExecOutput bounds the output of a failed exec probe that is logged.
+	maxExecOutput = 1024
+
+	commandOutputSubstatusName = "AppHealthCommandOutput"
+)
+
+var (
+	errExecRequiresCommand    = errors.New("'command' must be specified when using 'exec' protocol")
+	errCommandRequiresExec    = errors.New("'command', 'runAsUser', 'commandEnvironment' and 'captureCommandOutput' can only be specified when using 'exec' protocol")
+	errExecCommandNotAbsolute = errors.New("the executable of 'command' must be given as an absolute path")
+	errExecWithPort           = errors.New("'host', 'port', 'requestPath', 'systemdSocket', 'portFile' and 'unixSocketPath' cannot be specified when using 'exec' protocol")
+
+	// commandOutputs records the output of the last failed run of the
+	// command of each exec probe capturing it.
+	commandOutputs = newOutputRecorder()
+)
+
+// ExecHealthProbe runs a command and reports the application healthy if it
+// exits with status 0 before the timeout.
+type ExecHealthProbe struct {
+	Command []string
+	Timeout time.Duration
+
+	User          string   // runs the command as the user if set
+	Env           []string // names of the variables passed, all if nil
+	CaptureOutput bool     // records the output of failed runs in commandOutputs
+}
+
+func (p *ExecHealthProbe) evaluate(probeCtx context.Context, ctx *log.Context) (HealthStatus, error) {
+	cmdCtx, cancel := context.WithTimeout(probeCtx, p.Timeout)
+	defer cancel()
+	cmd := exec.CommandContext(cmdCtx, p.Command[0], p.Command[1:]...)
+	killGroupOnCancel(cmd)
+	if p.Env != nil {
+		cmd.Env = []string{}
+		for _, name := range p.Env {
+			if v, ok := os.LookupEnv(name); ok {
+				cmd.Env = append(cmd.Env, name+"="+v)
+			}
+		}
+	}
+	if p.User != "" {
+		cred, err := userCredential(p.User)
+		if err != nil {
+			return Unknown, err
+		}
+		cmd.SysProcAttr.Credential = cred
+	}
+
+	out, err := cmd.CombinedOutput()
+	if err != nil {
+		if len(out) > maxExecOutput {
+			out = out[len(out)-maxExecOutput:]
+		}
+		if cmdCtx.Err() != nil {
+			err = errors.Errorf("timed out after %s", p.Timeout)
+		}
+		ctx.Log("event", "exec probe failed", "command", p.address(), "error", err, "output", string(out))
+		if p.CaptureOutput {
+			commandOutputs.record(p.address(), err.Error()+": "+string(out))
+		}
+		return Unhealthy, nil
+	}
+	if p.CaptureOutput {
+		commandOutputs.record(p.address(), "")
+	}
+	return Healthy, nil
+}
+
+// killGroupOnCancel makes cmd kill its children with it when its context is
+// done, and not wait for the ones escaping the process group and keeping the
+// output open.
+func killGroupOnCancel(cmd *exec.Cmd) {
+	cmd.SysProcAttr = &syscall.SysProcAttr{Setpgid: true}
+	cmd.Cancel = func() error { return syscall.Kill(-cmd.Process.Pid, syscall.SIGKILL) }
+	cmd.WaitDelay = time.Second
+}
+
+// userCredential returns the credential of the named user, with its
+// supplementary groups.
+func userCredential(name string) (*syscall.Credential, error) {
+	u, err := user.Lookup(name)
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to look up user %s", name)
+	}
+	uid, _ := strconv.ParseUint(u.Uid, 10, 32)
+	gid, _ := strconv.ParseUint(u.Gid, 10, 32)
+	cred := &syscall.Credential{Uid: uint32(uid), Gid: uint32(gid)}
+	groups, err := u.GroupIds()
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to look up the groups of user %s", name)
+	}
+	for _, g := range groups {
+		if id, err := strconv.ParseUint(g, 10, 32); err == nil {
+			cred.Groups = append(cred.Groups, uint32(id))
+		}
+	}
+	return cred, nil
+}
+
+// outputRecorder records the output of the last failed run of each command.
+type outputRecorder struct {
+	mu      sync.Mutex
+	outputs map[string]string
+}
+
+func newOutputRecorder() *outputRecorder {
+	return &outputRecorder{outputs: make(map[string]string)}
+}
+
+// record records the output of the last run of command, "" if it succeeded.
+func (r *outputRecorder) record(command, output string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if output == "" {
+		delete(r.outputs, command)
+		return
+	}
+	r.outputs[command] = output
+}
+
+// message formats the recorded outputs as the substatus message, one command
+// per line, e.g. "/usr/bin/check: exit status 3: down".
+func (r *outputRecorder) message() string {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	var out []string
+	for command, output := range r.outputs {
+		out = append(out, command+": "+output)
+	}
+	sort.Strings(out)
+	return strings.Join(out, "\n")
+}
+
+func (p *ExecHealthProbe) address() string {
+	return strings.Join(p.Command, " ")
+}
+
+// validateExec makes logical validation of the settings of the exec probe.
+func (h handlerSettings) validateExec() error {
+	if h.protocol() != "exec" {
+		p := h.publicSettings
+		if len(p.Command) != 0 || p.RunAsUser != "" || p.CommandEnvironment != nil || p.CaptureCommandOutput {
+			return errCommandRequiresExec
+		}
+		return nil
+	}
+	if len(h.command()) == 0 {
+		return errExecRequiresCommand
+	}
+	if !filepath.IsAbs(h.command()[0]) {
+		return errExecCommandNotAbsolute
+	}
+	if h.publicSettings.Host != "" || h.port() != 0 || h.requestPath() != "" || h.systemdSocket() != "" || h.portFile() != "" || h.unixSocketPath() != "" {
+		return errExecWithPort
+	}
+	return nil
+}
+
+// commandSandbox returns the user the command of the exec probe runs as, ""
+// for the user of the extension, the names of the environment variables passed
+// to it, nil for all, and whether the output of its failed runs is reported.
+func (s *handlerSettings) commandSandbox() (user string, env []string, captureOutput bool) {
+	p := s.publicSettings
+	return p.RunAsUser, p.CommandEnvironment, p.CaptureCommandOutput
+}
@@ -0,0 +1,129 @@
+package main
+
+import (
+	"context"
+	"os"
+	"os/user"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/go-kit/kit/log"
+	"github.com/stretchr/testify/require"
+)
+
+func Test_ExecHealthProbe(t *testing.T) {
+	ctx := log.NewContext(log.NewNopLogger())
+	probe := func(timeout time.Duration, command ...string) HealthStatus {
+		state, err := (&ExecHealthProbe{Command: command, Timeout: timeout}).evaluate(context.Background(), ctx)
+		require.Nil(t, err)
+		return state
+	}
+
+	require.Equal(t, Healthy, probe(time.Second, "/bin/sh", "-c", "exit 0"))
+	require.Equal(t, Unhealthy, probe(time.Second, "/bin/sh", "-c", "echo down; exit 3"))
+	require.Equal(t, Unhealthy, probe(time.Second, "/nonexistent/check"))
+
+	start := time.Now()
+	require.Equal(t, Unhealthy, probe(100*time.Millisecond, "/bin/sh", "-c", "sleep 10"))
+	require.True(t, time.Since(start) < 5*time.Second, "killed on timeout")
+}
+
+func Test_ExecHealthProbe_sandbox(t *testing.T) {
+	ctx := log.NewContext(log.NewNopLogger())
+	defer func(r *outputRecorder) { commandOutputs = r }(commandOutputs)
+	commandOutputs = newOutputRecorder()
+
+	t.Setenv("APP_HEALTH_PASSED", "yes")
+	t.Setenv("APP_HEALTH_SECRET", "hunter2")
+	p := &ExecHealthProbe{
+		Command:       []string{"/bin/sh", "-c", `test "$APP_HEALTH_PASSED" = yes && test -z "$APP_HEALTH_SECRET"`},
+		Timeout:       time.Second,
+		Env:           []string{"APP_HEALTH_PASSED"},
+		CaptureOutput: true,
+	}
+	state, err := p.evaluate(context.Background(), ctx)
+	require.Nil(t, err)
+	require.Equal(t, Healthy, state, "only the listed variables are passed")
+
+	p.Command = []string{"/bin/sh", "-c", "echo disk full >&2; exit 3"}
+	state, err = p.evaluate(context.Background(), ctx)
+	require.Nil(t, err)
+	require.Equal(t, Unhealthy, state)
+	require.Equal(t, "/bin/sh -c echo disk full >&2; exit 3: exit status 3: disk full\n", commandOutputs.message())
+
+	p.Command = []string{"/bin/sh", "-c", "exit 0"}
+	p.CaptureOutput = false
+	state, err = p.evaluate(context.Background(), ctx)
+	require.Nil(t, err)
+	require.Equal(t, Healthy, state)
+	require.NotEmpty(t, commandOutputs.message(), "not recorded without capture")
+
+	commandOutputs = newOutputRecorder()
+	ready := filepath.Join(t.TempDir(), "ready")
+	p.Command = []string{"/bin/sh", "-c", "test -e " + ready}
+	p.CaptureOutput = true
+	state, _ = p.evaluate(context.Background(), ctx)
+	require.Equal(t, Unhealthy, state)
+	require.NotEmpty(t, commandOutputs.message())
+	require.Nil(t, os.WriteFile(ready, nil, 0644))
+	state, _ = p.evaluate(context.Background(), ctx)
+	require.Equal(t, Healthy, state)
+	require.Empty(t, commandOutputs.message(), "cleared by a successful run")
+}
+
+func Test_ExecHealthProbe_killsProcessGroup(t *testing.T) {
+	ctx := log.NewContext(log.NewNopLogger())
+	start := time.Now()
+	state, err := (&ExecHealthProbe{Command: []string{"/bin/sh", "-c", "sleep 10 & sleep 10; wait"}, Timeout: 100 * time.Millisecond}).evaluate(context.Background(), ctx)
+	require.Nil(t, err)
+	require.Equal(t, Unhealthy, state)
+	require.True(t, time.Since(start) < time.Second, "children killed on timeout rather than waited for")
+}
+
+func Test_ExecHealthProbe_runAsUser(t *testing.T) {
+	ctx := log.NewContext(log.NewNopLogger())
+	if os.Geteuid() != 0 {
+		t.Skip("running as another user requires root")
+	}
+	u, err := user.Lookup("nobody")
+	if err != nil {
+		t.Skip("no nobody user")
+	}
+	state, err := (&ExecHealthProbe{Command: []string{"/bin/sh", "-c", "test $(id -u) = " + u.Uid}, Timeout: time.Second, User: "nobody"}).evaluate(context.Background(), ctx)
+	require.Nil(t, err)
+	require.Equal(t, Healthy, state)
+
+	state, err = (&ExecHealthProbe{Command: []string{"/bin/true"}, Timeout: time.Second, User: "no-such-user-here"}).evaluate(context.Background(), ctx)
+	require.Equal(t, Unknown, state)
+	require.NotNil(t, err)
+}
+
+func Test_NewHealthProbe_exec(t *testing.T) {
+	ctx := log.NewContext(log.NewNopLogger())
+	p := NewHealthProbe(ctx, &handlerSettings{publicSettings: publicSettings{Protocol: "exec", Command: []string{"/usr/bin/check", "--quick"}}})
+	require.IsType(t, &ExecHealthProbe{}, p)
+	require.Equal(t, "/usr/bin/check --quick", p.address())
+}
+
+func Test_handlerSettingsValidate_exec(t *testing.T) {
+	validate := func(p publicSettings) error { return handlerSettings{p, protectedSettings{}}.validate() }
+
+	require.Nil(t, validate(publicSettings{Protocol: "exec", Command: []string{"/usr/bin/check"}}))
+	require.Equal(t, errExecRequiresCommand, validate(publicSettings{Protocol: "exec"}))
+	require.Equal(t, errExecCommandNotAbsolute, validate(publicSettings{Protocol: "exec", Command: []string{"check"}}))
+	require.Equal(t, errExecWithPort, validate(publicSettings{Protocol: "exec", Command: []string{"/usr/bin/check"}, Port: 80}))
+	require.Equal(t, errCommandRequiresExec, validate(publicSettings{Protocol: "tcp", Port: 80, Command: []string{"/usr/bin/check"}}))
+	require.Nil(t, validate(publicSettings{Protocol: "exec", Command: []string{"/usr/bin/check"}, RunAsUser: "nobody", CommandEnvironment: []string{"PATH"}, CaptureCommandOutput: true}))
+	require.Equal(t, errCommandRequiresExec, validate(publicSettings{Protocol: "tcp", Port: 80, RunAsUser: "nobody"}))
+	require.Equal(t, errCommandRequiresExec, validate(publicSettings{Protocol: "tcp", Port: 80, CommandEnvironment: []string{}}))
+	require.Equal(t, errCommandRequiresExec, validate(publicSettings{Protocol: "tcp", Port: 80, CaptureCommandOutput: true}))
+
+	require.Nil(t, validate(publicSettings{Applications: []applicationSettings{
+		{Name: "cli", Protocol: "exec", Command: []string{"/usr/bin/check"}},
+	}}))
+	require.Equal(t, errApplicationsWithTopLevelProbe, validate(publicSettings{
+		Command:      []string{"/usr/bin/check"},
+		Applications: []applicationSettings{{Name: "cli", Protocol: "exec", Command: []string{"/usr/bin/check"}}},
+	}))
+}
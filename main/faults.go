@@ -0,0 +1,64 @@
+package main
+
+import (
+	"context"
+	"math/rand"
+	"time"
+
+	"github.com/go-kit/kit/log"
+)
+
+// faultInjectingProbe wraps a HealthProbe and tampers with its evaluation as
+// configured by the fault injection settings.
+type faultInjectingProbe struct {
+	HealthProbe
+	failureRate float64
+	timeoutRate float64
+	latency     time.Duration
+	timeout     time.Duration
+
+	random func() float64
+	after  func(time.Duration) <-chan time.Time
+}
+
+// newFaultInjectingProbe wraps p, simulating timeouts of the given duration.
+func newFaultInjectingProbe(p HealthProbe, f *faultInjectionSettings, timeout time.Duration) *faultInjectingProbe {
+	return &faultInjectingProbe{
+		HealthProbe: p,
+		failureRate: f.FailureRate,
+		timeoutRate: f.TimeoutRate,
+		latency:     time.Duration(f.LatencyInMilliseconds) * time.Millisecond,
+		timeout:     timeout,
+		random:      rand.New(rand.NewSource(time.Now().UnixNano())).Float64,
+		after:       time.After,
+	}
+}
+
+func (p *faultInjectingProbe) evaluate(probeCtx context.Context, ctx *log.Context) (HealthStatus, error) {
+	if p.latency > 0 {
+		ctx.Log("event", "injecting probe latency", "latency", p.latency)
+		if !p.sleep(probeCtx, p.latency) {
+			return Unknown, probeCtx.Err()
+		}
+	}
+	if p.random() < p.timeoutRate {
+		ctx.Log("event", "injecting probe timeout", "timeout", p.timeout)
+		p.sleep(probeCtx, p.timeout)
+		return Unhealthy, nil
+	}
+	if p.random() < p.failureRate {
+		ctx.Log("event", "injecting probe failure")
+		return Unhealthy, nil
+	}
+	return p.HealthProbe.evaluate(probeCtx, ctx)
+}
+
+// sleep waits for d, returning false if probeCtx is done before.
+func (p *faultInjectingProbe) sleep(probeCtx context.Context, d time.Duration) bool {
+	select {
+	case <-p.after(d):
+		return true
+	case <-probeCtx.Done():
+		return false
+	}
+}
@@ -0,0 +1,75 @@
+package main
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/go-kit/kit/log"
+	"github.com/stretchr/testify/require"
+)
+
+func Test_faultInjectingProbe(t *testing.T) {
+	ctx := log.NewContext(log.NewNopLogger())
+	var slept []time.Duration
+	newProbe := func(f faultInjectionSettings, random float64) *faultInjectingProbe {
+		p := newFaultInjectingProbe(DefaultHealthProbe{}, &f, defaultProbeTimeout)
+		p.random = func() float64 { return random }
+		p.after = func(d time.Duration) <-chan time.Time {
+			slept = append(slept, d)
+			return time.After(0)
+		}
+		return p
+	}
+
+	// no faults
+	state, err := newProbe(faultInjectionSettings{}, 0.5).evaluate(context.Background(), ctx)
+	require.Nil(t, err)
+	require.Equal(t, Healthy, state)
+	require.Empty(t, slept)
+
+	// failure
+	state, err = newProbe(faultInjectionSettings{FailureRate: 0.6}, 0.5).evaluate(context.Background(), ctx)
+	require.Nil(t, err)
+	require.Equal(t, Unhealthy, state)
+	require.Empty(t, slept)
+
+	// timeout with latency
+	state, err = newProbe(faultInjectionSettings{TimeoutRate: 0.6, LatencyInMilliseconds: 20}, 0.5).evaluate(context.Background(), ctx)
+	require.Nil(t, err)
+	require.Equal(t, Unhealthy, state)
+	require.Equal(t, []time.Duration{20 * time.Millisecond, defaultProbeTimeout}, slept)
+}
+
+func Test_faultInjectingProbe_cancelled(t *testing.T) {
+	ctx := log.NewContext(log.NewNopLogger())
+	p := newFaultInjectingProbe(DefaultHealthProbe{}, &faultInjectionSettings{LatencyInMilliseconds: 3600000}, defaultProbeTimeout)
+	probeCtx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+
+	state, err := p.evaluate(probeCtx, ctx)
+	require.Equal(t, context.DeadlineExceeded, err, "latency interrupted")
+	require.Equal(t, Unknown, state)
+}
+
+func Test_NewHealthProbe_faultInjection(t *testing.T) {
+	ctx := log.NewContext(log.NewNopLogger())
+	faults := publicSettings{FaultInjection: &faultInjectionSettings{FailureRate: 1}}
+	p := NewHealthProbe(ctx, &handlerSettings{faults, protectedSettings{AllowFaultInjection: true}})
+	_, ok := p.(*faultInjectingProbe)
+	require.True(t, ok)
+
+	p = NewHealthProbe(ctx, &handlerSettings{publicSettings: faults})
+	_, ok = p.(*faultInjectingProbe)
+	require.False(t, ok, "not allowed by the protected settings")
+
+	p = NewHealthProbe(ctx, &handlerSettings{})
+	_, ok = p.(*faultInjectingProbe)
+	require.False(t, ok)
+}
+
+func Test_handlerSettingsValidate_faultInjection(t *testing.T) {
+	faults := publicSettings{Protocol: "tcp", Port: 80, FaultInjection: &faultInjectionSettings{FailureRate: 0.5}}
+	require.Equal(t, errFaultInjectionNotAllowed, handlerSettings{faults, protectedSettings{}}.validate())
+	require.Nil(t, handlerSettings{faults, protectedSettings{AllowFaultInjection: true}}.validate())
+}
@@ -0,0 +1,78 @@
+package main
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/go-kit/kit/log"
+	"github.com/pkg/errors"
+)
+
+var (
+	errFileRequiresPath     = errors.New("'filePath' must be specified when using 'file' protocol")
+	errFilePathRequiresFile = errors.New("'filePath' and 'fileMaxAgeInSeconds' can only be specified when using 'file' protocol")
+	errFilePathNotAbsolute  = errors.New("'filePath' must be an absolute path")
+	errFileWithPort         = errors.New("'host', 'port', 'requestPath', 'systemdSocket', 'portFile' and 'unixSocketPath' cannot be specified when using 'file' protocol")
+)
+
+// FileHealthProbe checks the heartbeat file of an application and reports it
+// healthy if the file exists and, if MaxAge is set, was modified within
+// MaxAge.
+type FileHealthProbe struct {
+	Path   string
+	MaxAge time.Duration
+	Now    func() time.Time
+}
+
+func (p *FileHealthProbe) evaluate(probeCtx context.Context, ctx *log.Context) (HealthStatus, error) {
+	fi, err := os.Stat(p.Path)
+	if err != nil {
+		ctx.Log("event", "heartbeat file not found", "path", p.Path, "error", err)
+		return Unhealthy, nil
+	}
+	if p.MaxAge == 0 {
+		return Healthy, nil
+	}
+	now := time.Now
+	if p.Now != nil {
+		now = p.Now
+	}
+	if age := now().Sub(fi.ModTime()); age > p.MaxAge {
+		ctx.Log("event", "heartbeat file is stale", "path", p.Path, "age", age.Round(time.Second).String())
+		return Unhealthy, nil
+	}
+	return Healthy, nil
+}
+
+func (p *FileHealthProbe) address() string {
+	return p.Path
+}
+
+// validateFile makes logical validation of the settings of the file probe.
+func (h handlerSettings) validateFile() error {
+	if h.protocol() != "file" {
+		if h.publicSettings.FilePath != "" || h.publicSettings.FileMaxAgeInSeconds != 0 {
+			return errFilePathRequiresFile
+		}
+		return nil
+	}
+	if h.publicSettings.FilePath == "" {
+		return errFileRequiresPath
+	}
+	if !filepath.IsAbs(h.publicSettings.FilePath) {
+		return errFilePathNotAbsolute
+	}
+	if h.publicSettings.Host != "" || h.port() != 0 || h.requestPath() != "" || h.systemdSocket() != "" || h.portFile() != "" || h.unixSocketPath() != "" {
+		return errFileWithPort
+	}
+	return nil
+}
+
+// heartbeatFile returns the path of the file checked by the file probe and
+// the time since its last modification after which it is stale, 0 if only
+// its existence is checked.
+func (s *handlerSettings) heartbeatFile() (string, time.Duration) {
+	return s.publicSettings.FilePath, time.Duration(s.publicSettings.FileMaxAgeInSeconds) * time.Second
+}
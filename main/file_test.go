@@ -0,0 +1,59 @@
+package main
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/go-kit/kit/log"
+	"github.com/stretchr/testify/require"
+)
+
+func Test_FileHealthProbe(t *testing.T) {
+	ctx := log.NewContext(log.NewNopLogger())
+	path := filepath.Join(t.TempDir(), "heartbeat")
+	now := time.Now()
+	probe := func(maxAge time.Duration) HealthStatus {
+		state, err := (&FileHealthProbe{Path: path, MaxAge: maxAge, Now: func() time.Time { return now }}).evaluate(context.Background(), ctx)
+		require.Nil(t, err)
+		return state
+	}
+
+	require.Equal(t, Unhealthy, probe(0), "missing file")
+	require.Nil(t, os.WriteFile(path, nil, 0644))
+	require.Nil(t, os.Chtimes(path, now.Add(-time.Minute), now.Add(-time.Minute)))
+	require.Equal(t, Healthy, probe(0), "existence only")
+	require.Equal(t, Healthy, probe(2*time.Minute))
+	require.Equal(t, Unhealthy, probe(30*time.Second), "stale")
+}
+
+func Test_NewHealthProbe_file(t *testing.T) {
+	ctx := log.NewContext(log.NewNopLogger())
+	p := NewHealthProbe(ctx, &handlerSettings{publicSettings: publicSettings{Protocol: "file", FilePath: "/run/app/heartbeat", FileMaxAgeInSeconds: 30}})
+	require.IsType(t, &FileHealthProbe{}, p)
+	require.Equal(t, "/run/app/heartbeat", p.address())
+	require.Equal(t, 30*time.Second, p.(*FileHealthProbe).MaxAge)
+}
+
+func Test_handlerSettingsValidate_file(t *testing.T) {
+	validate := func(p publicSettings) error { return handlerSettings{p, protectedSettings{}}.validate() }
+
+	require.Nil(t, validate(publicSettings{Protocol: "file", FilePath: "/run/app/heartbeat"}))
+	require.Nil(t, validate(publicSettings{Protocol: "file", FilePath: "/run/app/heartbeat", FileMaxAgeInSeconds: 30}))
+	require.Equal(t, errFileRequiresPath, validate(publicSettings{Protocol: "file"}))
+	require.Equal(t, errFilePathNotAbsolute, validate(publicSettings{Protocol: "file", FilePath: "heartbeat"}))
+	require.Equal(t, errFileWithPort, validate(publicSettings{Protocol: "file", FilePath: "/run/app/heartbeat", Port: 80}))
+	require.Equal(t, errFilePathRequiresFile, validate(publicSettings{Protocol: "tcp", Port: 80, FilePath: "/run/app/heartbeat"}))
+	require.Equal(t, errFilePathRequiresFile, validate(publicSettings{Protocol: "tcp", Port: 80, FileMaxAgeInSeconds: 30}))
+	require.Equal(t, errIPVersionUnsupported, validate(publicSettings{Protocol: "file", FilePath: "/run/app/heartbeat", IPVersion: ipVersion4}))
+
+	require.Nil(t, validate(publicSettings{Applications: []applicationSettings{
+		{Name: "batch", Protocol: "file", FilePath: "/run/batch/heartbeat", FileMaxAgeInSeconds: 300},
+	}}))
+	require.Equal(t, errApplicationsWithTopLevelProbe, validate(publicSettings{
+		FilePath:     "/run/batch/heartbeat",
+		Applications: []applicationSettings{{Name: "batch", Protocol: "file", FilePath: "/run/batch/heartbeat"}},
+	}))
+}
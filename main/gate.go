@@ -0,0 +1,43 @@
+package main
+
+import (
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+var (
+	errProvisioningGateTimeout = errors.New("Application was not found to be healthy before the provisioning gate timed out")
+)
+
+// provisioningGate holds the enable operation in 'transitioning' state until
+// the application is evaluated healthy for the first time. If that does not
+// happen before the deadline, the gate fails so that provisioning fails fast.
+type provisioningGate struct {
+	enabled  bool
+	passed   bool
+	deadline time.Time
+}
+
+func newProvisioningGate(cfg *handlerSettings, now time.Time) *provisioningGate {
+	return &provisioningGate{
+		enabled:  cfg.provisioningGate(),
+		deadline: now.Add(cfg.provisioningGateTimeout()),
+	}
+}
+
+// observe records a health evaluation made at the given time and returns the
+// status type and message the enable operation should report.
+func (g *provisioningGate) observe(now time.Time, state HealthStatus) (StatusType, messageID, error) {
+	if !g.enabled || g.passed {
+		return StatusSuccess, msgPolling, nil
+	}
+	if state == Healthy {
+		g.passed = true
+		return StatusSuccess, msgPolling, nil
+	}
+	if now.After(g.deadline) {
+		return StatusError, "", errProvisioningGateTimeout
+	}
+	return StatusTransitioning, msgWaitingForHealthy, nil
+}
@@ -0,0 +1,52 @@
+package main
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func Test_provisioningGate_disabled(t *testing.T) {
+	now := time.Now()
+	g := newProvisioningGate(&handlerSettings{}, now)
+
+	st, msg, err := g.observe(now.Add(time.Hour), Unhealthy)
+	require.Nil(t, err)
+	require.Equal(t, StatusSuccess, st)
+	require.Equal(t, msgPolling, msg)
+}
+
+func Test_provisioningGate_passesOnFirstHealthy(t *testing.T) {
+	now := time.Now()
+	g := newProvisioningGate(&handlerSettings{publicSettings: publicSettings{ProvisioningGate: true}}, now)
+
+	st, msg, err := g.observe(now, Unhealthy)
+	require.Nil(t, err)
+	require.Equal(t, StatusTransitioning, st)
+	require.Equal(t, msgWaitingForHealthy, msg)
+
+	st, _, err = g.observe(now.Add(time.Second), Healthy)
+	require.Nil(t, err)
+	require.Equal(t, StatusSuccess, st)
+
+	// once passed, the gate never closes again
+	st, _, err = g.observe(now.Add(time.Hour), Unhealthy)
+	require.Nil(t, err)
+	require.Equal(t, StatusSuccess, st)
+}
+
+func Test_provisioningGate_timesOut(t *testing.T) {
+	now := time.Now()
+	g := newProvisioningGate(&handlerSettings{publicSettings: publicSettings{
+		ProvisioningGate:                 true,
+		ProvisioningGateTimeoutInSeconds: 30,
+	}}, now)
+
+	st, _, err := g.observe(now.Add(29*time.Second), Unhealthy)
+	require.Nil(t, err)
+	require.Equal(t, StatusTransitioning, st)
+
+	_, _, err = g.observe(now.Add(31*time.Second), Unhealthy)
+	require.Equal(t, errProvisioningGateTimeout, err)
+}
@@ -0,0 +1,178 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"net"
+	"net/http"
+	"strconv"
+
+	"github.com/go-kit/kit/log"
+	"github.com/pkg/errors"
+)
+
+const (
+	// grpcHealthCheckPath is the method of the gRPC Health Checking Protocol
+	// called by the probe.
+	grpcHealthCheckPath = "/grpc.health.v1.Health/Check"
+
+	// serving statuses of grpc.health.v1.HealthCheckResponse
+	grpcServingStatusServing = 1
+)
+
+var (
+	errGrpcConfigurationMustIncludePort = errors.New("'port', 'systemdSocket' or 'portFile' must be specified when using 'grpc' protocol")
+	errGrpcMustNotIncludeRequestPath    = errors.New("'requestPath' cannot be specified when using 'grpc' protocol")
+	errGrpcServiceRequiresGrpc          = errors.New("'grpcService' can only be specified when using 'grpc' protocol")
+)
+
+// GrpcHealthProbe calls the Check method of the gRPC Health Checking Protocol
+// over plaintext HTTP/2 and reports the application healthy if the service is
+// SERVING.
+type GrpcHealthProbe struct {
+	HttpClient *http.Client
+	Address    string
+	// Service is the service whose health is checked, "" for the server.
+	Service string
+}
+
+func NewGrpcHealthProbe(host string, port int, service string) *GrpcHealthProbe {
+	protocols := new(http.Protocols)
+	protocols.SetUnencryptedHTTP2(true)
+	return &GrpcHealthProbe{
+		HttpClient: &http.Client{
+			// a redirect is no gRPC response, 'followRedirects' is rejected
+			CheckRedirect: noRedirect,
+			Timeout:       defaultProbeTimeout,
+			Transport:     &http.Transport{Protocols: protocols},
+		},
+		Address: net.JoinHostPort(host, strconv.Itoa(port)),
+		Service: service,
+	}
+}
+
+func (p *GrpcHealthProbe) evaluate(probeCtx context.Context, ctx *log.Context) (HealthStatus, error) {
+	req, err := http.NewRequestWithContext(probeCtx, "POST", "http://"+p.Address+grpcHealthCheckPath,
+		bytes.NewReader(grpcFrame(encodeHealthCheckRequest(p.Service))))
+	if err != nil {
+		return Unhealthy, err
+	}
+	req.Header.Set("Content-Type", "application/grpc")
+	req.Header.Set("TE", "trailers")
+	req.Header.Set("User-Agent", "ApplicationHealthExtension/1.0")
+
+	resp, err := p.HttpClient.Do(req)
+	if err != nil {
+		if err := resolutionError(err); err != nil {
+			return Unknown, err
+		}
+		return Unhealthy, nil
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return Unhealthy, nil
+	}
+	// reading the body to the end receives the trailers
+	body, err := readResponseBody(resp.Body)
+	if err != nil {
+		return Unhealthy, nil
+	}
+
+	code := resp.Trailer.Get("Grpc-Status")
+	if code == "" {
+		code = resp.Header.Get("Grpc-Status") // trailers-only response
+	}
+	if code != "0" {
+		ctx.Log("event", "grpc health check failed", "grpcStatus", code, "grpcMessage", resp.Trailer.Get("Grpc-Message")+resp.Header.Get("Grpc-Message"))
+		return Unhealthy, nil
+	}
+
+	status, err := decodeHealthCheckResponse(body)
+	if err != nil {
+		ctx.Log("event", "invalid grpc health check response", "error", err)
+		return Unhealthy, nil
+	}
+	if status != grpcServingStatusServing {
+		return Unhealthy, nil
+	}
+	return Healthy, nil
+}
+
+func (p *GrpcHealthProbe) address() string {
+	return p.Address
+}
+
+// grpcFrame prefixes an uncompressed gRPC message with its length.
+func grpcFrame(msg []byte) []byte {
+	b := make([]byte, 5, 5+len(msg))
+	binary.BigEndian.PutUint32(b[1:], uint32(len(msg)))
+	return append(b, msg...)
+}
+
+// encodeHealthCheckRequest encodes grpc.health.v1.HealthCheckRequest, whose
+// only field is 'string service = 1'.
+func encodeHealthCheckRequest(service string) []byte {
+	if service == "" {
+		return nil
+	}
+	b := []byte{1<<3 | 2}
+	b = binary.AppendUvarint(b, uint64(len(service)))
+	return append(b, service...)
+}
+
+// decodeHealthCheckResponse decodes the status, 'ServingStatus status = 1', of
+// the framed grpc.health.v1.HealthCheckResponse.
+func decodeHealthCheckResponse(frame []byte) (uint64, error) {
+	if len(frame) < 5 {
+		return 0, errors.New("truncated gRPC message")
+	}
+	if frame[0] != 0 {
+		return 0, errors.New("compressed gRPC message not supported")
+	}
+	n := binary.BigEndian.Uint32(frame[1:5])
+	msg := frame[5:]
+	if uint32(len(msg)) < n {
+		return 0, errors.New("truncated gRPC message")
+	}
+	msg = msg[:n]
+
+	var status uint64 // absent means UNKNOWN (0)
+	for len(msg) > 0 {
+		tag, l := binary.Uvarint(msg)
+		if l <= 0 {
+			return 0, errors.New("invalid protobuf field tag")
+		}
+		msg = msg[l:]
+		switch tag & 7 {
+		case 0: // varint
+			v, l := binary.Uvarint(msg)
+			if l <= 0 {
+				return 0, errors.New("invalid protobuf varint")
+			}
+			msg = msg[l:]
+			if tag>>3 == 1 {
+				status = v
+			}
+		case 1: // 64-bit
+			if len(msg) < 8 {
+				return 0, errors.New("truncated protobuf field")
+			}
+			msg = msg[8:]
+		case 2: // length-delimited
+			v, l := binary.Uvarint(msg)
+			if l <= 0 || uint64(len(msg)-l) < v {
+				return 0, errors.New("truncated protobuf field")
+			}
+			msg = msg[l+int(v):]
+		case 5: // 32-bit
+			if len(msg) < 4 {
+				return 0, errors.New("truncated protobuf field")
+			}
+			msg = msg[4:]
+		default:
+			return 0, errors.Errorf("unsupported protobuf wire type %d", tag&7)
+		}
+	}
+	return status, nil
+}
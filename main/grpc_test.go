@@ -0,0 +1,107 @@
+package main
+
+import (
+	"context"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/go-kit/kit/log"
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/require"
+)
+
+// newGrpcHealthServer serves the gRPC Health Checking Protocol over plaintext
+// HTTP/2, answering with the serving status of each service.
+func newGrpcHealthServer(t *testing.T, statuses map[string]byte) *httptest.Server {
+	srv := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		require.Equal(t, 2, r.ProtoMajor)
+		require.Equal(t, grpcHealthCheckPath, r.URL.Path)
+		require.Equal(t, "application/grpc", r.Header.Get("Content-Type"))
+		b, err := ioutil.ReadAll(r.Body)
+		require.Nil(t, err)
+		service := ""
+		if len(b) > 7 {
+			service = string(b[7:]) // frame header, tag and length
+		}
+
+		w.Header().Set("Content-Type", "application/grpc")
+		status, ok := statuses[service]
+		if !ok {
+			w.Header().Set("Grpc-Status", "5") // trailers-only NOT_FOUND
+			w.Header().Set("Grpc-Message", "unknown service")
+			return
+		}
+		w.Write(grpcFrame([]byte{1 << 3, status}))
+		w.Header().Set(http.TrailerPrefix+"Grpc-Status", "0")
+	}))
+	srv.Config.Protocols = new(http.Protocols)
+	srv.Config.Protocols.SetUnencryptedHTTP2(true)
+	srv.Start()
+	t.Cleanup(srv.Close)
+	return srv
+}
+
+func Test_GrpcHealthProbe(t *testing.T) {
+	ctx := log.NewContext(log.NewNopLogger())
+	srv := newGrpcHealthServer(t, map[string]byte{"": 1, "orders": 2})
+	probe := func(service string) HealthStatus {
+		p := NewGrpcHealthProbe("localhost", 0, service)
+		p.Address = strings.TrimPrefix(srv.URL, "http://")
+		state, err := p.evaluate(context.Background(), ctx)
+		require.Nil(t, err)
+		return state
+	}
+
+	require.Equal(t, Healthy, probe(""))
+	require.Equal(t, Unhealthy, probe("orders"), "NOT_SERVING")
+	require.Equal(t, Unhealthy, probe("billing"), "unknown service")
+
+	srv.Close()
+	require.Equal(t, Unhealthy, probe(""))
+}
+
+func Test_encodeHealthCheckRequest(t *testing.T) {
+	require.Empty(t, encodeHealthCheckRequest(""))
+	require.Equal(t, []byte{0x0a, 3, 'a', 'p', 'p'}, encodeHealthCheckRequest("app"))
+	require.Equal(t, []byte{0, 0, 0, 0, 2, 0x0a, 0}, grpcFrame([]byte{0x0a, 0}))
+}
+
+func Test_decodeHealthCheckResponse(t *testing.T) {
+	status, err := decodeHealthCheckResponse(grpcFrame([]byte{0x08, 1}))
+	require.Nil(t, err)
+	require.Equal(t, uint64(grpcServingStatusServing), status)
+
+	status, err = decodeHealthCheckResponse(grpcFrame(nil))
+	require.Nil(t, err)
+	require.Equal(t, uint64(0), status, "UNKNOWN by default")
+
+	// unknown fields are skipped
+	status, err = decodeHealthCheckResponse(grpcFrame([]byte{0x12, 2, 'x', 'y', 0x08, 2, 0x1d, 1, 2, 3, 4}))
+	require.Nil(t, err)
+	require.Equal(t, uint64(2), status)
+
+	_, err = decodeHealthCheckResponse([]byte{0, 0, 0})
+	require.NotNil(t, err)
+	_, err = decodeHealthCheckResponse([]byte{0, 0, 0, 0, 5, 0x08})
+	require.NotNil(t, err)
+	_, err = decodeHealthCheckResponse([]byte{1, 0, 0, 0, 0})
+	require.Contains(t, err.Error(), "compressed")
+}
+
+func Test_handlerSettingsValidate_grpc(t *testing.T) {
+	validate := func(p publicSettings) error { return handlerSettings{p, protectedSettings{}}.validate() }
+
+	require.Nil(t, validate(publicSettings{Protocol: "grpc", Port: 50051, GrpcService: "orders"}))
+	require.Equal(t, errGrpcConfigurationMustIncludePort, validate(publicSettings{Protocol: "grpc"}))
+	require.Equal(t, errGrpcMustNotIncludeRequestPath, validate(publicSettings{Protocol: "grpc", Port: 50051, RequestPath: "health"}))
+	require.Equal(t, errGrpcServiceRequiresGrpc, validate(publicSettings{Protocol: "tcp", Port: 80, GrpcService: "orders"}))
+
+	// grpc probes never follow redirects
+	require.Equal(t, errFollowRedirectsRequireHttp, validate(publicSettings{Protocol: "grpc", Port: 50051, FollowRedirects: true}))
+	require.Equal(t, errMaxRedirectsWithoutFollow, validate(publicSettings{Protocol: "grpc", Port: 50051, MaxRedirects: 3}))
+	err := validate(publicSettings{Probes: []applicationSettings{{Name: "orders", Protocol: "grpc", Port: 50051, FollowRedirects: true}}})
+	require.Equal(t, errFollowRedirectsRequireHttp, errors.Cause(err))
+}
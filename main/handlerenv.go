@@ -0,0 +1,104 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+const (
+	// handlerEnvFileName is the file name of the Handler Environment as
+	// placed by the Azure Linux Guest Agent.
+	handlerEnvFileName = "HandlerEnvironment.json"
+
+	// supportedHandlerEnvVersion is the major version of the Handler
+	// Environment layout this extension understands. Newer versions are
+	// parsed on a best-effort basis.
+	supportedHandlerEnvVersion = 1
+)
+
+// HandlerEnvironment describes the handler environment configuration presented
+// to the extension handler by the Azure Linux Guest Agent. Fields introduced
+// by newer guest agents are optional.
+type HandlerEnvironment struct {
+	Version            float64 `json:"version"`
+	Name               string  `json:"name"`
+	HandlerEnvironment struct {
+		HeartbeatFile       string `json:"heartbeatFile"`
+		StatusFolder        string `json:"statusFolder"`
+		ConfigFolder        string `json:"configFolder"`
+		LogFolder           string `json:"logFolder"`
+		EventsFolder        string `json:"eventsFolder"`
+		EventsFolderPreview string `json:"eventsFolder_preview"`
+		DeploymentID        string `json:"deploymentid"`
+		RoleName            string `json:"rolename"`
+		Instance            string `json:"instance"`
+		HostResolvConfPath  string `json:"hostResolvConfPath"`
+	}
+}
+
+// eventsFolder returns the folder extension events are written to, or empty
+// string if the guest agent does not collect extension events.
+func (h HandlerEnvironment) eventsFolder() string {
+	if h.HandlerEnvironment.EventsFolder != "" {
+		return h.HandlerEnvironment.EventsFolder
+	}
+	return h.HandlerEnvironment.EventsFolderPreview
+}
+
+// supported reports whether the version of the Handler Environment is one
+// this extension was built against.
+func (h HandlerEnvironment) supported() bool {
+	return int(h.Version) <= supportedHandlerEnvVersion
+}
+
+// getHandlerEnv locates the HandlerEnvironment.json file by assuming it lives
+// next to or one level above the extension handler (read: this) executable,
+// reads, parses and returns it.
+func getHandlerEnv() (he HandlerEnvironment, _ error) {
+	p, err := filepath.Abs(os.Args[0])
+	if err != nil {
+		return he, fmt.Errorf("cannot find base directory of the running process: %v", err)
+	}
+	dir := filepath.Dir(p)
+	paths := []string{
+		filepath.Join(dir, handlerEnvFileName),       // this level (i.e. executable is in [EXT_NAME]/.)
+		filepath.Join(dir, "..", handlerEnvFileName), // one up (i.e. executable is in [EXT_NAME]/bin/.)
+	}
+	for _, p := range paths {
+		b, err := ioutil.ReadFile(p)
+		if os.IsNotExist(err) {
+			continue
+		} else if err != nil {
+			return he, fmt.Errorf("error examining HandlerEnvironment at '%s': %v", p, err)
+		}
+		return parseHandlerEnv(b, filepath.Dir(p))
+	}
+	return he, fmt.Errorf("cannot find HandlerEnvironment at paths: %s", strings.Join(paths, ", "))
+}
+
+// parseHandlerEnv parses the /var/lib/waagent/[extension]/HandlerEnvironment.json
+// format. Folders missing from the file fall back to their conventional
+// location under the extension directory extDir.
+func parseHandlerEnv(b []byte, extDir string) (he HandlerEnvironment, _ error) {
+	var hf []HandlerEnvironment
+	if err := json.Unmarshal(b, &hf); err != nil {
+		return he, fmt.Errorf("failed to parse handler env: %v", err)
+	}
+	if len(hf) != 1 {
+		return he, fmt.Errorf("expected 1 config in parsed HandlerEnvironment, found: %v", len(hf))
+	}
+	he = hf[0]
+
+	e := &he.HandlerEnvironment
+	if e.ConfigFolder == "" {
+		e.ConfigFolder = filepath.Join(extDir, "config")
+	}
+	if e.StatusFolder == "" {
+		e.StatusFolder = filepath.Join(extDir, "status")
+	}
+	return he, nil
+}
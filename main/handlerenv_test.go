@@ -0,0 +1,62 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func Test_parseHandlerEnv_v1(t *testing.T) {
+	he, err := parseHandlerEnv([]byte(`[{
+		"name": "Microsoft.ManagedServices.ApplicationHealthLinux",
+		"version": 1.0,
+		"handlerEnvironment": {
+			"logFolder": "/var/log/azure/ext",
+			"configFolder": "/var/lib/waagent/ext/config",
+			"statusFolder": "/var/lib/waagent/ext/status",
+			"heartbeatFile": "/var/lib/waagent/ext/heartbeat.log"
+		}
+	}]`), "/var/lib/waagent/ext")
+	require.Nil(t, err)
+	require.True(t, he.supported())
+	require.Equal(t, "/var/lib/waagent/ext/config", he.HandlerEnvironment.ConfigFolder)
+	require.Equal(t, "", he.eventsFolder())
+}
+
+func Test_parseHandlerEnv_newerFields(t *testing.T) {
+	he, err := parseHandlerEnv([]byte(`[{
+		"version": 1.0,
+		"handlerEnvironment": {
+			"configFolder": "/var/lib/waagent/ext/config",
+			"statusFolder": "/var/lib/waagent/ext/status",
+			"eventsFolder_preview": "/var/log/azure/ext/events",
+			"deploymentid": "dep",
+			"rolename": "role",
+			"instance": "inst",
+			"hostResolvConfPath": "/etc/resolv.conf"
+		}
+	}]`), "/var/lib/waagent/ext")
+	require.Nil(t, err)
+	require.Equal(t, "/var/log/azure/ext/events", he.eventsFolder())
+	require.Equal(t, "dep", he.HandlerEnvironment.DeploymentID)
+
+	he.HandlerEnvironment.EventsFolder = "/var/log/azure/ext/events2"
+	require.Equal(t, "/var/log/azure/ext/events2", he.eventsFolder(), "eventsFolder preferred over preview")
+}
+
+func Test_parseHandlerEnv_fallbacks(t *testing.T) {
+	he, err := parseHandlerEnv([]byte(`[{"version": 2.0, "handlerEnvironment": {}}]`), "/ext")
+	require.Nil(t, err)
+	require.False(t, he.supported())
+	require.Equal(t, "/ext/config", he.HandlerEnvironment.ConfigFolder)
+	require.Equal(t, "/ext/status", he.HandlerEnvironment.StatusFolder)
+}
+
+func Test_parseHandlerEnv_invalid(t *testing.T) {
+	_, err := parseHandlerEnv([]byte(`{}`), "/ext")
+	require.NotNil(t, err)
+
+	_, err = parseHandlerEnv([]byte(`[{}, {}]`), "/ext")
+	require.NotNil(t, err)
+	require.Contains(t, err.Error(), "expected 1 config")
+}
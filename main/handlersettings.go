@@ -2,15 +2,55 @@ package main
 
 import (
 	"encoding/json"
+	"regexp"
+	"time"
 
 	"github.com/Azure/azure-docker-extension/pkg/vmextension"
 	"github.com/go-kit/kit/log"
 	"github.com/pkg/errors"
+	"github.com/xeipuuv/gojsonschema"
 )
 
 var (
 	errTcpMustNotIncludeRequestPath    = errors.New("'requestPath' cannot be specified when using 'tcp' protocol")
-	errTcpConfigurationMustIncludePort = errors.New("'port' must be specified when using 'tcp' protocol")
+	errTcpConfigurationMustIncludePort = errors.New("'port', 'systemdSocket', 'portFile' or 'unixSocketPath' must be specified when using 'tcp' protocol")
+	errGateTimeoutRequiresGate         = errors.New("'provisioningGateTimeoutInSeconds' cannot be specified unless 'provisioningGate' is enabled")
+	errAsyncEnableWithGate             = errors.New("'asyncEnable' cannot be used together with 'provisioningGate'")
+	errMessageCatalogRequiresLocale    = errors.New("'locale' must be specified when using 'messageCatalog'")
+	errSuppressedSubstatusNamed        = errors.New("'substatusName' and 'additionalSubstatusNames' cannot be specified when 'suppressSubstatus' is enabled")
+	errPassthroughWithGraceAccounting  = errors.New("'gracePeriodInSeconds' and 'excludeGracePeriodProbes' cannot be used together with 'passthrough'")
+	errPassthroughWithCooldown         = errors.New("'transitionCooldownInSeconds' cannot be used together with 'passthrough'")
+	errLegacyFormatAdditionalNames     = errors.New("'additionalSubstatusNames' cannot be used with the legacy 'statusFormatVersion' 1")
+	errMultiplePortSources             = errors.New("only one of 'port', 'systemdSocket', 'portFile' and 'unixSocketPath' can be specified")
+	errALPNRequiresHttps               = errors.New("'expectedAlpnProtocol' can only be specified when using 'https' protocol")
+	errVMMetadataSubstatusUnavailable  = errors.New("'reportVmMetadata' cannot be used together with 'suppressSubstatus' or the legacy 'statusFormatVersion' 1")
+	errBurstIntervalNotShorter         = errors.New("'confirmationBurst.intervalInSeconds' must be less than 'intervalInSeconds'")
+	errPassthroughWithThresholds       = errors.New("'numberOfProbes' and 'healthyThreshold' cannot be used together with 'passthrough'")
+	errUnhealthyDetectionTooSlow       = errors.New("'intervalInSeconds' multiplied by 'numberOfProbes' must not exceed 120 seconds")
+	errProbeTimeoutExceedsInterval     = errors.New("'probeTimeoutInSeconds' must not exceed 'intervalInSeconds'")
+	errHostWithUnixSocket              = errors.New("'host' cannot be used together with 'unixSocketPath'")
+	errFaultInjectionNotAllowed        = errors.New("'faultInjection' cannot be specified unless 'allowFaultInjection' is enabled in the protected settings")
+)
+
+const (
+	// defaultProvisioningGateTimeout is how long enable waits for the first
+	// healthy evaluation when the provisioning gate is enabled.
+	defaultProvisioningGateTimeout = 10 * time.Minute
+
+	// defaultInterval is the time between two probes.
+	defaultInterval = 5 * time.Second
+
+	// maxUnhealthyDetectionTime bounds the time it takes for an application
+	// failing every probe to be reported unhealthy.
+	maxUnhealthyDetectionTime = 120 * time.Second
+
+	// defaultMaxMessageLength is the maximum length of status and substatus
+	// messages, keeping the status file well within what the agent uploads.
+	defaultMaxMessageLength = 2048
+
+	// defaultStatusHeartbeat is how often the status file is rewritten while
+	// the status does not change.
+	defaultStatusHeartbeat = time.Minute
 )
 
 // handlerSettings holds the configuration of the extension handler.
@@ -23,6 +63,14 @@ func (s *handlerSettings) protocol() string {
 	return s.publicSettings.Protocol
 }
 
+// host returns the host probes connect to, localhost unless specified.
+func (s *handlerSettings) host() string {
+	if s.publicSettings.Host == "" {
+		return "localhost"
+	}
+	return s.publicSettings.Host
+}
+
 func (s *handlerSettings) requestPath() string {
 	return s.publicSettings.RequestPath
 }
@@ -31,10 +79,339 @@ func (s *handlerSettings) port() int {
 	return s.publicSettings.Port
 }
 
+// grpcService returns the service checked by the grpc probe, or "" for the
+// overall health of the server.
+func (s *handlerSettings) grpcService() string {
+	return s.publicSettings.GrpcService
+}
+
+// unixSocketPath returns the unix socket probes connect to instead of a TCP
+// port, or "" if they connect to a port.
+func (s *handlerSettings) unixSocketPath() string {
+	return s.publicSettings.UnixSocketPath
+}
+
+// command returns the command line run by the exec probe.
+func (s *handlerSettings) command() []string {
+	return s.publicSettings.Command
+}
+
+// systemdSocket returns the systemd socket unit the probed port is resolved
+// from, or "" if the port is configured directly.
+func (s *handlerSettings) systemdSocket() string {
+	return s.publicSettings.SystemdSocket
+}
+
+// portFile returns the file the application writes the probed port into, or
+// "" if the port is not discovered from a file.
+func (s *handlerSettings) portFile() string {
+	return s.publicSettings.PortFile
+}
+
+// confirmationBurst returns the settings of the probe bursts confirming state
+// changes, or nil if state changes are confirmed at the regular interval.
+func (s *handlerSettings) confirmationBurst() *confirmationBurstSettings {
+	return s.publicSettings.ConfirmationBurst
+}
+
+// honorRetryAfter tells whether the http probes back off when the application
+// responds with Retry-After.
+func (s *handlerSettings) honorRetryAfter() bool {
+	return s.publicSettings.HonorRetryAfter
+}
+
+// expectedALPNProtocol returns the protocol the TLS handshake of https probes
+// must negotiate, or "" if it is not checked.
+func (s *handlerSettings) expectedALPNProtocol() string {
+	return s.publicSettings.ExpectedALPNProtocol
+}
+
+// responseBodySchema returns the JSON Schema the response body of http probes
+// is validated against, or nil if the body is not validated.
+func (s *handlerSettings) responseBodySchema() *gojsonschema.Schema {
+	schema, _ := compileResponseBodySchema(s.publicSettings.ResponseBodySchema) // checked by validate
+	return schema
+}
+
+// responseBodyRegex returns the regular expression the response body of http
+// probes must match, or nil if the body is not matched.
+func (s *handlerSettings) responseBodyRegex() *regexp.Regexp {
+	if s.publicSettings.ResponseBodyRegex == "" {
+		return nil
+	}
+	re, _ := regexp.Compile(s.publicSettings.ResponseBodyRegex) // checked by validate
+	return re
+}
+
+// addressPolicy returns how probes connect to a target resolving to several
+// addresses, or "" to leave it to the Go dialer.
+func (s *handlerSettings) addressPolicy() string {
+	return s.publicSettings.AddressPolicy
+}
+
+// sshTunnel returns the ssh relay probes are tunneled through, or nil if
+// probes connect directly.
+func (s *handlerSettings) sshTunnel() *sshTunnelSettings {
+	return s.publicSettings.SshTunnel
+}
+
+func (s *handlerSettings) sshPrivateKey() string {
+	return s.protectedSettings.SshPrivateKey
+}
+
+// targetAllowlist returns the hosts probes may connect to, or nil if the
+// targets are not restricted.
+func (s *handlerSettings) targetAllowlist() *targetAllowlist {
+	if s.publicSettings.AllowedTargets == nil {
+		return nil
+	}
+	a, _ := parseTargetAllowlist(s.publicSettings.AllowedTargets) // checked by validate
+	return a
+}
+
+// pureGoResolver tells whether names are resolved by the Go resolver even
+// when the system resolver is available.
+func (s *handlerSettings) pureGoResolver() bool {
+	return s.publicSettings.PureGoResolver
+}
+
+// restartOnResourceLeak tells whether the probe loop restarts itself when it
+// is found to leak resources.
+func (s *handlerSettings) restartOnResourceLeak() bool {
+	return s.publicSettings.RestartOnResourceLeak
+}
+
+// reportVMMetadata tells whether the VM metadata is reported in its own
+// substatus.
+func (s *handlerSettings) reportVMMetadata() bool {
+	return s.publicSettings.ReportVMMetadata
+}
+
+func (s *handlerSettings) provisioningGate() bool {
+	return s.publicSettings.ProvisioningGate
+}
+
+// provisioningGateTimeout returns the deadline for the first healthy
+// evaluation when the provisioning gate is enabled.
+func (s *handlerSettings) provisioningGateTimeout() time.Duration {
+	if s.publicSettings.ProvisioningGateTimeoutInSeconds == 0 {
+		return defaultProvisioningGateTimeout
+	}
+	return time.Duration(s.publicSettings.ProvisioningGateTimeoutInSeconds) * time.Second
+}
+
+func (s *handlerSettings) asyncEnable() bool {
+	return s.publicSettings.AsyncEnable
+}
+
+// interval returns the time between two probes.
+func (s *handlerSettings) interval() time.Duration {
+	if s.publicSettings.IntervalInSeconds == 0 {
+		return defaultInterval
+	}
+	return time.Duration(s.publicSettings.IntervalInSeconds) * time.Second
+}
+
+// numberOfProbes returns the number of consecutive probe results required to
+// change the reported health state.
+func (s *handlerSettings) numberOfProbes() int {
+	if s.publicSettings.NumberOfProbes == 0 {
+		return defaultNumberOfProbes
+	}
+	return s.publicSettings.NumberOfProbes
+}
+
+// probeTimeout returns the time a single probe, e.g. a tcp connect or an http
+// request, may take before the application is found unhealthy.
+func (s *handlerSettings) probeTimeout() time.Duration {
+	if s.publicSettings.ProbeTimeoutInSeconds == 0 {
+		return defaultProbeTimeout
+	}
+	return time.Duration(s.publicSettings.ProbeTimeoutInSeconds) * time.Second
+}
+
+// healthyThreshold returns the number of consecutive healthy probe results
+// required to recover from an unhealthy or unknown state.
+func (s *handlerSettings) healthyThreshold() int {
+	if s.publicSettings.HealthyThreshold == 0 {
+		return defaultHealthyThreshold
+	}
+	return s.publicSettings.HealthyThreshold
+}
+
+// gracePeriod returns the time after the probe loop starts during which the
+// application is not reported unhealthy.
+func (s *handlerSettings) gracePeriod() time.Duration {
+	return time.Duration(s.publicSettings.GracePeriodInSeconds) * time.Second
+}
+
+func (s *handlerSettings) excludeGracePeriodProbes() bool {
+	return s.publicSettings.ExcludeGracePeriodProbes
+}
+
+// passthrough tells whether every probe result is reported immediately,
+// bypassing numberOfProbes and the grace period.
+func (s *handlerSettings) passthrough() bool {
+	return s.publicSettings.Passthrough
+}
+
+// persistState tells whether the derived health state is persisted across
+// restarts of the probe loop.
+func (s *handlerSettings) persistState() bool {
+	return s.publicSettings.PersistState
+}
+
+// persistedStateMaxAge returns the age after which the persisted state is
+// discarded, or 0 if it never expires.
+func (s *handlerSettings) persistedStateMaxAge() time.Duration {
+	return time.Duration(s.publicSettings.PersistedStateMaxAgeInSeconds) * time.Second
+}
+
+// transitionCooldown returns the minimum time between two changes of the
+// reported health state, or 0 if every change is reported.
+func (s *handlerSettings) transitionCooldown() time.Duration {
+	return time.Duration(s.publicSettings.TransitionCooldownInSeconds) * time.Second
+}
+
+// statusFormatVersion returns the version of the status structure to emit.
+func (s *handlerSettings) statusFormatVersion() int {
+	if s.publicSettings.StatusFormatVersion == 0 {
+		return currentStatusFormatVersion
+	}
+	return s.publicSettings.StatusFormatVersion
+}
+
+// faultInjection returns the fault injection settings, or nil if faults are
+// not to be injected. Faults are only injected if allowed by the protected
+// settings, which are not shown to whoever reads the public ones.
+func (s *handlerSettings) faultInjection() *faultInjectionSettings {
+	if !s.protectedSettings.AllowFaultInjection {
+		return nil
+	}
+	return s.publicSettings.FaultInjection
+}
+
+// locale returns the language status messages are reported in.
+func (s *handlerSettings) locale() string {
+	if s.publicSettings.Locale == "" {
+		return defaultLang
+	}
+	return s.publicSettings.Locale
+}
+
+// substatusNames returns the names the application health substatus is
+// reported under. Returns nil if substatus reporting is suppressed.
+func (s *handlerSettings) substatusNames() []string {
+	if s.suppressSubstatus() {
+		return nil
+	}
+	name := s.publicSettings.SubstatusName
+	if name == "" {
+		name = substatusName
+	}
+	return append([]string{name}, s.publicSettings.AdditionalSubstatusNames...)
+}
+
+func (s *handlerSettings) suppressSubstatus() bool {
+	return s.publicSettings.SuppressSubstatus
+}
+
+// maxMessageLength returns the length status and substatus messages are
+// truncated to.
+func (s *handlerSettings) maxMessageLength() int {
+	if s.publicSettings.MaxMessageLength == 0 {
+		return defaultMaxMessageLength
+	}
+	return s.publicSettings.MaxMessageLength
+}
+
+// statusHeartbeat returns how often the status file is rewritten while the
+// status does not change.
+func (s *handlerSettings) statusHeartbeat() time.Duration {
+	if s.publicSettings.StatusHeartbeatInSeconds == 0 {
+		return defaultStatusHeartbeat
+	}
+	return time.Duration(s.publicSettings.StatusHeartbeatInSeconds) * time.Second
+}
+
+// applications returns the independently monitored applications, or nil if
+// the top level probe is the only one.
+func (s *handlerSettings) applications() []applicationSettings {
+	return s.publicSettings.Applications
+}
+
+// applicationsPolicy returns the policy deciding the VM-level health from the
+// health of the applications.
+func (s *handlerSettings) applicationsPolicy() string {
+	if s.publicSettings.ApplicationsPolicy == "" {
+		return policyAll
+	}
+	return s.publicSettings.ApplicationsPolicy
+}
+
+// readinessProbe returns the probe telling whether the application is ready to
+// receive traffic, reported apart from its health, or nil if not configured.
+func (s *handlerSettings) readinessProbe() *applicationSettings {
+	r := s.publicSettings.ReadinessProbe
+	if r == nil {
+		return nil
+	}
+	out := *r
+	out.Name = "readiness"
+	out.SubstatusName = readinessSubstatusName
+	return &out
+}
+
 // validate makes logical validation on the handlerSettings which already passed
 // the schema validation.
 func (h handlerSettings) validate() error {
-	if h.protocol() == "tcp" && h.port() == 0 {
+	if h.publicSettings.FaultInjection != nil && !h.protectedSettings.AllowFaultInjection {
+		return errFaultInjectionNotAllowed
+	}
+
+	if err := h.validateApplications(); err != nil {
+		return err
+	}
+
+	if err := h.validateProbes(); err != nil {
+		return err
+	}
+
+	if err := h.validateExec(); err != nil {
+		return err
+	}
+
+	if err := h.validateFile(); err != nil {
+		return err
+	}
+
+	if err := h.validateSystemd(); err != nil {
+		return err
+	}
+
+	if err := h.validateDocker(); err != nil {
+		return err
+	}
+
+	if err := h.validateProcess(); err != nil {
+		return err
+	}
+
+	portSources := 0
+	for _, set := range []bool{h.port() != 0, h.systemdSocket() != "", h.portFile() != "", h.unixSocketPath() != ""} {
+		if set {
+			portSources++
+		}
+	}
+	if portSources > 1 {
+		return errMultiplePortSources
+	}
+
+	if h.publicSettings.Host != "" && h.unixSocketPath() != "" {
+		return errHostWithUnixSocket
+	}
+
+	if h.protocol() == "tcp" && portSources == 0 {
 		return errTcpConfigurationMustIncludePort
 	}
 
@@ -42,6 +419,181 @@ func (h handlerSettings) validate() error {
 		return errTcpMustNotIncludeRequestPath
 	}
 
+	if err := h.validateUdp(portSources); err != nil {
+		return err
+	}
+
+	if err := h.validateIcmp(); err != nil {
+		return err
+	}
+
+	if err := h.validateDns(); err != nil {
+		return err
+	}
+
+	if err := h.validateTls(portSources); err != nil {
+		return err
+	}
+
+	if h.protocol() == "grpc" && portSources == 0 {
+		return errGrpcConfigurationMustIncludePort
+	}
+
+	if h.protocol() == "grpc" && h.requestPath() != "" {
+		return errGrpcMustNotIncludeRequestPath
+	}
+
+	if h.protocol() != "grpc" && h.grpcService() != "" {
+		return errGrpcServiceRequiresGrpc
+	}
+
+	if b := h.confirmationBurst(); b != nil && time.Duration(b.IntervalInSeconds)*time.Second >= h.interval() {
+		return errBurstIntervalNotShorter
+	}
+
+	if h.expectedALPNProtocol() != "" && h.protocol() != "https" {
+		return errALPNRequiresHttps
+	}
+
+	if err := h.validateHttpRequest(); err != nil {
+		return err
+	}
+
+	if err := h.validateHttpAuth(); err != nil {
+		return err
+	}
+
+	if err := h.validateClientCertificate(); err != nil {
+		return err
+	}
+
+	if err := h.validateCABundle(); err != nil {
+		return err
+	}
+
+	if err := h.validateTLSSkipVerify(); err != nil {
+		return err
+	}
+
+	if err := h.validateCertificateExpiry(); err != nil {
+		return err
+	}
+
+	if err := h.validateProxy(); err != nil {
+		return err
+	}
+
+	if err := h.validateIPVersion(); err != nil {
+		return err
+	}
+
+	if err := h.validatePassiveListenCheck(); err != nil {
+		return err
+	}
+
+	if err := h.validateStatusCodes(); err != nil {
+		return err
+	}
+
+	if len(h.publicSettings.ResponseBodySchema) != 0 {
+		if !h.allowsHttpRequest() {
+			return errResponseSchemaRequiresHttp
+		}
+		if _, err := compileResponseBodySchema(h.publicSettings.ResponseBodySchema); err != nil {
+			return err
+		}
+	}
+
+	if h.publicSettings.ResponseBodyRegex != "" {
+		if !h.allowsHttpRequest() {
+			return errResponseRegexRequiresHttp
+		}
+		if _, err := regexp.Compile(h.publicSettings.ResponseBodyRegex); err != nil {
+			return errors.Wrap(errInvalidResponseBodyRegex, err.Error())
+		}
+	}
+
+	if err := h.validateJsonPath(); err != nil {
+		return err
+	}
+
+	allowlist, err := parseTargetAllowlist(h.publicSettings.AllowedTargets)
+	if err != nil {
+		return err
+	}
+
+	if t := h.sshTunnel(); t != nil {
+		if h.sshPrivateKey() == "" {
+			return errSshTunnelRequiresKey
+		}
+		if h.systemdSocket() != "" || h.portFile() != "" || h.unixSocketPath() != "" {
+			return errSshTunnelWithPortSource
+		}
+		if h.publicSettings.AllowedTargets != nil && !allowlist.allowedHost(t.Host) {
+			return errSshTunnelHostNotAllowed
+		}
+		if h.addressPolicy() != "" {
+			return errAddressPolicyWithSshTunnel
+		}
+	} else if h.sshPrivateKey() != "" {
+		return errSshKeyRequiresTunnel
+	}
+
+	if !h.provisioningGate() && h.publicSettings.ProvisioningGateTimeoutInSeconds != 0 {
+		return errGateTimeoutRequiresGate
+	}
+
+	if h.asyncEnable() && h.provisioningGate() {
+		return errAsyncEnableWithGate
+	}
+
+	if len(h.publicSettings.MessageCatalog) != 0 && h.publicSettings.Locale == "" {
+		return errMessageCatalogRequiresLocale
+	}
+
+	if h.suppressSubstatus() && (h.publicSettings.SubstatusName != "" || len(h.publicSettings.AdditionalSubstatusNames) != 0) {
+		return errSuppressedSubstatusNamed
+	}
+
+	if h.passthrough() && (h.gracePeriod() != 0 || h.excludeGracePeriodProbes()) {
+		return errPassthroughWithGraceAccounting
+	}
+
+	if h.passthrough() && h.transitionCooldown() != 0 {
+		return errPassthroughWithCooldown
+	}
+
+	if h.passthrough() && (h.publicSettings.NumberOfProbes != 0 || h.publicSettings.HealthyThreshold != 0) {
+		return errPassthroughWithThresholds
+	}
+
+	if h.interval()*time.Duration(h.numberOfProbes()) > maxUnhealthyDetectionTime {
+		return errUnhealthyDetectionTooSlow
+	}
+
+	if h.publicSettings.ProbeTimeoutInSeconds != 0 && h.probeTimeout() > h.interval() {
+		return errProbeTimeoutExceedsInterval
+	}
+
+	if !h.persistState() && h.persistedStateMaxAge() != 0 {
+		return errMaxAgeRequiresPersistState
+	}
+
+	if h.statusFormatVersion() == legacyStatusFormatVersion && len(h.publicSettings.AdditionalSubstatusNames) != 0 {
+		return errLegacyFormatAdditionalNames
+	}
+
+	if h.reportVMMetadata() && (h.suppressSubstatus() || h.statusFormatVersion() == legacyStatusFormatVersion) {
+		return errVMMetadataSubstatusUnavailable
+	}
+
+	if err := h.validateHooks(); err != nil {
+		return err
+	}
+	if err := h.validateApplicationInsights(); err != nil {
+		return err
+	}
+
 	return nil
 }
 
@@ -49,13 +601,151 @@ func (h handlerSettings) validate() error {
 // the extension handler. This should be in sync with publicSettingsSchema.
 type publicSettings struct {
 	Protocol    string `json:"protocol"`
+	Host        string `json:"host"`
 	Port        int    `json:"port,int"`
 	RequestPath string `json:"requestPath"`
+
+	Command     []string `json:"command"`
+	GrpcService string   `json:"grpcService"`
+
+	RunAsUser            string   `json:"runAsUser"`
+	CommandEnvironment   []string `json:"commandEnvironment"`
+	CaptureCommandOutput bool     `json:"captureCommandOutput"`
+
+	UdpPayload          string `json:"udpPayload"`
+	UdpExpectedResponse string `json:"udpExpectedResponse"`
+
+	IcmpAddress               string `json:"icmpAddress"`
+	IcmpCount                 int    `json:"icmpCount,int"`
+	IcmpTimeoutInMilliseconds int    `json:"icmpTimeoutInMilliseconds,int"`
+
+	DnsName string `json:"dnsName"`
+
+	FilePath            string `json:"filePath"`
+	FileMaxAgeInSeconds int    `json:"fileMaxAgeInSeconds,int"`
+
+	SystemdUnit string `json:"systemdUnit"`
+
+	ContainerName string `json:"containerName"`
+	DockerSocket  string `json:"dockerSocket"`
+
+	PidFile        string `json:"pidFile"`
+	ProcessPattern string `json:"processPattern"`
+
+	PassiveListenCheck bool `json:"passiveListenCheck"`
+
+	SystemdSocket  string `json:"systemdSocket"`
+	PortFile       string `json:"portFile"`
+	UnixSocketPath string `json:"unixSocketPath"`
+
+	HonorRetryAfter      bool                       `json:"honorRetryAfter"`
+	ExpectedALPNProtocol string                     `json:"expectedAlpnProtocol"`
+	CABundle             string                     `json:"caBundle"`
+	CABundlePath         string                     `json:"caBundlePath"`
+	TLSSkipVerify        *bool                      `json:"tlsSkipVerify"`
+	TLSServerName        string                     `json:"tlsServerName"`
+	RequestHeaders       map[string]string          `json:"requestHeaders"`
+	HostHeader           string                     `json:"hostHeader"`
+	FollowRedirects      bool                       `json:"followRedirects"`
+	MaxRedirects         int                        `json:"maxRedirects,int"`
+	HttpMethod           string                     `json:"httpMethod"`
+	RequestBody          string                     `json:"requestBody"`
+	ExpectedStatusCodes  []interface{}              `json:"expectedStatusCodes"`
+	ResponseBodySchema   json.RawMessage            `json:"responseBodySchema"`
+	ResponseBodyRegex    string                     `json:"responseBodyRegex"`
+	ResponseJsonPath     string                     `json:"responseJsonPath"`
+	ExpectedValue        json.RawMessage            `json:"expectedValue"`
+	ConfirmationBurst    *confirmationBurstSettings `json:"confirmationBurst"`
+
+	ReportCertificateExpiry          bool `json:"reportCertificateExpiry"`
+	CertificateExpiryThresholdInDays int  `json:"certificateExpiryThresholdInDays,int"`
+	ReportProbeLatency               bool `json:"reportProbeLatency"`
+
+	AllowedTargets []string           `json:"allowedTargets"`
+	AddressPolicy  string             `json:"addressPolicy"`
+	SshTunnel      *sshTunnelSettings `json:"sshTunnel"`
+	PureGoResolver bool               `json:"pureGoResolver"`
+	IPVersion      string             `json:"ipVersion"`
+
+	ProxyURL             string `json:"proxyUrl"`
+	ProxyFromEnvironment bool   `json:"proxyFromEnvironment"`
+
+	RestartOnResourceLeak bool `json:"restartOnResourceLeak"`
+	ReportVMMetadata      bool `json:"reportVmMetadata"`
+
+	Applications       []applicationSettings `json:"applications"`
+	ApplicationsPolicy string                `json:"applicationsPolicy"`
+	Probes             []applicationSettings `json:"probes"`
+	Aggregation        string                `json:"aggregation"`
+	ReadinessProbe     *applicationSettings  `json:"readinessProbe"`
+
+	HealthyScoreThreshold int `json:"healthyScoreThreshold,int"`
+
+	IntervalInSeconds int `json:"intervalInSeconds,int"`
+	NumberOfProbes    int `json:"numberOfProbes,int"`
+	HealthyThreshold  int `json:"healthyThreshold,int"`
+
+	ProbeTimeoutInSeconds int `json:"probeTimeoutInSeconds,int"`
+	GracePeriodInSeconds  int `json:"gracePeriodInSeconds,int"`
+
+	ProvisioningGate                 bool `json:"provisioningGate"`
+	ProvisioningGateTimeoutInSeconds int  `json:"provisioningGateTimeoutInSeconds,int"`
+	AsyncEnable                      bool `json:"asyncEnable"`
+	ExcludeGracePeriodProbes         bool `json:"excludeGracePeriodProbes"`
+	Passthrough                      bool `json:"passthrough"`
+	TransitionCooldownInSeconds      int  `json:"transitionCooldownInSeconds,int"`
+	PersistState                     bool `json:"persistState"`
+	PersistedStateMaxAgeInSeconds    int  `json:"persistedStateMaxAgeInSeconds,int"`
+
+	Locale         string            `json:"locale"`
+	MessageCatalog map[string]string `json:"messageCatalog"`
+
+	SubstatusName            string   `json:"substatusName"`
+	AdditionalSubstatusNames []string `json:"additionalSubstatusNames"`
+	SuppressSubstatus        bool     `json:"suppressSubstatus"`
+
+	MaxMessageLength                int `json:"maxMessageLength,int"`
+	StatusFormatVersion             int `json:"statusFormatVersion,int"`
+	StatusHeartbeatInSeconds        int `json:"statusHeartbeatInSeconds,int"`
+	MinStatusWriteIntervalInSeconds int `json:"minStatusWriteIntervalInSeconds,int"`
+
+	LogLevel    string               `json:"logLevel"`
+	LogRotation *logRotationSettings `json:"logRotation"`
+	Syslog      bool                 `json:"syslog"`
+
+	OnUnhealthyCommand []string `json:"onUnhealthyCommand"`
+	OnHealthyCommand   []string `json:"onHealthyCommand"`
+
+	Notification        *notificationSettings        `json:"notification"`
+	ApplicationInsights *applicationInsightsSettings `json:"applicationInsights"`
+	AdminAPI            *adminAPISettings            `json:"adminApi"`
+	SystemChecks        *systemChecksSettings        `json:"systemChecks"`
+	FaultInjection      *faultInjectionSettings      `json:"faultInjection"`
+}
+
+// faultInjectionSettings configure artificial probe faults, for testing the
+// handling of unhealthy applications only.
+type faultInjectionSettings struct {
+	FailureRate           float64 `json:"failureRate"`
+	TimeoutRate           float64 `json:"timeoutRate"`
+	LatencyInMilliseconds int     `json:"latencyInMilliseconds,int"`
 }
 
 // protectedSettings is the type decoded and deserialized from protected
 // configuration section. This should be in sync with protectedSettingsSchema.
 type protectedSettings struct {
+	SshPrivateKey string `json:"sshPrivateKey"`
+
+	Username    string          `json:"username"`
+	Password    string          `json:"password"`
+	BearerToken string          `json:"bearerToken"`
+	OAuth2      *oauth2Settings `json:"oauth2"`
+
+	ClientCertificate           string `json:"clientCertificate"`
+	ClientKey                   string `json:"clientKey"`
+	ClientCertificateThumbprint string `json:"clientCertificateThumbprint"`
+
+	AllowFaultInjection bool `json:"allowFaultInjection"`
 }
 
 // parseAndValidateSettings reads configuration from configFolder, decrypts it,
@@ -85,6 +775,7 @@ func parseAndValidateSettings(ctx *log.Context, configFolder string) (h handlerS
 		return h, errors.Wrap(err, "invalid configuration")
 	}
 	ctx.Log("event", "validated configuration")
+	h.migrateFlatProbe()
 	return h, nil
 }
 
@@ -92,7 +783,7 @@ func parseAndValidateSettings(ctx *log.Context, configFolder string) (h handlerS
 // decrypt and parse the public/protected settings of the extension handler into
 // JSON objects.
 func readSettings(configFolder string) (pubSettingsJSON, protSettingsJSON map[string]interface{}, err error) {
-	pubSettingsJSON, protSettingsJSON, err = vmextension.ReadSettings(configFolder)
+	pubSettingsJSON, protSettingsJSON, err = readSettingsFile(configFolder)
 	err = errors.Wrapf(err, "error reading extension configuration")
 	return
 }
@@ -1,7 +1,14 @@
 package main
 
+import "encoding/json"
+import "io/ioutil"
+import "os"
+import "path/filepath"
 import "testing"
+import "time"
+import "github.com/go-kit/kit/log"
 import "github.com/stretchr/testify/require"
+import "github.com/pkg/errors"
 
 func Test_handlerSettingsValidate(t *testing.T) {
 	// tcp includes request path
@@ -44,3 +51,467 @@ func Test_toJSON(t *testing.T) {
 	require.Nil(t, err)
 	require.Equal(t, `{"a":3}`, s)
 }
+
+func Test_handlerSettingsValidate_provisioningGate(t *testing.T) {
+	require.Equal(t, errGateTimeoutRequiresGate, handlerSettings{
+		publicSettings{ProvisioningGateTimeoutInSeconds: 60},
+		protectedSettings{},
+	}.validate())
+
+	require.Nil(t, handlerSettings{
+		publicSettings{ProvisioningGate: true, ProvisioningGateTimeoutInSeconds: 60},
+		protectedSettings{},
+	}.validate())
+}
+
+func Test_handlerSettingsValidate_asyncEnable(t *testing.T) {
+	require.Equal(t, errAsyncEnableWithGate, handlerSettings{
+		publicSettings{AsyncEnable: true, ProvisioningGate: true},
+		protectedSettings{},
+	}.validate())
+
+	require.Nil(t, handlerSettings{
+		publicSettings{AsyncEnable: true},
+		protectedSettings{},
+	}.validate())
+}
+
+func Test_handlerSettingsValidate_messageCatalog(t *testing.T) {
+	require.Equal(t, errMessageCatalogRequiresLocale, handlerSettings{
+		publicSettings{MessageCatalog: map[string]string{"healthy": "OK"}},
+		protectedSettings{},
+	}.validate())
+
+	require.Nil(t, handlerSettings{
+		publicSettings{Locale: "de", MessageCatalog: map[string]string{"healthy": "OK"}},
+		protectedSettings{},
+	}.validate())
+}
+
+func Test_handlerSettingsValidate_suppressSubstatus(t *testing.T) {
+	require.Equal(t, errSuppressedSubstatusNamed, handlerSettings{
+		publicSettings{SuppressSubstatus: true, SubstatusName: "Foo"},
+		protectedSettings{},
+	}.validate())
+	require.Equal(t, errSuppressedSubstatusNamed, handlerSettings{
+		publicSettings{SuppressSubstatus: true, AdditionalSubstatusNames: []string{"Foo"}},
+		protectedSettings{},
+	}.validate())
+	require.Nil(t, handlerSettings{
+		publicSettings{SuppressSubstatus: true},
+		protectedSettings{},
+	}.validate())
+}
+
+func Test_handlerSettingsValidate_passthrough(t *testing.T) {
+	require.Equal(t, errPassthroughWithGraceAccounting, handlerSettings{
+		publicSettings{Passthrough: true, ExcludeGracePeriodProbes: true},
+		protectedSettings{},
+	}.validate())
+	require.Equal(t, errPassthroughWithCooldown, handlerSettings{
+		publicSettings{Passthrough: true, TransitionCooldownInSeconds: 60},
+		protectedSettings{},
+	}.validate())
+	require.Nil(t, handlerSettings{
+		publicSettings{Passthrough: true},
+		protectedSettings{},
+	}.validate())
+}
+
+func Test_handlerSettingsValidate_statusFormatVersion(t *testing.T) {
+	require.Equal(t, errLegacyFormatAdditionalNames, handlerSettings{
+		publicSettings{StatusFormatVersion: 1, AdditionalSubstatusNames: []string{"Other"}},
+		protectedSettings{},
+	}.validate())
+	require.Nil(t, handlerSettings{
+		publicSettings{StatusFormatVersion: 1, SubstatusName: "Renamed"},
+		protectedSettings{},
+	}.validate())
+}
+
+func Test_handlerSettingsValidate_expectedALPNProtocol(t *testing.T) {
+	require.Equal(t, errALPNRequiresHttps, handlerSettings{
+		publicSettings{Protocol: "http", ExpectedALPNProtocol: "h2"},
+		protectedSettings{},
+	}.validate())
+	require.Nil(t, handlerSettings{
+		publicSettings{Protocol: "https", ExpectedALPNProtocol: "h2"},
+		protectedSettings{},
+	}.validate())
+}
+
+func Test_handlerSettingsValidate_responseBodySchema(t *testing.T) {
+	require.Equal(t, errResponseSchemaRequiresHttp, handlerSettings{
+		publicSettings{Protocol: "tcp", Port: 80, ResponseBodySchema: json.RawMessage(`{"type": "object"}`)},
+		protectedSettings{},
+	}.validate())
+	err := handlerSettings{
+		publicSettings{Protocol: "http", ResponseBodySchema: json.RawMessage(`{"type": "nope"}`)},
+		protectedSettings{},
+	}.validate()
+	require.NotNil(t, err)
+	require.Contains(t, err.Error(), errInvalidResponseBodySchema.Error())
+
+	cfg := handlerSettings{
+		publicSettings{Protocol: "http", ResponseBodySchema: json.RawMessage(`{"type": "object"}`)},
+		protectedSettings{},
+	}
+	require.Nil(t, cfg.validate())
+	require.NotNil(t, cfg.responseBodySchema())
+	require.Nil(t, (&handlerSettings{}).responseBodySchema())
+}
+
+func Test_handlerSettingsValidate_addressPolicy(t *testing.T) {
+	require.Equal(t, errAddressPolicyWithSshTunnel, handlerSettings{
+		publicSettings{Protocol: "tcp", Port: 80, AddressPolicy: "all",
+			SshTunnel: &sshTunnelSettings{Host: "relay", User: "probe", HostPublicKey: "ssh-ed25519 AAAA"}},
+		protectedSettings{SshPrivateKey: "key"},
+	}.validate())
+	require.Nil(t, handlerSettings{
+		publicSettings{Protocol: "tcp", Port: 80, AddressPolicy: "all"},
+		protectedSettings{},
+	}.validate())
+}
+
+func Test_handlerSettingsValidate_persistState(t *testing.T) {
+	require.Equal(t, errMaxAgeRequiresPersistState, handlerSettings{
+		publicSettings{PersistedStateMaxAgeInSeconds: 3600},
+		protectedSettings{},
+	}.validate())
+	require.Nil(t, handlerSettings{
+		publicSettings{PersistState: true, PersistedStateMaxAgeInSeconds: 3600},
+		protectedSettings{},
+	}.validate())
+}
+
+func Test_handlerSettingsValidate_unixSocketPath(t *testing.T) {
+	require.Nil(t, handlerSettings{
+		publicSettings{Protocol: "tcp", UnixSocketPath: "/var/run/app.sock"},
+		protectedSettings{},
+	}.validate())
+	require.Equal(t, errMultiplePortSources, handlerSettings{
+		publicSettings{Protocol: "http", Port: 8080, UnixSocketPath: "/var/run/app.sock"},
+		protectedSettings{},
+	}.validate())
+	require.Equal(t, errSshTunnelWithPortSource, handlerSettings{
+		publicSettings{Protocol: "tcp", UnixSocketPath: "/var/run/app.sock",
+			SshTunnel: &sshTunnelSettings{Host: "relay", User: "probe", HostPublicKey: "ssh-ed25519 AAAA"}},
+		protectedSettings{SshPrivateKey: "key"},
+	}.validate())
+}
+
+func Test_handlerSettingsValidate_host(t *testing.T) {
+	require.Equal(t, "localhost", (&handlerSettings{}).host())
+	cfg := handlerSettings{publicSettings{Protocol: "http", Host: "10.0.1.4"}, protectedSettings{}}
+	require.Nil(t, cfg.validate())
+	require.Equal(t, "10.0.1.4", cfg.host())
+
+	require.Equal(t, errHostWithUnixSocket, handlerSettings{
+		publicSettings{Protocol: "http", Host: "10.0.1.4", UnixSocketPath: "/run/app.sock"},
+		protectedSettings{},
+	}.validate())
+	require.Equal(t, errIcmpWithPort, handlerSettings{
+		publicSettings{Protocol: "icmp", IcmpAddress: "10.0.1.4", Host: "10.0.1.4"},
+		protectedSettings{},
+	}.validate())
+}
+
+func Test_handlerSettingsValidate_interval(t *testing.T) {
+	require.Equal(t, defaultInterval, (&handlerSettings{}).interval())
+	require.Equal(t, 30*time.Second, (&handlerSettings{publicSettings: publicSettings{IntervalInSeconds: 30}}).interval())
+
+	burst := &confirmationBurstSettings{Probes: 3, IntervalInSeconds: 5}
+	require.Equal(t, errBurstIntervalNotShorter, handlerSettings{
+		publicSettings{ConfirmationBurst: burst},
+		protectedSettings{},
+	}.validate())
+	require.Nil(t, handlerSettings{
+		publicSettings{IntervalInSeconds: 10, ConfirmationBurst: burst},
+		protectedSettings{},
+	}.validate())
+	require.Equal(t, errOffsetExceedsInterval, errors.Cause(handlerSettings{
+		publicSettings{IntervalInSeconds: 10, Applications: []applicationSettings{
+			{Name: "web", Protocol: "tcp", Port: 80, OffsetInMilliseconds: 10000},
+		}},
+		protectedSettings{},
+	}.validate()))
+}
+
+func Test_handlerSettingsValidate_numberOfProbes(t *testing.T) {
+	require.Equal(t, defaultNumberOfProbes, (&handlerSettings{}).numberOfProbes())
+	require.Equal(t, 3, (&handlerSettings{publicSettings: publicSettings{NumberOfProbes: 3}}).numberOfProbes())
+
+	require.Nil(t, handlerSettings{
+		publicSettings{IntervalInSeconds: 10, NumberOfProbes: 12},
+		protectedSettings{},
+	}.validate())
+	require.Equal(t, errUnhealthyDetectionTooSlow, handlerSettings{
+		publicSettings{IntervalInSeconds: 10, NumberOfProbes: 13},
+		protectedSettings{},
+	}.validate())
+	require.Nil(t, handlerSettings{
+		publicSettings{NumberOfProbes: 24},
+		protectedSettings{},
+	}.validate(), "with the default interval")
+	require.Equal(t, errPassthroughWithThresholds, handlerSettings{
+		publicSettings{Passthrough: true, NumberOfProbes: 2},
+		protectedSettings{},
+	}.validate())
+}
+
+func Test_handlerSettingsValidate_healthyThreshold(t *testing.T) {
+	require.Equal(t, defaultHealthyThreshold, (&handlerSettings{}).healthyThreshold())
+	require.Equal(t, 3, (&handlerSettings{publicSettings: publicSettings{HealthyThreshold: 3}}).healthyThreshold())
+
+	require.Nil(t, handlerSettings{
+		publicSettings{NumberOfProbes: 2, HealthyThreshold: 3},
+		protectedSettings{},
+	}.validate())
+	require.Equal(t, errPassthroughWithThresholds, handlerSettings{
+		publicSettings{Passthrough: true, HealthyThreshold: 2},
+		protectedSettings{},
+	}.validate())
+}
+
+func Test_handlerSettingsValidate_probeTimeout(t *testing.T) {
+	require.Equal(t, defaultProbeTimeout, (&handlerSettings{}).probeTimeout())
+	require.Equal(t, 3*time.Second, (&handlerSettings{publicSettings: publicSettings{ProbeTimeoutInSeconds: 3}}).probeTimeout())
+
+	require.Nil(t, handlerSettings{
+		publicSettings{ProbeTimeoutInSeconds: 5},
+		protectedSettings{},
+	}.validate())
+	require.Equal(t, errProbeTimeoutExceedsInterval, handlerSettings{
+		publicSettings{ProbeTimeoutInSeconds: 6},
+		protectedSettings{},
+	}.validate())
+	require.Nil(t, handlerSettings{
+		publicSettings{IntervalInSeconds: 30, ProbeTimeoutInSeconds: 20},
+		protectedSettings{},
+	}.validate())
+}
+
+func Test_handlerSettingsValidate_gracePeriod(t *testing.T) {
+	require.Equal(t, time.Duration(0), (&handlerSettings{}).gracePeriod())
+	require.Equal(t, 5*time.Minute, (&handlerSettings{publicSettings: publicSettings{GracePeriodInSeconds: 300}}).gracePeriod())
+
+	require.Nil(t, handlerSettings{
+		publicSettings{GracePeriodInSeconds: 300, ExcludeGracePeriodProbes: true},
+		protectedSettings{},
+	}.validate())
+	require.Equal(t, errPassthroughWithGraceAccounting, handlerSettings{
+		publicSettings{Passthrough: true, GracePeriodInSeconds: 300},
+		protectedSettings{},
+	}.validate())
+}
+
+func Test_handlerSettingsValidate_requestHeaders(t *testing.T) {
+	cfg := handlerSettings{
+		publicSettings{Protocol: "https", RequestHeaders: map[string]string{"x-probe": "azure", "X-Api-Key": "secret"}},
+		protectedSettings{},
+	}
+	require.Nil(t, cfg.validate())
+	require.Equal(t, "azure", cfg.requestHeaders().Get("X-Probe"))
+	require.Nil(t, (&handlerSettings{}).requestHeaders())
+
+	require.Equal(t, errRequestHeadersRequireHttp, handlerSettings{
+		publicSettings{Protocol: "tcp", Port: 80, RequestHeaders: map[string]string{"X-Probe": "azure"}},
+		protectedSettings{},
+	}.validate())
+	require.Equal(t, errRequestHeaderHost, handlerSettings{
+		publicSettings{Protocol: "http", RequestHeaders: map[string]string{"host": "example.com"}},
+		protectedSettings{},
+	}.validate())
+}
+
+func Test_handlerSettingsValidate_redirects(t *testing.T) {
+	require.Equal(t, 0, (&handlerSettings{}).maxRedirects())
+	require.Equal(t, defaultMaxRedirects, (&handlerSettings{publicSettings: publicSettings{FollowRedirects: true}}).maxRedirects())
+	cfg := handlerSettings{publicSettings{Protocol: "http", FollowRedirects: true, MaxRedirects: 3}, protectedSettings{}}
+	require.Nil(t, cfg.validate())
+	require.Equal(t, 3, cfg.maxRedirects())
+
+	require.Equal(t, errFollowRedirectsRequireHttp, handlerSettings{
+		publicSettings{Protocol: "tcp", Port: 80, FollowRedirects: true},
+		protectedSettings{},
+	}.validate())
+	require.Equal(t, errMaxRedirectsWithoutFollow, handlerSettings{
+		publicSettings{Protocol: "http", MaxRedirects: 3},
+		protectedSettings{},
+	}.validate())
+}
+
+func Test_handlerSettingsValidate_hostHeader(t *testing.T) {
+	cfg := handlerSettings{publicSettings{Protocol: "http", HostHeader: "app.contoso.com"}, protectedSettings{}}
+	require.Nil(t, cfg.validate())
+	require.Equal(t, "app.contoso.com", cfg.hostHeader())
+
+	require.Equal(t, errHostHeaderRequiresHttp, handlerSettings{
+		publicSettings{Protocol: "grpc", Port: 50051, HostHeader: "app.contoso.com"},
+		protectedSettings{},
+	}.validate())
+}
+
+func Test_handlerSettingsValidate_httpMethod(t *testing.T) {
+	require.Equal(t, "GET", (&handlerSettings{}).httpMethod())
+
+	cfg := handlerSettings{
+		publicSettings{Protocol: "http", HttpMethod: "POST", RequestBody: `{"ping": true}`},
+		protectedSettings{},
+	}
+	require.Nil(t, cfg.validate())
+	require.Equal(t, "POST", cfg.httpMethod())
+	require.Equal(t, `{"ping": true}`, cfg.requestBody())
+
+	require.Equal(t, errHttpMethodRequiresHttp, handlerSettings{
+		publicSettings{Protocol: "tcp", Port: 80, HttpMethod: "HEAD"},
+		protectedSettings{},
+	}.validate())
+	require.Equal(t, errRequestBodyRequiresPost, handlerSettings{
+		publicSettings{Protocol: "http", RequestBody: "ping"},
+		protectedSettings{},
+	}.validate())
+	require.Equal(t, errHeadWithResponseCheck, handlerSettings{
+		publicSettings{Protocol: "http", HttpMethod: "HEAD", ResponseBodySchema: json.RawMessage(`{"type": "object"}`)},
+		protectedSettings{},
+	}.validate())
+}
+
+func Test_handlerSettingsValidate_responseBodyRegex(t *testing.T) {
+	cfg := handlerSettings{
+		publicSettings{Protocol: "http", ResponseBodyRegex: `"status"\s*:\s*"UP"`},
+		protectedSettings{},
+	}
+	require.Nil(t, cfg.validate())
+	require.True(t, cfg.responseBodyRegex().MatchString(`{"status": "UP"}`))
+	require.Nil(t, (&handlerSettings{}).responseBodyRegex())
+
+	require.Equal(t, errResponseRegexRequiresHttp, handlerSettings{
+		publicSettings{Protocol: "tcp", Port: 80, ResponseBodyRegex: "UP"},
+		protectedSettings{},
+	}.validate())
+	err := handlerSettings{
+		publicSettings{Protocol: "http", ResponseBodyRegex: "(UP"},
+		protectedSettings{},
+	}.validate()
+	require.NotNil(t, err)
+	require.Contains(t, err.Error(), errInvalidResponseBodyRegex.Error())
+	require.Equal(t, errHeadWithResponseCheck, handlerSettings{
+		publicSettings{Protocol: "http", HttpMethod: "HEAD", ResponseBodyRegex: "UP"},
+		protectedSettings{},
+	}.validate())
+}
+
+func Test_handlerSettingsValidate_reportVMMetadata(t *testing.T) {
+	require.Equal(t, errVMMetadataSubstatusUnavailable, handlerSettings{
+		publicSettings{ReportVMMetadata: true, SuppressSubstatus: true},
+		protectedSettings{},
+	}.validate())
+	require.Equal(t, errVMMetadataSubstatusUnavailable, handlerSettings{
+		publicSettings{ReportVMMetadata: true, StatusFormatVersion: 1},
+		protectedSettings{},
+	}.validate())
+	require.Nil(t, handlerSettings{
+		publicSettings{ReportVMMetadata: true},
+		protectedSettings{},
+	}.validate())
+}
+
+func Test_handlerSettingsValidate_systemdSocket(t *testing.T) {
+	require.Equal(t, errMultiplePortSources, handlerSettings{
+		publicSettings{Protocol: "tcp", Port: 80, SystemdSocket: "app.socket"},
+		protectedSettings{},
+	}.validate())
+
+	require.Nil(t, handlerSettings{
+		publicSettings{Protocol: "tcp", SystemdSocket: "app.socket"},
+		protectedSettings{},
+	}.validate())
+}
+
+func Test_handlerSettingsValidate_portFile(t *testing.T) {
+	require.Equal(t, errMultiplePortSources, handlerSettings{
+		publicSettings{Protocol: "tcp", Port: 80, PortFile: "/run/app/port"},
+		protectedSettings{},
+	}.validate())
+
+	require.Equal(t, errMultiplePortSources, handlerSettings{
+		publicSettings{Protocol: "http", SystemdSocket: "app.socket", PortFile: "/run/app/port"},
+		protectedSettings{},
+	}.validate())
+
+	require.Nil(t, handlerSettings{
+		publicSettings{Protocol: "tcp", PortFile: "/run/app/port"},
+		protectedSettings{},
+	}.validate())
+}
+
+func Test_handlerSettingsValidate_allowedTargets(t *testing.T) {
+	err := handlerSettings{
+		publicSettings{Protocol: "tcp", Port: 80, AllowedTargets: []string{"10.0.0.0/40"}},
+		protectedSettings{},
+	}.validate()
+	require.Equal(t, errInvalidAllowedTarget, errors.Cause(err))
+
+	require.Nil(t, handlerSettings{
+		publicSettings{Protocol: "tcp", Port: 80, AllowedTargets: []string{"10.0.0.0/8"}},
+		protectedSettings{},
+	}.validate())
+}
+
+func Test_handlerSettingsValidate_sshTunnel(t *testing.T) {
+	tunnel := &sshTunnelSettings{Host: "10.1.0.4", User: "probe", HostPublicKey: "ssh-ed25519 AAAA"}
+
+	require.Nil(t, handlerSettings{
+		publicSettings{Protocol: "tcp", Port: 80, SshTunnel: tunnel},
+		protectedSettings{SshPrivateKey: "KEY"},
+	}.validate())
+
+	require.Equal(t, errSshTunnelRequiresKey, handlerSettings{
+		publicSettings{Protocol: "tcp", Port: 80, SshTunnel: tunnel},
+		protectedSettings{},
+	}.validate())
+
+	require.Equal(t, errSshKeyRequiresTunnel, handlerSettings{
+		publicSettings{Protocol: "tcp", Port: 80},
+		protectedSettings{SshPrivateKey: "KEY"},
+	}.validate())
+
+	require.Equal(t, errSshTunnelWithPortSource, handlerSettings{
+		publicSettings{Protocol: "tcp", PortFile: "/run/app/port", SshTunnel: tunnel},
+		protectedSettings{SshPrivateKey: "KEY"},
+	}.validate())
+
+	require.Equal(t, errSshTunnelHostNotAllowed, handlerSettings{
+		publicSettings{Protocol: "tcp", Port: 80, SshTunnel: tunnel, AllowedTargets: []string{"10.2.0.0/16"}},
+		protectedSettings{SshPrivateKey: "KEY"},
+	}.validate())
+
+	require.Nil(t, handlerSettings{
+		publicSettings{Protocol: "tcp", Port: 80, SshTunnel: tunnel, AllowedTargets: []string{"10.1.0.0/16"}},
+		protectedSettings{SshPrivateKey: "KEY"},
+	}.validate())
+}
+
+// parseTestSettings parses and validates the public settings as enable does.
+func parseTestSettings(t *testing.T, publicSettings string) handlerSettings {
+	dir, err := ioutil.TempDir("", "")
+	require.Nil(t, err)
+	defer os.RemoveAll(dir)
+	require.Nil(t, ioutil.WriteFile(filepath.Join(dir, "0.settings"),
+		[]byte(`{"runtimeSettings":[{"handlerSettings":{"publicSettings":`+publicSettings+`}}]}`), 0600))
+	h, err := parseAndValidateSettings(log.NewContext(log.NewNopLogger()), dir)
+	require.Nil(t, err)
+	return h
+}
+
+func Test_parseAndValidateSettings_flatProbeMigrated(t *testing.T) {
+	parse := func(publicSettings string) handlerSettings { return parseTestSettings(t, publicSettings) }
+
+	flat := parse(`{"protocol":"http","port":8080,"requestPath":"health","numberOfProbes":2}`)
+	probes := parse(`{"probes":[{"protocol":"http","port":8080,"requestPath":"health"}],"numberOfProbes":2}`)
+	require.Equal(t, probes, flat)
+	require.False(t, flat.hasTopLevelProbe())
+	require.Len(t, monitoredSettings(&flat), 1)
+	require.Equal(t, flatProbeName, monitoredSettings(&flat)[0].name)
+}
@@ -1,72 +1,375 @@
 package main
 
 import (
+	"context"
 	"crypto/tls"
+	stderrors "errors"
+	"io"
 	"net"
 	"net/http"
+	"regexp"
 	"strconv"
+	"strings"
 	"time"
 
 	"github.com/go-kit/kit/log"
 	"github.com/pkg/errors"
+	"github.com/xeipuuv/gojsonschema"
 )
 
 type HealthStatus string
 
+const (
+	// defaultProbeTimeout bounds a single tcp connect or http request unless
+	// probeTimeoutInSeconds is set.
+	defaultProbeTimeout = 30 * time.Second
+
+	// maxRetryAfter caps how long an application can suspend probing with
+	// Retry-After, so that an application stuck in that state is noticed.
+	maxRetryAfter = 5 * time.Minute
+)
+
 const (
 	Healthy   HealthStatus = "healthy"
 	Unhealthy HealthStatus = "unhealthy"
+
+	// Degraded is reported for an application responding but reporting
+	// itself degraded, or asking for probes to back off because it is
+	// overloaded.
+	Degraded HealthStatus = "degraded"
+
+	// Initializing is reported for an application starting up, until it is
+	// found healthy or its grace period is over.
+	Initializing HealthStatus = "initializing"
+
+	// Unknown is reported when the probe itself fails, e.g. the probed
+	// address cannot be resolved, so the health of the application is not
+	// known.
+	Unknown HealthStatus = "unknown"
 )
 
 type HealthProbe interface {
-	evaluate(ctx *log.Context) (HealthStatus, error)
+	evaluate(probeCtx context.Context, ctx *log.Context) (HealthStatus, error)
 	address() string
 }
 
+// dialFunc connects to the address on the named network.
+type dialFunc func(ctx context.Context, network, addr string) (net.Conn, error)
+
 type TcpHealthProbe struct {
 	Address string
+	Dial    dialFunc
+	Timeout time.Duration // defaultProbeTimeout if 0
 }
 
 type HttpHealthProbe struct {
 	HttpClient *http.Client
 	Address    string
+
+	// HonorRetryAfter makes backpressure responses degraded rather than
+	// unhealthy, and delays probing as requested by the application.
+	HonorRetryAfter bool
+	backoffUntil    time.Time
+
+	// ExpectedALPN is the protocol the TLS handshake must negotiate, e.g.
+	// "h2", or "" if the negotiated protocol is not checked.
+	ExpectedALPN string
+	// ExpiryThreshold is how long the server certificate must remain valid
+	// for, or 0 if its expiry is not checked.
+	ExpiryThreshold time.Duration
+
+	// ResponseSchema is the JSON Schema the response body must match, or nil
+	// if the body is not validated.
+	ResponseSchema *gojsonschema.Schema
+
+	// ResponseRegex is the regular expression the response body must match,
+	// or nil if the body is not matched.
+	ResponseRegex *regexp.Regexp
+
+	// ResponseJsonPath selects the value of the JSON response body which must
+	// equal ExpectedValue, or is nil if no value is compared.
+	ResponseJsonPath *jsonPath
+	ExpectedValue    interface{}
+
+	// Headers are sent with every request in addition to the User-Agent,
+	// which they may override.
+	Headers http.Header
+	// HostHeader is the Host header of the requests, e.g. the virtual host a
+	// reverse proxy routes by, or "" for the host of Address.
+	HostHeader string
+
+	// Method is the method of the requests, GET if "", and Body the body
+	// sent with them.
+	Method string
+	Body   string
+
+	// Username and Password are the basic auth credentials of the requests,
+	// or "" if requests are anonymous.
+	Username, Password string
+	// Tokens provides the bearer token of the requests, or is nil.
+	Tokens tokenSource
+
+	// ExpectedStatusCodes are the status codes of a healthy application, 200
+	// if nil.
+	ExpectedStatusCodes statusCodes
+}
+
+// NewHealthProbes creates a probe for each monitored application, in the order
+// of monitoredSettings.
+func NewHealthProbes(ctx *log.Context, cfg *handlerSettings) []HealthProbe {
+	var probes []HealthProbe
+	for _, s := range monitoredSettings(cfg) {
+		if s.name != "" {
+			ctx.Log("event", "creating probe for application "+s.name)
+		}
+		probes = append(probes, NewHealthProbe(ctx, s.cfg))
+	}
+	return probes
 }
 
 func NewHealthProbe(ctx *log.Context, cfg *handlerSettings) HealthProbe {
+	var p HealthProbe
+	var resolve portResolver
+	if unit := cfg.systemdSocket(); unit != "" {
+		ctx.Log("event", "resolving probed port from systemd socket "+unit)
+		resolve = systemdSocketPort(unit)
+	} else if path := cfg.portFile(); path != "" {
+		ctx.Log("event", "resolving probed port from file "+path)
+		resolve = filePort(path)
+	}
+	if resolve != nil {
+		p = newResolvingProbe(resolve, func(port int) HealthProbe {
+			return newProbe(ctx, cfg, port)
+		})
+	} else {
+		p = newProbe(ctx, cfg, cfg.port())
+	}
+
+	if c := cfg.systemChecks(); c != nil {
+		ctx.Log("event", "degrading the application health while the VM is short of resources",
+			"maxCpuPercent", c.MaxCpuPercent, "minAvailableMemoryInMB", c.MinAvailableMemoryInMB, "maxPressurePercent", c.MaxPressurePercent)
+		p = newSystemCheckingProbe(p, c)
+	}
+
+	if f := cfg.faultInjection(); f != nil {
+		ctx.Log("event", "WARNING: fault injection enabled, probe results will be tampered with",
+			"failureRate", f.FailureRate, "timeoutRate", f.TimeoutRate, "latencyInMilliseconds", f.LatencyInMilliseconds)
+		p = newFaultInjectingProbe(p, f, cfg.probeTimeout())
+	}
+	return p
+}
+
+// newProbe creates the probe of the configured protocol targeting port.
+func newProbe(ctx *log.Context, cfg *handlerSettings, port int) HealthProbe {
 	var p HealthProbe
 	p = new(DefaultHealthProbe)
 
 	switch cfg.protocol() {
 	case "tcp":
-		p = &TcpHealthProbe{
-			Address: "localhost:" + strconv.Itoa(cfg.port()),
+		if cfg.passiveListenCheck() {
+			p = &ListenHealthProbe{Port: port, IPVersion: cfg.ipVersion()}
+			ctx.Log("event", "creating passive tcp probe checking sockets listening on "+p.address())
+			break
+		}
+		tp := &TcpHealthProbe{Address: net.JoinHostPort(cfg.host(), strconv.Itoa(port)), Timeout: cfg.probeTimeout()}
+		if path := cfg.unixSocketPath(); path != "" {
+			tp.Address = "unix:" + path
 		}
+		dial, err := newDialer(ctx, cfg)
+		if err != nil {
+			return &brokenProbe{tp.Address, err}
+		}
+		tp.Dial = dial
+		p = tp
 		ctx.Log("event", "creating tcp probe targeting "+p.address())
 	case "http":
 		fallthrough
 	case "https":
-		p = NewHttpHealthProbe(cfg.protocol(), cfg.requestPath(), cfg.port())
+		hp := NewHttpHealthProbe(cfg.protocol(), cfg.host(), cfg.requestPath(), port)
+		hp.HttpClient.Timeout = cfg.probeTimeout()
+		dial, err := newDialer(ctx, cfg)
+		if err != nil {
+			return &brokenProbe{hp.Address, err}
+		}
+		hp.HttpClient.Transport.(*http.Transport).DialContext = dial
+		hp.HttpClient.Transport.(*http.Transport).Proxy = cfg.proxy()
+		if cfg.protocol() == "https" {
+			if err := cfg.configureTLS(hp.HttpClient.Transport.(*http.Transport).TLSClientConfig); err != nil {
+				return &brokenProbe{hp.Address, err}
+			}
+		}
+		hp.HttpClient.CheckRedirect = redirectPolicy(cfg.maxRedirects())
+		hp.ExpiryThreshold = cfg.certificateExpiryThreshold()
+		hp.HonorRetryAfter = cfg.honorRetryAfter()
+		if alpn := cfg.expectedALPNProtocol(); alpn != "" {
+			hp.expectALPN(alpn)
+		}
+		hp.ResponseSchema = cfg.responseBodySchema()
+		hp.ResponseRegex = cfg.responseBodyRegex()
+		hp.ResponseJsonPath, hp.ExpectedValue = cfg.responseJsonPath(), cfg.expectedValue()
+		hp.Headers, hp.HostHeader = cfg.requestHeaders(), cfg.hostHeader()
+		hp.Method, hp.Body = cfg.httpMethod(), cfg.requestBody()
+		hp.Username, hp.Password, _ = cfg.basicAuth()
+		hp.Tokens = cfg.tokenSource()
+		hp.ExpectedStatusCodes = cfg.expectedStatusCodes()
+		p = hp
 		ctx.Log("event", "creating "+cfg.protocol()+" probe targeting "+p.address())
+	case "grpc":
+		gp := NewGrpcHealthProbe(cfg.host(), port, cfg.grpcService())
+		gp.HttpClient.Timeout = cfg.probeTimeout()
+		dial, err := newDialer(ctx, cfg)
+		if err != nil {
+			return &brokenProbe{gp.Address, err}
+		}
+		gp.HttpClient.Transport.(*http.Transport).DialContext = dial
+		p = gp
+		ctx.Log("event", "creating grpc probe targeting "+p.address(), "service", gp.Service)
+	case "udp":
+		payload, expected, _ := cfg.udpPayload() // checked by validate
+		up := &UdpHealthProbe{
+			Address:  net.JoinHostPort(cfg.host(), strconv.Itoa(port)),
+			Payload:  payload,
+			Expected: expected,
+			Timeout:  cfg.probeTimeout(),
+		}
+		dial, err := newDialer(ctx, cfg)
+		if err != nil {
+			return &brokenProbe{up.Address, err}
+		}
+		up.Dial = dial
+		p = up
+		ctx.Log("event", "creating udp probe targeting "+p.address())
+	case "icmp":
+		host, count, timeout := cfg.icmp()
+		p = &IcmpHealthProbe{Host: host, Count: count, Timeout: timeout, Allowlist: cfg.targetAllowlist(), IPVersion: cfg.ipVersion()}
+		ctx.Log("event", "creating icmp probe targeting "+p.address())
+	case "tls":
+		tp := &TlsHealthProbe{Address: net.JoinHostPort(cfg.host(), strconv.Itoa(port)), Config: &tls.Config{}, Timeout: cfg.probeTimeout()}
+		if path := cfg.unixSocketPath(); path != "" {
+			tp.Address = "unix:" + path
+		}
+		dial, err := newDialer(ctx, cfg)
+		if err != nil {
+			return &brokenProbe{tp.Address, err}
+		}
+		tp.Dial = dial
+		if err := cfg.configureTLS(tp.Config); err != nil {
+			return &brokenProbe{tp.Address, err}
+		}
+		tp.ExpiryThreshold = cfg.certificateExpiryThreshold()
+		p = tp
+		ctx.Log("event", "creating tls probe targeting "+p.address())
+	case "dns":
+		if port == 0 {
+			port = defaultDnsPort
+		}
+		dp := &DnsHealthProbe{Server: net.JoinHostPort(cfg.host(), strconv.Itoa(port)), Name: cfg.dnsName(), Timeout: cfg.probeTimeout()}
+		dial, err := newDialer(ctx, cfg)
+		if err != nil {
+			return &brokenProbe{dp.Server, err}
+		}
+		dp.Dial = dial
+		p = dp
+		ctx.Log("event", "creating dns probe resolving "+dp.Name+" against "+p.address())
+	case "exec":
+		ep := &ExecHealthProbe{Command: cfg.command(), Timeout: cfg.probeTimeout()}
+		ep.User, ep.Env, ep.CaptureOutput = cfg.commandSandbox()
+		p = ep
+		ctx.Log("event", "creating exec probe running "+p.address())
+	case "file":
+		path, maxAge := cfg.heartbeatFile()
+		p = &FileHealthProbe{Path: path, MaxAge: maxAge}
+		ctx.Log("event", "creating file probe checking "+p.address())
+	case "systemd":
+		p = &SystemdHealthProbe{Unit: cfg.systemdUnit(), Timeout: cfg.probeTimeout()}
+		ctx.Log("event", "creating systemd probe checking unit "+p.address())
+	case "docker":
+		name, socket := cfg.container()
+		p = NewDockerHealthProbe(socket, name, cfg.probeTimeout())
+		ctx.Log("event", "creating docker probe inspecting container "+p.address(), "socket", socket)
+	case "process":
+		pidFile, pattern := cfg.process()
+		p = &ProcessHealthProbe{PidFile: pidFile, Pattern: pattern}
+		ctx.Log("event", "creating process probe checking "+p.address())
 	default:
 		ctx.Log("event", "default settings without probe")
 	}
-
 	return p
 }
 
-func (p *TcpHealthProbe) evaluate(ctx *log.Context) (HealthStatus, error) {
-	conn, err := net.DialTimeout("tcp", p.address(), 30*time.Second)
+// newDialer returns the function probes connect with: to the unix socket or
+// through the ssh tunnel if one is configured, otherwise directly to the
+// allowed targets, following the address policy if any.
+func newDialer(ctx *log.Context, cfg *handlerSettings) (dialFunc, error) {
+	if path := cfg.unixSocketPath(); path != "" {
+		ctx.Log("event", "connecting to unix socket "+path)
+		return unixSocketDialer(path), nil
+	}
+	s := cfg.sshTunnel()
+	if s == nil {
+		if policy := cfg.addressPolicy(); policy != "" {
+			ctx.Log("event", "connecting to the probe target addresses with policy "+policy)
+			return withIPVersion(newAddressPolicyDialer(ctx, policy, cfg.targetAllowlist()).dialContext, cfg.ipVersion()), nil
+		}
+		return withIPVersion(cfg.targetAllowlist().dialContext, cfg.ipVersion()), nil
+	}
+	t, err := newSshTunnel(*s, cfg.sshPrivateKey(), dataDir)
 	if err != nil {
-		return Unhealthy, nil
+		ctx.Log("event", "failed to set up ssh tunnel", "error", err)
+		return nil, errors.Wrap(err, "failed to set up ssh tunnel")
+	}
+	ctx.Log("event", "tunneling probes through ssh relay "+s.Host)
+	return t.dialContext, nil
+}
+
+// brokenProbe is a probe which could not be set up. It fails every evaluation
+// with the setup error, which is a failure of the extension, not of the
+// application.
+type brokenProbe struct {
+	Address string
+	err     error
+}
+
+func (p *brokenProbe) evaluate(probeCtx context.Context, ctx *log.Context) (HealthStatus, error) {
+	return Unknown, p.err
+}
+
+func (p *brokenProbe) address() string {
+	return p.Address
+}
+
+// unixSocketDialer returns a dialFunc connecting to the unix socket at path
+// whatever the address.
+func unixSocketDialer(path string) dialFunc {
+	return func(ctx context.Context, _, _ string) (net.Conn, error) {
+		return (&net.Dialer{}).DialContext(ctx, "unix", path)
 	}
+}
 
-	tcpConn, ok := conn.(*net.TCPConn)
-	if !ok {
-		return Unhealthy, errUnableToConvertType
+func (p *TcpHealthProbe) evaluate(probeCtx context.Context, ctx *log.Context) (HealthStatus, error) {
+	timeout := p.Timeout
+	if timeout == 0 {
+		timeout = defaultProbeTimeout
+	}
+	dialCtx, cancel := context.WithTimeout(probeCtx, timeout)
+	defer cancel()
+	dial := p.Dial
+	if dial == nil {
+		dial = (&net.Dialer{}).DialContext
+	}
+	conn, err := dial(dialCtx, "tcp", p.address())
+	if err != nil {
+		if err := resolutionError(err); err != nil {
+			return Unknown, err
+		}
+		logDebug(ctx, "event", "probe connection failed", "address", p.address(), "reason", err)
+		return Unhealthy, nil
 	}
 
-	tcpConn.SetLinger(0)
-	tcpConn.Close()
+	if tcpConn, ok := conn.(*net.TCPConn); ok {
+		tcpConn.SetLinger(0)
+	}
+	conn.Close()
 	return Healthy, nil
 }
 
@@ -74,67 +377,180 @@ func (p *TcpHealthProbe) address() string {
 	return p.Address
 }
 
-func NewHttpHealthProbe(protocol string, requestPath string, port int) *HttpHealthProbe {
+func NewHttpHealthProbe(protocol string, host string, requestPath string, port int) *HttpHealthProbe {
 	p := new(HttpHealthProbe)
 
-	timeout := time.Duration(30 * time.Second)
+	timeout := defaultProbeTimeout
 
-	var transport *http.Transport
+	transport := &http.Transport{}
 	if protocol == "https" {
-		transport = &http.Transport{
-			// Ignore authentication/certificate failures - just validate that the localhost
-			// endpoint responds with HTTP.OK
-			TLSClientConfig: &tls.Config{InsecureSkipVerify: true},
-		}
-
-		p.HttpClient = &http.Client{
-			CheckRedirect: noRedirect,
-			Timeout:       timeout,
-			Transport:     transport,
-		}
-	} else if protocol == "http" {
-		p.HttpClient = &http.Client{
-			CheckRedirect: noRedirect,
-			Timeout:       timeout,
-		}
+		// Ignore authentication/certificate failures - just validate that the
+		// endpoint responds with HTTP.OK
+		transport.TLSClientConfig = &tls.Config{InsecureSkipVerify: true}
+	}
+	p.HttpClient = &http.Client{
+		CheckRedirect: redirectPolicy(0),
+		Timeout:       timeout,
+		Transport:     transport,
 	}
 
-	portString := ""
-	if protocol == "http" && port != 0 && port != 80 {
-		portString = ":" + strconv.Itoa(port)
-	} else if protocol == "https" && port != 0 && port != 443 {
-		portString = ":" + strconv.Itoa(port)
+	hostPort := host
+	if (protocol == "http" && port != 0 && port != 80) || (protocol == "https" && port != 0 && port != 443) {
+		hostPort = net.JoinHostPort(host, strconv.Itoa(port))
+	} else if strings.Contains(host, ":") {
+		hostPort = "[" + host + "]" // IPv6 literal
 	}
 
-	p.Address = protocol + "://localhost" + portString + "/" + requestPath
+	p.Address = protocol + "://" + hostPort + "/" + requestPath
 	return p
 }
 
-func (p *HttpHealthProbe) evaluate(ctx *log.Context) (HealthStatus, error) {
-	req, err := http.NewRequest("GET", p.address(), nil)
+// expectALPN makes the probe offer h2 besides http/1.1 in the TLS handshake
+// and require the given protocol to be negotiated.
+func (p *HttpHealthProbe) expectALPN(protocol string) {
+	// a custom dialer disables HTTP/2 unless forced
+	p.HttpClient.Transport.(*http.Transport).ForceAttemptHTTP2 = true
+	p.ExpectedALPN = protocol
+}
+
+func (p *HttpHealthProbe) evaluate(probeCtx context.Context, ctx *log.Context) (HealthStatus, error) {
+	if time.Now().Before(p.backoffUntil) {
+		// the application asked not to be probed until then
+		return Degraded, nil
+	}
+
+	method := p.Method
+	if method == "" {
+		method = http.MethodGet
+	}
+	var body io.Reader
+	if p.Body != "" {
+		body = strings.NewReader(p.Body)
+	}
+	req, err := http.NewRequestWithContext(probeCtx, method, p.address(), body)
 	if err != nil {
 		return Unhealthy, err
 	}
 
 	req.Header.Set("User-Agent", "ApplicationHealthExtension/1.0")
+	for name, values := range p.Headers {
+		req.Header[name] = values
+	}
+	if p.HostHeader != "" {
+		req.Host = p.HostHeader
+	}
+	if err := p.authenticate(req); err != nil {
+		// the health of the application is not known without credentials
+		return Unknown, errors.Wrap(err, "failed to authenticate probe")
+	}
+	logDebug(ctx, "event", "probe request", "method", method, "url", req.URL, "host", req.Host, "headers", headerNames(req.Header))
+	var tracer *phaseTracer
+	if logFilter.enabled(levelDebug) {
+		req, tracer = traceRequest(req)
+		defer func() {
+			t := tracer.result()
+			probeTimings.record(p.address(), t)
+			logDebug(ctx, "event", "probe timing", "url", req.URL, "dnsLookup", t.DNSLookup, "tcpConnect", t.TCPConnect,
+				"tlsHandshake", t.TLSHandshake, "timeToFirstByte", t.FirstByte, "reusedConnection", t.ReusedConnection)
+		}()
+	}
 	resp, err := p.HttpClient.Do(req)
 	if err != nil {
+		if err := resolutionError(err); err != nil {
+			return Unknown, err
+		}
+		logDebug(ctx, "event", "probe request failed", "url", req.URL, "reason", err)
+		if stderrors.Is(err, errTooManyRedirects) {
+			ctx.Log("event", "too many redirects", "error", err)
+		}
+		return Unhealthy, nil
+	}
+	defer resp.Body.Close()
+	logDebug(ctx, "event", "probe response", "url", req.URL, "status", resp.Status, "proto", resp.Proto, "headers", resp.Header)
+	if resp.StatusCode == http.StatusUnauthorized && p.Tokens != nil {
+		// e.g. revoked, a new token is requested by the next probe
+		p.Tokens.invalidate()
+	}
+
+	if resp.TLS != nil && !checkCertificateExpiry(ctx, req.URL.Host, resp.TLS, p.ExpiryThreshold) {
+		return Unhealthy, nil
+	}
+
+	if p.ExpectedALPN != "" && (resp.TLS == nil || resp.TLS.NegotiatedProtocol != p.ExpectedALPN) {
+		negotiated := ""
+		if resp.TLS != nil {
+			negotiated = resp.TLS.NegotiatedProtocol
+		}
+		ctx.Log("event", "unexpected ALPN protocol", "expected", p.ExpectedALPN, "negotiated", negotiated)
 		return Unhealthy, nil
 	}
 
-	if resp.StatusCode == http.StatusOK {
+	expected := p.ExpectedStatusCodes
+	if expected == nil {
+		expected = defaultStatusCodes
+	}
+	if expected.contains(resp.StatusCode) {
+		body, err := readResponseBody(resp.Body)
+		logDebug(ctx, "event", "probe response body", "url", req.URL, "body", truncateMiddle(string(body), maxDebugBodyLength))
+		if p.inspectsBody() {
+			if err == nil {
+				err = p.checkResponseBody(body)
+			}
+			if err != nil {
+				ctx.Log("event", "invalid health response", "error", err)
+				return Unhealthy, nil
+			}
+		}
+		// the application may report a richer state than the status code
+		state, reported, err := parseReportedState(body)
+		if err != nil {
+			ctx.Log("event", "invalid reported health state", "error", err)
+			return Unhealthy, nil
+		}
+		if reported {
+			return state, nil
+		}
 		return Healthy, nil
 	}
 
+	if p.HonorRetryAfter && (resp.StatusCode == http.StatusTooManyRequests || resp.StatusCode == http.StatusServiceUnavailable) {
+		if d, ok := parseRetryAfter(resp.Header.Get("Retry-After"), time.Now()); ok {
+			ctx.Log("event", "application asked to back off", "status", resp.StatusCode, "retryAfter", d)
+			p.backoffUntil = time.Now().Add(d)
+			return Degraded, nil
+		}
+	}
+
 	return Unhealthy, nil
 }
 
+// parseRetryAfter parses the value of a Retry-After header, given either in
+// seconds or as a date, into the delay from now, capped at maxRetryAfter.
+func parseRetryAfter(v string, now time.Time) (time.Duration, bool) {
+	var d time.Duration
+	if secs, err := strconv.Atoi(strings.TrimSpace(v)); err == nil {
+		d = time.Duration(secs) * time.Second
+	} else if t, err := http.ParseTime(v); err == nil {
+		d = t.Sub(now)
+	} else {
+		return 0, false
+	}
+	if d < 0 {
+		d = 0
+	}
+	if d > maxRetryAfter {
+		d = maxRetryAfter
+	}
+	return d, true
+}
+
 func (p *HttpHealthProbe) address() string {
 	return p.Address
 }
 
 var (
 	errNoRedirect          = errors.New("No redirect allowed")
+	errTooManyRedirects    = errors.New("too many redirects")
 	errUnableToConvertType = errors.New("Unable to convert type")
 )
 
@@ -142,10 +558,35 @@ func noRedirect(req *http.Request, via []*http.Request) error {
 	return errNoRedirect
 }
 
+// redirectPolicy returns the CheckRedirect function of http probes following
+// up to max redirects. If max is 0, redirects are not followed and the status
+// code of the redirect response is checked instead.
+func redirectPolicy(max int) func(*http.Request, []*http.Request) error {
+	return func(req *http.Request, via []*http.Request) error {
+		if max == 0 {
+			return http.ErrUseLastResponse
+		}
+		if len(via) > max {
+			return errTooManyRedirects
+		}
+		return nil
+	}
+}
+
+// resolutionError returns the failure to resolve the probed address that err
+// is caused by, a failure of the probe rather than of the application, or nil.
+func resolutionError(err error) error {
+	var dnsErr *net.DNSError
+	if stderrors.As(err, &dnsErr) {
+		return errors.Wrap(dnsErr, "failed to resolve the probed address")
+	}
+	return nil
+}
+
 type DefaultHealthProbe struct {
 }
 
-func (p DefaultHealthProbe) evaluate(ctx *log.Context) (HealthStatus, error) {
+func (p DefaultHealthProbe) evaluate(probeCtx context.Context, ctx *log.Context) (HealthStatus, error) {
 	return Healthy, nil
 }
 
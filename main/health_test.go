@@ -0,0 +1,409 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"regexp"
+	"testing"
+	"time"
+
+	"github.com/go-kit/kit/log"
+	"github.com/stretchr/testify/require"
+)
+
+func Test_parseRetryAfter(t *testing.T) {
+	now := time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	d, ok := parseRetryAfter("30", now)
+	require.True(t, ok)
+	require.Equal(t, 30*time.Second, d)
+
+	d, ok = parseRetryAfter(now.Add(2*time.Minute).Format(http.TimeFormat), now)
+	require.True(t, ok)
+	require.Equal(t, 2*time.Minute, d)
+
+	d, ok = parseRetryAfter("86400", now)
+	require.True(t, ok)
+	require.Equal(t, maxRetryAfter, d, "capped")
+
+	_, ok = parseRetryAfter("soon", now)
+	require.False(t, ok)
+	_, ok = parseRetryAfter("", now)
+	require.False(t, ok)
+}
+
+func Test_HttpHealthProbe_retryAfter(t *testing.T) {
+	ctx := log.NewContext(log.NewNopLogger())
+	requests := 0
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		w.Header().Set("Retry-After", "60")
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer srv.Close()
+
+	p := NewHttpHealthProbe("http", "localhost", "", 0)
+	p.Address = srv.URL
+
+	state, err := p.evaluate(context.Background(), ctx)
+	require.Nil(t, err)
+	require.Equal(t, Unhealthy, state, "not honored by default")
+
+	p.HonorRetryAfter = true
+	state, err = p.evaluate(context.Background(), ctx)
+	require.Nil(t, err)
+	require.Equal(t, Degraded, state)
+	require.Equal(t, 2, requests)
+
+	// backing off
+	state, err = p.evaluate(context.Background(), ctx)
+	require.Nil(t, err)
+	require.Equal(t, Degraded, state)
+	require.Equal(t, 2, requests, "not probed while backing off")
+}
+
+func Test_HttpHealthProbe_expectedALPN(t *testing.T) {
+	ctx := log.NewContext(log.NewNopLogger())
+	h2 := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	h2.EnableHTTP2 = true
+	h2.StartTLS()
+	defer h2.Close()
+	h1 := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer h1.Close()
+
+	probe := func(url, alpn string) HealthStatus {
+		p := NewHttpHealthProbe("https", "localhost", "", 0)
+		p.Address = url
+		p.expectALPN(alpn)
+		state, err := p.evaluate(context.Background(), ctx)
+		require.Nil(t, err)
+		return state
+	}
+	require.Equal(t, Healthy, probe(h2.URL, "h2"))
+	require.Equal(t, Unhealthy, probe(h1.URL, "h2"), "downgraded")
+	require.Equal(t, Unhealthy, probe(h2.URL, "http/1.1"))
+}
+
+func Test_HttpHealthProbe_responseSchema(t *testing.T) {
+	ctx := log.NewContext(log.NewNopLogger())
+	body := `{"status": "ok"}`
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(body))
+	}))
+	defer srv.Close()
+
+	p := NewHttpHealthProbe("http", "localhost", "", 0)
+	p.Address = srv.URL
+	p.ResponseSchema, _ = compileResponseBodySchema(json.RawMessage(testResponseBodySchema))
+
+	state, err := p.evaluate(context.Background(), ctx)
+	require.Nil(t, err)
+	require.Equal(t, Healthy, state)
+
+	body = `{"status": "broken"}`
+	state, err = p.evaluate(context.Background(), ctx)
+	require.Nil(t, err)
+	require.Equal(t, Unhealthy, state)
+}
+
+func Test_HttpHealthProbe_responseRegex(t *testing.T) {
+	ctx := log.NewContext(log.NewNopLogger())
+	body := `{"status" : "UP"}`
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(body))
+	}))
+	defer srv.Close()
+
+	p := NewHttpHealthProbe("http", "localhost", "", 0)
+	p.Address = srv.URL
+	p.ResponseRegex = regexp.MustCompile(`"status"\s*:\s*"UP"`)
+
+	state, err := p.evaluate(context.Background(), ctx)
+	require.Nil(t, err)
+	require.Equal(t, Healthy, state)
+
+	body = `<html>502 Bad Gateway</html>`
+	state, err = p.evaluate(context.Background(), ctx)
+	require.Nil(t, err)
+	require.Equal(t, Unhealthy, state)
+}
+
+func Test_HttpHealthProbe_reportedState(t *testing.T) {
+	ctx := log.NewContext(log.NewNopLogger())
+	status, body := http.StatusOK, `{"ApplicationHealthState": "Degraded"}`
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(status)
+		w.Write([]byte(body))
+	}))
+	defer srv.Close()
+
+	p := NewHttpHealthProbe("http", "localhost", "", 0)
+	p.Address = srv.URL
+	for _, tc := range []struct {
+		status   int
+		body     string
+		expected HealthStatus
+	}{
+		{http.StatusOK, `{"ApplicationHealthState": "Degraded"}`, Degraded},
+		{http.StatusOK, `{"ApplicationHealthState": "Unhealthy"}`, Unhealthy},
+		{http.StatusOK, `{"ApplicationHealthState": "Healthy"}`, Healthy},
+		{http.StatusOK, `{"ApplicationHealthState": "Sick"}`, Unhealthy},
+		{http.StatusOK, `OK`, Healthy},
+		{http.StatusInternalServerError, `{"ApplicationHealthState": "Healthy"}`, Unhealthy},
+	} {
+		status, body = tc.status, tc.body
+		state, err := p.evaluate(context.Background(), ctx)
+		require.Nil(t, err)
+		require.Equal(t, tc.expected, state, "%d %s", tc.status, tc.body)
+	}
+}
+
+func Test_HttpHealthProbe_headers(t *testing.T) {
+	ctx := log.NewContext(log.NewNopLogger())
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("X-Api-Key") != "secret" || r.UserAgent() != "probe/2.0" {
+			w.WriteHeader(http.StatusUnauthorized)
+		}
+	}))
+	defer srv.Close()
+
+	p := NewHttpHealthProbe("http", "localhost", "", 0)
+	p.Address = srv.URL
+	state, err := p.evaluate(context.Background(), ctx)
+	require.Nil(t, err)
+	require.Equal(t, Unhealthy, state)
+
+	p.Headers = http.Header{"X-Api-Key": {"secret"}, "User-Agent": {"probe/2.0"}}
+	state, err = p.evaluate(context.Background(), ctx)
+	require.Nil(t, err)
+	require.Equal(t, Healthy, state)
+}
+
+func Test_HttpHealthProbe_hostHeader(t *testing.T) {
+	ctx := log.NewContext(log.NewNopLogger())
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Host != "app.contoso.com" {
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer srv.Close()
+
+	p := NewHttpHealthProbe("http", "localhost", "", 0)
+	p.Address = srv.URL
+	state, err := p.evaluate(context.Background(), ctx)
+	require.Nil(t, err)
+	require.Equal(t, Unhealthy, state)
+
+	p.HostHeader = "app.contoso.com"
+	state, err = p.evaluate(context.Background(), ctx)
+	require.Nil(t, err)
+	require.Equal(t, Healthy, state)
+}
+
+func Test_HttpHealthProbe_redirects(t *testing.T) {
+	ctx := log.NewContext(log.NewNopLogger())
+	mux := http.NewServeMux()
+	mux.Handle("/old", http.RedirectHandler("/moved", http.StatusFound))
+	mux.Handle("/moved", http.RedirectHandler("/health", http.StatusFound))
+	mux.HandleFunc("/health", func(w http.ResponseWriter, r *http.Request) {})
+	srv := httptest.NewServer(mux)
+	defer srv.Close()
+
+	p := NewHttpHealthProbe("http", "localhost", "", 0)
+	p.Address = srv.URL + "/old"
+	state, err := p.evaluate(context.Background(), ctx)
+	require.Nil(t, err)
+	require.Equal(t, Unhealthy, state, "redirect not followed")
+
+	p.ExpectedStatusCodes = statusCodes{{302, 302}}
+	state, err = p.evaluate(context.Background(), ctx)
+	require.Nil(t, err)
+	require.Equal(t, Healthy, state, "redirect expected")
+
+	p.ExpectedStatusCodes = nil
+	p.HttpClient.CheckRedirect = redirectPolicy(2)
+	state, err = p.evaluate(context.Background(), ctx)
+	require.Nil(t, err)
+	require.Equal(t, Healthy, state, "redirects followed")
+
+	p.HttpClient.CheckRedirect = redirectPolicy(1)
+	state, err = p.evaluate(context.Background(), ctx)
+	require.Nil(t, err)
+	require.Equal(t, Unhealthy, state, "too many redirects")
+}
+
+func Test_HttpHealthProbe_method(t *testing.T) {
+	ctx := log.NewContext(log.NewNopLogger())
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := ioutil.ReadAll(r.Body)
+		if r.Method != "POST" || string(body) != "ping" {
+			w.WriteHeader(http.StatusMethodNotAllowed)
+		}
+	}))
+	defer srv.Close()
+
+	p := NewHttpHealthProbe("http", "localhost", "", 0)
+	p.Address = srv.URL
+	state, err := p.evaluate(context.Background(), ctx)
+	require.Nil(t, err)
+	require.Equal(t, Unhealthy, state)
+
+	p.Method, p.Body = "POST", "ping"
+	state, err = p.evaluate(context.Background(), ctx)
+	require.Nil(t, err)
+	require.Equal(t, Healthy, state)
+	state, err = p.evaluate(context.Background(), ctx)
+	require.Nil(t, err)
+	require.Equal(t, Healthy, state, "body sent again")
+}
+
+func Test_HttpHealthProbe_expectedStatusCodes(t *testing.T) {
+	ctx := log.NewContext(log.NewNopLogger())
+	status := http.StatusUnauthorized
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(status)
+	}))
+	defer srv.Close()
+
+	p := NewHttpHealthProbe("http", "localhost", "", 0)
+	p.Address = srv.URL
+	state, err := p.evaluate(context.Background(), ctx)
+	require.Nil(t, err)
+	require.Equal(t, Unhealthy, state)
+
+	p.ExpectedStatusCodes = statusCodes{{401, 401}, {200, 299}}
+	for code, expected := range map[int]HealthStatus{401: Healthy, 204: Healthy, 403: Unhealthy, 500: Unhealthy} {
+		status = code
+		state, err = p.evaluate(context.Background(), ctx)
+		require.Nil(t, err)
+		require.Equal(t, expected, state, "%d", code)
+	}
+}
+
+func Test_NewHealthProbe_probeTimeout(t *testing.T) {
+	ctx := log.NewContext(log.NewNopLogger())
+	hung := make(chan struct{})
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-hung
+	}))
+	defer srv.Close()
+	defer close(hung)
+	port := srv.Listener.Addr().(*net.TCPAddr).Port
+
+	cfg := &handlerSettings{publicSettings: publicSettings{Protocol: "http", Port: port, ProbeTimeoutInSeconds: 1}}
+	start := time.Now()
+	state, err := NewHealthProbe(ctx, cfg).evaluate(context.Background(), ctx)
+	require.Nil(t, err)
+	require.Equal(t, Unhealthy, state)
+	require.True(t, time.Since(start) < 5*time.Second, "bounded by the probe timeout")
+
+	cfg.publicSettings.Protocol = "tcp"
+	require.Equal(t, time.Second, NewHealthProbe(ctx, cfg).(*TcpHealthProbe).Timeout)
+}
+
+func Test_HttpHealthProbe_cancelled(t *testing.T) {
+	ctx := log.NewContext(log.NewNopLogger())
+	hung := make(chan struct{})
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-hung
+	}))
+	defer srv.Close()
+	defer close(hung)
+
+	p := NewHttpHealthProbe("http", "localhost", "", 0)
+	p.Address = srv.URL
+	probeCtx, cancel := context.WithCancel(context.Background())
+	time.AfterFunc(100*time.Millisecond, cancel)
+	start := time.Now()
+	_, err := p.evaluate(probeCtx, ctx)
+	require.Nil(t, err)
+	require.True(t, time.Since(start) < defaultProbeTimeout, "interrupted before the probe timeout")
+}
+
+func Test_NewHttpHealthProbe_host(t *testing.T) {
+	for _, c := range []struct {
+		protocol, host string
+		port           int
+		expected       string
+	}{
+		{"http", "localhost", 0, "http://localhost/health"},
+		{"http", "10.0.1.4", 8080, "http://10.0.1.4:8080/health"},
+		{"https", "fd00::4", 443, "https://[fd00::4]/health"},
+		{"https", "fd00::4", 8443, "https://[fd00::4]:8443/health"},
+	} {
+		require.Equal(t, c.expected, NewHttpHealthProbe(c.protocol, c.host, "health", c.port).Address)
+	}
+}
+
+func Test_NewHealthProbe_host(t *testing.T) {
+	ctx := log.NewContext(log.NewNopLogger())
+	l, err := net.Listen("tcp", "127.0.0.2:0")
+	require.Nil(t, err)
+	defer l.Close()
+	port := l.Addr().(*net.TCPAddr).Port
+
+	cfg := &handlerSettings{publicSettings: publicSettings{Protocol: "tcp", Port: port}}
+	state, _ := NewHealthProbe(ctx, cfg).evaluate(context.Background(), ctx)
+	require.Equal(t, Unhealthy, state, "not listening on localhost")
+
+	cfg.publicSettings.Host = "127.0.0.2"
+	p := NewHealthProbe(ctx, cfg)
+	require.Equal(t, l.Addr().String(), p.address())
+	state, err = p.evaluate(context.Background(), ctx)
+	require.Nil(t, err)
+	require.Equal(t, Healthy, state)
+}
+
+func Test_probes_resolutionError(t *testing.T) {
+	ctx := log.NewContext(log.NewNopLogger())
+	httpProbe := NewHttpHealthProbe("http", "localhost", "", 0)
+	httpProbe.Address = "http://health.invalid/"
+	for _, p := range []HealthProbe{
+		&TcpHealthProbe{Address: "health.invalid:80"},
+		httpProbe,
+		&UdpHealthProbe{Address: "health.invalid:53", Payload: []byte("ping"), Timeout: time.Second},
+	} {
+		state, err := p.evaluate(context.Background(), ctx)
+		require.Equal(t, Unknown, state, p.address())
+		require.NotNil(t, err, p.address())
+		require.Contains(t, err.Error(), "failed to resolve the probed address")
+	}
+
+	state, err := (&TcpHealthProbe{Address: "127.0.0.1:1"}).evaluate(context.Background(), ctx)
+	require.Nil(t, err, "refused by the application")
+	require.Equal(t, Unhealthy, state)
+}
+
+func Test_unixSocketProbes(t *testing.T) {
+	ctx := log.NewContext(log.NewNopLogger())
+	dir, err := ioutil.TempDir("", "")
+	require.Nil(t, err)
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "app.sock")
+
+	l, err := net.Listen("unix", path)
+	require.Nil(t, err)
+	srv := &http.Server{Handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/health" {
+			w.WriteHeader(http.StatusNotFound)
+		}
+	})}
+	go srv.Serve(l)
+	defer srv.Close()
+
+	probe := func(p publicSettings) HealthStatus {
+		state, err := NewHealthProbe(ctx, &handlerSettings{publicSettings: p}).evaluate(context.Background(), ctx)
+		require.Nil(t, err)
+		return state
+	}
+	require.Equal(t, Healthy, probe(publicSettings{Protocol: "tcp", UnixSocketPath: path}))
+	require.Equal(t, Healthy, probe(publicSettings{Protocol: "http", RequestPath: "health", UnixSocketPath: path}))
+	require.Equal(t, Unhealthy, probe(publicSettings{Protocol: "http", RequestPath: "missing", UnixSocketPath: path}))
+	require.Equal(t, Unhealthy, probe(publicSettings{Protocol: "tcp", UnixSocketPath: filepath.Join(dir, "none.sock")}))
+}
@@ -0,0 +1,81 @@
+package main
+
+import (
+	"context"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"time"
+
+	"github.com/go-kit/kit/log"
+	"github.com/pkg/errors"
+)
+
+const (
+	// hookTimeout bounds the run of a command run on a health state
+	// transition.
+	hookTimeout = 5 * time.Minute
+)
+
+var errHookCommandNotAbsolute = errors.New("the executable of 'onUnhealthyCommand' and 'onHealthyCommand' must be given as an absolute path")
+
+// transitionHook returns the command run when the derived state changes from
+// one state to another, or nil if none is configured.
+func (s *handlerSettings) transitionHook(from, to HealthStatus) []string {
+	switch {
+	case to == Unhealthy:
+		return s.publicSettings.OnUnhealthyCommand
+	case to == Healthy && from != Degraded:
+		// recovered rather than merely no longer degraded
+		return s.publicSettings.OnHealthyCommand
+	}
+	return nil
+}
+
+// validateHooks makes logical validation of the transition hook commands.
+func (h handlerSettings) validateHooks() error {
+	for _, c := range [][]string{h.publicSettings.OnUnhealthyCommand, h.publicSettings.OnHealthyCommand} {
+		if len(c) != 0 && !filepath.IsAbs(c[0]) {
+			return errHookCommandNotAbsolute
+		}
+	}
+	return nil
+}
+
+// runTransitionHook runs the command configured for the transition in the
+// background, passing both states in its environment, until runCtx is
+// cancelled.
+func runTransitionHook(runCtx context.Context, ctx *log.Context, cfg *handlerSettings, from, to HealthStatus) {
+	command := cfg.transitionHook(from, to)
+	if len(command) == 0 {
+		return
+	}
+	go func() {
+		err := runHook(runCtx, command, from, to, hookTimeout)
+		ctx.Log("event", "ran health state transition hook", "command", command[0], "oldState", from, "newState", to, "error", err)
+	}()
+}
+
+// runHook runs command with the states of the transition in the
+// APPHEALTH_OLD_STATE and APPHEALTH_NEW_STATE environment variables, killing
+// it with its children after timeout or once runCtx is cancelled.
+func runHook(runCtx context.Context, command []string, from, to HealthStatus, timeout time.Duration) error {
+	cmdCtx, cancel := context.WithTimeout(runCtx, timeout)
+	defer cancel()
+	cmd := exec.CommandContext(cmdCtx, command[0], command[1:]...)
+	killGroupOnCancel(cmd)
+	cmd.Env = append(os.Environ(), "APPHEALTH_OLD_STATE="+string(from), "APPHEALTH_NEW_STATE="+string(to))
+	out, err := cmd.CombinedOutput()
+	if err != nil {
+		if len(out) > maxExecOutput {
+			out = out[len(out)-maxExecOutput:]
+		}
+		if runCtx.Err() != nil {
+			err = errors.New("interrupted")
+		} else if cmdCtx.Err() != nil {
+			err = errors.Errorf("timed out after %s", timeout)
+		}
+		return errors.Wrapf(err, "output: %s", out)
+	}
+	return nil
+}
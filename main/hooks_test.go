@@ -0,0 +1,59 @@
+package main
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func Test_handlerSettings_transitionHook(t *testing.T) {
+	cfg := &handlerSettings{publicSettings: publicSettings{
+		OnUnhealthyCommand: []string{"/usr/local/bin/collect-logs"},
+		OnHealthyCommand:   []string{"/usr/local/bin/recovered"},
+	}}
+	require.Equal(t, []string{"/usr/local/bin/collect-logs"}, cfg.transitionHook(Healthy, Unhealthy))
+	require.Equal(t, []string{"/usr/local/bin/collect-logs"}, cfg.transitionHook(Degraded, Unhealthy))
+	require.Equal(t, []string{"/usr/local/bin/recovered"}, cfg.transitionHook(Unhealthy, Healthy))
+	require.Equal(t, []string{"/usr/local/bin/recovered"}, cfg.transitionHook(Initializing, Healthy))
+	require.Nil(t, cfg.transitionHook(Degraded, Healthy))
+	require.Nil(t, cfg.transitionHook(Healthy, Degraded))
+	require.Nil(t, (&handlerSettings{}).transitionHook(Healthy, Unhealthy))
+}
+
+func Test_runHook(t *testing.T) {
+	out := filepath.Join(t.TempDir(), "transition")
+	require.Nil(t, runHook(context.Background(), []string{"/bin/sh", "-c", `echo "$APPHEALTH_OLD_STATE->$APPHEALTH_NEW_STATE" > ` + out}, Healthy, Unhealthy, time.Second))
+	b, err := os.ReadFile(out)
+	require.Nil(t, err)
+	require.Equal(t, "healthy->unhealthy\n", string(b))
+
+	err = runHook(context.Background(), []string{"/bin/sh", "-c", "echo no space left; exit 1"}, Healthy, Unhealthy, time.Second)
+	require.NotNil(t, err)
+	require.Contains(t, err.Error(), "no space left")
+
+	start := time.Now()
+	err = runHook(context.Background(), []string{"/bin/sh", "-c", "sleep 10"}, Healthy, Unhealthy, 100*time.Millisecond)
+	require.NotNil(t, err)
+	require.Contains(t, err.Error(), "timed out")
+	require.True(t, time.Since(start) < 5*time.Second)
+
+	runCtx, cancel := context.WithCancel(context.Background())
+	time.AfterFunc(100*time.Millisecond, cancel)
+	start = time.Now()
+	err = runHook(runCtx, []string{"/bin/sh", "-c", "sleep 10"}, Healthy, Unhealthy, time.Minute)
+	require.NotNil(t, err)
+	require.Contains(t, err.Error(), "interrupted")
+	require.True(t, time.Since(start) < 5*time.Second, "stopped on termination")
+}
+
+func Test_handlerSettingsValidate_hooks(t *testing.T) {
+	validate := func(p publicSettings) error { return handlerSettings{p, protectedSettings{}}.validate() }
+
+	require.Nil(t, validate(publicSettings{OnUnhealthyCommand: []string{"/usr/local/bin/collect-logs", "--all"}, OnHealthyCommand: []string{"/bin/true"}}))
+	require.Equal(t, errHookCommandNotAbsolute, validate(publicSettings{OnUnhealthyCommand: []string{"collect-logs"}}))
+	require.Equal(t, errHookCommandNotAbsolute, validate(publicSettings{OnHealthyCommand: []string{"./recovered"}}))
+}
@@ -0,0 +1,186 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+const (
+	// tokenRequestTimeout bounds a request for an OAuth2 access token.
+	tokenRequestTimeout = 10 * time.Second
+
+	// tokenExpiryMargin is how long before its expiry an access token is
+	// refreshed, so that it does not expire while a probe is in flight.
+	tokenExpiryMargin = time.Minute
+)
+
+var (
+	errBasicAuthRequiresHttp    = errors.New("'username', 'password', 'bearerToken' and 'oauth2' can only be specified when using 'http' or 'https' protocol")
+	errBasicAuthIncomplete      = errors.New("'username' and 'password' must be specified together")
+	errMultipleCredentials      = errors.New("only one of 'username', 'bearerToken' and 'oauth2' can be specified")
+	errAuthorizationHeaderTwice = errors.New("'requestHeaders' cannot set the 'Authorization' header when credentials are specified in the protected settings")
+)
+
+// oauth2Settings configure the OAuth2 client credentials grant the access
+// token of http probes is requested with.
+type oauth2Settings struct {
+	TokenURL     string `json:"tokenUrl"`
+	ClientID     string `json:"clientId"`
+	ClientSecret string `json:"clientSecret"`
+	Scope        string `json:"scope"`
+	// Resource is the resource the token is requested for by the v1
+	// endpoint of Azure Active Directory, instead of a scope.
+	Resource string `json:"resource"`
+}
+
+// tokenSource provides the bearer token of the requests of http probes.
+type tokenSource interface {
+	token() (string, error)
+	// invalidate discards the token after it was rejected.
+	invalidate()
+}
+
+// staticToken is a bearer token given in the settings.
+type staticToken string
+
+func (t staticToken) token() (string, error) { return string(t), nil }
+func (t staticToken) invalidate()            {}
+
+// clientCredentialsSource requests access tokens with the OAuth2 client
+// credentials grant, caching each until shortly before it expires.
+type clientCredentialsSource struct {
+	cfg    oauth2Settings
+	client *http.Client
+	now    func() time.Time
+
+	mu      sync.Mutex
+	current string
+	expiry  time.Time
+}
+
+func newClientCredentialsSource(cfg oauth2Settings) *clientCredentialsSource {
+	return &clientCredentialsSource{
+		cfg:    cfg,
+		client: &http.Client{Timeout: tokenRequestTimeout},
+		now:    time.Now,
+	}
+}
+
+func (s *clientCredentialsSource) token() (string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.current != "" && s.now().Before(s.expiry) {
+		return s.current, nil
+	}
+
+	form := url.Values{
+		"grant_type":    {"client_credentials"},
+		"client_id":     {s.cfg.ClientID},
+		"client_secret": {s.cfg.ClientSecret},
+	}
+	if s.cfg.Scope != "" {
+		form.Set("scope", s.cfg.Scope)
+	}
+	if s.cfg.Resource != "" {
+		form.Set("resource", s.cfg.Resource)
+	}
+	resp, err := s.client.Post(s.cfg.TokenURL, "application/x-www-form-urlencoded", strings.NewReader(form.Encode()))
+	if err != nil {
+		return "", errors.Wrap(err, "failed to request access token")
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return "", errors.Errorf("token endpoint responded with %s", resp.Status)
+	}
+
+	var t struct {
+		AccessToken string      `json:"access_token"`
+		ExpiresIn   json.Number `json:"expires_in"` // a string for the v1 endpoint
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&t); err != nil {
+		return "", errors.Wrap(err, "failed to parse token response")
+	}
+	if t.AccessToken == "" {
+		return "", errors.New("token response has no access_token")
+	}
+	expiresIn, _ := t.ExpiresIn.Int64() // the token is used once if unknown
+	secrets.addToken(t.AccessToken)
+	s.current = t.AccessToken
+	s.expiry = s.now().Add(time.Duration(expiresIn)*time.Second - tokenExpiryMargin)
+	return s.current, nil
+}
+
+func (s *clientCredentialsSource) invalidate() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.current = ""
+}
+
+// basicAuth returns the credentials http probes authenticate with, or false if
+// requests are anonymous.
+func (s *handlerSettings) basicAuth() (username, password string, ok bool) {
+	p := s.protectedSettings
+	return p.Username, p.Password, p.Username != ""
+}
+
+// tokenSource returns the source of the bearer token http probes send, or nil
+// if they do not send one.
+func (s *handlerSettings) tokenSource() tokenSource {
+	p := s.protectedSettings
+	switch {
+	case p.BearerToken != "":
+		return staticToken(p.BearerToken)
+	case p.OAuth2 != nil:
+		return newClientCredentialsSource(*p.OAuth2)
+	}
+	return nil
+}
+
+// validateHttpAuth makes logical validation of the credentials of http probes.
+func (h handlerSettings) validateHttpAuth() error {
+	p := h.protectedSettings
+	credentials := 0
+	for _, set := range []bool{p.Username != "" || p.Password != "", p.BearerToken != "", p.OAuth2 != nil} {
+		if set {
+			credentials++
+		}
+	}
+	if credentials == 0 {
+		return nil
+	}
+	if h.protocol() != "http" && h.protocol() != "https" {
+		return errBasicAuthRequiresHttp
+	}
+	if credentials > 1 {
+		return errMultipleCredentials
+	}
+	if (p.Username != "" || p.Password != "") && (p.Username == "" || p.Password == "") {
+		return errBasicAuthIncomplete
+	}
+	if _, ok := h.requestHeaders()["Authorization"]; ok {
+		return errAuthorizationHeaderTwice
+	}
+	return nil
+}
+
+// authenticate sets the credentials of the probe on req. An error is returned
+// if the credentials could not be obtained.
+func (p *HttpHealthProbe) authenticate(req *http.Request) error {
+	if p.Username != "" {
+		req.SetBasicAuth(p.Username, p.Password)
+	}
+	if p.Tokens != nil {
+		t, err := p.Tokens.token()
+		if err != nil {
+			return err
+		}
+		req.Header.Set("Authorization", "Bearer "+t)
+	}
+	return nil
+}
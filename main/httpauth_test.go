@@ -0,0 +1,174 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/go-kit/kit/log"
+	"github.com/stretchr/testify/require"
+)
+
+func Test_HttpHealthProbe_basicAuth(t *testing.T) {
+	ctx := log.NewContext(log.NewNopLogger())
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if user, pass, ok := r.BasicAuth(); !ok || user != "probe" || pass != "s3cret" {
+			w.WriteHeader(http.StatusUnauthorized)
+		}
+	}))
+	defer srv.Close()
+
+	p := NewHttpHealthProbe("http", "localhost", "", 0)
+	p.Address = srv.URL
+	state, err := p.evaluate(context.Background(), ctx)
+	require.Nil(t, err)
+	require.Equal(t, Unhealthy, state)
+
+	p.Username, p.Password = "probe", "s3cret"
+	state, err = p.evaluate(context.Background(), ctx)
+	require.Nil(t, err)
+	require.Equal(t, Healthy, state)
+}
+
+func Test_handlerSettingsValidate_basicAuth(t *testing.T) {
+	cfg := handlerSettings{
+		publicSettings{Protocol: "https"},
+		protectedSettings{Username: "probe", Password: "s3cret"},
+	}
+	require.Nil(t, cfg.validate())
+	user, pass, ok := cfg.basicAuth()
+	require.True(t, ok)
+	require.Equal(t, "probe", user)
+	require.Equal(t, "s3cret", pass)
+	_, _, ok = (&handlerSettings{}).basicAuth()
+	require.False(t, ok)
+
+	require.Equal(t, errBasicAuthRequiresHttp, handlerSettings{
+		publicSettings{Protocol: "tcp", Port: 80},
+		protectedSettings{Username: "probe", Password: "s3cret"},
+	}.validate())
+	require.Equal(t, errBasicAuthIncomplete, handlerSettings{
+		publicSettings{Protocol: "http"},
+		protectedSettings{Username: "probe"},
+	}.validate())
+	require.Equal(t, errBasicAuthIncomplete, handlerSettings{
+		publicSettings{Protocol: "http"},
+		protectedSettings{Password: "s3cret"},
+	}.validate())
+	require.Equal(t, errAuthorizationHeaderTwice, handlerSettings{
+		publicSettings{Protocol: "http", RequestHeaders: map[string]string{"authorization": "Basic eA=="}},
+		protectedSettings{Username: "probe", Password: "s3cret"},
+	}.validate())
+}
+
+func Test_clientCredentialsSource(t *testing.T) {
+	requests := 0
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		r.ParseForm()
+		if r.Form.Get("grant_type") != "client_credentials" || r.Form.Get("client_secret") != "s3cret" {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		require.Equal(t, "api://app/.default", r.Form.Get("scope"))
+		fmt.Fprintf(w, `{"access_token": "token-%d", "expires_in": "3600"}`, requests)
+	}))
+	defer srv.Close()
+
+	now := time.Now()
+	s := newClientCredentialsSource(oauth2Settings{TokenURL: srv.URL, ClientID: "probe", ClientSecret: "s3cret", Scope: "api://app/.default"})
+	s.now = func() time.Time { return now }
+
+	tok, err := s.token()
+	require.Nil(t, err)
+	require.Equal(t, "token-1", tok)
+	tok, _ = s.token()
+	require.Equal(t, "token-1", tok, "cached")
+
+	now = now.Add(time.Hour - tokenExpiryMargin)
+	tok, _ = s.token()
+	require.Equal(t, "token-2", tok, "refreshed before expiry")
+
+	s.invalidate()
+	tok, _ = s.token()
+	require.Equal(t, "token-3", tok)
+
+	s = newClientCredentialsSource(oauth2Settings{TokenURL: srv.URL, ClientID: "probe", ClientSecret: "wrong"})
+	_, err = s.token()
+	require.NotNil(t, err)
+	require.Contains(t, err.Error(), "400 Bad Request")
+}
+
+func Test_HttpHealthProbe_bearerToken(t *testing.T) {
+	ctx := log.NewContext(log.NewNopLogger())
+	issued := 0
+	idp := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		issued++
+		fmt.Fprintf(w, `{"access_token": "token-%d", "expires_in": 3600}`, issued)
+	}))
+	defer idp.Close()
+	valid := "token-1"
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Bearer "+valid {
+			w.WriteHeader(http.StatusUnauthorized)
+		}
+	}))
+	defer srv.Close()
+
+	p := NewHttpHealthProbe("http", "localhost", "", 0)
+	p.Address = srv.URL
+	p.Tokens = staticToken("token-1")
+	state, err := p.evaluate(context.Background(), ctx)
+	require.Nil(t, err)
+	require.Equal(t, Healthy, state)
+
+	p.Tokens = newClientCredentialsSource(oauth2Settings{TokenURL: idp.URL, ClientID: "probe", ClientSecret: "s3cret"})
+	state, err = p.evaluate(context.Background(), ctx)
+	require.Nil(t, err)
+	require.Equal(t, Healthy, state)
+
+	// a rejected token is replaced by the next probe
+	valid = "token-2"
+	state, _ = p.evaluate(context.Background(), ctx)
+	require.Equal(t, Unhealthy, state)
+	state, _ = p.evaluate(context.Background(), ctx)
+	require.Equal(t, Healthy, state)
+
+	idp.Close()
+	p.Tokens.invalidate()
+	state, err = p.evaluate(context.Background(), ctx)
+	require.Equal(t, Unknown, state, "no token")
+	require.NotNil(t, err)
+	require.Contains(t, err.Error(), "failed to authenticate probe")
+}
+
+func Test_handlerSettingsValidate_tokens(t *testing.T) {
+	oauth2 := &oauth2Settings{TokenURL: "https://idp/token", ClientID: "probe", ClientSecret: "s3cret"}
+	cfg := handlerSettings{publicSettings{Protocol: "https"}, protectedSettings{BearerToken: "token"}}
+	require.Nil(t, cfg.validate())
+	require.Equal(t, staticToken("token"), cfg.tokenSource())
+	cfg = handlerSettings{publicSettings{Protocol: "https"}, protectedSettings{OAuth2: oauth2}}
+	require.Nil(t, cfg.validate())
+	require.IsType(t, &clientCredentialsSource{}, cfg.tokenSource())
+	require.Nil(t, (&handlerSettings{}).tokenSource())
+
+	require.Equal(t, errBasicAuthRequiresHttp, handlerSettings{
+		publicSettings{Protocol: "tcp", Port: 80},
+		protectedSettings{BearerToken: "token"},
+	}.validate())
+	require.Equal(t, errMultipleCredentials, handlerSettings{
+		publicSettings{Protocol: "http"},
+		protectedSettings{BearerToken: "token", OAuth2: oauth2},
+	}.validate())
+	require.Equal(t, errMultipleCredentials, handlerSettings{
+		publicSettings{Protocol: "http"},
+		protectedSettings{Username: "probe", Password: "s3cret", BearerToken: "token"},
+	}.validate())
+	require.Equal(t, errAuthorizationHeaderTwice, handlerSettings{
+		publicSettings{Protocol: "http", RequestHeaders: map[string]string{"Authorization": "Bearer x"}},
+		protectedSettings{OAuth2: oauth2},
+	}.validate())
+}
@@ -0,0 +1,108 @@
+package main
+
+import (
+	"net/http"
+
+	"github.com/pkg/errors"
+)
+
+// defaultMaxRedirects is how many redirects http probes following redirects
+// follow unless 'maxRedirects' is specified.
+const defaultMaxRedirects = 10
+
+var (
+	errRequestHeadersRequireHttp  = errors.New("'requestHeaders' can only be specified when using 'http' or 'https' protocol")
+	errRequestHeaderHost          = errors.New("'requestHeaders' cannot set the 'Host' header, use 'hostHeader' instead")
+	errHostHeaderRequiresHttp     = errors.New("'hostHeader' can only be specified when using 'http' or 'https' protocol")
+	errHttpMethodRequiresHttp     = errors.New("'httpMethod' and 'requestBody' can only be specified when using 'http' or 'https' protocol")
+	errRequestBodyRequiresPost    = errors.New("'requestBody' can only be specified when 'httpMethod' is POST")
+	errHeadWithResponseCheck      = errors.New("'responseBodySchema' and 'responseBodyRegex' cannot be used when 'httpMethod' is HEAD")
+	errFollowRedirectsRequireHttp = errors.New("'followRedirects' can only be specified when using 'http' or 'https' protocol")
+	errMaxRedirectsWithoutFollow  = errors.New("'maxRedirects' can only be specified when 'followRedirects' is true")
+)
+
+// httpMethod returns the method of the requests of http probes.
+func (s *handlerSettings) httpMethod() string {
+	if s.publicSettings.HttpMethod == "" {
+		return http.MethodGet
+	}
+	return s.publicSettings.HttpMethod
+}
+
+// requestBody returns the body sent with the requests of http probes.
+func (s *handlerSettings) requestBody() string {
+	return s.publicSettings.RequestBody
+}
+
+// requestHeaders returns the headers sent with the requests of http probes, or
+// nil if none are configured.
+func (s *handlerSettings) requestHeaders() http.Header {
+	if len(s.publicSettings.RequestHeaders) == 0 {
+		return nil
+	}
+	h := make(http.Header)
+	for name, value := range s.publicSettings.RequestHeaders {
+		h.Set(name, value)
+	}
+	return h
+}
+
+// hostHeader returns the Host header of the requests of http probes, or "" if
+// it is the probed host.
+func (s *handlerSettings) hostHeader() string {
+	return s.publicSettings.HostHeader
+}
+
+// maxRedirects returns how many redirects http probes follow, 0 if the status
+// code of the redirect response is checked instead.
+func (s *handlerSettings) maxRedirects() int {
+	switch {
+	case !s.publicSettings.FollowRedirects:
+		return 0
+	case s.publicSettings.MaxRedirects == 0:
+		return defaultMaxRedirects
+	}
+	return s.publicSettings.MaxRedirects
+}
+
+// allowsHttpRequest reports whether the options of the requests of http probes
+// can be specified: for an http or https probe, or as the defaults of the http
+// and https ones of 'probes' or 'applications', validated with each of those.
+func (h handlerSettings) allowsHttpRequest() bool {
+	return h.protocol() == "http" || h.protocol() == "https" || len(h.probes()) != 0 || len(h.applications()) != 0
+}
+
+// validateHttpRequest makes logical validation of the settings customizing the
+// requests of http probes.
+func (h handlerSettings) validateHttpRequest() error {
+	isHttp := h.allowsHttpRequest()
+	if len(h.publicSettings.RequestHeaders) != 0 {
+		if !isHttp {
+			return errRequestHeadersRequireHttp
+		}
+		if _, ok := h.requestHeaders()["Host"]; ok {
+			return errRequestHeaderHost
+		}
+	}
+	if h.hostHeader() != "" && !isHttp {
+		return errHostHeaderRequiresHttp
+	}
+	if h.publicSettings.FollowRedirects && !isHttp {
+		return errFollowRedirectsRequireHttp
+	}
+	if h.publicSettings.MaxRedirects != 0 && !h.publicSettings.FollowRedirects {
+		return errMaxRedirectsWithoutFollow
+	}
+	if h.publicSettings.HttpMethod != "" || h.requestBody() != "" {
+		if !isHttp {
+			return errHttpMethodRequiresHttp
+		}
+		if h.requestBody() != "" && h.httpMethod() != http.MethodPost {
+			return errRequestBodyRequiresPost
+		}
+		if (len(h.publicSettings.ResponseBodySchema) != 0 || h.publicSettings.ResponseBodyRegex != "") && h.httpMethod() == http.MethodHead {
+			return errHeadWithResponseCheck
+		}
+	}
+	return nil
+}
@@ -0,0 +1,112 @@
+package main
+
+import (
+	"crypto/tls"
+	"net/http"
+	"net/http/httptrace"
+	"sync"
+	"time"
+)
+
+// probeTimings records the phases of the latest http probe of each target,
+// at debug level only.
+var probeTimings = newTimingRecorder()
+
+// phaseTiming is the time an http probe took to complete each phase of its
+// request, measured from the start of the request. Phases skipped, e.g. the
+// DNS lookup of an IP address or of a reused connection, are zero.
+type phaseTiming struct {
+	DNSLookup        time.Duration `json:"dnsLookup"`
+	TCPConnect       time.Duration `json:"tcpConnect"`
+	TLSHandshake     time.Duration `json:"tlsHandshake"`
+	FirstByte        time.Duration `json:"timeToFirstByte"`
+	ReusedConnection bool          `json:"reusedConnection"`
+}
+
+// phaseTracer measures the phases of a request.
+type phaseTracer struct {
+	mu     sync.Mutex
+	start  time.Time
+	timing phaseTiming
+
+	dnsStart, connectStart, tlsStart time.Time
+}
+
+// traceRequest returns req with its phases measured by a new tracer.
+func traceRequest(req *http.Request) (*http.Request, *phaseTracer) {
+	t := &phaseTracer{start: time.Now()}
+	trace := &httptrace.ClientTrace{
+		DNSStart: func(httptrace.DNSStartInfo) { t.set(&t.dnsStart, time.Now()) },
+		DNSDone: func(httptrace.DNSDoneInfo) {
+			t.measure(&t.timing.DNSLookup, &t.dnsStart)
+		},
+		ConnectStart: func(string, string) { t.set(&t.connectStart, time.Now()) },
+		ConnectDone: func(string, string, error) {
+			t.measure(&t.timing.TCPConnect, &t.connectStart)
+		},
+		TLSHandshakeStart: func() { t.set(&t.tlsStart, time.Now()) },
+		TLSHandshakeDone: func(tls.ConnectionState, error) {
+			t.measure(&t.timing.TLSHandshake, &t.tlsStart)
+		},
+		GotConn: func(info httptrace.GotConnInfo) {
+			t.mu.Lock()
+			defer t.mu.Unlock()
+			t.timing.ReusedConnection = info.Reused
+		},
+		GotFirstResponseByte: func() { t.measure(&t.timing.FirstByte, &t.start) },
+	}
+	return req.WithContext(httptrace.WithClientTrace(req.Context(), trace)), t
+}
+
+func (t *phaseTracer) set(at *time.Time, now time.Time) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	*at = now
+}
+
+// measure sets d to the time elapsed since the start of the phase.
+func (t *phaseTracer) measure(d *time.Duration, phaseStart *time.Time) {
+	now := time.Now()
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if !phaseStart.IsZero() {
+		*d = now.Sub(*phaseStart)
+	}
+}
+
+func (t *phaseTracer) result() phaseTiming {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return t.timing
+}
+
+// timingRecorder records the phase timing of the latest http probe of each
+// target.
+type timingRecorder struct {
+	mu      sync.Mutex
+	timings map[string]phaseTiming
+}
+
+func newTimingRecorder() *timingRecorder {
+	return &timingRecorder{timings: make(map[string]phaseTiming)}
+}
+
+func (r *timingRecorder) record(target string, t phaseTiming) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.timings[target] = t
+}
+
+// snapshot returns the recorded timings, or nil if none.
+func (r *timingRecorder) snapshot() map[string]phaseTiming {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if len(r.timings) == 0 {
+		return nil
+	}
+	out := make(map[string]phaseTiming, len(r.timings))
+	for target, t := range r.timings {
+		out[target] = t
+	}
+	return out
+}
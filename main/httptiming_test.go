@@ -0,0 +1,60 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/go-kit/kit/log"
+	"github.com/stretchr/testify/require"
+)
+
+func Test_traceRequest(t *testing.T) {
+	srv := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		time.Sleep(20 * time.Millisecond)
+	}))
+	defer srv.Close()
+
+	req, err := http.NewRequest("GET", srv.URL, nil)
+	require.Nil(t, err)
+	req, tracer := traceRequest(req)
+	resp, err := srv.Client().Do(req)
+	require.Nil(t, err)
+	resp.Body.Close()
+
+	timing := tracer.result()
+	require.Zero(t, timing.DNSLookup, "IP address not looked up")
+	require.NotZero(t, timing.TCPConnect)
+	require.NotZero(t, timing.TLSHandshake)
+	require.True(t, timing.FirstByte >= 20*time.Millisecond, "time to first byte %s", timing.FirstByte)
+	require.False(t, timing.ReusedConnection)
+}
+
+func Test_timingRecorder(t *testing.T) {
+	r := newTimingRecorder()
+	require.Nil(t, r.snapshot())
+
+	r.record("http://localhost:80/health", phaseTiming{TCPConnect: time.Millisecond})
+	r.record("http://localhost:80/health", phaseTiming{TCPConnect: 2 * time.Millisecond})
+	require.Equal(t, map[string]phaseTiming{"http://localhost:80/health": {TCPConnect: 2 * time.Millisecond}}, r.snapshot())
+}
+
+func Test_HttpHealthProbe_timingAtDebugLevel(t *testing.T) {
+	defer logFilter.setLevel(levelInfo)
+	defer func(r *timingRecorder) { probeTimings = r }(probeTimings)
+	probeTimings = newTimingRecorder()
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer srv.Close()
+	p := &HttpHealthProbe{HttpClient: srv.Client(), Address: srv.URL}
+
+	_, err := p.evaluate(context.Background(), log.NewContext(log.NewNopLogger()))
+	require.Nil(t, err)
+	require.Nil(t, probeTimings.snapshot(), "only at debug level")
+
+	logFilter.setLevel(levelDebug)
+	_, err = p.evaluate(context.Background(), log.NewContext(log.NewNopLogger()))
+	require.Nil(t, err)
+	require.Contains(t, probeTimings.snapshot(), srv.URL)
+}
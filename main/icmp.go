@@ -0,0 +1,172 @@
+package main
+
+import (
+	"context"
+	"encoding/binary"
+	"net"
+	"os"
+	"time"
+
+	"github.com/go-kit/kit/log"
+	"github.com/pkg/errors"
+)
+
+const (
+	defaultIcmpCount   = 3
+	defaultIcmpTimeout = time.Second
+
+	icmpv4EchoRequest = 8
+	icmpv4EchoReply   = 0
+	icmpv6EchoRequest = 128
+	icmpv6EchoReply   = 129
+)
+
+var (
+	errIcmpRequiresAddress     = errors.New("'icmpAddress' must be specified when using 'icmp' protocol")
+	errIcmpSettingsRequireIcmp = errors.New("'icmpAddress', 'icmpCount' and 'icmpTimeoutInMilliseconds' can only be specified when using 'icmp' protocol")
+	errIcmpWithPort            = errors.New("'host', 'port', 'requestPath', 'systemdSocket', 'portFile' and 'unixSocketPath' cannot be specified when using 'icmp' protocol")
+	errIcmpWithSshTunnel       = errors.New("'icmp' protocol cannot be used together with 'sshTunnel'")
+)
+
+// IcmpHealthProbe sends ICMP echo requests to a host and reports it healthy if
+// any of them is answered before the timeout.
+type IcmpHealthProbe struct {
+	Host      string
+	Count     int
+	Timeout   time.Duration // for each echo request
+	Allowlist *targetAllowlist
+	// IPVersion restricts the addresses Host resolves to, ipVersionAny if
+	// the first one is pinged whatever its version.
+	IPVersion string
+
+	seq uint16
+}
+
+func (p *IcmpHealthProbe) evaluate(probeCtx context.Context, ctx *log.Context) (HealthStatus, error) {
+	lookupCtx, cancel := context.WithTimeout(probeCtx, defaultProbeTimeout)
+	defer cancel()
+	version := p.IPVersion
+	if version == "" {
+		version = ipVersionAny
+	}
+	ips, err := net.DefaultResolver.LookupIP(lookupCtx, ipNetwork(version), p.Host)
+	if err != nil {
+		return Unknown, errors.Wrap(err, "failed to resolve the probed address")
+	}
+	ip := ips[0]
+	if !p.Allowlist.allowed(p.Host, ip) {
+		return Unknown, errors.Wrapf(errTargetNotAllowed, "%s (%s)", p.Host, ip)
+	}
+
+	network, request, reply := "ip4:icmp", byte(icmpv4EchoRequest), byte(icmpv4EchoReply)
+	if ip.To4() == nil {
+		network, request, reply = "ip6:ipv6-icmp", icmpv6EchoRequest, icmpv6EchoReply
+	}
+	conn, err := net.ListenPacket(network, "")
+	if err != nil {
+		// a failure of the extension, e.g. lacking privileges
+		return Unknown, errors.Wrap(err, "failed to open icmp socket")
+	}
+	defer conn.Close()
+
+	id := uint16(os.Getpid())
+	buf := make([]byte, 1500)
+	for i := 0; i < p.Count; i++ {
+		if err := probeCtx.Err(); err != nil {
+			return Unknown, err
+		}
+		p.seq++
+		if _, err := conn.WriteTo(icmpEcho(request, id, p.seq), &net.IPAddr{IP: ip}); err != nil {
+			ctx.Log("event", "failed to send icmp echo request", "address", ip, "error", err)
+			continue
+		}
+		conn.SetReadDeadline(time.Now().Add(p.Timeout))
+		for {
+			n, from, err := conn.ReadFrom(buf)
+			if err != nil {
+				break // timed out
+			}
+			if from.(*net.IPAddr).IP.Equal(ip) && isIcmpEchoReply(buf[:n], reply, id, p.seq) {
+				return Healthy, nil
+			}
+		}
+	}
+	return Unhealthy, nil
+}
+
+func (p *IcmpHealthProbe) address() string {
+	return p.Host
+}
+
+// icmpEcho builds an ICMP echo request of the given type. The checksum of
+// ICMPv6 messages is filled in by the kernel.
+func icmpEcho(typ byte, id, seq uint16) []byte {
+	b := []byte{typ, 0, 0, 0, 0, 0, 0, 0, 'a', 'p', 'p', 'h', 'e', 'a', 'l', 't', 'h'}
+	binary.BigEndian.PutUint16(b[4:], id)
+	binary.BigEndian.PutUint16(b[6:], seq)
+	if typ == icmpv4EchoRequest {
+		binary.BigEndian.PutUint16(b[2:], icmpChecksum(b))
+	}
+	return b
+}
+
+// isIcmpEchoReply reports whether b is the echo reply of the given type to the
+// request with id and seq.
+func isIcmpEchoReply(b []byte, typ byte, id, seq uint16) bool {
+	return len(b) >= 8 && b[0] == typ && b[1] == 0 &&
+		binary.BigEndian.Uint16(b[4:]) == id && binary.BigEndian.Uint16(b[6:]) == seq
+}
+
+// icmpChecksum computes the internet checksum of b.
+func icmpChecksum(b []byte) uint16 {
+	var sum uint32
+	for i := 0; i+1 < len(b); i += 2 {
+		sum += uint32(b[i])<<8 | uint32(b[i+1])
+	}
+	if len(b)%2 == 1 {
+		sum += uint32(b[len(b)-1]) << 8
+	}
+	for sum>>16 != 0 {
+		sum = sum&0xffff + sum>>16
+	}
+	return ^uint16(sum)
+}
+
+// validateIcmp makes logical validation of the settings of the icmp probe.
+func (h handlerSettings) validateIcmp() error {
+	p := h.publicSettings
+	if h.protocol() != "icmp" {
+		if p.IcmpAddress != "" || p.IcmpCount != 0 || p.IcmpTimeoutInMilliseconds != 0 {
+			return errIcmpSettingsRequireIcmp
+		}
+		return nil
+	}
+	if p.IcmpAddress == "" {
+		return errIcmpRequiresAddress
+	}
+	if h.publicSettings.Host != "" || h.port() != 0 || h.requestPath() != "" || h.systemdSocket() != "" || h.portFile() != "" || h.unixSocketPath() != "" {
+		return errIcmpWithPort
+	}
+	if h.sshTunnel() != nil {
+		return errIcmpWithSshTunnel
+	}
+	if p.AllowedTargets != nil {
+		allowlist, _ := parseTargetAllowlist(p.AllowedTargets) // checked by validate
+		if net.ParseIP(p.IcmpAddress) != nil && !allowlist.allowedHost(p.IcmpAddress) {
+			return errors.Wrap(errTargetNotAllowed, p.IcmpAddress)
+		}
+	}
+	return nil
+}
+
+// icmp returns the settings of the icmp probe.
+func (s *handlerSettings) icmp() (host string, count int, timeout time.Duration) {
+	count, timeout = defaultIcmpCount, defaultIcmpTimeout
+	if s.publicSettings.IcmpCount != 0 {
+		count = s.publicSettings.IcmpCount
+	}
+	if s.publicSettings.IcmpTimeoutInMilliseconds != 0 {
+		timeout = time.Duration(s.publicSettings.IcmpTimeoutInMilliseconds) * time.Millisecond
+	}
+	return s.publicSettings.IcmpAddress, count, timeout
+}
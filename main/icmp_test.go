@@ -0,0 +1,70 @@
+package main
+
+import (
+	"context"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/go-kit/kit/log"
+	"github.com/stretchr/testify/require"
+)
+
+func Test_icmpEcho(t *testing.T) {
+	b := icmpEcho(icmpv4EchoRequest, 0x1234, 7)
+	require.Equal(t, byte(icmpv4EchoRequest), b[0])
+	require.Equal(t, uint16(0), icmpChecksum(b), "checksum of a checksummed message")
+
+	reply := append([]byte{icmpv4EchoReply, 0, 0, 0}, b[4:]...)
+	require.True(t, isIcmpEchoReply(reply, icmpv4EchoReply, 0x1234, 7))
+	require.False(t, isIcmpEchoReply(reply, icmpv4EchoReply, 0x1234, 8), "other sequence")
+	require.False(t, isIcmpEchoReply(b, icmpv4EchoReply, 0x1234, 7), "request")
+	require.False(t, isIcmpEchoReply(reply[:4], icmpv4EchoReply, 0x1234, 7))
+
+	require.Equal(t, []byte{0, 0}, icmpEcho(icmpv6EchoRequest, 1, 1)[2:4], "computed by the kernel")
+}
+
+func Test_icmpChecksum(t *testing.T) {
+	// example of RFC 1071
+	require.Equal(t, ^uint16(0xddf2), icmpChecksum([]byte{0x00, 0x01, 0xf2, 0x03, 0xf4, 0xf5, 0xf6, 0xf7}))
+	require.Equal(t, ^uint16(0x0100), icmpChecksum([]byte{0x01}))
+}
+
+func Test_IcmpHealthProbe(t *testing.T) {
+	ctx := log.NewContext(log.NewNopLogger())
+	if c, err := net.ListenPacket("ip4:icmp", ""); err != nil {
+		t.Skip("raw icmp sockets not permitted: ", err)
+	} else {
+		c.Close()
+	}
+
+	p := &IcmpHealthProbe{Host: "127.0.0.1", Count: 2, Timeout: time.Second}
+	state, err := p.evaluate(context.Background(), ctx)
+	require.Nil(t, err)
+	require.Equal(t, Healthy, state)
+
+	allowlist, _ := parseTargetAllowlist([]string{"10.0.0.0/8"})
+	p = &IcmpHealthProbe{Host: "192.0.2.1", Count: 1, Timeout: 10 * time.Millisecond, Allowlist: allowlist}
+	_, err = p.evaluate(context.Background(), ctx)
+	require.NotNil(t, err)
+	require.Contains(t, err.Error(), errTargetNotAllowed.Error())
+}
+
+func Test_handlerSettingsValidate_icmp(t *testing.T) {
+	validate := func(p publicSettings) error { return handlerSettings{p, protectedSettings{}}.validate() }
+
+	require.Nil(t, validate(publicSettings{Protocol: "icmp", IcmpAddress: "10.0.0.1", IcmpCount: 5}))
+	require.Equal(t, errIcmpRequiresAddress, validate(publicSettings{Protocol: "icmp"}))
+	require.Equal(t, errIcmpWithPort, validate(publicSettings{Protocol: "icmp", IcmpAddress: "10.0.0.1", Port: 80}))
+	require.Equal(t, errIcmpSettingsRequireIcmp, validate(publicSettings{Protocol: "tcp", Port: 80, IcmpCount: 1}))
+
+	err := validate(publicSettings{Protocol: "icmp", IcmpAddress: "192.0.2.1", AllowedTargets: []string{"10.0.0.0/8"}})
+	require.NotNil(t, err)
+	require.Contains(t, err.Error(), errTargetNotAllowed.Error())
+
+	cfg := &handlerSettings{publicSettings: publicSettings{Protocol: "icmp", IcmpAddress: "gateway"}}
+	host, count, timeout := cfg.icmp()
+	require.Equal(t, "gateway", host)
+	require.Equal(t, defaultIcmpCount, count)
+	require.Equal(t, defaultIcmpTimeout, timeout)
+}
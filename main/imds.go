@@ -0,0 +1,175 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/go-kit/kit/log"
+	"github.com/pkg/errors"
+)
+
+const (
+	// imdsComputeURL is the Instance Metadata Service endpoint describing the
+	// VM the extension runs on.
+	imdsComputeURL = "http://169.254.169.254/metadata/instance/compute?api-version=2021-02-01"
+
+	vmMetadataSubstatusName = "AppHealthVMMetadata"
+
+	imdsTimeout = 5 * time.Second
+
+	// imdsRefreshInterval is how often the metadata is queried again, e.g.
+	// to pick up a VM moved to another host or zone.
+	imdsRefreshInterval = time.Hour
+	// imdsRetryInterval is how soon a failed query is retried.
+	imdsRetryInterval = time.Minute
+)
+
+// vmMetadata identifies the VM the application runs on, attached to the
+// health reports so they can be attributed without an inventory lookup.
+type vmMetadata struct {
+	VMID           string `json:"vmId"`
+	VMName         string `json:"vmName,omitempty"`
+	VMScaleSetName string `json:"vmScaleSetName,omitempty"`
+	InstanceID     string `json:"instanceId,omitempty"`
+	Region         string `json:"region"`
+	Zone           string `json:"zone,omitempty"`
+}
+
+// message formats the metadata as the substatus message.
+func (m vmMetadata) message() string {
+	return fmt.Sprintf("vmId=%s vmScaleSetName=%s instanceId=%s region=%s zone=%s",
+		m.VMID, m.VMScaleSetName, m.InstanceID, m.Region, m.Zone)
+}
+
+// imdsCompute is the subset of the IMDS compute document used.
+type imdsCompute struct {
+	VMID           string `json:"vmId"`
+	Name           string `json:"name"`
+	VMScaleSetName string `json:"vmScaleSetName"`
+	ResourceID     string `json:"resourceId"`
+	Location       string `json:"location"`
+	Zone           string `json:"zone"`
+}
+
+// fetchVMMetadata queries IMDS at url for the metadata of the VM.
+func fetchVMMetadata(client *http.Client, url string) (vmMetadata, error) {
+	req, err := http.NewRequest("GET", url, nil)
+	if err != nil {
+		return vmMetadata{}, err
+	}
+	req.Header.Set("Metadata", "true")
+	resp, err := client.Do(req)
+	if err != nil {
+		return vmMetadata{}, errors.Wrap(err, "failed to query IMDS")
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return vmMetadata{}, errors.Errorf("IMDS responded with %s", resp.Status)
+	}
+
+	var c imdsCompute
+	if err := json.NewDecoder(resp.Body).Decode(&c); err != nil {
+		return vmMetadata{}, errors.Wrap(err, "failed to parse IMDS response")
+	}
+	m := vmMetadata{VMID: c.VMID, VMName: c.Name, VMScaleSetName: c.VMScaleSetName, Region: c.Location, Zone: c.Zone}
+	if c.VMScaleSetName != "" {
+		// .../virtualMachineScaleSets/<name>/virtualMachines/<instance id>
+		if i := strings.LastIndex(c.ResourceID, "/virtualMachines/"); i != -1 {
+			m.InstanceID = c.ResourceID[i+len("/virtualMachines/"):]
+		}
+	}
+	return m, nil
+}
+
+// vmMetadataCache holds the VM metadata refreshed in the background, so that
+// the probe loop never waits on IMDS.
+type vmMetadataCache struct {
+	mu      sync.Mutex
+	meta    *vmMetadata
+	url     string
+	client  *http.Client
+	refresh time.Duration
+	retry   time.Duration
+	stop    chan struct{}
+}
+
+func newVMMetadataCache(url string) *vmMetadataCache {
+	return &vmMetadataCache{
+		url: url,
+		// IMDS must be reached directly, never through a proxy
+		client:  &http.Client{Timeout: imdsTimeout, Transport: &http.Transport{}},
+		refresh: imdsRefreshInterval,
+		retry:   imdsRetryInterval,
+		stop:    make(chan struct{}),
+	}
+}
+
+// start queries IMDS now and then periodically until closed.
+func (c *vmMetadataCache) start(ctx *log.Context) {
+	go func() {
+		for {
+			wait := c.refresh
+			m, err := fetchVMMetadata(c.client, c.url)
+			if err != nil {
+				ctx.Log("event", "failed to get VM metadata", "error", err)
+				wait = c.retry
+			} else {
+				c.mu.Lock()
+				changed := c.meta == nil || *c.meta != m
+				c.meta = &m
+				c.mu.Unlock()
+				if changed {
+					ctx.Log("event", "VM metadata", "metadata", m.message())
+				}
+			}
+			select {
+			case <-c.stop:
+				return
+			case <-time.After(wait):
+			}
+		}
+	}()
+}
+
+func (c *vmMetadataCache) Close() {
+	close(c.stop)
+}
+
+// get returns the latest known metadata, or nil if IMDS was never reached.
+func (c *vmMetadataCache) get() *vmMetadata {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.meta
+}
+
+// logContext returns ctx with the VM metadata attached to every event it logs.
+func (c *vmMetadataCache) logContext(ctx *log.Context) *log.Context {
+	field := func(f func(m *vmMetadata) string) log.Valuer {
+		return func() interface{} {
+			if m := c.get(); m != nil {
+				return f(m)
+			}
+			return ""
+		}
+	}
+	return ctx.With(
+		"vmId", field(func(m *vmMetadata) string { return m.VMID }),
+		"vmScaleSetName", field(func(m *vmMetadata) string { return m.VMScaleSetName }),
+		"instanceId", field(func(m *vmMetadata) string { return m.InstanceID }),
+		"region", field(func(m *vmMetadata) string { return m.Region }),
+		"zone", field(func(m *vmMetadata) string { return m.Zone }))
+}
+
+// substatus returns the substatus item reporting the VM metadata, or false if
+// it is not known yet.
+func (c *vmMetadataCache) substatus() (SubstatusItem, bool) {
+	m := c.get()
+	if m == nil {
+		return SubstatusItem{}, false
+	}
+	return NewSubstatus(StatusSuccess, vmMetadataSubstatusName, m.message()), true
+}
@@ -0,0 +1,104 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/go-kit/kit/log"
+	"github.com/stretchr/testify/require"
+)
+
+const testIMDSCompute = `{
+  "location": "westeurope",
+  "name": "web_3",
+  "resourceId": "/subscriptions/sub/resourceGroups/rg/providers/Microsoft.Compute/virtualMachineScaleSets/web/virtualMachines/3",
+  "vmId": "02aab8a4-74ef-476e-8182-f6d2ba4166a6",
+  "vmScaleSetName": "web",
+  "zone": "2"
+}`
+
+func Test_fetchVMMetadata(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Metadata") != "true" {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		w.Write([]byte(testIMDSCompute))
+	}))
+	defer srv.Close()
+
+	m, err := fetchVMMetadata(http.DefaultClient, srv.URL)
+	require.Nil(t, err)
+	require.Equal(t, vmMetadata{
+		VMID:           "02aab8a4-74ef-476e-8182-f6d2ba4166a6",
+		VMName:         "web_3",
+		VMScaleSetName: "web",
+		InstanceID:     "3",
+		Region:         "westeurope",
+		Zone:           "2",
+	}, m)
+	require.Equal(t, "vmId=02aab8a4-74ef-476e-8182-f6d2ba4166a6 vmScaleSetName=web instanceId=3 region=westeurope zone=2", m.message())
+}
+
+func Test_fetchVMMetadata_standaloneVM(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{"location": "eastus", "resourceId": "/subscriptions/sub/resourceGroups/rg/providers/Microsoft.Compute/virtualMachines/vm1", "vmId": "id"}`))
+	}))
+	defer srv.Close()
+
+	m, err := fetchVMMetadata(http.DefaultClient, srv.URL)
+	require.Nil(t, err)
+	require.Equal(t, vmMetadata{VMID: "id", Region: "eastus"}, m)
+}
+
+func Test_fetchVMMetadata_error(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusInternalServerError)
+	}))
+	defer srv.Close()
+
+	_, err := fetchVMMetadata(http.DefaultClient, srv.URL)
+	require.NotNil(t, err)
+	require.Contains(t, err.Error(), "IMDS responded with 500")
+}
+
+func Test_vmMetadataCache(t *testing.T) {
+	var healthy int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if atomic.LoadInt32(&healthy) == 0 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		w.Write([]byte(testIMDSCompute))
+	}))
+	defer srv.Close()
+
+	var buf syncBuffer
+	c := newVMMetadataCache(srv.URL)
+	c.retry = 10 * time.Millisecond
+	ctx := c.logContext(log.NewContext(log.NewLogfmtLogger(&buf)))
+	ctx.Log("event", "test")
+	require.Contains(t, buf.String(), `vmId= vmScaleSetName=`, "unknown until IMDS responds")
+
+	c.start(log.NewContext(log.NewNopLogger()))
+	defer c.Close()
+	_, ok := c.substatus()
+	require.False(t, ok)
+
+	// retried until IMDS responds
+	atomic.StoreInt32(&healthy, 1)
+	for deadline := time.Now().Add(5 * time.Second); c.get() == nil; time.Sleep(time.Millisecond) {
+		require.True(t, time.Now().Before(deadline), "metadata not fetched")
+	}
+	item, ok := c.substatus()
+	require.True(t, ok)
+	require.Equal(t, vmMetadataSubstatusName, item.Name)
+	require.Equal(t, StatusSuccess, item.Status)
+	require.Contains(t, item.FormattedMessage.Message, "instanceId=3")
+
+	ctx.Log("event", "test")
+	require.Contains(t, buf.String(), "vmId=02aab8a4-74ef-476e-8182-f6d2ba4166a6 vmScaleSetName=web instanceId=3 region=westeurope zone=2")
+}
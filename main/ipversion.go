@@ -0,0 +1,83 @@
+package main
+
+import (
+	"context"
+	"net"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+const (
+	ipVersionAny = "any"
+	ipVersion4   = "4"
+	ipVersion6   = "6"
+)
+
+var errIPVersionUnsupported = errors.New("'ipVersion' cannot be used together with 'unixSocketPath', 'sshTunnel' or a protocol not connecting to the application, e.g. 'exec'")
+
+// ipVersion returns the IP version probes connect with, ipVersionAny if
+// either.
+func (s *handlerSettings) ipVersion() string {
+	if s.publicSettings.IPVersion == "" {
+		return ipVersionAny
+	}
+	return s.publicSettings.IPVersion
+}
+
+// validateIPVersion makes logical validation of 'ipVersion'.
+func (h handlerSettings) validateIPVersion() error {
+	if h.ipVersion() == ipVersionAny {
+		return nil
+	}
+	if h.unixSocketPath() != "" || h.sshTunnel() != nil || isLocalProtocol(h.protocol()) {
+		return errIPVersionUnsupported
+	}
+	return nil
+}
+
+// isLocalProtocol reports whether probes of the protocol check the application
+// without connecting to it.
+func isLocalProtocol(protocol string) bool {
+	switch protocol {
+	case "exec", "file", "systemd", "docker", "process":
+		return true
+	}
+	return false
+}
+
+// withIPVersion returns a dialFunc connecting through dial with only the
+// given IP version, e.g. to ::1 rather than 127.0.0.1 for localhost.
+func withIPVersion(dial dialFunc, version string) dialFunc {
+	if version == ipVersionAny {
+		return dial
+	}
+	return func(ctx context.Context, network, addr string) (net.Conn, error) {
+		if network == "tcp" || network == "udp" {
+			network += version
+		}
+		return dial(ctx, network, addr)
+	}
+}
+
+// ipNetwork returns the network resolving names to addresses of the given IP
+// version for net.Resolver.LookupIP.
+func ipNetwork(version string) string {
+	if version == ipVersionAny {
+		return "ip"
+	}
+	return "ip" + version
+}
+
+// matchesNetwork reports whether ip can be connected to on network, e.g. not
+// an IPv4 address on "tcp6".
+func matchesNetwork(network, ip string) bool {
+	v4 := net.ParseIP(ip).To4() != nil
+	switch {
+	case strings.HasSuffix(network, "4"):
+		return v4
+	case strings.HasSuffix(network, "6"):
+		return !v4
+	}
+	return true
+}
@@ -0,0 +1,91 @@
+package main
+
+import (
+	"context"
+	"net"
+	"testing"
+
+	"github.com/go-kit/kit/log"
+	"github.com/stretchr/testify/require"
+)
+
+func Test_withIPVersion(t *testing.T) {
+	var dialed string
+	dial := func(ctx context.Context, network, addr string) (net.Conn, error) {
+		dialed = network
+		return nil, nil
+	}
+	for _, c := range []struct{ version, network, expected string }{
+		{ipVersionAny, "tcp", "tcp"},
+		{ipVersion4, "tcp", "tcp4"},
+		{ipVersion6, "tcp", "tcp6"},
+		{ipVersion6, "udp", "udp6"},
+		{ipVersion6, "unix", "unix"},
+	} {
+		withIPVersion(dial, c.version)(context.Background(), c.network, "localhost:80")
+		require.Equal(t, c.expected, dialed)
+	}
+}
+
+func Test_matchesNetwork(t *testing.T) {
+	require.True(t, matchesNetwork("tcp", "::1"))
+	require.True(t, matchesNetwork("tcp", "127.0.0.1"))
+	require.True(t, matchesNetwork("tcp4", "127.0.0.1"))
+	require.False(t, matchesNetwork("tcp4", "::1"))
+	require.True(t, matchesNetwork("tcp6", "2001:db8::1"))
+	require.False(t, matchesNetwork("tcp6", "127.0.0.1"))
+}
+
+func Test_TcpHealthProbe_ipVersion(t *testing.T) {
+	l, err := net.Listen("tcp6", "[::1]:0")
+	if err != nil {
+		t.Skip("IPv6 loopback not available")
+	}
+	defer l.Close()
+	go func() {
+		for {
+			conn, err := l.Accept()
+			if err != nil {
+				return
+			}
+			conn.Close()
+		}
+	}()
+
+	ctx := log.NewContext(log.NewNopLogger())
+	for _, c := range []struct {
+		version  string
+		expected HealthStatus
+	}{
+		{ipVersionAny, Healthy},
+		{ipVersion6, Healthy},
+		{ipVersion4, Unhealthy},
+	} {
+		p := &TcpHealthProbe{Address: l.Addr().String(), Dial: withIPVersion((*targetAllowlist)(nil).dialContext, c.version)}
+		state, _ := p.evaluate(context.Background(), ctx)
+		require.Equal(t, c.expected, state, c.version)
+	}
+
+	// only the IPv6 addresses of the target are connected to
+	d := newAddressPolicyDialer(ctx, addressPolicyAll, nil)
+	d.lookup = func(context.Context, string) ([]string, error) { return []string{"127.0.0.3", "::1"}, nil }
+	d.recorder = newAddressRecorder()
+	_, port, _ := net.SplitHostPort(l.Addr().String())
+	conn, err := withIPVersion(d.dialContext, ipVersion6)(context.Background(), "tcp", "app:"+port)
+	require.Nil(t, err)
+	conn.Close()
+	require.Equal(t, "app:"+port+"=[::1]:"+port, d.recorder.message())
+}
+
+func Test_handlerSettingsValidate_ipVersion(t *testing.T) {
+	require.Equal(t, ipVersionAny, (&handlerSettings{}).ipVersion())
+	require.Nil(t, handlerSettings{publicSettings{Protocol: "tcp", Port: 80, IPVersion: ipVersion6}, protectedSettings{}}.validate())
+	require.Equal(t, errIPVersionUnsupported, handlerSettings{
+		publicSettings{Protocol: "http", UnixSocketPath: "/run/app.sock", IPVersion: ipVersion6},
+		protectedSettings{},
+	}.validate())
+	require.Equal(t, errIPVersionUnsupported, handlerSettings{
+		publicSettings{Protocol: "exec", Command: []string{"/bin/true"}, IPVersion: ipVersion4},
+		protectedSettings{},
+	}.validate())
+}
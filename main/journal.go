@@ -0,0 +1,97 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// probeJournalFile is the file under dataDir each probe outcome is appended to
+// until the health state is persisted, so that the outcomes of an interval
+// interrupted by a kill are not lost.
+const probeJournalFile = "probejournal.jsonl"
+
+// journalEntry is the outcome of a probe of an application.
+type journalEntry struct {
+	Time        time.Time    `json:"time"`
+	Application string       `json:"application,omitempty"`
+	Result      HealthStatus `json:"result"`
+}
+
+// appendJournal appends the entry to the journal at path, flushed to disk
+// before returning.
+func appendJournal(path string, e journalEntry) error {
+	b, err := json.Marshal(e)
+	if err != nil {
+		return errors.Wrap(err, "failed to marshal journal entry")
+	}
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0600)
+	if err != nil {
+		return errors.Wrap(err, "failed to open probe journal")
+	}
+	if _, err := f.Write(append(b, '\n')); err != nil {
+		f.Close()
+		return errors.Wrap(err, "failed to write probe journal")
+	}
+	if err := f.Sync(); err != nil {
+		f.Close()
+		return errors.Wrap(err, "failed to flush probe journal")
+	}
+	return errors.Wrap(f.Close(), "failed to write probe journal")
+}
+
+// loadJournal reads the entries of the journal at path. An entry torn by a
+// kill while it was written ends the journal.
+func loadJournal(path string) ([]journalEntry, error) {
+	b, err := ioutil.ReadFile(path)
+	if os.IsNotExist(err) {
+		return nil, nil
+	} else if err != nil {
+		return nil, errors.Wrap(err, "failed to read probe journal")
+	}
+	var out []journalEntry
+	s := bufio.NewScanner(bytes.NewReader(b))
+	for s.Scan() {
+		var e journalEntry
+		if err := json.Unmarshal(s.Bytes(), &e); err != nil {
+			break
+		}
+		out = append(out, e)
+	}
+	return out, nil
+}
+
+// clearJournal removes the journal at path, once its entries are part of the
+// persisted health state.
+func clearJournal(path string) error {
+	if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+		return errors.Wrap(err, "failed to clear probe journal")
+	}
+	return nil
+}
+
+// replay feeds the journaled outcomes made after since to the state machines
+// of their applications, ignoring those of applications no longer monitored.
+// It returns the number of outcomes replayed.
+func (m *monitor) replay(entries []journalEntry, since time.Time) int {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	n := 0
+	for _, e := range entries {
+		if !e.Time.After(since) {
+			continue
+		}
+		for _, g := range m.groups {
+			if g.persistedAs(e.Application) {
+				g.machine.observe(e.Time, e.Result)
+				n++
+			}
+		}
+	}
+	return n
+}
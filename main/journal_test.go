@@ -0,0 +1,89 @@
+package main
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/go-kit/kit/log"
+	"github.com/stretchr/testify/require"
+)
+
+func Test_journal_appendAndLoad(t *testing.T) {
+	dir, err := ioutil.TempDir("", "")
+	require.Nil(t, err)
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, probeJournalFile)
+
+	entries, err := loadJournal(path)
+	require.Nil(t, err)
+	require.Empty(t, entries)
+
+	now := time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+	require.Nil(t, appendJournal(path, journalEntry{Time: now, Application: "web", Result: Unhealthy}))
+	require.Nil(t, appendJournal(path, journalEntry{Time: now.Add(time.Second), Result: Healthy}))
+
+	// torn by a kill
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_APPEND, 0600)
+	require.Nil(t, err)
+	_, err = f.WriteString(`{"time":"2020-01-01T00:0`)
+	require.Nil(t, err)
+	f.Close()
+
+	entries, err = loadJournal(path)
+	require.Nil(t, err)
+	require.Equal(t, []journalEntry{
+		{Time: now, Application: "web", Result: Unhealthy},
+		{Time: now.Add(time.Second), Result: Healthy},
+	}, entries)
+
+	require.Nil(t, clearJournal(path))
+	require.Nil(t, clearJournal(path), "already cleared")
+	entries, err = loadJournal(path)
+	require.Nil(t, err)
+	require.Empty(t, entries)
+}
+
+func Test_monitor_replay(t *testing.T) {
+	now := time.Now()
+	m := newMonitor(&handlerSettings{}, now, newExtensionMetrics(now, 0))
+	n := m.replay([]journalEntry{
+		{Time: now.Add(-time.Second), Result: Healthy},
+		{Time: now.Add(time.Second), Application: "gone", Result: Healthy},
+		{Time: now.Add(2 * time.Second), Result: Unhealthy},
+	}, now)
+	require.Equal(t, 1, n, "older and unknown outcomes skipped")
+	require.Equal(t, Unhealthy, m.state())
+}
+
+func Test_probeLoop_replayJournal(t *testing.T) {
+	dir, err := ioutil.TempDir("", "")
+	require.Nil(t, err)
+	defer os.RemoveAll(dir)
+	ctx := log.NewContext(log.NewNopLogger())
+	cfg := handlerSettings{publicSettings: publicSettings{PersistState: true}}
+
+	// killed after probing, before the state is saved
+	loop, _ := newTestLoop(cfg, &scriptedProbe{[]HealthStatus{Unhealthy}}, 0)
+	loop.statePath = filepath.Join(dir, healthStateFile)
+	loop.journalPath = filepath.Join(dir, probeJournalFile)
+	require.Equal(t, errTerminated, loop.run(context.Background(), ctx))
+	_, saved, err := loadHealthState(loop.statePath)
+	require.Nil(t, err)
+	require.False(t, saved)
+
+	loop, _ = newTestLoop(cfg, &scriptedProbe{[]HealthStatus{Unhealthy}}, 1)
+	loop.statePath = filepath.Join(dir, healthStateFile)
+	loop.journalPath = filepath.Join(dir, probeJournalFile)
+	loop.start(ctx)
+	require.Equal(t, Unhealthy, loop.mon.state(), "interrupted interval replayed")
+
+	// cleared once the state is saved
+	require.Equal(t, errTerminated, loop.run(context.Background(), ctx))
+	entries, err := loadJournal(loop.journalPath)
+	require.Nil(t, err)
+	require.Empty(t, entries)
+}
@@ -0,0 +1,154 @@
+package main
+
+import (
+	"encoding/json"
+	"reflect"
+	"strconv"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+var (
+	errInvalidJsonPath          = errors.New("'responseJsonPath' is not a valid JSONPath")
+	errJsonPathRequiresHttp     = errors.New("'responseJsonPath' and 'expectedValue' can only be specified when using 'http' or 'https' protocol")
+	errJsonPathAndExpectedValue = errors.New("'responseJsonPath' and 'expectedValue' must be specified together")
+	errHeadWithJsonPath         = errors.New("'responseJsonPath' cannot be used when 'httpMethod' is HEAD")
+	errJsonPathValueNotFound    = errors.New("response body has no value at the JSONPath")
+	errJsonPathValueNotMatching = errors.New("response body value at the JSONPath is not the expected value")
+)
+
+// jsonPath is a JSONPath selecting a single value by member names and array
+// indexes, e.g. $.components.db.status or $['components'][0]. Wildcards,
+// slices and filters are not supported.
+type jsonPath struct {
+	expr  string
+	steps []interface{} // string member names and int array indexes
+}
+
+// parseJsonPath parses expr, which must start with the root '$'.
+func parseJsonPath(expr string) (*jsonPath, error) {
+	if !strings.HasPrefix(expr, "$") {
+		return nil, errors.Wrap(errInvalidJsonPath, "must start with '$'")
+	}
+	p := &jsonPath{expr: expr}
+	rest := expr[1:]
+	for rest != "" {
+		switch {
+		case rest[0] == '.':
+			end := strings.IndexAny(rest[1:], ".[")
+			if end == -1 {
+				end = len(rest) - 1
+			}
+			name := rest[1 : end+1]
+			if name == "" || name == "*" {
+				return nil, errors.Wrapf(errInvalidJsonPath, "unsupported member %q", name)
+			}
+			p.steps = append(p.steps, name)
+			rest = rest[end+1:]
+		case strings.HasPrefix(rest, "['"):
+			end := strings.Index(rest, "']")
+			if end == -1 {
+				return nil, errors.Wrap(errInvalidJsonPath, "unterminated member name")
+			}
+			p.steps = append(p.steps, rest[2:end])
+			rest = rest[end+2:]
+		case rest[0] == '[':
+			end := strings.IndexByte(rest, ']')
+			if end == -1 {
+				return nil, errors.Wrap(errInvalidJsonPath, "unterminated index")
+			}
+			i, err := strconv.Atoi(rest[1:end])
+			if err != nil || i < 0 {
+				return nil, errors.Wrapf(errInvalidJsonPath, "unsupported index %q", rest[1:end])
+			}
+			p.steps = append(p.steps, i)
+			rest = rest[end+1:]
+		default:
+			return nil, errors.Wrapf(errInvalidJsonPath, "unexpected %q", rest)
+		}
+	}
+	return p, nil
+}
+
+// lookup returns the value selected in the decoded JSON document, or false if
+// there is none.
+func (p *jsonPath) lookup(doc interface{}) (interface{}, bool) {
+	v := doc
+	for _, step := range p.steps {
+		switch s := step.(type) {
+		case string:
+			obj, ok := v.(map[string]interface{})
+			if !ok {
+				return nil, false
+			}
+			if v, ok = obj[s]; !ok {
+				return nil, false
+			}
+		case int:
+			arr, ok := v.([]interface{})
+			if !ok || s >= len(arr) {
+				return nil, false
+			}
+			v = arr[s]
+		}
+	}
+	return v, true
+}
+
+func (p *jsonPath) String() string {
+	return p.expr
+}
+
+// checkJsonPath checks that the value at path in the JSON body equals
+// expected, a value decoded from JSON.
+func checkJsonPath(path *jsonPath, expected interface{}, body []byte) error {
+	var doc interface{}
+	if err := json.Unmarshal(body, &doc); err != nil {
+		return errors.Wrap(err, "response body is not valid JSON")
+	}
+	v, ok := path.lookup(doc)
+	if !ok {
+		return errors.Wrap(errJsonPathValueNotFound, path.expr)
+	}
+	if !reflect.DeepEqual(v, expected) {
+		return errors.Wrapf(errJsonPathValueNotMatching, "%s is %v", path.expr, v)
+	}
+	return nil
+}
+
+// responseJsonPath returns the JSONPath of the value of the response body of
+// http probes compared to the expected value, or nil if none is compared.
+func (s *handlerSettings) responseJsonPath() *jsonPath {
+	if s.publicSettings.ResponseJsonPath == "" {
+		return nil
+	}
+	p, _ := parseJsonPath(s.publicSettings.ResponseJsonPath) // checked by validate
+	return p
+}
+
+// expectedValue returns the value expected at responseJsonPath.
+func (s *handlerSettings) expectedValue() interface{} {
+	var v interface{}
+	json.Unmarshal(s.publicSettings.ExpectedValue, &v) // checked by the schema
+	return v
+}
+
+// validateJsonPath makes logical validation of the JSONPath assertion.
+func (h handlerSettings) validateJsonPath() error {
+	p := h.publicSettings
+	if p.ResponseJsonPath == "" && len(p.ExpectedValue) == 0 {
+		return nil
+	}
+	if !h.allowsHttpRequest() {
+		return errJsonPathRequiresHttp
+	}
+	if p.ResponseJsonPath == "" || len(p.ExpectedValue) == 0 {
+		return errJsonPathAndExpectedValue
+	}
+	if h.httpMethod() == "HEAD" {
+		return errHeadWithJsonPath
+	}
+	_, err := parseJsonPath(p.ResponseJsonPath)
+	return err
+}
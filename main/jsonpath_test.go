@@ -0,0 +1,124 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/go-kit/kit/log"
+	"github.com/stretchr/testify/require"
+)
+
+const testHealthDocument = `{
+  "status": "UP",
+  "components": {
+    "db": {"status": "DOWN", "details": {"pool": 3}},
+    "disk.space": {"status": "UP"}
+  },
+  "checks": [{"name": "cache", "ok": true}]
+}`
+
+func Test_parseJsonPath(t *testing.T) {
+	var doc interface{}
+	require.Nil(t, json.Unmarshal([]byte(testHealthDocument), &doc))
+
+	for expr, expected := range map[string]interface{}{
+		"$":                            doc,
+		"$.status":                     "UP",
+		"$.components.db.status":       "DOWN",
+		"$.components.db.details.pool": float64(3),
+		"$.components['disk.space']":   map[string]interface{}{"status": "UP"},
+		"$['checks'][0].ok":            true,
+	} {
+		p, err := parseJsonPath(expr)
+		require.Nil(t, err, expr)
+		v, ok := p.lookup(doc)
+		require.True(t, ok, expr)
+		require.Equal(t, expected, v, expr)
+	}
+
+	for _, expr := range []string{"$.missing", "$.status.length", "$.checks[1]", "$.components[0]"} {
+		p, err := parseJsonPath(expr)
+		require.Nil(t, err, expr)
+		_, ok := p.lookup(doc)
+		require.False(t, ok, expr)
+	}
+
+	for _, expr := range []string{"status", "$..status", "$.*", "$.checks[-1]", "$.checks[0", "$['status", "$status"} {
+		_, err := parseJsonPath(expr)
+		require.NotNil(t, err, expr)
+		require.Contains(t, err.Error(), errInvalidJsonPath.Error(), expr)
+	}
+}
+
+func Test_checkJsonPath(t *testing.T) {
+	p, _ := parseJsonPath("$.components.db.status")
+	require.Nil(t, checkJsonPath(p, "DOWN", []byte(testHealthDocument)))
+
+	err := checkJsonPath(p, "UP", []byte(testHealthDocument))
+	require.NotNil(t, err)
+	require.Contains(t, err.Error(), errJsonPathValueNotMatching.Error())
+
+	p, _ = parseJsonPath("$.components.cache.status")
+	err = checkJsonPath(p, "UP", []byte(testHealthDocument))
+	require.NotNil(t, err)
+	require.Contains(t, err.Error(), errJsonPathValueNotFound.Error())
+
+	err = checkJsonPath(p, "UP", []byte("<html>"))
+	require.NotNil(t, err)
+	require.Contains(t, err.Error(), "response body is not valid JSON")
+}
+
+func Test_HttpHealthProbe_responseJsonPath(t *testing.T) {
+	ctx := log.NewContext(log.NewNopLogger())
+	body := testHealthDocument
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(body))
+	}))
+	defer srv.Close()
+
+	cfg := &handlerSettings{publicSettings: publicSettings{Protocol: "http", ResponseJsonPath: "$.checks[0].ok", ExpectedValue: json.RawMessage(`true`)}}
+	p := NewHttpHealthProbe("http", "localhost", "", 0)
+	p.Address = srv.URL
+	p.ResponseJsonPath, p.ExpectedValue = cfg.responseJsonPath(), cfg.expectedValue()
+
+	state, err := p.evaluate(context.Background(), ctx)
+	require.Nil(t, err)
+	require.Equal(t, Healthy, state)
+
+	body = `{"checks": [{"ok": false}]}`
+	state, err = p.evaluate(context.Background(), ctx)
+	require.Nil(t, err)
+	require.Equal(t, Unhealthy, state)
+}
+
+func Test_handlerSettingsValidate_responseJsonPath(t *testing.T) {
+	require.Nil(t, handlerSettings{
+		publicSettings{Protocol: "http", ResponseJsonPath: "$.status", ExpectedValue: json.RawMessage(`"UP"`)},
+		protectedSettings{},
+	}.validate())
+	require.Equal(t, errJsonPathRequiresHttp, handlerSettings{
+		publicSettings{Protocol: "tcp", Port: 80, ResponseJsonPath: "$.status", ExpectedValue: json.RawMessage(`"UP"`)},
+		protectedSettings{},
+	}.validate())
+	require.Equal(t, errJsonPathAndExpectedValue, handlerSettings{
+		publicSettings{Protocol: "http", ResponseJsonPath: "$.status"},
+		protectedSettings{},
+	}.validate())
+	require.Equal(t, errJsonPathAndExpectedValue, handlerSettings{
+		publicSettings{Protocol: "http", ExpectedValue: json.RawMessage(`"UP"`)},
+		protectedSettings{},
+	}.validate())
+	require.Equal(t, errHeadWithJsonPath, handlerSettings{
+		publicSettings{Protocol: "http", HttpMethod: "HEAD", ResponseJsonPath: "$.status", ExpectedValue: json.RawMessage(`"UP"`)},
+		protectedSettings{},
+	}.validate())
+	err := handlerSettings{
+		publicSettings{Protocol: "http", ResponseJsonPath: "$.*", ExpectedValue: json.RawMessage(`"UP"`)},
+		protectedSettings{},
+	}.validate()
+	require.NotNil(t, err)
+	require.Contains(t, err.Error(), errInvalidJsonPath.Error())
+}
@@ -0,0 +1,71 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	probeLatencySubstatusName = "AppHealthProbeLatency"
+
+	// latencyWindow is the number of latest probes the average latency is
+	// computed over.
+	latencyWindow = 10
+)
+
+// probeLatencies records how long the probes of each target took.
+var probeLatencies = newLatencyRecorder()
+
+// latencyRecorder records the latest round-trip times of the probes of each
+// target.
+type latencyRecorder struct {
+	mu      sync.Mutex
+	samples map[string][]time.Duration // newest last
+}
+
+func newLatencyRecorder() *latencyRecorder {
+	return &latencyRecorder{samples: make(map[string][]time.Duration)}
+}
+
+// record adds the duration of a probe of target.
+func (r *latencyRecorder) record(target string, d time.Duration) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	s := append(r.samples[target], d)
+	if over := len(s) - latencyWindow; over > 0 {
+		s = s[over:]
+	}
+	r.samples[target] = s
+}
+
+// message formats the latest and the average latency of each target as the
+// substatus message, e.g. "localhost:80 last=12ms average=15ms".
+func (r *latencyRecorder) message() string {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	var out []string
+	for target, s := range r.samples {
+		var sum time.Duration
+		for _, d := range s {
+			sum += d
+		}
+		out = append(out, fmt.Sprintf("%s last=%s average=%s", target,
+			roundLatency(s[len(s)-1]), roundLatency(sum/time.Duration(len(s)))))
+	}
+	sort.Strings(out)
+	return strings.Join(out, "; ")
+}
+
+func roundLatency(d time.Duration) time.Duration {
+	if d < 10*time.Millisecond {
+		return d.Round(10 * time.Microsecond)
+	}
+	return d.Round(time.Millisecond)
+}
+
+func (s *handlerSettings) reportProbeLatency() bool {
+	return s.publicSettings.ReportProbeLatency
+}
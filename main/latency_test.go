@@ -0,0 +1,24 @@
+package main
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func Test_latencyRecorder(t *testing.T) {
+	r := newLatencyRecorder()
+	require.Equal(t, "", r.message())
+
+	r.record("localhost:80", 10*time.Millisecond)
+	r.record("localhost:80", 30*time.Millisecond)
+	r.record("/usr/bin/check", 1500*time.Microsecond)
+	require.Equal(t, "/usr/bin/check last=1.5ms average=1.5ms; localhost:80 last=30ms average=20ms", r.message())
+
+	for i := 0; i < latencyWindow; i++ {
+		r.record("localhost:80", 5*time.Millisecond)
+	}
+	require.Len(t, r.samples["localhost:80"], latencyWindow)
+	require.Contains(t, r.message(), "localhost:80 last=5ms average=5ms")
+}
@@ -0,0 +1,90 @@
+package main
+
+import (
+	"fmt"
+	"io/ioutil"
+	"runtime"
+	"time"
+)
+
+const (
+	// leakCheckInterval is the time between two resource samples. The first
+	// sample, taken one interval after the loop started, is the baseline.
+	leakCheckInterval = 10 * time.Minute
+
+	// leakCheckConfirmations is the number of consecutive samples over the
+	// thresholds required to report a leak, so that load spikes are ignored.
+	leakCheckConfirmations = 3
+
+	// growth over the baseline considered a leak
+	leakGoroutineGrowth = 100
+	leakFDGrowth        = 100
+	leakHeapFactor      = 4
+	leakHeapMinGrowth   = 64 << 20
+)
+
+// resourceSample is a snapshot of the resources held by the process.
+type resourceSample struct {
+	goroutines int
+	fds        int
+	heap       uint64
+}
+
+func (s resourceSample) String() string {
+	return fmt.Sprintf("goroutines=%d fds=%d heap=%d", s.goroutines, s.fds, s.heap)
+}
+
+// sampleResources samples the resources of the running process.
+func sampleResources() resourceSample {
+	var m runtime.MemStats
+	runtime.ReadMemStats(&m)
+	fds := -1
+	if f, err := ioutil.ReadDir("/proc/self/fd"); err == nil {
+		fds = len(f)
+	}
+	return resourceSample{goroutines: runtime.NumGoroutine(), fds: fds, heap: m.HeapAlloc}
+}
+
+// leakChecker periodically compares the resources held by the process with a
+// baseline and detects sustained growth.
+type leakChecker struct {
+	sample func() resourceSample
+
+	next     time.Time
+	baseline *resourceSample
+	exceeded int
+}
+
+func newLeakChecker(now time.Time) *leakChecker {
+	return &leakChecker{sample: sampleResources, next: now.Add(leakCheckInterval)}
+}
+
+// check samples the resources if a check is due at now and returns a report
+// if the growth over the baseline was sustained over leakCheckConfirmations
+// consecutive checks.
+func (c *leakChecker) check(now time.Time) (report string, leaking bool) {
+	if now.Before(c.next) {
+		return "", false
+	}
+	c.next = now.Add(leakCheckInterval)
+
+	s := c.sample()
+	if c.baseline == nil {
+		c.baseline = &s
+		return "", false
+	}
+	b := *c.baseline
+	if s.goroutines-b.goroutines < leakGoroutineGrowth &&
+		s.fds-b.fds < leakFDGrowth &&
+		(s.heap < leakHeapFactor*b.heap || s.heap-b.heap < leakHeapMinGrowth) {
+		c.exceeded = 0
+		return "", false
+	}
+
+	c.exceeded++
+	if c.exceeded < leakCheckConfirmations {
+		return "", false
+	}
+	c.exceeded = 0
+	return fmt.Sprintf("%s (baseline %s)", s, b), true
+}
@@ -0,0 +1,62 @@
+package main
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func Test_leakChecker(t *testing.T) {
+	now := time.Now()
+	c := newLeakChecker(now)
+	sample := resourceSample{goroutines: 10, fds: 8, heap: 1 << 20}
+	c.sample = func() resourceSample { return sample }
+	step := func() (string, bool) {
+		now = now.Add(leakCheckInterval)
+		return c.check(now)
+	}
+
+	// not due yet
+	_, leaking := c.check(now.Add(time.Minute))
+	require.False(t, leaking)
+	require.Nil(t, c.baseline)
+
+	// baseline
+	_, leaking = step()
+	require.False(t, leaking)
+	require.Equal(t, sample, *c.baseline)
+
+	// spike is ignored
+	sample.goroutines = 200
+	_, leaking = step()
+	require.False(t, leaking)
+	sample.goroutines = 12
+	_, leaking = step()
+	require.False(t, leaking)
+
+	// small heap growth is no leak
+	sample.heap = 8 << 20
+	for i := 0; i < leakCheckConfirmations; i++ {
+		_, leaking = step()
+		require.False(t, leaking)
+	}
+
+	// sustained growth
+	sample.fds = 500
+	for i := 0; i < leakCheckConfirmations-1; i++ {
+		_, leaking = step()
+		require.False(t, leaking)
+	}
+	report, leaking := step()
+	require.True(t, leaking)
+	require.Contains(t, report, "fds=500")
+	require.Contains(t, report, "baseline goroutines=10 fds=8")
+}
+
+func Test_sampleResources(t *testing.T) {
+	s := sampleResources()
+	require.True(t, s.goroutines > 0)
+	require.True(t, s.fds > 0)
+	require.True(t, s.heap > 0)
+}
@@ -0,0 +1,113 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/go-kit/kit/log"
+	"github.com/pkg/errors"
+)
+
+const (
+	// tcpListen is the state of a listening socket in /proc/net/tcp.
+	tcpListen = "0A"
+)
+
+var (
+	errPassiveRequiresTcp = errors.New("'passiveListenCheck' can only be used with 'tcp' protocol")
+	errPassiveNotLocal    = errors.New("'passiveListenCheck' cannot be used together with 'host', 'unixSocketPath' or 'sshTunnel'")
+)
+
+// ListenHealthProbe reports the application healthy if a TCP socket listens
+// on the port, found in the socket tables of the kernel without connecting.
+type ListenHealthProbe struct {
+	Port      int
+	IPVersion string
+	ProcDir   string // procDir if empty
+}
+
+func (p *ListenHealthProbe) evaluate(probeCtx context.Context, ctx *log.Context) (HealthStatus, error) {
+	dir := p.ProcDir
+	if dir == "" {
+		dir = procDir
+	}
+	var tables []string
+	if p.IPVersion != ipVersion6 {
+		tables = append(tables, "tcp")
+	}
+	if p.IPVersion != ipVersion4 {
+		tables = append(tables, "tcp6")
+	}
+
+	read := 0
+	for _, table := range tables {
+		b, err := ioutil.ReadFile(filepath.Join(dir, "net", table))
+		if os.IsNotExist(err) {
+			continue // e.g. IPv6 disabled
+		} else if err != nil {
+			return Unknown, errors.Wrapf(err, "failed to read %s sockets", table)
+		}
+		read++
+		if listening(b, p.Port) {
+			return Healthy, nil
+		}
+	}
+	if read == 0 {
+		return Unknown, errors.New("no socket table to read")
+	}
+	ctx.Log("event", "no socket listening", "port", p.Port)
+	return Unhealthy, nil
+}
+
+func (p *ListenHealthProbe) address() string {
+	return ":" + strconv.Itoa(p.Port)
+}
+
+// listening reports whether a socket in the socket table listens on port.
+// Each line after the header describes a socket, e.g.
+// '0: 0100007F:1F90 00000000:0000 0A ...' for 127.0.0.1:8080 listening.
+func listening(table []byte, port int) bool {
+	s := bufio.NewScanner(bytes.NewReader(table))
+	s.Scan() // header
+	for s.Scan() {
+		fields := strings.Fields(s.Text())
+		if len(fields) < 4 || fields[3] != tcpListen {
+			continue
+		}
+		i := strings.LastIndexByte(fields[1], ':')
+		if i < 0 {
+			continue
+		}
+		if p, err := strconv.ParseUint(fields[1][i+1:], 16, 16); err == nil && int(p) == port {
+			return true
+		}
+	}
+	return false
+}
+
+// passiveListenCheck reports whether tcp probes check the socket tables rather
+// than connecting.
+func (s *handlerSettings) passiveListenCheck() bool {
+	return s.publicSettings.PassiveListenCheck
+}
+
+// validatePassiveListenCheck makes logical validation of
+// 'passiveListenCheck'.
+func (h handlerSettings) validatePassiveListenCheck() error {
+	if !h.passiveListenCheck() {
+		return nil
+	}
+	if h.protocol() != "tcp" {
+		return errPassiveRequiresTcp
+	}
+	if h.publicSettings.Host != "" || h.unixSocketPath() != "" || h.sshTunnel() != nil {
+		return errPassiveNotLocal
+	}
+	return nil
+}
@@ -0,0 +1,103 @@
+package main
+
+import (
+	"context"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/go-kit/kit/log"
+	"github.com/stretchr/testify/require"
+)
+
+const (
+	testTcpTable = `  sl  local_address rem_address   st tx_queue rx_queue tr tm->when retrnsmt   uid  timeout inode
+   0: 0100007F:1F90 00000000:0000 0A 00000000:00000000 00:00000000 00000000  1000        0 12345 1 0000000000000000 100 0 0 10 0
+   1: 0100007F:1F90 0100007F:D431 01 00000000:00000000 00:00000000 00000000  1000        0 12346 1 0000000000000000 20 4 30 10 -1
+   2: 0100007F:D431 0100007F:0050 01 00000000:00000000 00:00000000 00000000  1000        0 12347 1 0000000000000000 20 4 30 10 -1
+`
+	testTcp6Table = `  sl  local_address                         remote_address                        st tx_queue rx_queue tr tm->when retrnsmt   uid  timeout inode
+   0: 00000000000000000000000000000000:1F91 00000000000000000000000000000000:0000 0A 00000000:00000000 00:00000000 00000000  1000        0 22345 1 0000000000000000 100 0 0 10 0
+`
+)
+
+func Test_listening(t *testing.T) {
+	require.True(t, listening([]byte(testTcpTable), 8080))
+	require.False(t, listening([]byte(testTcpTable), 80), "only connected to")
+	require.False(t, listening([]byte(testTcpTable), 54321), "connected, not listening")
+	require.True(t, listening([]byte(testTcp6Table), 8081))
+	require.False(t, listening(nil, 8080))
+}
+
+func Test_ListenHealthProbe(t *testing.T) {
+	ctx := log.NewContext(log.NewNopLogger())
+	dir := t.TempDir()
+	probe := func(port int, version string) (HealthStatus, error) {
+		return (&ListenHealthProbe{Port: port, IPVersion: version, ProcDir: dir}).evaluate(context.Background(), ctx)
+	}
+
+	_, err := probe(8080, ipVersionAny)
+	require.NotNil(t, err, "no socket tables")
+
+	writeProcFile(t, dir, "net/tcp", testTcpTable)
+	state, err := probe(8080, ipVersionAny)
+	require.Nil(t, err)
+	require.Equal(t, Healthy, state)
+	state, err = probe(8081, ipVersionAny)
+	require.Nil(t, err)
+	require.Equal(t, Unhealthy, state, "IPv6 disabled")
+
+	writeProcFile(t, dir, "net/tcp6", testTcp6Table)
+	state, err = probe(8081, ipVersionAny)
+	require.Nil(t, err)
+	require.Equal(t, Healthy, state)
+	state, err = probe(8081, ipVersion4)
+	require.Nil(t, err)
+	require.Equal(t, Unhealthy, state)
+	state, err = probe(8080, ipVersion6)
+	require.Nil(t, err)
+	require.Equal(t, Unhealthy, state)
+}
+
+func Test_ListenHealthProbe_proc(t *testing.T) {
+	if _, err := os.Stat(filepath.Join(procDir, "net", "tcp")); err != nil {
+		t.Skip("no socket tables in " + procDir)
+	}
+	ctx := log.NewContext(log.NewNopLogger())
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	require.Nil(t, err)
+	port := l.Addr().(*net.TCPAddr).Port
+	p := &ListenHealthProbe{Port: port}
+
+	state, err := p.evaluate(context.Background(), ctx)
+	require.Nil(t, err)
+	require.Equal(t, Healthy, state)
+
+	require.Nil(t, l.Close())
+	state, err = p.evaluate(context.Background(), ctx)
+	require.Nil(t, err)
+	require.Equal(t, Unhealthy, state)
+}
+
+func Test_NewHealthProbe_passiveListenCheck(t *testing.T) {
+	ctx := log.NewContext(log.NewNopLogger())
+	p := NewHealthProbe(ctx, &handlerSettings{publicSettings: publicSettings{Protocol: "tcp", Port: 8080, PassiveListenCheck: true}})
+	require.IsType(t, &ListenHealthProbe{}, p)
+	require.Equal(t, ":8080", p.address())
+}
+
+func Test_handlerSettingsValidate_passiveListenCheck(t *testing.T) {
+	validate := func(p publicSettings) error { return handlerSettings{p, protectedSettings{}}.validate() }
+
+	require.Nil(t, validate(publicSettings{Protocol: "tcp", Port: 8080, PassiveListenCheck: true}))
+	require.Nil(t, validate(publicSettings{Protocol: "tcp", PortFile: "/run/app.port", PassiveListenCheck: true}))
+	require.Equal(t, errPassiveRequiresTcp, validate(publicSettings{Protocol: "http", PassiveListenCheck: true}))
+	require.Equal(t, errPassiveNotLocal, validate(publicSettings{Protocol: "tcp", Port: 8080, Host: "10.0.0.4", PassiveListenCheck: true}))
+	require.Equal(t, errPassiveNotLocal, validate(publicSettings{Protocol: "tcp", UnixSocketPath: "/run/app.sock", PassiveListenCheck: true}))
+
+	require.Nil(t, validate(publicSettings{Applications: []applicationSettings{
+		{Name: "db", Protocol: "tcp", Port: 5432, PassiveListenCheck: true},
+		{Name: "web", Protocol: "http", Port: 8080},
+	}}))
+}
@@ -0,0 +1,128 @@
+package main
+
+import (
+	"net/http"
+	"os"
+	"sort"
+	"strings"
+	"sync/atomic"
+
+	"github.com/go-kit/kit/log"
+)
+
+const (
+	// logLevelEnvVar overrides the log level of the settings, e.g. to
+	// troubleshoot the probes without changing the extension configuration.
+	logLevelEnvVar = "APPHEALTH_LOG_LEVEL"
+
+	// maxDebugBodyLength is the number of characters of the response bodies
+	// logged at debug level.
+	maxDebugBodyLength = 1024
+)
+
+// logLevel is the verbosity of the log, each level including the ones before.
+type logLevel int32
+
+const (
+	levelError logLevel = iota
+	levelInfo
+	levelDebug
+)
+
+var logLevelNames = []string{"error", "info", "debug"}
+
+func (l logLevel) String() string {
+	return logLevelNames[l]
+}
+
+// parseLogLevel returns the level named s.
+func parseLogLevel(s string) (logLevel, bool) {
+	for i, name := range logLevelNames {
+		if strings.EqualFold(s, name) {
+			return logLevel(i), true
+		}
+	}
+	return levelInfo, false
+}
+
+// logFilter drops the log records above the configured level.
+var logFilter = &levelFilter{level: int32(levelInfo)}
+
+// levelFilter passes on the log records at or below its level.
+type levelFilter struct {
+	level int32 // logLevel, accessed atomically
+}
+
+func (f *levelFilter) setLevel(l logLevel) {
+	atomic.StoreInt32(&f.level, int32(l))
+}
+
+// enabled tells whether records at level l are logged.
+func (f *levelFilter) enabled(l logLevel) bool {
+	return l <= logLevel(atomic.LoadInt32(&f.level))
+}
+
+// wrap returns a logger passing the records allowed by f on to next.
+func (f *levelFilter) wrap(next log.Logger) log.Logger {
+	return log.LoggerFunc(func(keyvals ...interface{}) error {
+		if !f.enabled(recordLevel(keyvals)) {
+			return nil
+		}
+		return next.Log(keyvals...)
+	})
+}
+
+// recordLevel returns the level of a log record: the one given by its "level"
+// key, else error if it carries an error, else info.
+func recordLevel(keyvals []interface{}) logLevel {
+	level := levelInfo
+	for i := 0; i+1 < len(keyvals); i += 2 {
+		switch keyvals[i] {
+		case "level":
+			if s, ok := keyvals[i+1].(string); ok {
+				if l, ok := parseLogLevel(s); ok {
+					return l
+				}
+			}
+		case "error":
+			if keyvals[i+1] != nil {
+				level = levelError
+			}
+		}
+	}
+	return level
+}
+
+// logDebug logs the record at debug level.
+func logDebug(ctx *log.Context, keyvals ...interface{}) {
+	if logFilter.enabled(levelDebug) {
+		ctx.Log(append([]interface{}{"level", "debug"}, keyvals...)...)
+	}
+}
+
+// headerNames returns the sorted names of the headers h, without their values
+// which may hold credentials.
+func headerNames(h http.Header) []string {
+	names := make([]string, 0, len(h))
+	for name := range h {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// logLevel returns the log level set by the environment, else by the settings.
+func (s *handlerSettings) logLevel() logLevel {
+	if l, ok := parseLogLevel(os.Getenv(logLevelEnvVar)); ok {
+		return l
+	}
+	l, _ := parseLogLevel(s.publicSettings.LogLevel)
+	return l
+}
+
+// configureLogLevel applies the log level of the settings and logs the choice.
+func configureLogLevel(ctx *log.Context, cfg *handlerSettings) {
+	l := cfg.logLevel()
+	logFilter.setLevel(l)
+	ctx.Log("event", "using log level", "logLevel", l)
+}
@@ -0,0 +1,78 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"net/http"
+	"os"
+	"testing"
+
+	"github.com/go-kit/kit/log"
+	"github.com/stretchr/testify/require"
+)
+
+func Test_parseLogLevel(t *testing.T) {
+	l, ok := parseLogLevel("DEBUG")
+	require.True(t, ok)
+	require.Equal(t, levelDebug, l)
+	require.Equal(t, "debug", l.String())
+
+	_, ok = parseLogLevel("verbose")
+	require.False(t, ok)
+}
+
+func Test_recordLevel(t *testing.T) {
+	require.Equal(t, levelInfo, recordLevel([]interface{}{"event", "start"}))
+	require.Equal(t, levelInfo, recordLevel([]interface{}{"event", "probe trace", "error", nil}))
+	require.Equal(t, levelError, recordLevel([]interface{}{"event", "failed", "error", errors.New("boom")}))
+	require.Equal(t, levelDebug, recordLevel([]interface{}{"level", "debug", "event", "probe", "error", errors.New("boom")}))
+}
+
+func Test_levelFilter(t *testing.T) {
+	var buf bytes.Buffer
+	f := &levelFilter{level: int32(levelError)}
+	logger := f.wrap(log.NewLogfmtLogger(&buf))
+
+	logger.Log("event", "info")
+	logger.Log("event", "failure", "error", errors.New("boom"))
+	require.Equal(t, "event=failure error=boom\n", buf.String())
+
+	buf.Reset()
+	f.setLevel(levelDebug)
+	logger.Log("level", "debug", "event", "detail")
+	require.Equal(t, "level=debug event=detail\n", buf.String())
+}
+
+func Test_logDebug(t *testing.T) {
+	defer logFilter.setLevel(levelInfo)
+	var buf bytes.Buffer
+	ctx := log.NewContext(logFilter.wrap(log.NewLogfmtLogger(&buf)))
+
+	logFilter.setLevel(levelInfo)
+	logDebug(ctx, "event", "detail")
+	require.Empty(t, buf.String())
+
+	logFilter.setLevel(levelDebug)
+	logDebug(ctx, "event", "detail")
+	require.Equal(t, "level=debug event=detail\n", buf.String())
+}
+
+func Test_handlerSettings_logLevel(t *testing.T) {
+	defer os.Unsetenv(logLevelEnvVar)
+	os.Unsetenv(logLevelEnvVar)
+	require.Equal(t, levelInfo, (&handlerSettings{}).logLevel())
+
+	cfg := &handlerSettings{publicSettings: publicSettings{LogLevel: "error"}}
+	require.Equal(t, levelError, cfg.logLevel())
+
+	os.Setenv(logLevelEnvVar, "debug")
+	require.Equal(t, levelDebug, cfg.logLevel())
+
+	os.Setenv(logLevelEnvVar, "invalid")
+	require.Equal(t, levelError, cfg.logLevel())
+}
+
+func Test_headerNames(t *testing.T) {
+	h := http.Header{"Authorization": {"Bearer secret"}, "Accept": {"*/*"}}
+	require.Equal(t, []string{"Accept", "Authorization"}, headerNames(h))
+}
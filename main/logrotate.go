@@ -0,0 +1,144 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+
+	"github.com/go-kit/kit/log"
+	"github.com/pkg/errors"
+)
+
+const (
+	logFileName = "handler.log"
+
+	defaultLogMaxSizeInMB = 10
+	defaultLogMaxFiles    = 5
+)
+
+var (
+	// logDir is where the extension writes its log.
+	logDir = "/var/log/azure/applicationhealth-extension"
+
+	// logFile is the log of this process, nil if it logs to the standard
+	// output.
+	logFile *rotatingFile
+)
+
+// logRotationSettings bound the disk space taken by the extension log.
+type logRotationSettings struct {
+	MaxSizeInMB int `json:"maxSizeInMB,int"`
+	MaxFiles    int `json:"maxFiles,int"`
+}
+
+// logRotation returns the size the log is rotated at and the number of rotated
+// logs kept.
+func (s *handlerSettings) logRotation() (maxSize int64, maxFiles int) {
+	maxSizeInMB, maxFiles := defaultLogMaxSizeInMB, defaultLogMaxFiles
+	if r := s.publicSettings.LogRotation; r != nil {
+		if r.MaxSizeInMB != 0 {
+			maxSizeInMB = r.MaxSizeInMB
+		}
+		if r.MaxFiles != 0 {
+			maxFiles = r.MaxFiles
+		}
+	}
+	return int64(maxSizeInMB) << 20, maxFiles
+}
+
+// configureLogRotation applies the log rotation limits of the settings.
+func configureLogRotation(ctx *log.Context, cfg *handlerSettings) {
+	if logFile == nil {
+		return
+	}
+	maxSize, maxFiles := cfg.logRotation()
+	logFile.setLimits(maxSize, maxFiles)
+	ctx.Log("event", "rotating log", "path", logFile.path, "maxSize", maxSize, "maxFiles", maxFiles)
+}
+
+// rotatingFile is a log file renamed with the suffix .1 once it reaches its
+// maximum size, the previously rotated files shifting to .2, .3 and so on
+// until the oldest is deleted. It is safe to share between processes: a file
+// rotated by another process is reopened on the next write.
+type rotatingFile struct {
+	mu       sync.Mutex
+	path     string
+	maxSize  int64
+	maxFiles int
+	f        *os.File
+}
+
+// openRotatingFile opens the log file at path for appending, creating its
+// directory if needed.
+func openRotatingFile(path string, maxSize int64, maxFiles int) (*rotatingFile, error) {
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return nil, errors.Wrap(err, "failed to create log directory")
+	}
+	r := &rotatingFile{path: path, maxSize: maxSize, maxFiles: maxFiles}
+	if err := r.open(); err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+func (r *rotatingFile) open() error {
+	f, err := os.OpenFile(r.path, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0644)
+	if err != nil {
+		return errors.Wrap(err, "failed to open log file")
+	}
+	r.f = f
+	return nil
+}
+
+func (r *rotatingFile) setLimits(maxSize int64, maxFiles int) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.maxSize, r.maxFiles = maxSize, maxFiles
+}
+
+func (r *rotatingFile) Write(p []byte) (int, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	cur, err := r.f.Stat()
+	if fi, statErr := os.Stat(r.path); err != nil || statErr != nil || !os.SameFile(fi, cur) {
+		// rotated or removed by another process
+		r.f.Close()
+		if err := r.open(); err != nil {
+			return 0, err
+		}
+		if cur, err = r.f.Stat(); err != nil {
+			return 0, err
+		}
+	}
+	if cur.Size() > 0 && cur.Size()+int64(len(p)) > r.maxSize {
+		if err := r.rotate(); err != nil {
+			return 0, err
+		}
+	}
+	return r.f.Write(p)
+}
+
+// rotate shifts the rotated files, moves the current file to .1 and starts a
+// new one.
+func (r *rotatingFile) rotate() error {
+	r.f.Close()
+	os.Remove(r.rotatedPath(r.maxFiles))
+	for i := r.maxFiles - 1; i >= 1; i-- {
+		os.Rename(r.rotatedPath(i), r.rotatedPath(i+1))
+	}
+	// on failure, keep appending to the current file rather than lose the log
+	os.Rename(r.path, r.rotatedPath(1))
+	return r.open()
+}
+
+func (r *rotatingFile) rotatedPath(i int) string {
+	return fmt.Sprintf("%s.%d", r.path, i)
+}
+
+func (r *rotatingFile) Close() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.f.Close()
+}
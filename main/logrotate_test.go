@@ -0,0 +1,72 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func Test_handlerSettings_logRotation(t *testing.T) {
+	maxSize, maxFiles := (&handlerSettings{}).logRotation()
+	require.Equal(t, int64(defaultLogMaxSizeInMB<<20), maxSize)
+	require.Equal(t, defaultLogMaxFiles, maxFiles)
+
+	cfg := &handlerSettings{publicSettings: publicSettings{LogRotation: &logRotationSettings{MaxSizeInMB: 2}}}
+	maxSize, maxFiles = cfg.logRotation()
+	require.Equal(t, int64(2<<20), maxSize)
+	require.Equal(t, defaultLogMaxFiles, maxFiles)
+}
+
+func Test_rotatingFile(t *testing.T) {
+	dir, err := ioutil.TempDir("", "")
+	require.Nil(t, err)
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "logs", logFileName)
+
+	r, err := openRotatingFile(path, 10, 2)
+	require.Nil(t, err)
+	defer r.Close()
+
+	for _, line := range []string{"first\n", "second\n", "third\n", "fourth\n"} {
+		_, err := r.Write([]byte(line))
+		require.Nil(t, err)
+	}
+	requireFile(t, path, "fourth\n")
+	requireFile(t, path+".1", "third\n")
+	requireFile(t, path+".2", "second\n")
+	_, err = os.Stat(path + ".3")
+	require.True(t, os.IsNotExist(err), "oldest log deleted")
+
+	r.setLimits(100, 2)
+	_, err = r.Write([]byte("fifth\n"))
+	require.Nil(t, err)
+	requireFile(t, path, "fourth\nfifth\n")
+}
+
+func Test_rotatingFile_rotatedByAnotherProcess(t *testing.T) {
+	dir, err := ioutil.TempDir("", "")
+	require.Nil(t, err)
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, logFileName)
+
+	r, err := openRotatingFile(path, 100, 2)
+	require.Nil(t, err)
+	defer r.Close()
+	_, err = r.Write([]byte("first\n"))
+	require.Nil(t, err)
+
+	require.Nil(t, os.Rename(path, path+".1"))
+	_, err = r.Write([]byte("second\n"))
+	require.Nil(t, err)
+	requireFile(t, path, "second\n")
+	requireFile(t, path+".1", "first\n")
+}
+
+func requireFile(t *testing.T, path, content string) {
+	b, err := ioutil.ReadFile(path)
+	require.Nil(t, err)
+	require.Equal(t, content, string(b))
+}
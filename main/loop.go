@@ -0,0 +1,448 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/go-kit/kit/log"
+	"github.com/pkg/errors"
+)
+
+// probeLoop probes the application and reports its health at every interval
+// until stopped. Time and the side effects are injected so that the loop can
+// be driven deterministically in tests.
+type probeLoop struct {
+	clock   clock
+	cfg     handlerSettings
+	metrics *extensionMetrics
+	control *loopControl
+	// statePath is the file the health state is persisted to.
+	statePath string
+	// journalPath is the file the probe outcomes are journaled to until the
+	// health state is persisted, if not empty.
+	journalPath string
+
+	// loadSettings reads the settings again on a reload request.
+	loadSettings func() (handlerSettings, error)
+	// newProbes creates the probes of the monitored applications.
+	newProbes func(cfg *handlerSettings) []HealthProbe
+	// report writes the derived status.
+	report func(mon *monitor, st monitorStatus) error
+	// stopped tells whether the loop must terminate besides the cancellation
+	// of its context, if not nil.
+	stopped func() bool
+	// final reports the status once the loop terminated, if not nil.
+	final func(mon *monitor, st monitorStatus) error
+	// restart replaces the process with a fresh one.
+	restart func() error
+	// notify announces a transition of the derived state, if not nil.
+	notify func(cfg *handlerSettings, from, to HealthStatus, t time.Time)
+	// observed receives the state derived at t from probes which took d, if
+	// not nil.
+	observed func(cfg *handlerSettings, state HealthStatus, t time.Time, d time.Duration)
+	// events receives the telemetry events, if not nil.
+	events *eventWriter
+
+	probes    []HealthProbe
+	offsets   []time.Duration
+	intervals []time.Duration
+	deadlines []time.Duration
+	// due is when each probe is next due, for those probed less often than
+	// at every interval.
+	due       []time.Time
+	mon       *monitor
+	leaks     *leakChecker
+	burst     *burstSchedule
+	prevState HealthStatus
+	last      monitorStatus // the status reported last
+
+	// probeErrors is the latest error of each probe, reported as an event
+	// when it changes.
+	probeErrors []string
+	// abandoned is the evaluation of each probe abandoned past its deadline
+	// and still running, if any.
+	abandoned []*probeRun
+}
+
+// probeRun is an evaluation of a probe running on its own goroutine.
+type probeRun struct {
+	done   chan struct{}
+	result HealthStatus
+	err    error
+}
+
+// probeOffsets returns the offset of each probe in its interval, in the order
+// of monitoredSettings.
+func probeOffsets(cfg *handlerSettings) []time.Duration {
+	var out []time.Duration
+	for _, s := range monitoredSettings(cfg) {
+		out = append(out, s.offset)
+	}
+	return out
+}
+
+// probeIntervals returns the interval of each probe, in the order of
+// monitoredSettings.
+func probeIntervals(cfg *handlerSettings) []time.Duration {
+	var out []time.Duration
+	for _, s := range monitoredSettings(cfg) {
+		out = append(out, s.cfg.interval())
+	}
+	return out
+}
+
+// probeDeadlines returns the time each probe may run before it is abandoned,
+// in the order of monitoredSettings: its timeout, capped at its own interval
+// and at what remains of the top level interval after its offset, as the due
+// probes run one after the other within that interval.
+func probeDeadlines(cfg *handlerSettings) []time.Duration {
+	var out []time.Duration
+	for _, s := range monitoredSettings(cfg) {
+		d := s.cfg.probeTimeout()
+		if i := s.cfg.interval(); i < d {
+			d = i
+		}
+		if r := cfg.interval() - s.offset; r < d {
+			d = r
+		}
+		out = append(out, d)
+	}
+	return out
+}
+
+// start sets up the probes and the monitor for the current settings.
+func (l *probeLoop) start(ctx *log.Context) {
+	l.probes = l.newProbes(&l.cfg)
+	l.probeErrors = make([]string, len(l.probes))
+	l.abandoned = make([]*probeRun, len(l.probes))
+	l.offsets = probeOffsets(&l.cfg)
+	l.intervals = probeIntervals(&l.cfg)
+	l.deadlines = probeDeadlines(&l.cfg)
+	l.due = make([]time.Time, len(l.probes))
+	l.mon = newMonitor(&l.cfg, l.clock.Now(), l.metrics)
+	if l.cfg.persistState() {
+		l.restoreState(ctx)
+	}
+	if l.mon.gate.enabled {
+		ctx.Log("event", "provisioning gate enabled", "timeout", l.cfg.provisioningGateTimeout())
+	}
+	l.leaks = newLeakChecker(l.clock.Now())
+	l.burst = newBurstSchedule(&l.cfg)
+	l.control.setMonitor(l.mon)
+}
+
+// run iterates until runCtx is cancelled or the loop is stopped, returning
+// errTerminated, or fails. The cancellation interrupts the probe in flight and
+// the wait for the next one.
+func (l *probeLoop) run(runCtx context.Context, ctx *log.Context) error {
+	l.start(ctx)
+	for {
+		if err := l.iterate(runCtx, ctx); err != nil {
+			if err == errTerminated {
+				l.reportStopped(ctx)
+			}
+			return err
+		}
+	}
+}
+
+// reportStopped reports the final status of the terminated loop, keeping the
+// health last reported.
+func (l *probeLoop) reportStopped(ctx *log.Context) {
+	if l.final == nil {
+		return
+	}
+	st := l.last
+	if st.statusType == "" {
+		st.statusType = StatusTransitioning
+	}
+	st.message = l.mon.catalog.format(msgProbingStopped)
+	if err := l.final(l.mon, st); err != nil {
+		ctx.Log("event", "failed to report final status", "error", err)
+	}
+	ctx.Log("event", "probing stopped", "state", st.state)
+}
+
+// terminated tells whether the loop must terminate.
+func (l *probeLoop) terminated(runCtx context.Context) bool {
+	return runCtx.Err() != nil || (l.stopped != nil && l.stopped())
+}
+
+// evaluate runs the i-th probe under a deadline of its timeout or interval,
+// so that a probe stuck e.g. in a tcp handshake never holds the loop up. The
+// evaluation past its deadline is abandoned and counted as unhealthy, the
+// application having failed to answer in time, as is the probe until that
+// evaluation returns.
+func (l *probeLoop) evaluate(runCtx context.Context, ctx *log.Context, i int) (HealthStatus, error) {
+	probe := l.probes[i]
+	if r := l.abandoned[i]; r != nil {
+		select {
+		case <-r.done:
+			l.abandoned[i] = nil
+		default:
+			ctx.Log("event", "abandoned probe still running", "address", probe.address())
+			return Unhealthy, nil
+		}
+	}
+
+	probeCtx, cancel := context.WithTimeout(runCtx, l.deadlines[i])
+	defer cancel()
+	r := &probeRun{done: make(chan struct{})}
+	go func() {
+		defer close(r.done)
+		defer func() {
+			// a probe panicking tells nothing of the application health
+			if p := recover(); p != nil {
+				r.result, r.err = Unknown, errors.Errorf("probe panicked: %v", p)
+			}
+		}()
+		r.result, r.err = probe.evaluate(probeCtx, ctx)
+	}()
+	select {
+	case <-r.done:
+		return r.result, r.err
+	case <-probeCtx.Done():
+		if runCtx.Err() != nil {
+			return Unknown, runCtx.Err()
+		}
+		ctx.Log("event", "probe abandoned past its deadline", "address", probe.address(), "deadline", l.deadlines[i])
+		l.abandoned[i] = r
+		l.metrics.probeAbandoned()
+		return Unhealthy, nil
+	}
+}
+
+// sleep waits for d, returning false if runCtx was cancelled meanwhile.
+func (l *probeLoop) sleep(runCtx context.Context, d time.Duration) bool {
+	return l.clock.Sleep(runCtx, d)
+}
+
+// restoreState resumes the monitor from the persisted health state.
+func (l *probeLoop) restoreState(ctx *log.Context) {
+	s, ok, err := loadHealthState(l.statePath)
+	if err != nil {
+		ctx.Log("event", "failed to restore health state, starting over", "error", err)
+		l.metrics.internalError(l.clock.Now(), err)
+		return
+	}
+	if ok {
+		if !l.mon.restore(s, l.clock.Now(), l.cfg.persistedStateMaxAge()) {
+			ctx.Log("event", "persisted health state expired, starting over", "savedAt", s.SavedAt)
+			return
+		}
+		ctx.Log("event", "restored health state", "savedAt", s.SavedAt, "state", l.mon.state())
+	}
+	l.replayJournal(ctx, s.SavedAt)
+}
+
+// replayJournal resumes the state machines with the probe outcomes journaled
+// after since, those of an interval interrupted before the state was saved.
+func (l *probeLoop) replayJournal(ctx *log.Context, since time.Time) {
+	if l.journalPath == "" {
+		return
+	}
+	entries, err := loadJournal(l.journalPath)
+	if err != nil {
+		ctx.Log("event", "failed to replay probe journal", "error", err)
+		l.metrics.internalError(l.clock.Now(), err)
+		return
+	}
+	if n := l.mon.replay(entries, since); n > 0 {
+		ctx.Log("event", "replayed probe journal", "outcomes", n, "state", l.mon.state())
+	}
+}
+
+// journal appends the outcome of the i-th probe to the probe journal.
+func (l *probeLoop) journal(i int, result HealthStatus) {
+	if l.journalPath == "" || !l.cfg.persistState() {
+		return
+	}
+	e := journalEntry{Time: l.clock.Now(), Application: l.mon.groups[i].name, Result: result}
+	if err := appendJournal(l.journalPath, e); err != nil {
+		l.metrics.internalError(l.clock.Now(), err)
+	}
+}
+
+// reload switches to the settings loaded again, keeping the current ones if
+// they cannot be loaded.
+func (l *probeLoop) reload(ctx *log.Context) {
+	newCfg, err := l.loadSettings()
+	if err != nil {
+		ctx.Log("event", "failed to reload configuration, keeping the current one", "error", err)
+		l.metrics.internalError(l.clock.Now(), errors.Wrap(err, "failed to reload configuration"))
+		l.event(ctx, eventLevelError, eventTaskConfigReload, "failed to reload configuration: "+err.Error())
+		return
+	}
+	l.cfg = newCfg
+	configureRedaction(&l.cfg)
+	configureLogLevel(ctx, &l.cfg)
+	configureLogRotation(ctx, &l.cfg)
+	configureSyslog(ctx, &l.cfg)
+	configureResolver(ctx, &l.cfg)
+	l.probes = l.newProbes(&l.cfg)
+	l.probeErrors = make([]string, len(l.probes))
+	l.abandoned = make([]*probeRun, len(l.probes))
+	l.offsets = probeOffsets(&l.cfg)
+	l.intervals = probeIntervals(&l.cfg)
+	l.deadlines = probeDeadlines(&l.cfg)
+	l.due = make([]time.Time, len(l.probes))
+	prev := l.mon
+	l.mon = newMonitor(&l.cfg, l.clock.Now(), l.metrics)
+	l.mon.gate.passed = prev.gate.passed
+	if l.cfg.persistState() {
+		// carry the health state over as across a restart
+		l.mon.restore(prev.persisted(l.clock.Now()), l.clock.Now(), 0)
+	}
+	l.burst = newBurstSchedule(&l.cfg)
+	l.control.setMonitor(l.mon)
+	l.metrics.configLoaded(l.clock.Now())
+	ctx.Log("event", "reloaded configuration")
+	l.event(ctx, eventLevelInformational, eventTaskConfigReload, "reloaded configuration")
+}
+
+// probeError reports the error of the i-th probe as an event if it differs
+// from the previous one, so that a probe failing the same way every interval
+// is reported once.
+func (l *probeLoop) probeError(ctx *log.Context, i int, probe HealthProbe, err error) {
+	msg := ""
+	if err != nil {
+		msg = err.Error()
+	}
+	if msg == l.probeErrors[i] {
+		return
+	}
+	l.probeErrors[i] = msg
+	if msg != "" {
+		l.event(ctx, eventLevelError, eventTaskProbeError, fmt.Sprintf("failed to evaluate health of %s: %s", probe.address(), msg))
+	}
+}
+
+// event writes a telemetry event, logging the failure to do so.
+func (l *probeLoop) event(ctx *log.Context, level, task, message string) {
+	if err := l.events.write(level, task, message); err != nil {
+		ctx.Log("event", "failed to write telemetry event", "task", task, "error", err)
+	}
+}
+
+// iterate probes once, reports the status and waits for the next probe.
+func (l *probeLoop) iterate(runCtx context.Context, ctx *log.Context) error {
+	if l.control.takeReload() {
+		l.reload(ctx)
+	}
+
+	if l.control.isPaused() {
+		if !l.sleep(runCtx, l.cfg.interval()) || l.terminated(runCtx) {
+			return errTerminated
+		}
+		return nil
+	}
+
+	start := l.clock.Now()
+	results := make([]HealthStatus, len(l.probes))
+	var staggering time.Duration
+	for _, i := range staggered(l.offsets) {
+		if start.Before(l.due[i]) {
+			// probed less often than at every interval, not due yet
+			continue
+		}
+		if d := l.offsets[i] - l.clock.Now().Sub(start); d > 0 {
+			if !l.sleep(runCtx, d) {
+				return errTerminated
+			}
+			staggering += d
+		}
+		// tolerate the drift of the interval, not to skip one more
+		l.due[i] = start.Add(l.intervals[i] - l.cfg.interval()/2)
+		probe := l.probes[i]
+		probeStart := l.clock.Now()
+		result, err := l.evaluate(runCtx, ctx, i)
+		if runCtx.Err() != nil {
+			// interrupted, the result tells nothing
+			return errTerminated
+		}
+		took := l.clock.Now().Sub(probeStart)
+		lastEvaluation.set(result, err)
+		probeLatencies.record(probe.address(), took)
+		logDebug(ctx, "event", "probe evaluated", "address", probe.address(), "result", result, "error", err, "duration", took)
+		if l.control.isTracing() {
+			ctx.Log("event", "probe trace", "address", probe.address(), "result", result, "error", err)
+		}
+		if err != nil {
+			// a failure of the probe tells nothing of the application health
+			ctx.Log("event", "failed to evaluate health", "address", probe.address(), "error", err)
+			l.metrics.internalError(l.clock.Now(), errors.Wrap(err, "failed to evaluate health"))
+			result = Unknown
+		}
+		l.probeError(ctx, i, probe, err)
+		results[i] = result
+		l.journal(i, result)
+	}
+
+	if l.terminated(runCtx) {
+		return errTerminated
+	}
+
+	gatePassed := l.mon.gate.passed
+	st, err := l.mon.observe(l.clock.Now(), results...)
+	if err != nil {
+		return err
+	}
+	if l.observed != nil {
+		l.observed(&l.cfg, st.state, l.clock.Now(), l.clock.Now().Sub(start)-staggering)
+	}
+	if l.mon.gate.passed && !gatePassed {
+		ctx.Log("event", "provisioning gate passed")
+	}
+	if l.cfg.persistState() {
+		if err := saveHealthState(l.statePath, l.mon.persisted(l.clock.Now())); err != nil {
+			l.metrics.internalError(l.clock.Now(), err)
+		} else if l.journalPath != "" {
+			if err := clearJournal(l.journalPath); err != nil {
+				l.metrics.internalError(l.clock.Now(), err)
+			}
+		}
+	}
+
+	if l.prevState != st.state {
+		ctx.Log("event", stateChangeLogMap[st.state])
+		if l.prevState != "" && l.notify != nil {
+			l.notify(&l.cfg, l.prevState, st.state, l.clock.Now())
+		}
+		if l.prevState != "" {
+			level := eventLevelInformational
+			if st.state == Unhealthy {
+				level = eventLevelWarning
+			}
+			l.event(ctx, level, eventTaskStateChange, fmt.Sprintf("state changed from %s to %s", l.prevState, st.state))
+		}
+		l.prevState = st.state
+	}
+
+	if err := l.report(l.mon, st); err != nil {
+		l.metrics.internalError(l.clock.Now(), errors.Wrap(err, "failed to report status"))
+	}
+	l.last = st
+	l.control.iterationDone(start, l.clock.Now().Sub(start))
+
+	if report, leaking := l.leaks.check(l.clock.Now()); leaking {
+		ctx.Log("event", "resource leak suspected", "resources", report)
+		dumpDiagnostics(ctx, "resource leak suspected: "+report)
+		l.metrics.internalError(l.clock.Now(), errors.New("resource leak suspected: "+report))
+		if l.cfg.restartOnResourceLeak() {
+			ctx.Log("event", "restarting probe loop")
+			return l.restart()
+		}
+	}
+	// the interval is counted from the start of the staggered probes
+	if wait := l.burst.wait(l.mon.pendingChange(), l.cfg.interval()) - staggering; wait > 0 {
+		if !l.sleep(runCtx, wait) {
+			return errTerminated
+		}
+	}
+
+	if l.terminated(runCtx) {
+		return errTerminated
+	}
+	return nil
+}
@@ -0,0 +1,371 @@
+package main
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/go-kit/kit/log"
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/require"
+)
+
+// instantClock is a clock whose sleeps return immediately, advancing the time.
+type instantClock struct {
+	now time.Time
+}
+
+func (c *instantClock) Now() time.Time { return c.now }
+
+func (c *instantClock) Sleep(ctx context.Context, d time.Duration) bool {
+	c.now = c.now.Add(d)
+	return ctx.Err() == nil
+}
+
+// scriptedProbe returns the scripted results, then the last one forever.
+type scriptedProbe struct {
+	results []HealthStatus
+}
+
+func (p *scriptedProbe) evaluate(probeCtx context.Context, ctx *log.Context) (HealthStatus, error) {
+	r := p.results[0]
+	if len(p.results) > 1 {
+		p.results = p.results[1:]
+	}
+	return r, nil
+}
+
+func (p *scriptedProbe) address() string { return "scripted" }
+
+// newTestLoop returns a probe loop on an instant clock probing with probe,
+// which stops after the given number of status reports.
+func newTestLoop(cfg handlerSettings, probe HealthProbe, reports int) (*probeLoop, *[]monitorStatus) {
+	var reported []monitorStatus
+	clk := &instantClock{now: time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)}
+	return &probeLoop{
+		clock:   clk,
+		cfg:     cfg,
+		metrics: newExtensionMetrics(clk.now, 0),
+		control: &loopControl{clock: clk},
+		loadSettings: func() (handlerSettings, error) {
+			return cfg, nil
+		},
+		newProbes: func(*handlerSettings) []HealthProbe { return []HealthProbe{probe} },
+		report: func(mon *monitor, st monitorStatus) error {
+			reported = append(reported, st)
+			return nil
+		},
+		stopped: func() bool { return len(reported) >= reports },
+		restart: func() error { panic("unexpected restart") },
+	}, &reported
+}
+
+func Test_probeLoop_run(t *testing.T) {
+	ctx := log.NewContext(log.NewNopLogger())
+	probe := &scriptedProbe{[]HealthStatus{Healthy, Unhealthy, Healthy}}
+	loop, reported := newTestLoop(handlerSettings{}, probe, 3)
+
+	require.Equal(t, errTerminated, loop.run(context.Background(), ctx))
+	require.Len(t, *reported, 3)
+	require.Equal(t, Healthy, (*reported)[0].state)
+	require.Equal(t, Unhealthy, (*reported)[1].state)
+	require.Equal(t, Healthy, (*reported)[2].state)
+	require.Equal(t, 3, loop.control.timing.Iterations)
+}
+
+func Test_probeLoop_notify(t *testing.T) {
+	ctx := log.NewContext(log.NewNopLogger())
+	probe := &scriptedProbe{[]HealthStatus{Healthy, Healthy, Unhealthy, Healthy}}
+	loop, _ := newTestLoop(handlerSettings{}, probe, 4)
+	var transitions []string
+	loop.notify = func(cfg *handlerSettings, from, to HealthStatus, _ time.Time) {
+		transitions = append(transitions, string(from)+"->"+string(to))
+	}
+
+	require.Equal(t, errTerminated, loop.run(context.Background(), ctx))
+	require.Equal(t, []string{"healthy->unhealthy", "unhealthy->healthy"}, transitions, "not for the initial state")
+}
+
+func Test_probeLoop_observed(t *testing.T) {
+	ctx := log.NewContext(log.NewNopLogger())
+	probe := &scriptedProbe{[]HealthStatus{Healthy, Unhealthy}}
+	loop, _ := newTestLoop(handlerSettings{}, probe, 2)
+	var states []HealthStatus
+	loop.observed = func(cfg *handlerSettings, state HealthStatus, _ time.Time, _ time.Duration) {
+		states = append(states, state)
+	}
+
+	require.Equal(t, errTerminated, loop.run(context.Background(), ctx))
+	require.Equal(t, []HealthStatus{Healthy, Unhealthy}, states)
+}
+
+func Test_probeLoop_probeError(t *testing.T) {
+	ctx := log.NewContext(log.NewNopLogger())
+	probe := &brokenProbe{"localhost:80", errors.New("failed to set up ssh tunnel")}
+	loop, reported := newTestLoop(handlerSettings{}, probe, 2)
+
+	require.Equal(t, errTerminated, loop.run(context.Background(), ctx))
+	require.Len(t, *reported, 2)
+	st := (*reported)[1]
+	require.Equal(t, Unknown, st.state)
+	require.Equal(t, StatusSuccess, st.statusType)
+	require.Equal(t, StatusTransitioning, st.substatuses[0].Status)
+	require.Equal(t, defaultMessages[msgUnknown], st.substatuses[0].FormattedMessage.Message)
+	require.Equal(t, extensionErrorSubstatusName, st.substatuses[1].Name)
+	require.Equal(t, StatusError, st.substatuses[1].Status)
+	require.Contains(t, st.substatuses[1].FormattedMessage.Message, "failed to evaluate health: failed to set up ssh tunnel")
+}
+
+func Test_probeLoop_events(t *testing.T) {
+	dir, err := ioutil.TempDir("", "")
+	require.Nil(t, err)
+	defer os.RemoveAll(dir)
+
+	ctx := log.NewContext(log.NewNopLogger())
+	probe := &brokenProbe{"localhost:80", errors.New("failed to set up ssh tunnel")}
+	loop, _ := newTestLoop(handlerSettings{}, probe, 3)
+	loop.events = newEventWriter(dir, 0)
+	require.Equal(t, errTerminated, loop.run(context.Background(), ctx))
+
+	files, err := filepath.Glob(filepath.Join(dir, "*.json"))
+	require.Nil(t, err)
+	require.Len(t, files, 1, "probe error reported once")
+	b, err := ioutil.ReadFile(files[0])
+	require.Nil(t, err)
+	require.Contains(t, string(b), `"TaskName":"ProbeError"`)
+	require.Contains(t, string(b), "failed to evaluate health of localhost:80: failed to set up ssh tunnel")
+}
+
+// timedProbe records the times it was evaluated at.
+type timedProbe struct {
+	clock clock
+	times []time.Time
+}
+
+func (p *timedProbe) evaluate(probeCtx context.Context, ctx *log.Context) (HealthStatus, error) {
+	p.times = append(p.times, p.clock.Now())
+	return Healthy, nil
+}
+
+func (p *timedProbe) address() string { return "timed" }
+
+func Test_probeLoop_staggered(t *testing.T) {
+	ctx := log.NewContext(log.NewNopLogger())
+	cfg := handlerSettings{publicSettings: publicSettings{Applications: []applicationSettings{
+		{Name: "web", Protocol: "tcp", Port: 80, OffsetInMilliseconds: 2000},
+		{Name: "worker", Protocol: "tcp", Port: 81},
+	}}}
+	loop, _ := newTestLoop(cfg, nil, 2)
+	web, worker := &timedProbe{clock: loop.clock}, &timedProbe{clock: loop.clock}
+	loop.newProbes = func(*handlerSettings) []HealthProbe { return []HealthProbe{web, worker} }
+	start := loop.clock.Now()
+
+	require.Equal(t, errTerminated, loop.run(context.Background(), ctx))
+	require.Equal(t, []time.Time{start, start.Add(defaultInterval)}, worker.times)
+	require.Equal(t, []time.Time{start.Add(2 * time.Second), start.Add(defaultInterval + 2*time.Second)}, web.times)
+}
+
+func Test_probeLoop_probeInterval(t *testing.T) {
+	ctx := log.NewContext(log.NewNopLogger())
+	cfg := handlerSettings{publicSettings: publicSettings{Probes: []applicationSettings{
+		{Name: "web", Protocol: "tcp", Port: 80},
+		{Name: "batch", Protocol: "tcp", Port: 81, IntervalInSeconds: 15},
+	}}}
+	loop, reported := newTestLoop(cfg, nil, 4)
+	web, batch := &timedProbe{clock: loop.clock}, &timedProbe{clock: loop.clock}
+	loop.newProbes = func(*handlerSettings) []HealthProbe { return []HealthProbe{web, batch} }
+	start := loop.clock.Now()
+
+	require.Equal(t, errTerminated, loop.run(context.Background(), ctx))
+	require.Len(t, web.times, 4)
+	require.Equal(t, []time.Time{start, start.Add(15 * time.Second)}, batch.times)
+	require.Equal(t, Healthy, (*reported)[1].state, "the health of the batch probe carried over")
+}
+
+func Test_probeLoop_provisioningGateTimeout(t *testing.T) {
+	ctx := log.NewContext(log.NewNopLogger())
+	cfg := handlerSettings{publicSettings: publicSettings{ProvisioningGate: true, ProvisioningGateTimeoutInSeconds: 60}}
+	loop, reported := newTestLoop(cfg, &scriptedProbe{[]HealthStatus{Unhealthy}}, 1000)
+	start := loop.clock.Now()
+
+	// fails after a minute of virtual time, instantly
+	require.Equal(t, errProvisioningGateTimeout, loop.run(context.Background(), ctx))
+	require.Equal(t, 13, len(*reported))
+	require.Equal(t, StatusTransitioning, (*reported)[12].statusType)
+	require.True(t, loop.clock.Now().Sub(start) > time.Minute)
+}
+
+func Test_probeLoop_pauseAndReload(t *testing.T) {
+	ctx := log.NewContext(log.NewNopLogger())
+	loop, reported := newTestLoop(handlerSettings{}, &scriptedProbe{[]HealthStatus{Healthy}}, 2)
+	loop.start(ctx)
+
+	loop.control.handle("pause")
+	require.Nil(t, loop.iterate(context.Background(), ctx))
+	require.Empty(t, *reported, "not probed while paused")
+
+	loop.control.handle("resume")
+	loop.control.handle("reload")
+	mon := loop.mon
+	require.Nil(t, loop.iterate(context.Background(), ctx))
+	require.Len(t, *reported, 1)
+	require.True(t, mon != loop.mon, "monitor rebuilt on reload")
+	require.Equal(t, loop.mon, loop.control.mon)
+}
+
+func Test_manualClock(t *testing.T) {
+	start := time.Now()
+	c := newManualClock(start)
+	woke := make(chan time.Time)
+	go func() {
+		c.Sleep(context.Background(), 10*time.Second)
+		woke <- c.Now()
+	}()
+
+	for c.sleepers() == 0 {
+		time.Sleep(time.Millisecond)
+	}
+	c.Advance(5 * time.Second)
+	select {
+	case <-woke:
+		t.Fatal("woke up early")
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	resp := (&loopControl{clock: c}).handle("advance 5s")
+	require.Empty(t, resp.Error)
+	require.Equal(t, start.Add(10*time.Second), <-woke)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	go func() {
+		for c.sleepers() == 0 {
+			time.Sleep(time.Millisecond)
+		}
+		cancel()
+	}()
+	require.False(t, c.Sleep(ctx, time.Hour), "cancelled")
+	require.Equal(t, 0, c.sleepers())
+
+	resp = (&loopControl{clock: realClock{}}).handle("advance 5s")
+	require.NotEmpty(t, resp.Error)
+	resp = (&loopControl{clock: c}).handle("advance soon")
+	require.Equal(t, `invalid duration "soon"`, resp.Error)
+}
+
+// terminatingProbe returns healthy, then cancels the loop on its second
+// evaluation and returns once interrupted.
+type terminatingProbe struct {
+	calls  int
+	cancel func()
+}
+
+func (p *terminatingProbe) evaluate(probeCtx context.Context, ctx *log.Context) (HealthStatus, error) {
+	p.calls++
+	if p.calls == 1 {
+		return Healthy, nil
+	}
+	p.cancel()
+	<-probeCtx.Done()
+	return Unhealthy, nil
+}
+
+func (p *terminatingProbe) address() string { return "terminating" }
+
+func Test_probeLoop_terminated(t *testing.T) {
+	ctx := log.NewContext(log.NewNopLogger())
+	runCtx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	probe := &terminatingProbe{cancel: cancel}
+	loop, reported := newTestLoop(handlerSettings{}, probe, 100)
+	var final []monitorStatus
+	loop.final = func(mon *monitor, st monitorStatus) error {
+		final = append(final, st)
+		return nil
+	}
+
+	require.Equal(t, errTerminated, loop.run(runCtx, ctx), "probe in flight interrupted")
+	require.Len(t, *reported, 1, "result of the interrupted probe ignored")
+	require.Len(t, final, 1)
+	require.Equal(t, defaultMessages[msgProbingStopped], final[0].message.Message)
+	require.Equal(t, StatusSuccess, final[0].statusType)
+	require.Equal(t, (*reported)[0].substatuses, final[0].substatuses, "last known health kept")
+}
+
+func Test_probeLoop_sleepInterrupted(t *testing.T) {
+	runCtx, cancel := context.WithCancel(context.Background())
+	loop := &probeLoop{clock: newManualClock(time.Now())}
+	time.AfterFunc(10*time.Millisecond, cancel)
+	require.False(t, loop.sleep(runCtx, time.Hour))
+}
+
+// wedgedProbe ignores its deadline on its first evaluation, returning only
+// once released, and is healthy afterwards.
+type wedgedProbe struct {
+	calls   int
+	release chan struct{}
+}
+
+func (p *wedgedProbe) evaluate(probeCtx context.Context, ctx *log.Context) (HealthStatus, error) {
+	p.calls++
+	if p.calls == 1 {
+		<-p.release
+	}
+	return Healthy, nil
+}
+
+func (p *wedgedProbe) address() string { return "wedged" }
+
+func Test_probeLoop_probeDeadline(t *testing.T) {
+	ctx := log.NewContext(log.NewNopLogger())
+	probe := &wedgedProbe{release: make(chan struct{})}
+	loop, reported := newTestLoop(handlerSettings{publicSettings: publicSettings{IntervalInSeconds: 1}}, probe, 100)
+	loop.start(ctx)
+
+	start := time.Now()
+	require.Nil(t, loop.iterate(context.Background(), ctx))
+	require.True(t, time.Since(start) < 5*time.Second, "abandoned at the interval")
+	require.Equal(t, Unhealthy, (*reported)[0].state)
+	require.Contains(t, loop.metrics.message(time.Now()), "abandonedProbes=1")
+
+	require.Nil(t, loop.iterate(context.Background(), ctx))
+	require.Equal(t, Unhealthy, (*reported)[1].state, "still stuck")
+
+	close(probe.release)
+	<-loop.abandoned[0].done
+	require.Equal(t, 1, probe.calls, "not evaluated again while stuck")
+	require.Nil(t, loop.iterate(context.Background(), ctx))
+	require.Equal(t, Healthy, (*reported)[2].state)
+	require.Equal(t, 2, probe.calls)
+}
+
+func Test_probeDeadlines(t *testing.T) {
+	require.Equal(t, []time.Duration{defaultInterval}, probeDeadlines(&handlerSettings{}), "interval shorter than the default timeout")
+	require.Equal(t, []time.Duration{2 * time.Second}, probeDeadlines(&handlerSettings{publicSettings: publicSettings{IntervalInSeconds: 10, ProbeTimeoutInSeconds: 2}}))
+
+	cfg := handlerSettings{publicSettings: publicSettings{IntervalInSeconds: 10, Probes: []applicationSettings{
+		{Name: "slow", Protocol: "tcp", Port: 80, IntervalInSeconds: 30, ProbeTimeoutInSeconds: 20},
+		{Name: "late", Protocol: "tcp", Port: 81, OffsetInMilliseconds: 4000},
+	}}}
+	require.Equal(t, []time.Duration{10 * time.Second, 6 * time.Second}, probeDeadlines(&cfg), "capped at the top level interval")
+}
+
+// panickingProbe panics on evaluation.
+type panickingProbe struct{}
+
+func (panickingProbe) evaluate(probeCtx context.Context, ctx *log.Context) (HealthStatus, error) {
+	panic("boom")
+}
+
+func (panickingProbe) address() string { return "panicking" }
+
+func Test_probeLoop_probePanic(t *testing.T) {
+	ctx := log.NewContext(log.NewNopLogger())
+	loop, reported := newTestLoop(handlerSettings{}, panickingProbe{}, 1)
+
+	require.Equal(t, errTerminated, loop.run(context.Background(), ctx))
+	require.Equal(t, Unknown, (*reported)[0].state)
+	require.Contains(t, loop.probeErrors[0], "probe panicked: boom")
+}
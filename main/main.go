@@ -1,9 +1,12 @@
 package main
 
 import (
+	"context"
 	"fmt"
+	"io"
 	"os"
 	"os/signal"
+	"path/filepath"
 	"strings"
 	"syscall"
 
@@ -12,40 +15,77 @@ import (
 )
 
 var (
-	// dataDir is where we store the logs and state for the extension handler
-	dataDir = "/var/lib/waagent/apphealth"
-
-	shutdown = false
+	// dataDir is where we store the logs and state for the extension handler,
+	// one per version so that uninstalling the previous version on an update
+	// leaves the data carried over alone
+	dataDir = versionedDataDir(dataRoot, Version)
 )
 
 func main() {
-	ctx := log.NewContext(log.NewSyncLogger(log.NewLogfmtLogger(
-		os.Stdout))).With("time", log.DefaultTimestamp).With("version", VersionString())
-
 	// parse command line arguments
 	cmd := parseCmd(os.Args)
+
+	// standalone commands print their results to stdout, so keep logs apart
+	var logOut io.Writer = os.Stdout
+	var logFileErr error
+	if cmd.standalone {
+		logOut = os.Stderr
+	} else if logFile, logFileErr = openRotatingFile(filepath.Join(logDir, logFileName),
+		defaultLogMaxSizeInMB<<20, defaultLogMaxFiles); logFileErr == nil {
+		// not to stdout as well, which the shim captures into a log nothing
+		// rotates
+		logOut = logFile
+	}
+	ctx := log.NewContext(secrets.wrap(syslogSink.wrap(logFilter.wrap(log.NewSyncLogger(log.NewLogfmtLogger(
+		io.MultiWriter(recentLogs, logOut))))))).With("time", log.DefaultTimestamp).With("version", VersionString())
 	ctx = ctx.With("operation", strings.ToLower(cmd.name))
+	if logFileErr != nil {
+		ctx.Log("event", "logging to standard output", "error", logFileErr)
+	}
 
-	// subscribe to cleanly shutdown
+	if cmd.standalone {
+		if _, err := cmd.f(context.Background(), ctx, HandlerEnvironment{}, 0); err != nil {
+			ctx.Log("event", "failed to handle", "error", err)
+			os.Exit(cmd.failExitCode)
+		}
+		return
+	}
+
+	// subscribe to cleanly shutdown, cancelling the command
+	runCtx, cancel := context.WithCancel(context.Background())
+	defer cancel()
 	sigs := make(chan os.Signal, 1)
 	signal.Notify(sigs, syscall.SIGINT, syscall.SIGTERM)
 	go func() {
 		<-sigs
-		shutdown = true
+		cancel()
 	}()
 
 	// parse extension environment
-	hEnv, err := vmextension.GetHandlerEnv()
+	hEnv, err := getHandlerEnv()
 	if err != nil {
 		ctx.Log("message", "failed to parse handlerenv", "error", err)
 		os.Exit(cmd.failExitCode)
 	}
+	if !hEnv.supported() {
+		ctx.Log("event", "unrecognized handler environment version, parsing on a best-effort basis", "version", hEnv.Version)
+	}
 	seqNum, err := vmextension.FindSeqNumConfig(hEnv.HandlerEnvironment.ConfigFolder)
 	if err != nil {
 		ctx.Log("messsage", "failed to find sequence number", "error", err)
 	}
 	ctx = ctx.With("seq", seqNum)
 
+	// on a crash, leave diagnostics behind and report where to find them
+	defer func() {
+		if r := recover(); r != nil {
+			ctx.Log("event", "panic", "error", r)
+			ref := dumpDiagnostics(ctx, fmt.Sprintf("panic: %v", r))
+			reportStatus(ctx, hEnv, seqNum, StatusError, cmd, fmt.Sprintf("panic: %v%s", r, ref))
+			os.Exit(cmd.failExitCode)
+		}
+	}()
+
 	// check sub-command preconditions, if any, before executing
 	ctx.Log("event", "start")
 	if cmd.pre != nil {
@@ -57,9 +97,16 @@ func main() {
 	}
 	// execute the subcommand
 	reportStatus(ctx, hEnv, seqNum, StatusTransitioning, cmd, "")
-	msg, err := cmd.f(ctx, hEnv, seqNum)
+	msg, err := cmd.f(runCtx, ctx, hEnv, seqNum)
+	if err == errTerminated {
+		// the probe loop reported its final status, being stopped is not a
+		// failure of the command and exits with 0
+		ctx.Log("event", "terminated")
+		return
+	}
 	if err != nil {
 		ctx.Log("event", "failed to handle", "error", err)
+		msg += dumpDiagnostics(ctx, err.Error())
 		reportStatus(ctx, hEnv, seqNum, StatusError, cmd, err.Error()+msg)
 		os.Exit(cmd.failExitCode)
 	}
@@ -70,7 +117,7 @@ func main() {
 // parseCmd looks at os.Args and parses the subcommand. If it is invalid,
 // it prints the usage string and an error message and exits with code 0.
 func parseCmd(args []string) cmd {
-	if len(os.Args) != 2 {
+	if len(os.Args) < 2 {
 		printUsage(args)
 		fmt.Println("Incorrect usage.")
 		os.Exit(2)
@@ -82,6 +129,11 @@ func parseCmd(args []string) cmd {
 		fmt.Printf("Incorrect command: %q\n", op)
 		os.Exit(2)
 	}
+	if len(os.Args) != 2 && !cmd.standalone {
+		printUsage(args)
+		fmt.Println("Incorrect usage.")
+		os.Exit(2)
+	}
 	return cmd
 }
 
@@ -91,7 +143,7 @@ func printUsage(args []string) {
 	fmt.Printf("Usage: %s ", os.Args[0])
 	i := 0
 	for k := range cmds {
-		fmt.Printf(k)
+		fmt.Print(k)
 		if i != len(cmds)-1 {
 			fmt.Printf("|")
 		}
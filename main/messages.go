@@ -0,0 +1,67 @@
+package main
+
+// messageID identifies a status message reported to the platform which can be
+// localized through the settings.
+type messageID string
+
+const (
+	msgPolling           messageID = "polling"
+	msgWaitingForHealthy messageID = "waitingForHealthy"
+	msgHealthy           messageID = "healthy"
+	msgUnhealthy         messageID = "unhealthy"
+	msgDegraded          messageID = "degraded"
+	msgInitializing      messageID = "initializing"
+	msgUnknown           messageID = "unknown"
+	msgReady             messageID = "ready"
+	msgNotReady          messageID = "notReady"
+	msgProbingStopped    messageID = "probingStopped"
+)
+
+const defaultLang = "en"
+
+// defaultMessages is the built-in English message catalog.
+var defaultMessages = map[messageID]string{
+	msgPolling:           "Successfully polling for application health",
+	msgWaitingForHealthy: "Waiting for the application to be found healthy",
+	msgHealthy:           "Application found to be healthy",
+	msgUnhealthy:         "Application found to be unhealthy",
+	msgDegraded:          "Application found to be degraded",
+	msgInitializing:      "Application is initializing",
+	msgUnknown:           "Application health could not be determined",
+	msgReady:             "Application is ready to receive traffic",
+	msgNotReady:          "Application is not ready to receive traffic",
+	msgProbingStopped:    "Application health probing stopped",
+}
+
+// messageCatalog resolves status messages in the configured language, falling
+// back to the built-in English message for the ones not translated.
+type messageCatalog struct {
+	lang     string
+	messages map[string]string
+}
+
+func newMessageCatalog(cfg *handlerSettings) messageCatalog {
+	return messageCatalog{
+		lang:     cfg.locale(),
+		messages: cfg.publicSettings.MessageCatalog,
+	}
+}
+
+// get returns the message with the given ID.
+func (c messageCatalog) get(id messageID) string {
+	return c.format(id).Message
+}
+
+// format returns the message with the given ID along with its language: the
+// configured one if the catalog translates it, English otherwise.
+func (c messageCatalog) format(id messageID) FormattedMessage {
+	if m, ok := c.messages[string(id)]; ok {
+		return FormattedMessage{Lang: c.lang, Message: m}
+	}
+	return FormattedMessage{Lang: defaultLang, Message: defaultMessages[id]}
+}
+
+// substatus creates a substatus item with the given type, name and message.
+func (c messageCatalog) substatus(t StatusType, name string, id messageID) SubstatusItem {
+	return SubstatusItem{Name: name, Status: t, FormattedMessage: c.format(id)}
+}
@@ -0,0 +1,31 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func Test_messageCatalog_default(t *testing.T) {
+	c := newMessageCatalog(&handlerSettings{})
+	require.Equal(t, "en", c.lang)
+	require.Equal(t, "Application found to be healthy", c.get(msgHealthy))
+}
+
+func Test_messageCatalog_localized(t *testing.T) {
+	c := newMessageCatalog(&handlerSettings{publicSettings: publicSettings{
+		Locale:         "fr-FR",
+		MessageCatalog: map[string]string{"healthy": "Application en bonne santé"},
+	}})
+	require.Equal(t, "fr-FR", c.lang)
+	require.Equal(t, "Application en bonne santé", c.get(msgHealthy))
+	require.Equal(t, "Application found to be unhealthy", c.get(msgUnhealthy), "falls back to english")
+	require.Equal(t, "fr-FR", c.format(msgHealthy).Lang)
+	require.Equal(t, "en", c.format(msgUnhealthy).Lang)
+}
+
+func Test_defaultMessages_complete(t *testing.T) {
+	for _, id := range []messageID{msgPolling, msgWaitingForHealthy, msgHealthy, msgUnhealthy, msgDegraded, msgInitializing, msgUnknown, msgReady, msgNotReady} {
+		require.NotEmpty(t, defaultMessages[id], "message %q", id)
+	}
+}
@@ -0,0 +1,118 @@
+package main
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+const (
+	extensionMetricsSubstatusName = "AppHealthExtensionMetrics"
+	extensionErrorSubstatusName   = "AppHealthExtensionError"
+
+	// extensionErrorWindow is how long an internal error is reported in the
+	// extension error substatus after it happened.
+	extensionErrorWindow = 10 * time.Minute
+
+	// startCountFile is the file under dataDir counting how many times the
+	// probe loop has been started since the extension was installed.
+	startCountFile = "startcount"
+)
+
+// extensionMetrics tracks the health of the extension itself, so that
+// problems of the monitoring can be told apart from application problems.
+type extensionMetrics struct {
+	mu             sync.Mutex
+	startTime      time.Time
+	restarts       int
+	lastConfigLoad time.Time
+	internalErrors int
+	lastError      error
+	lastErrorTime  time.Time
+	// abandonedProbes counts the evaluations abandoned past their deadline.
+	abandonedProbes int
+}
+
+func newExtensionMetrics(now time.Time, restarts int) *extensionMetrics {
+	return &extensionMetrics{startTime: now, restarts: restarts}
+}
+
+// configLoaded records that the settings were (re)loaded at the given time.
+func (m *extensionMetrics) configLoaded(now time.Time) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.lastConfigLoad = now
+}
+
+// internalError records a failure of the extension itself made at now.
+func (m *extensionMetrics) internalError(now time.Time, err error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.internalErrors++
+	m.lastError, m.lastErrorTime = err, now
+}
+
+// probeAbandoned records an evaluation of a probe abandoned past its deadline.
+func (m *extensionMetrics) probeAbandoned() {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.abandonedProbes++
+}
+
+// message formats the metrics as the substatus message.
+func (m *extensionMetrics) message(now time.Time) string {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	lastConfigLoad := "never"
+	if !m.lastConfigLoad.IsZero() {
+		lastConfigLoad = m.lastConfigLoad.UTC().Format(time.RFC3339)
+	}
+	return fmt.Sprintf("uptime=%s restarts=%d lastConfigLoad=%s internalErrors=%d abandonedProbes=%d",
+		now.Sub(m.startTime)/time.Second*time.Second, m.restarts, lastConfigLoad, m.internalErrors, m.abandonedProbes)
+}
+
+// substatus returns the substatus item reporting the metrics.
+func (m *extensionMetrics) substatus(now time.Time) SubstatusItem {
+	return NewSubstatus(StatusSuccess, extensionMetricsSubstatusName, m.message(now))
+}
+
+// errorSubstatus returns the substatus item reporting the last internal error,
+// or false if there was none recently. Internal errors are reported apart from
+// the application health so that they never trigger the repair of the
+// application.
+func (m *extensionMetrics) errorSubstatus(now time.Time) (SubstatusItem, bool) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.lastError == nil || now.Sub(m.lastErrorTime) > extensionErrorWindow {
+		return SubstatusItem{}, false
+	}
+	return NewSubstatus(StatusError, extensionErrorSubstatusName, fmt.Sprintf("%s: %v",
+		m.lastErrorTime.UTC().Format(time.RFC3339), m.lastError)), true
+}
+
+// recordStart increments the persisted start counter of the probe loop in dir
+// and returns the number of restarts, i.e. the starts before this one.
+func recordStart(dir string) (int, error) {
+	path := filepath.Join(dir, startCountFile)
+	starts := 0
+	b, err := ioutil.ReadFile(path)
+	if err != nil && !os.IsNotExist(err) {
+		return 0, errors.Wrap(err, "failed to read start count")
+	} else if err == nil {
+		if starts, err = strconv.Atoi(strings.TrimSpace(string(b))); err != nil {
+			// corrupt counter; start over rather than failing the loop
+			starts = 0
+		}
+	}
+	if err := ioutil.WriteFile(path, []byte(strconv.Itoa(starts+1)), 0644); err != nil {
+		return starts, errors.Wrap(err, "failed to write start count")
+	}
+	return starts, nil
+}
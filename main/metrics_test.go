@@ -0,0 +1,69 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/require"
+)
+
+func Test_extensionMetrics_message(t *testing.T) {
+	start := time.Date(2017, 1, 1, 0, 0, 0, 0, time.UTC)
+	m := newExtensionMetrics(start, 2)
+	require.Equal(t, "uptime=0s restarts=2 lastConfigLoad=never internalErrors=0 abandonedProbes=0", m.message(start))
+
+	m.configLoaded(start.Add(time.Second))
+	m.internalError(start, errors.New("first"))
+	m.internalError(start, errors.New("second"))
+	m.probeAbandoned()
+	require.Equal(t, "uptime=1h0m5s restarts=2 lastConfigLoad=2017-01-01T00:00:01Z internalErrors=2 abandonedProbes=1",
+		m.message(start.Add(time.Hour+5*time.Second+300*time.Millisecond)))
+
+	sub := m.substatus(start)
+	require.Equal(t, extensionMetricsSubstatusName, sub.Name)
+	require.Equal(t, StatusSuccess, sub.Status)
+}
+
+func Test_extensionMetrics_errorSubstatus(t *testing.T) {
+	start := time.Date(2017, 1, 1, 0, 0, 0, 0, time.UTC)
+	m := newExtensionMetrics(start, 0)
+	_, ok := m.errorSubstatus(start)
+	require.False(t, ok)
+
+	m.internalError(start, errors.New("failed to reload configuration: invalid JSON"))
+	sub, ok := m.errorSubstatus(start.Add(time.Minute))
+	require.True(t, ok)
+	require.Equal(t, extensionErrorSubstatusName, sub.Name)
+	require.Equal(t, StatusError, sub.Status)
+	require.Equal(t, "2017-01-01T00:00:00Z: failed to reload configuration: invalid JSON", sub.FormattedMessage.Message)
+
+	_, ok = m.errorSubstatus(start.Add(extensionErrorWindow + time.Second))
+	require.False(t, ok, "no longer reported")
+}
+
+func Test_recordStart(t *testing.T) {
+	tmpDir, err := ioutil.TempDir("", "")
+	require.Nil(t, err)
+	defer os.RemoveAll(tmpDir)
+
+	for i := 0; i < 3; i++ {
+		n, err := recordStart(tmpDir)
+		require.Nil(t, err)
+		require.Equal(t, i, n)
+	}
+
+	// corrupt counter starts over
+	require.Nil(t, ioutil.WriteFile(filepath.Join(tmpDir, startCountFile), []byte("x"), 0644))
+	n, err := recordStart(tmpDir)
+	require.Nil(t, err)
+	require.Equal(t, 0, n)
+}
+
+func Test_recordStart_missingDir(t *testing.T) {
+	_, err := recordStart("/non-existing/dir")
+	require.NotNil(t, err)
+}
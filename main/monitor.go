@@ -0,0 +1,290 @@
+package main
+
+import (
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// monitor turns the results of the health probes into the status reported for
+// the enable operation.
+type monitor struct {
+	mu sync.Mutex // guards the state machines and gate
+
+	cfg        *handlerSettings
+	groups     []*monitorGroup
+	gate       *provisioningGate
+	catalog    messageCatalog
+	statusOpts statusOptions
+	metrics    *extensionMetrics
+
+	// reported is the state last reported in the health substatus, changed
+	// at lastTransition, held for the transition cooldown.
+	reported       HealthStatus
+	lastTransition time.Time
+}
+
+// monitorGroup is an application monitored by its own probe and state machine,
+// or one of the aggregated probes. Without configured applications or probes,
+// the monitor has a single unnamed group.
+type monitorGroup struct {
+	name      string
+	cfg       *handlerSettings
+	machine   *healthStateMachine
+	readiness bool // reported on its own, not part of the VM-level health
+	weight    int  // in the health score of the weighted aggregation
+}
+
+// persistedAs tells whether the state persisted for the named application is
+// that of the group, including the unnamed state of the probe of the flat
+// settings shape persisted before it was migrated into 'probes'.
+func (g *monitorGroup) persistedAs(name string) bool {
+	return name == g.name || (name == "" && g.name == flatProbeName && !g.readiness)
+}
+
+func newMonitor(cfg *handlerSettings, now time.Time, metrics *extensionMetrics) *monitor {
+	m := &monitor{
+		cfg:        cfg,
+		gate:       newProvisioningGate(cfg, now),
+		catalog:    newMessageCatalog(cfg),
+		statusOpts: newStatusOptions(cfg),
+		metrics:    metrics,
+	}
+	for _, s := range monitoredSettings(cfg) {
+		m.groups = append(m.groups, &monitorGroup{name: s.name, cfg: s.cfg, machine: newHealthStateMachine(s.cfg, now), readiness: s.readiness, weight: s.weight})
+	}
+	return m
+}
+
+// namedSettings are the settings of a monitored application.
+type namedSettings struct {
+	name      string
+	cfg       *handlerSettings
+	readiness bool
+	offset    time.Duration // of the probe in each interval
+	weight    int
+}
+
+// monitoredSettings returns the settings of each monitored application or
+// aggregated probe, each of which is probed separately, followed by the
+// readiness probe if any.
+func monitoredSettings(cfg *handlerSettings) []namedSettings {
+	var out []namedSettings
+	apps := cfg.applications()
+	if len(apps) == 0 && len(cfg.probes()) == 0 {
+		out = append(out, namedSettings{cfg: cfg, weight: 1})
+	}
+	for _, a := range apps {
+		s := a.settings(cfg)
+		out = append(out, namedSettings{name: a.Name, cfg: &s, offset: a.offset(), weight: 1})
+	}
+	for i, p := range cfg.probes() {
+		s := p.settings(cfg)
+		out = append(out, namedSettings{name: probeName(p, i), cfg: &s, offset: p.offset(), weight: p.weight()})
+	}
+	if r := cfg.readinessProbe(); r != nil {
+		s := r.settings(cfg)
+		out = append(out, namedSettings{name: r.Name, cfg: &s, readiness: true, offset: r.offset()})
+	}
+	return out
+}
+
+// monitorStatus is the status derived from a single probe result.
+type monitorStatus struct {
+	state       HealthStatus
+	statusType  StatusType
+	message     FormattedMessage
+	substatuses []SubstatusItem
+}
+
+// observe derives the status from the probe results made at now, one result
+// for each monitored application in the order of monitoredSettings, empty for
+// an application not probed at this interval. An error is returned if the
+// enable operation must fail.
+func (m *monitor) observe(now time.Time, results ...HealthStatus) (monitorStatus, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if len(results) != len(m.groups) {
+		return monitorStatus{}, errors.Errorf("got %d probe results for %d applications", len(results), len(m.groups))
+	}
+
+	var states, liveness []HealthStatus
+	var weights []int
+	for i, g := range m.groups {
+		result := results[i]
+		var st HealthStatus
+		if result == "" {
+			// not probed at this interval
+			st = g.machine.current()
+			result = st
+		} else {
+			st = g.machine.observe(now, result)
+		}
+		if !g.readiness {
+			states = append(states, st)
+			liveness = append(liveness, result)
+			weights = append(weights, g.weight)
+		}
+	}
+	state := m.aggregate(states, weights)
+	statusType, msgID, err := m.gate.observe(now, m.aggregate(liveness, weights))
+	if err != nil {
+		return monitorStatus{state: state}, err
+	}
+	return monitorStatus{
+		state:       state,
+		statusType:  statusType,
+		message:     m.catalog.format(msgID),
+		substatuses: m.healthSubstatuses(m.coalesce(now, state), now),
+	}, nil
+}
+
+// coalesce returns the state to report for the state derived at now, holding
+// back changes within the transition cooldown of the previous change.
+func (m *monitor) coalesce(now time.Time, state HealthStatus) HealthStatus {
+	switch {
+	case m.reported == "":
+		m.reported = state
+	case state != m.reported && now.Sub(m.lastTransition) >= m.cfg.transitionCooldown():
+		m.reported, m.lastTransition = state, now
+	}
+	return m.reported
+}
+
+// state returns the currently derived health state.
+func (m *monitor) state() HealthStatus {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.currentState()
+}
+
+func (m *monitor) currentState() HealthStatus {
+	var states []HealthStatus
+	var weights []int
+	for _, g := range m.groups {
+		if !g.readiness {
+			states = append(states, g.machine.current())
+			weights = append(weights, g.weight)
+		}
+	}
+	return m.aggregate(states, weights)
+}
+
+// aggregate decides the VM-level health from the health of the monitored
+// applications or probes, in the order of the groups.
+func (m *monitor) aggregate(states []HealthStatus, weights []int) HealthStatus {
+	if m.cfg.healthPolicy() == policyWeighted {
+		return aggregateWeightedHealth(m.cfg.healthyScoreThreshold(), states, weights)
+	}
+	return aggregateHealth(m.cfg.healthPolicy(), states)
+}
+
+// pendingChange reports whether a probe result contradicting the derived
+// state of an application was observed and not confirmed yet.
+func (m *monitor) pendingChange() bool {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for _, g := range m.groups {
+		if g.machine.consecutive > 0 {
+			return true
+		}
+	}
+	return false
+}
+
+// history returns a copy of the recent probe results of all applications
+// ordered by time.
+func (m *monitor) history() []probeRecord {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	var out []probeRecord
+	for _, g := range m.groups {
+		for _, r := range g.machine.history {
+			r.Application = g.name
+			out = append(out, r)
+		}
+	}
+	sort.SliceStable(out, func(i, j int) bool { return out[i].Time.Before(out[j].Time) })
+	return out
+}
+
+// report builds the status report for the given derived status.
+func (m *monitor) report(s monitorStatus) StatusReport {
+	r := NewFormattedStatus(s.statusType, "enable", s.message)
+	r.AddSubstatusItems(s.substatuses...)
+	m.statusOpts.apply(r)
+	return r
+}
+
+// capturesCommandOutput reports whether the exec probe of any group reports
+// the output of its failed runs.
+func (m *monitor) capturesCommandOutput() bool {
+	for _, g := range m.groups {
+		if _, _, capture := g.cfg.commandSandbox(); capture {
+			return true
+		}
+	}
+	return false
+}
+
+// healthSubstatuses builds the substatus items reported for the given derived
+// health state, honoring the substatus naming and suppression settings: one
+// substatus for each configured application, the readiness substatus, the
+// addresses connected to, the captured command output, the probe latencies,
+// the certificate expiries, the recent extension error and the metrics. The
+// legacy status format only has the application health substatus.
+func (m *monitor) healthSubstatuses(state HealthStatus, now time.Time) []SubstatusItem {
+	if m.cfg.suppressSubstatus() {
+		return nil
+	}
+	names := m.cfg.substatusNames()
+	legacy := m.cfg.statusFormatVersion() == legacyStatusFormatVersion
+	if legacy {
+		names = names[:1]
+	}
+
+	var out []SubstatusItem
+	for _, name := range names {
+		out = append(out, m.catalog.substatus(healthStatusToStatusType[state], name, healthStatusToMessage[state]))
+	}
+	if legacy {
+		return out
+	}
+	for _, g := range m.groups {
+		st := g.machine.current()
+		switch {
+		case g.readiness && st == Healthy:
+			out = append(out, m.catalog.substatus(StatusSuccess, g.cfg.substatusNames()[0], msgReady))
+		case g.readiness:
+			out = append(out, m.catalog.substatus(StatusTransitioning, g.cfg.substatusNames()[0], msgNotReady))
+		case len(m.cfg.applications()) != 0:
+			out = append(out, m.catalog.substatus(healthStatusToStatusType[st], g.cfg.substatusNames()[0], healthStatusToMessage[st]))
+		}
+	}
+	if m.cfg.addressPolicy() != "" {
+		if msg := probeAddresses.message(); msg != "" {
+			out = append(out, NewSubstatus(StatusSuccess, probeAddressesSubstatusName, msg))
+		}
+	}
+	if m.capturesCommandOutput() {
+		if msg := commandOutputs.message(); msg != "" {
+			out = append(out, NewSubstatus(StatusError, commandOutputSubstatusName, msg))
+		}
+	}
+	if m.cfg.reportProbeLatency() {
+		if msg := probeLatencies.message(); msg != "" {
+			out = append(out, NewSubstatus(StatusSuccess, probeLatencySubstatusName, msg))
+		}
+	}
+	if m.cfg.reportCertificateExpiry() {
+		if msg := certificateExpiries.message(now); msg != "" {
+			out = append(out, NewSubstatus(StatusSuccess, certificateExpirySubstatusName, msg))
+		}
+	}
+	if item, ok := m.metrics.errorSubstatus(now); ok {
+		out = append(out, item)
+	}
+	return append(out, m.metrics.substatus(now))
+}
@@ -0,0 +1,181 @@
+package main
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func Test_monitor_healthSubstatuses(t *testing.T) {
+	now := time.Now()
+	metrics := newExtensionMetrics(now, 0)
+
+	subs := newMonitor(&handlerSettings{}, now, metrics).healthSubstatuses(Unhealthy, now)
+	require.Len(t, subs, 2)
+	require.Equal(t, substatusName, subs[0].Name)
+	require.Equal(t, StatusError, subs[0].Status)
+	require.Equal(t, extensionMetricsSubstatusName, subs[1].Name)
+
+	cfg := &handlerSettings{publicSettings: publicSettings{SubstatusName: "Custom", AdditionalSubstatusNames: []string{"Other"}}}
+	subs = newMonitor(cfg, now, metrics).healthSubstatuses(Healthy, now)
+	require.Len(t, subs, 3)
+	require.Equal(t, "Custom", subs[0].Name)
+	require.Equal(t, "Other", subs[1].Name)
+	require.Equal(t, subs[0].FormattedMessage, subs[1].FormattedMessage)
+
+	cfg = &handlerSettings{publicSettings: publicSettings{SuppressSubstatus: true}}
+	require.Empty(t, newMonitor(cfg, now, metrics).healthSubstatuses(Healthy, now))
+}
+
+func Test_monitor_probeAddressesSubstatus(t *testing.T) {
+	now := time.Now()
+	defer func(r *addressRecorder) { probeAddresses = r }(probeAddresses)
+	probeAddresses = newAddressRecorder()
+	probeAddresses.record("localhost:80", "127.0.0.1:80")
+
+	subs := newMonitor(&handlerSettings{}, now, newExtensionMetrics(now, 0)).healthSubstatuses(Healthy, now)
+	require.Len(t, subs, 2, "only with an address policy")
+
+	cfg := &handlerSettings{publicSettings: publicSettings{AddressPolicy: addressPolicyAny}}
+	subs = newMonitor(cfg, now, newExtensionMetrics(now, 0)).healthSubstatuses(Healthy, now)
+	require.Len(t, subs, 3)
+	require.Equal(t, probeAddressesSubstatusName, subs[1].Name)
+	require.Equal(t, "localhost:80=127.0.0.1:80", subs[1].FormattedMessage.Message)
+}
+
+func Test_monitor_certificateExpirySubstatus(t *testing.T) {
+	now := time.Date(2026, 10, 15, 12, 0, 0, 0, time.UTC)
+	defer func(r *expiryRecorder) { certificateExpiries = r }(certificateExpiries)
+	certificateExpiries = newExpiryRecorder()
+	certificateExpiries.record("localhost:443", now.Add(47*24*time.Hour))
+
+	subs := newMonitor(&handlerSettings{}, now, newExtensionMetrics(now, 0)).healthSubstatuses(Healthy, now)
+	require.Len(t, subs, 2, "only when reported")
+
+	cfg := &handlerSettings{publicSettings: publicSettings{Protocol: "https", ReportCertificateExpiry: true}}
+	subs = newMonitor(cfg, now, newExtensionMetrics(now, 0)).healthSubstatuses(Healthy, now)
+	require.Len(t, subs, 3)
+	require.Equal(t, certificateExpirySubstatusName, subs[1].Name)
+	require.Equal(t, "localhost:443=2026-12-01T12:00:00Z (47 days)", subs[1].FormattedMessage.Message)
+}
+
+func Test_monitor_probeLatencySubstatus(t *testing.T) {
+	now := time.Now()
+	defer func(r *latencyRecorder) { probeLatencies = r }(probeLatencies)
+	probeLatencies = newLatencyRecorder()
+	probeLatencies.record("localhost:80", 20*time.Millisecond)
+
+	subs := newMonitor(&handlerSettings{}, now, newExtensionMetrics(now, 0)).healthSubstatuses(Healthy, now)
+	require.Len(t, subs, 2, "only when reported")
+
+	cfg := &handlerSettings{publicSettings: publicSettings{ReportProbeLatency: true}}
+	subs = newMonitor(cfg, now, newExtensionMetrics(now, 0)).healthSubstatuses(Healthy, now)
+	require.Len(t, subs, 3)
+	require.Equal(t, probeLatencySubstatusName, subs[1].Name)
+	require.Equal(t, "localhost:80 last=20ms average=20ms", subs[1].FormattedMessage.Message)
+}
+
+func Test_monitor_commandOutputSubstatus(t *testing.T) {
+	now := time.Now()
+	defer func(r *outputRecorder) { commandOutputs = r }(commandOutputs)
+	commandOutputs = newOutputRecorder()
+	commandOutputs.record("/usr/bin/check", "exit status 3: disk full")
+
+	subs := newMonitor(&handlerSettings{}, now, newExtensionMetrics(now, 0)).healthSubstatuses(Healthy, now)
+	require.Len(t, subs, 2, "only when captured")
+
+	cfg := &handlerSettings{publicSettings: publicSettings{Applications: []applicationSettings{
+		{Name: "web", Protocol: "http"},
+		{Name: "cli", Protocol: "exec", Command: []string{"/usr/bin/check"}, CaptureCommandOutput: true},
+	}}}
+	subs = newMonitor(cfg, now, newExtensionMetrics(now, 0)).healthSubstatuses(Unhealthy, now)
+	require.Len(t, subs, 5)
+	require.Equal(t, commandOutputSubstatusName, subs[3].Name)
+	require.Equal(t, StatusError, subs[3].Status)
+	require.Equal(t, "/usr/bin/check: exit status 3: disk full", subs[3].FormattedMessage.Message)
+}
+
+func Test_monitor_observe(t *testing.T) {
+	now := time.Now()
+	cfg := &handlerSettings{publicSettings: publicSettings{ProvisioningGate: true, Locale: "de",
+		MessageCatalog: map[string]string{"polling": "Anwendungsstatus wird abgefragt"}}}
+	m := newMonitor(cfg, now, newExtensionMetrics(now, 0))
+
+	st, err := m.observe(now, Unhealthy)
+	require.Nil(t, err)
+	require.Equal(t, Unhealthy, st.state)
+	require.Equal(t, StatusTransitioning, st.statusType)
+	require.Equal(t, FormattedMessage{Lang: "en", Message: defaultMessages[msgWaitingForHealthy]}, st.message, "not translated")
+
+	st, err = m.observe(now.Add(time.Second), Healthy)
+	require.Nil(t, err)
+	require.Equal(t, Healthy, st.state)
+	require.Equal(t, StatusSuccess, st.statusType)
+
+	r := m.report(st)
+	require.Equal(t, FormattedMessage{Lang: "de", Message: "Anwendungsstatus wird abgefragt"}, r[0].Status.FormattedMessage)
+	require.Len(t, r[0].Status.SubstatusList, 2)
+	for _, s := range r[0].Status.SubstatusList {
+		require.Equal(t, "en", s.FormattedMessage.Lang, "%s not translated", s.Name)
+	}
+}
+
+func Test_monitor_transitionCooldown(t *testing.T) {
+	now := time.Now()
+	cfg := &handlerSettings{publicSettings: publicSettings{TransitionCooldownInSeconds: 60}}
+	m := newMonitor(cfg, now, newExtensionMetrics(now, 0))
+	reported := func(st monitorStatus) StatusType { return st.substatuses[0].Status }
+
+	st, err := m.observe(now, Healthy)
+	require.Nil(t, err)
+	require.Equal(t, StatusSuccess, reported(st))
+
+	st, err = m.observe(now.Add(5*time.Second), Unhealthy)
+	require.Nil(t, err)
+	require.Equal(t, StatusError, reported(st), "first change is reported")
+
+	// flapping within the cooldown
+	st, err = m.observe(now.Add(10*time.Second), Healthy)
+	require.Nil(t, err)
+	require.Equal(t, Healthy, st.state, "derived state is not held back")
+	require.Equal(t, StatusError, reported(st))
+	st, err = m.observe(now.Add(30*time.Second), Unhealthy)
+	require.Nil(t, err)
+	require.Equal(t, StatusError, reported(st))
+	st, err = m.observe(now.Add(40*time.Second), Healthy)
+	require.Nil(t, err)
+	require.Equal(t, StatusError, reported(st))
+
+	// latest state reported when the cooldown ends
+	st, err = m.observe(now.Add(65*time.Second), Healthy)
+	require.Nil(t, err)
+	require.Equal(t, StatusSuccess, reported(st))
+}
+
+func Test_monitor_legacyStatusFormat(t *testing.T) {
+	now := time.Now()
+	cfg := &handlerSettings{publicSettings: publicSettings{StatusFormatVersion: legacyStatusFormatVersion}}
+	m := newMonitor(cfg, now, newExtensionMetrics(now, 0))
+
+	st, err := m.observe(now, Healthy)
+	require.Nil(t, err)
+	r := m.report(st)
+	require.Len(t, r[0].Status.SubstatusList, 1)
+	require.Equal(t, substatusName, r[0].Status.SubstatusList[0].Name)
+	require.Equal(t, 0, r[0].FormatVersion)
+
+	b, err := r.marshal()
+	require.Nil(t, err)
+	require.NotContains(t, string(b), "formatVersion")
+}
+
+func Test_monitor_currentStatusFormat(t *testing.T) {
+	now := time.Now()
+	m := newMonitor(&handlerSettings{}, now, newExtensionMetrics(now, 0))
+
+	st, err := m.observe(now, Healthy)
+	require.Nil(t, err)
+	r := m.report(st)
+	require.Equal(t, currentStatusFormatVersion, r[0].FormatVersion)
+}
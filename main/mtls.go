@@ -0,0 +1,71 @@
+package main
+
+import (
+	"crypto/tls"
+	"path/filepath"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// certificateDir is where the guest agent places the certificates of the VM,
+// named after their thumbprint.
+var certificateDir = "/var/lib/waagent"
+
+var (
+	errClientCertRequiresHttps = errors.New("'clientCertificate' and 'clientCertificateThumbprint' can only be specified when using 'https' or 'tls' protocol")
+	errClientCertIncomplete    = errors.New("'clientCertificate' and 'clientKey' must be specified together")
+	errClientCertTwice         = errors.New("only one of 'clientCertificate' and 'clientCertificateThumbprint' can be specified")
+	errInvalidClientCert       = errors.New("'clientCertificate' and 'clientKey' are not a valid PEM encoded certificate and private key")
+)
+
+// clientCertificate returns the certificate https and tls probes present in
+// the TLS handshake, or nil if they do not present one. A certificate
+// referenced by thumbprint is read from the files the guest agent placed it in.
+func (s *handlerSettings) clientCertificate() (*tls.Certificate, error) {
+	p := s.protectedSettings
+	switch {
+	case p.ClientCertificate != "":
+		c, err := tls.X509KeyPair([]byte(p.ClientCertificate), []byte(p.ClientKey))
+		if err != nil {
+			return nil, errInvalidClientCert
+		}
+		return &c, nil
+	case p.ClientCertificateThumbprint != "":
+		thumbprint := strings.ToUpper(p.ClientCertificateThumbprint)
+		c, err := tls.LoadX509KeyPair(
+			filepath.Join(certificateDir, thumbprint+".crt"),
+			filepath.Join(certificateDir, thumbprint+".prv"))
+		if err != nil {
+			return nil, errors.Wrapf(err, "failed to load client certificate %s", thumbprint)
+		}
+		return &c, nil
+	}
+	return nil, nil
+}
+
+// validateClientCertificate makes logical validation of the client
+// certificate of https and tls probes. A certificate referenced by thumbprint is only
+// loaded when the probe is created, as the guest agent may place it later.
+func (h handlerSettings) validateClientCertificate() error {
+	p := h.protectedSettings
+	inline := p.ClientCertificate != "" || p.ClientKey != ""
+	if !inline && p.ClientCertificateThumbprint == "" {
+		return nil
+	}
+	if !h.usesTLS() {
+		return errClientCertRequiresHttps
+	}
+	if inline && p.ClientCertificateThumbprint != "" {
+		return errClientCertTwice
+	}
+	if inline {
+		if p.ClientCertificate == "" || p.ClientKey == "" {
+			return errClientCertIncomplete
+		}
+		if _, err := h.clientCertificate(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
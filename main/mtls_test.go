@@ -0,0 +1,94 @@
+package main
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/pem"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/go-kit/kit/log"
+	"github.com/stretchr/testify/require"
+)
+
+const testThumbprint = "0123456789ABCDEF0123456789ABCDEF01234567"
+
+// writeClientCert writes a client certificate like the guest agent does and
+// returns its PEM encoded certificate and key.
+func writeClientCert(t *testing.T, dir string) (crt, key string) {
+	k, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.Nil(t, err)
+	der, err := x509.MarshalECPrivateKey(k)
+	require.Nil(t, err)
+	prv := pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: der})
+	writeHandlerCert(t, dir, testThumbprint, k, func() []byte { return prv })
+	b, err := ioutil.ReadFile(filepath.Join(dir, testThumbprint+".crt"))
+	require.Nil(t, err)
+	return string(b), string(prv)
+}
+
+func Test_HttpHealthProbe_clientCertificate(t *testing.T) {
+	dir, err := ioutil.TempDir("", "")
+	require.Nil(t, err)
+	defer os.RemoveAll(dir)
+	defer func(d string) { certificateDir = d }(certificateDir)
+	certificateDir = dir
+	crt, key := writeClientCert(t, dir)
+
+	srv := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	srv.TLS = &tls.Config{ClientAuth: tls.RequireAnyClientCert}
+	srv.StartTLS()
+	defer srv.Close()
+
+	ctx := log.NewContext(log.NewNopLogger())
+	for _, c := range []struct {
+		name      string
+		protected protectedSettings
+		expected  HealthStatus
+	}{
+		{"none", protectedSettings{}, Unhealthy},
+		{"inline", protectedSettings{ClientCertificate: crt, ClientKey: key}, Healthy},
+		{"thumbprint", protectedSettings{ClientCertificateThumbprint: testThumbprint}, Healthy},
+		{"lowercase thumbprint", protectedSettings{ClientCertificateThumbprint: "0123456789abcdef0123456789abcdef01234567"}, Healthy},
+	} {
+		cfg := &handlerSettings{publicSettings{Protocol: "https"}, c.protected}
+		require.Nil(t, cfg.validate(), c.name)
+		p := newProbe(ctx, cfg, 0).(*HttpHealthProbe)
+		p.Address = srv.URL
+		state, _ := p.evaluate(context.Background(), ctx)
+		require.Equal(t, c.expected, state, c.name)
+	}
+
+	cfg := &handlerSettings{publicSettings{Protocol: "https"}, protectedSettings{ClientCertificateThumbprint: "89ABCDEF0123456789ABCDEF0123456789ABCDEF"}}
+	require.Nil(t, cfg.validate(), "certificate placed later")
+	_, err = newProbe(ctx, cfg, 0).evaluate(context.Background(), ctx)
+	require.NotNil(t, err)
+	require.Contains(t, err.Error(), "failed to load client certificate 89ABCDEF0123456789ABCDEF0123456789ABCDEF")
+}
+
+func Test_handlerSettingsValidate_clientCertificate(t *testing.T) {
+	require.Equal(t, errClientCertRequiresHttps, handlerSettings{
+		publicSettings{Protocol: "http"},
+		protectedSettings{ClientCertificateThumbprint: testThumbprint},
+	}.validate())
+	require.Equal(t, errClientCertIncomplete, handlerSettings{
+		publicSettings{Protocol: "https"},
+		protectedSettings{ClientCertificate: "cert"},
+	}.validate())
+	require.Equal(t, errClientCertTwice, handlerSettings{
+		publicSettings{Protocol: "https"},
+		protectedSettings{ClientCertificate: "cert", ClientKey: "key", ClientCertificateThumbprint: testThumbprint},
+	}.validate())
+	require.Equal(t, errInvalidClientCert, handlerSettings{
+		publicSettings{Protocol: "https"},
+		protectedSettings{ClientCertificate: "cert", ClientKey: "key"},
+	}.validate())
+}
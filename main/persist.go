@@ -0,0 +1,118 @@
+package main
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+const (
+	// healthStateFile is the file under dataDir the derived health state is
+	// persisted to, so that it survives restarts of the probe loop.
+	healthStateFile = "healthstate.json"
+)
+
+var (
+	errMaxAgeRequiresPersistState = errors.New("'persistedStateMaxAgeInSeconds' cannot be specified unless 'persistState' is enabled")
+)
+
+// persistedState is the derived health state saved across restarts.
+type persistedState struct {
+	SavedAt    time.Time          `json:"savedAt"`
+	GatePassed bool               `json:"gatePassed"`
+	Machines   []persistedMachine `json:"machines"`
+
+	// Reported is the state last reported, changed at LastTransition, so
+	// that the transition cooldown carries over as well.
+	Reported       HealthStatus `json:"reported,omitempty"`
+	LastTransition time.Time    `json:"lastTransition,omitempty"`
+}
+
+// persistedMachine is the state of the state machine of an application.
+type persistedMachine struct {
+	Application string       `json:"application,omitempty"`
+	State       HealthStatus `json:"state"`
+	Consecutive int          `json:"consecutive"`
+	Healthy     int          `json:"healthy"`
+	// GraceRemaining is what was left of the grace period.
+	GraceRemaining time.Duration `json:"graceRemaining"`
+	GraceOver      bool          `json:"graceOver"`
+}
+
+func (m *healthStateMachine) persisted(now time.Time) persistedMachine {
+	p := persistedMachine{State: m.state, Consecutive: m.consecutive, Healthy: m.healthy, GraceOver: m.graceOver}
+	if m.inGracePeriod(now) {
+		p.GraceRemaining = m.graceEnd.Sub(now)
+	}
+	return p
+}
+
+// restore resumes the state machine from the persisted state at now.
+func (m *healthStateMachine) restore(p persistedMachine, now time.Time) {
+	m.state, m.consecutive, m.healthy, m.graceOver = p.State, p.Consecutive, p.Healthy, p.GraceOver
+	m.graceEnd = now.Add(p.GraceRemaining)
+}
+
+// persisted returns the state of the monitor to persist.
+func (m *monitor) persisted(now time.Time) persistedState {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	s := persistedState{SavedAt: now, GatePassed: m.gate.passed, Reported: m.reported, LastTransition: m.lastTransition}
+	for _, g := range m.groups {
+		p := g.machine.persisted(now)
+		p.Application = g.name
+		s.Machines = append(s.Machines, p)
+	}
+	return s
+}
+
+// restore resumes the monitor from the persisted state unless it is older
+// than maxAge, if set. Applications not found in the persisted state start
+// fresh. It reports whether the state was restored.
+func (m *monitor) restore(s persistedState, now time.Time, maxAge time.Duration) bool {
+	if maxAge != 0 && now.Sub(s.SavedAt) > maxAge {
+		return false
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.gate.passed = m.gate.passed || s.GatePassed
+	if s.Reported != "" {
+		m.reported, m.lastTransition = s.Reported, s.LastTransition
+	}
+	for _, g := range m.groups {
+		for _, p := range s.Machines {
+			if g.persistedAs(p.Application) {
+				g.machine.restore(p, now)
+			}
+		}
+	}
+	return true
+}
+
+// saveHealthState writes the state to path atomically.
+func saveHealthState(path string, s persistedState) error {
+	b, err := json.Marshal(s)
+	if err != nil {
+		return errors.Wrap(err, "failed to marshal health state")
+	}
+	return errors.Wrap(writeFileAtomic(path, b, 0600), "failed to write health state")
+}
+
+// loadHealthState reads the state persisted at path. It returns false if no
+// state was persisted.
+func loadHealthState(path string) (persistedState, bool, error) {
+	var s persistedState
+	b, err := ioutil.ReadFile(path)
+	if os.IsNotExist(err) {
+		return s, false, nil
+	} else if err != nil {
+		return s, false, errors.Wrap(err, "failed to read health state")
+	}
+	if err := json.Unmarshal(b, &s); err != nil {
+		return s, false, errors.Wrap(err, "failed to parse health state")
+	}
+	return s, true, nil
+}
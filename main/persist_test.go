@@ -0,0 +1,134 @@
+package main
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/go-kit/kit/log"
+	"github.com/stretchr/testify/require"
+)
+
+func Test_healthState_saveAndLoad(t *testing.T) {
+	dir, err := ioutil.TempDir("", "")
+	require.Nil(t, err)
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, healthStateFile)
+
+	_, ok, err := loadHealthState(path)
+	require.Nil(t, err)
+	require.False(t, ok)
+
+	s := persistedState{
+		SavedAt:    time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC),
+		GatePassed: true,
+		Machines:   []persistedMachine{{Application: "web", State: Unhealthy, Consecutive: 1, GraceRemaining: time.Minute}},
+	}
+	require.Nil(t, saveHealthState(path, s))
+	loaded, ok, err := loadHealthState(path)
+	require.Nil(t, err)
+	require.True(t, ok)
+	require.Equal(t, s, loaded)
+
+	require.Nil(t, ioutil.WriteFile(path, []byte("{"), 0600))
+	_, _, err = loadHealthState(path)
+	require.NotNil(t, err)
+}
+
+func Test_monitor_restore(t *testing.T) {
+	now := time.Now()
+	cfg := &handlerSettings{publicSettings: publicSettings{ProvisioningGate: true}}
+	m := newMonitor(cfg, now, newExtensionMetrics(now, 0))
+	_, err := m.observe(now, Healthy)
+	require.Nil(t, err)
+	_, err = m.observe(now.Add(time.Second), Unhealthy)
+	require.Nil(t, err)
+	s := m.persisted(now.Add(time.Second))
+
+	restarted := now.Add(time.Hour)
+	m = newMonitor(cfg, restarted, newExtensionMetrics(restarted, 0))
+	require.True(t, m.restore(s, restarted, 0))
+	require.Equal(t, Unhealthy, m.state(), "not reset to healthy")
+	require.True(t, m.gate.passed)
+
+	m = newMonitor(cfg, restarted, newExtensionMetrics(restarted, 0))
+	require.False(t, m.restore(s, restarted, time.Minute), "expired")
+	require.Equal(t, Healthy, m.state())
+}
+
+func Test_monitor_restoreTransitionCooldown(t *testing.T) {
+	now := time.Now()
+	cfg := &handlerSettings{publicSettings: publicSettings{TransitionCooldownInSeconds: 60}}
+	m := newMonitor(cfg, now, newExtensionMetrics(now, 0))
+	reported := func(st monitorStatus) StatusType { return st.substatuses[0].Status }
+	_, err := m.observe(now, Healthy)
+	require.Nil(t, err)
+	_, err = m.observe(now.Add(5*time.Second), Unhealthy)
+	require.Nil(t, err)
+	s := m.persisted(now.Add(5 * time.Second))
+	require.Equal(t, Unhealthy, s.Reported)
+
+	restarted := now.Add(10 * time.Second)
+	m = newMonitor(cfg, restarted, newExtensionMetrics(restarted, 0))
+	require.True(t, m.restore(s, restarted, 0))
+	st, err := m.observe(restarted, Healthy)
+	require.Nil(t, err)
+	require.Equal(t, StatusError, reported(st), "cooldown carried over")
+	st, err = m.observe(now.Add(65*time.Second), Healthy)
+	require.Nil(t, err)
+	require.Equal(t, StatusSuccess, reported(st))
+}
+
+func Test_healthStateMachine_restoreGracePeriod(t *testing.T) {
+	now := time.Now()
+	m := &healthStateMachine{numberOfProbes: 3, graceEnd: now.Add(time.Minute)}
+	m.observe(now, Unhealthy)
+	p := m.persisted(now.Add(20 * time.Second))
+	require.Equal(t, 40*time.Second, p.GraceRemaining)
+	require.Equal(t, 0, p.Consecutive, "not counted during the grace period")
+	require.Equal(t, 0, p.Healthy)
+
+	restarted := now.Add(time.Hour)
+	r := &healthStateMachine{numberOfProbes: 3}
+	r.restore(p, restarted)
+	require.True(t, r.inGracePeriod(restarted.Add(30*time.Second)), "grace period resumed")
+	require.False(t, r.inGracePeriod(restarted.Add(40*time.Second)))
+	require.Equal(t, 0, r.consecutive)
+}
+
+func Test_probeLoop_persistState(t *testing.T) {
+	dir, err := ioutil.TempDir("", "")
+	require.Nil(t, err)
+	defer os.RemoveAll(dir)
+	ctx := log.NewContext(log.NewNopLogger())
+	cfg := handlerSettings{publicSettings: publicSettings{PersistState: true}}
+
+	loop, _ := newTestLoop(cfg, &scriptedProbe{[]HealthStatus{Unhealthy}}, 1)
+	loop.statePath = filepath.Join(dir, healthStateFile)
+	require.Equal(t, errTerminated, loop.run(context.Background(), ctx))
+
+	// restarted, the application is still unhealthy before the first probe
+	loop, _ = newTestLoop(cfg, &scriptedProbe{[]HealthStatus{Healthy}}, 1)
+	loop.statePath = filepath.Join(dir, healthStateFile)
+	loop.start(ctx)
+	require.Equal(t, Unhealthy, loop.mon.state())
+}
+
+func Test_monitor_restoreFlatProbe(t *testing.T) {
+	now := time.Now()
+	flat := &handlerSettings{publicSettings: publicSettings{Protocol: "tcp", Port: 80, NumberOfProbes: 3}}
+	m := newMonitor(flat, now, newExtensionMetrics(now, 0))
+	_, err := m.observe(now, Unhealthy)
+	require.Nil(t, err)
+	s := m.persisted(now)
+
+	migrated := *flat
+	migrated.migrateFlatProbe()
+	m = newMonitor(&migrated, now, newExtensionMetrics(now, 0))
+	require.True(t, m.restore(s, now, 0))
+	require.Equal(t, flatProbeName, m.groups[0].name)
+	require.Equal(t, 1, m.groups[0].machine.consecutive, "state persisted before the migration carried over")
+}
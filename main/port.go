@@ -0,0 +1,144 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"io/ioutil"
+	"os/exec"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/go-kit/kit/log"
+	"github.com/pkg/errors"
+)
+
+// portResolver looks up the port to probe at runtime.
+type portResolver func(probeCtx context.Context) (int, error)
+
+// resolvingProbe probes the port found by a portResolver. The port is resolved
+// again whenever the application is found unhealthy, so the probe follows the
+// application to a new port.
+type resolvingProbe struct {
+	resolve portResolver
+	build   func(port int) HealthProbe
+
+	// mu guards port and probe, read by address while an abandoned
+	// evaluation may still be refreshing them
+	mu    sync.Mutex
+	port  int
+	probe HealthProbe
+}
+
+func newResolvingProbe(resolve portResolver, build func(port int) HealthProbe) *resolvingProbe {
+	return &resolvingProbe{resolve: resolve, build: build}
+}
+
+func (p *resolvingProbe) evaluate(probeCtx context.Context, ctx *log.Context) (HealthStatus, error) {
+	probe := p.current()
+	if probe == nil {
+		if !p.refresh(probeCtx, ctx) {
+			return Unhealthy, nil
+		}
+		probe = p.current()
+	}
+	state, err := probe.evaluate(probeCtx, ctx)
+	if err != nil || state == Healthy {
+		return state, err
+	}
+	if !p.refresh(probeCtx, ctx) {
+		return state, nil
+	}
+	return p.current().evaluate(probeCtx, ctx)
+}
+
+func (p *resolvingProbe) current() HealthProbe {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.probe
+}
+
+// refresh resolves the port and rebuilds the probe if the port changed.
+// Returns whether a probe for a changed port is ready to evaluate.
+func (p *resolvingProbe) refresh(probeCtx context.Context, ctx *log.Context) bool {
+	port, err := p.resolve(probeCtx)
+	if err != nil {
+		ctx.Log("event", "failed to resolve probed port", "error", err)
+		return false
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.probe != nil && port == p.port {
+		return false
+	}
+	ctx.Log("event", "resolved probed port", "port", port)
+	p.port, p.probe = port, p.build(port)
+	return true
+}
+
+func (p *resolvingProbe) address() string {
+	probe := p.current()
+	if probe == nil {
+		return ""
+	}
+	return probe.address()
+}
+
+// systemdSocketPort returns a resolver of the port the systemd socket unit
+// listens on.
+func systemdSocketPort(unit string) portResolver {
+	return func(probeCtx context.Context) (int, error) {
+		out, err := exec.CommandContext(probeCtx, "systemctl", "show", "--property=Listen", unit).Output()
+		if err != nil {
+			return 0, errors.Wrapf(err, "failed to query systemd socket %s", unit)
+		}
+		port, err := parseSocketListenPort(string(out))
+		return port, errors.Wrapf(err, "systemd socket %s", unit)
+	}
+}
+
+// filePort returns a resolver of the port the application wrote into the file
+// at path.
+func filePort(path string) portResolver {
+	return func(probeCtx context.Context) (int, error) {
+		b, err := ioutil.ReadFile(path)
+		if err != nil {
+			return 0, errors.Wrap(err, "failed to read port file")
+		}
+		port, err := strconv.Atoi(strings.TrimSpace(string(b)))
+		if err != nil || port < 1 || port > 65535 {
+			return 0, errors.Errorf("port file %s does not contain a valid port", path)
+		}
+		return port, nil
+	}
+}
+
+// parseSocketListenPort returns the port of the first stream listener in the
+// output of 'systemctl show --property=Listen', where each listener is given
+// as e.g. 'Listen=[::]:8080 (Stream)'.
+func parseSocketListenPort(out string) (int, error) {
+	s := bufio.NewScanner(strings.NewReader(out))
+	for s.Scan() {
+		line := strings.TrimSpace(s.Text())
+		if !strings.HasPrefix(line, "Listen=") {
+			continue
+		}
+		fields := strings.Fields(strings.TrimPrefix(line, "Listen="))
+		if len(fields) != 2 || fields[1] != "(Stream)" {
+			continue
+		}
+		addr := fields[0]
+		if strings.HasPrefix(addr, "/") || strings.HasPrefix(addr, "@") {
+			continue // unix socket
+		}
+		if i := strings.LastIndex(addr, ":"); i >= 0 {
+			addr = addr[i+1:]
+		}
+		port, err := strconv.Atoi(addr)
+		if err != nil || port < 1 || port > 65535 {
+			continue
+		}
+		return port, nil
+	}
+	return 0, errors.New("no tcp stream listener found")
+}
@@ -0,0 +1,102 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/go-kit/kit/log"
+	"github.com/stretchr/testify/require"
+)
+
+func Test_parseSocketListenPort(t *testing.T) {
+	port, err := parseSocketListenPort("Listen=[::]:8080 (Stream)\n")
+	require.Nil(t, err)
+	require.Equal(t, 8080, port)
+
+	port, err = parseSocketListenPort("Listen=/run/app.sock (Stream)\nListen=0.0.0.0:53 (Datagram)\nListen=127.0.0.1:9000 (Stream)\n")
+	require.Nil(t, err)
+	require.Equal(t, 9000, port)
+
+	port, err = parseSocketListenPort("Listen=8081 (Stream)")
+	require.Nil(t, err)
+	require.Equal(t, 8081, port)
+
+	_, err = parseSocketListenPort("Listen=/run/app.sock (Stream)\n")
+	require.NotNil(t, err)
+	_, err = parseSocketListenPort("")
+	require.NotNil(t, err)
+}
+
+type funcProbe func() HealthStatus
+
+func (p funcProbe) evaluate(probeCtx context.Context, ctx *log.Context) (HealthStatus, error) {
+	return p(), nil
+}
+func (p funcProbe) address() string { return "" }
+
+func Test_resolvingProbe(t *testing.T) {
+	ctx := log.NewContext(log.NewNopLogger())
+	port, resolveErr, resolves := 0, errors.New("not listening"), 0
+	healthyPort := 8081
+	p := newResolvingProbe(func(context.Context) (int, error) {
+		resolves++
+		return port, resolveErr
+	}, func(port int) HealthProbe {
+		return funcProbe(func() HealthStatus {
+			if port == healthyPort {
+				return Healthy
+			}
+			return Unhealthy
+		})
+	})
+
+	// unresolved port is unhealthy
+	state, err := p.evaluate(context.Background(), ctx)
+	require.Nil(t, err)
+	require.Equal(t, Unhealthy, state)
+
+	// resolved once while healthy
+	port, resolveErr = 8081, nil
+	state, _ = p.evaluate(context.Background(), ctx)
+	require.Equal(t, Healthy, state)
+	state, _ = p.evaluate(context.Background(), ctx)
+	require.Equal(t, Healthy, state)
+	require.Equal(t, 2, resolves)
+
+	// application moves to a new port: found on the failing evaluation
+	healthyPort, port = 8082, 8082
+	state, _ = p.evaluate(context.Background(), ctx)
+	require.Equal(t, Healthy, state)
+	require.Equal(t, 3, resolves)
+	require.Equal(t, 8082, p.port)
+
+	// port unchanged while unhealthy
+	healthyPort = 0
+	state, _ = p.evaluate(context.Background(), ctx)
+	require.Equal(t, Unhealthy, state)
+	require.Equal(t, 8082, p.port)
+}
+
+func Test_filePort(t *testing.T) {
+	dir, err := ioutil.TempDir("", "")
+	require.Nil(t, err)
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "port")
+	resolve := filePort(path)
+
+	_, err = resolve(context.Background())
+	require.NotNil(t, err, "missing file")
+
+	require.Nil(t, ioutil.WriteFile(path, []byte("not a port"), 0644))
+	_, err = resolve(context.Background())
+	require.NotNil(t, err)
+
+	require.Nil(t, ioutil.WriteFile(path, []byte("34567\n"), 0644))
+	port, err := resolve(context.Background())
+	require.Nil(t, err)
+	require.Equal(t, 34567, port)
+}
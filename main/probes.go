@@ -0,0 +1,192 @@
+package main
+
+import (
+	"fmt"
+
+	"github.com/pkg/errors"
+)
+
+var (
+	errProbesWithTopLevelProbe   = errors.New("'protocol', 'host', 'port', 'requestPath', 'command', 'runAsUser', 'commandEnvironment', 'captureCommandOutput', 'grpcService', 'udpPayload', 'udpExpectedResponse', 'icmpAddress', 'icmpCount', 'icmpTimeoutInMilliseconds', 'dnsName', 'filePath', 'fileMaxAgeInSeconds', 'systemdUnit', 'containerName', 'dockerSocket', 'pidFile', 'processPattern', 'passiveListenCheck', 'systemdSocket', 'portFile' and 'unixSocketPath' cannot be specified when using 'probes'")
+	errProbesWithApplications    = errors.New("'probes' cannot be used together with 'applications'")
+	errDuplicateProbeName        = errors.New("'probes' must have unique names")
+	errAggregationRequiresProbes = errors.New("'aggregation' cannot be specified unless 'probes' are configured")
+	errProbeWithSubstatusName    = errors.New("'substatusName' cannot be specified for 'probes', their health is only reported aggregated")
+
+	errWeightRequiresWeightedAggregation = errors.New("'weight' can only be specified for 'probes' with the 'weighted' aggregation")
+	errScoreThresholdRequiresWeighted    = errors.New("'healthyScoreThreshold' can only be specified with the 'weighted' aggregation")
+	errWeightedRequiresScoreThreshold    = errors.New("'healthyScoreThreshold' must be specified with the 'weighted' aggregation")
+)
+
+// policyWeighted reports the VM healthy when the weights of the healthy probes
+// reach the healthy score threshold.
+const policyWeighted = "weighted"
+
+// probes returns the probes whose results are aggregated into the application
+// health, or nil if the top level probe is the only one.
+func (s *handlerSettings) probes() []applicationSettings {
+	return s.publicSettings.Probes
+}
+
+// probeName returns the name of the i-th probe in logs and the probe history.
+func probeName(p applicationSettings, i int) string {
+	if p.Name != "" {
+		return p.Name
+	}
+	return fmt.Sprintf("probe %d", i+1)
+}
+
+// healthPolicy returns the policy deciding the VM-level health from the health
+// of the probes, or of the applications.
+func (s *handlerSettings) healthPolicy() string {
+	if len(s.probes()) == 0 {
+		return s.applicationsPolicy()
+	}
+	if s.publicSettings.Aggregation == "" {
+		return policyAll
+	}
+	return s.publicSettings.Aggregation
+}
+
+// weight returns the weight of the probe in the health score.
+func (a applicationSettings) weight() int {
+	if a.Weight == 0 {
+		return 1
+	}
+	return a.Weight
+}
+
+// healthyScoreThreshold returns the percentage of the total weight of the
+// probes that must be healthy with the weighted aggregation.
+func (s *handlerSettings) healthyScoreThreshold() int {
+	return s.publicSettings.HealthyScoreThreshold
+}
+
+// aggregateWeightedHealth decides the VM-level health from the health of the
+// probes and their weights. Degraded probes count as healthy ones. Above the
+// threshold the VM is as healthy as the worst passing probe, below it as
+// unhealthy as the worst failing one.
+func aggregateWeightedHealth(threshold int, states []HealthStatus, weights []int) HealthStatus {
+	var passing, failing []HealthStatus
+	var score, total int
+	for i, s := range states {
+		total += weights[i]
+		if s == Healthy || s == Degraded {
+			score += weights[i]
+			passing = append(passing, s)
+		} else {
+			failing = append(failing, s)
+		}
+	}
+	if score*100 >= threshold*total {
+		return aggregateHealth(policyAll, passing)
+	}
+	return aggregateHealth(policyAll, failing)
+}
+
+// validateProbes makes logical validation of the probes.
+func (h handlerSettings) validateProbes() error {
+	for _, a := range h.applications() {
+		if a.Weight != 0 {
+			return errors.Wrapf(errWeightRequiresWeightedAggregation, "application %q", a.Name)
+		}
+	}
+	if r := h.readinessProbe(); r != nil && r.Weight != 0 {
+		return errors.Wrap(errWeightRequiresWeightedAggregation, "readiness probe")
+	}
+	weighted := h.healthPolicy() == policyWeighted
+	if h.healthyScoreThreshold() != 0 && !weighted {
+		return errScoreThresholdRequiresWeighted
+	}
+	if weighted && h.healthyScoreThreshold() == 0 {
+		return errWeightedRequiresScoreThreshold
+	}
+
+	probes := h.probes()
+	if len(probes) == 0 {
+		if h.publicSettings.Aggregation != "" {
+			return errAggregationRequiresProbes
+		}
+		return nil
+	}
+	if len(h.applications()) != 0 {
+		return errProbesWithApplications
+	}
+	if h.hasTopLevelProbe() {
+		return errProbesWithTopLevelProbe
+	}
+	names := make(map[string]bool)
+	for i, p := range probes {
+		name := probeName(p, i)
+		if names[name] {
+			return errDuplicateProbeName
+		}
+		names[name] = true
+		if p.Weight != 0 && !weighted {
+			return errors.Wrapf(errWeightRequiresWeightedAggregation, "probe %q", name)
+		}
+		if p.SubstatusName != "" {
+			return errors.Wrapf(errProbeWithSubstatusName, "probe %q", name)
+		}
+		s := p.settings(&h)
+		if err := s.validate(); err != nil {
+			return errors.Wrapf(err, "probe %q", name)
+		}
+		if p.offset() >= h.interval() {
+			return errors.Wrapf(errOffsetExceedsInterval, "probe %q", name)
+		}
+		if s.interval() < h.interval() {
+			return errors.Wrapf(errIntervalShorterThanTopLevel, "probe %q", name)
+		}
+	}
+	return nil
+}
+
+// flatProbeName is the name of the probe migrated from the flat settings shape,
+// persisted unnamed by earlier versions.
+var flatProbeName = probeName(applicationSettings{}, 0)
+
+// migrateFlatProbe moves the probe of the flat settings shape into a single
+// entry of 'probes', so that the settings are the same as configured either
+// way. The settings must be valid.
+func (h *handlerSettings) migrateFlatProbe() {
+	if !h.hasTopLevelProbe() || len(h.applications()) != 0 {
+		return
+	}
+	p := &h.publicSettings
+	p.Probes = []applicationSettings{{
+		Protocol:                  p.Protocol,
+		Host:                      p.Host,
+		Port:                      p.Port,
+		RequestPath:               p.RequestPath,
+		Command:                   p.Command,
+		GrpcService:               p.GrpcService,
+		RunAsUser:                 p.RunAsUser,
+		CommandEnvironment:        p.CommandEnvironment,
+		CaptureCommandOutput:      p.CaptureCommandOutput,
+		UdpPayload:                p.UdpPayload,
+		UdpExpectedResponse:       p.UdpExpectedResponse,
+		IcmpAddress:               p.IcmpAddress,
+		IcmpCount:                 p.IcmpCount,
+		IcmpTimeoutInMilliseconds: p.IcmpTimeoutInMilliseconds,
+		DnsName:                   p.DnsName,
+		FilePath:                  p.FilePath,
+		FileMaxAgeInSeconds:       p.FileMaxAgeInSeconds,
+		SystemdUnit:               p.SystemdUnit,
+		ContainerName:             p.ContainerName,
+		DockerSocket:              p.DockerSocket,
+		PidFile:                   p.PidFile,
+		ProcessPattern:            p.ProcessPattern,
+		PassiveListenCheck:        p.PassiveListenCheck,
+		SystemdSocket:             p.SystemdSocket,
+		PortFile:                  p.PortFile,
+		UnixSocketPath:            p.UnixSocketPath,
+	}}
+	p.Protocol, p.Host, p.Port, p.RequestPath, p.Command, p.GrpcService = "", "", 0, "", nil, ""
+	p.RunAsUser, p.CommandEnvironment, p.CaptureCommandOutput = "", nil, false
+	p.UdpPayload, p.UdpExpectedResponse = "", ""
+	p.IcmpAddress, p.IcmpCount, p.IcmpTimeoutInMilliseconds, p.DnsName = "", 0, 0, ""
+	p.FilePath, p.FileMaxAgeInSeconds, p.SystemdUnit = "", 0, ""
+	p.ContainerName, p.DockerSocket, p.PidFile, p.ProcessPattern, p.PassiveListenCheck = "", "", "", "", false
+	p.SystemdSocket, p.PortFile, p.UnixSocketPath = "", "", ""
+}
@@ -0,0 +1,299 @@
+package main
+
+import (
+	"testing"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/require"
+)
+
+func Test_handlerSettingsValidate_probes(t *testing.T) {
+	web := applicationSettings{Protocol: "http", RequestPath: "health"}
+	cache := applicationSettings{Name: "cache", Protocol: "tcp", Port: 6379}
+
+	require.Nil(t, handlerSettings{
+		publicSettings{Probes: []applicationSettings{web, cache}, Aggregation: policyAny},
+		protectedSettings{},
+	}.validate())
+	require.Nil(t, handlerSettings{
+		publicSettings{Probes: []applicationSettings{web}, ReadinessProbe: &cache},
+		protectedSettings{},
+	}.validate())
+
+	require.Equal(t, errProbesWithTopLevelProbe, handlerSettings{
+		publicSettings{Protocol: "tcp", Port: 80, Probes: []applicationSettings{web}},
+		protectedSettings{},
+	}.validate())
+	require.Equal(t, errProbesWithApplications, handlerSettings{
+		publicSettings{Probes: []applicationSettings{web}, Applications: []applicationSettings{cache}},
+		protectedSettings{},
+	}.validate())
+	require.Equal(t, errDuplicateProbeName, handlerSettings{
+		publicSettings{Probes: []applicationSettings{cache, cache}},
+		protectedSettings{},
+	}.validate())
+	require.Equal(t, errDuplicateProbeName, handlerSettings{
+		publicSettings{Probes: []applicationSettings{{Name: "probe 2", Protocol: "tcp", Port: 80}, web}},
+		protectedSettings{},
+	}.validate(), "named like the default name of another probe")
+	require.Equal(t, errAggregationRequiresProbes, handlerSettings{
+		publicSettings{Aggregation: policyAll},
+		protectedSettings{},
+	}.validate())
+
+	err := handlerSettings{
+		publicSettings{Probes: []applicationSettings{web, {Protocol: "tcp"}}},
+		protectedSettings{},
+	}.validate()
+	require.Equal(t, errTcpConfigurationMustIncludePort, errors.Cause(err))
+	require.Contains(t, err.Error(), `probe "probe 2"`)
+
+	err = handlerSettings{
+		publicSettings{Probes: []applicationSettings{{Protocol: "tcp", Port: 80, SubstatusName: "Cache"}}},
+		protectedSettings{},
+	}.validate()
+	require.Equal(t, errProbeWithSubstatusName, errors.Cause(err))
+}
+
+func Test_handlerSettingsValidate_probeOptions(t *testing.T) {
+	slow := applicationSettings{Name: "slow", Protocol: "http", RequestPath: "health", ProbeTimeoutInSeconds: 10, NumberOfProbes: 3, HealthyThreshold: 2}
+	require.Nil(t, handlerSettings{
+		publicSettings{IntervalInSeconds: 10, Probes: []applicationSettings{slow}},
+		protectedSettings{},
+	}.validate())
+
+	err := handlerSettings{
+		publicSettings{IntervalInSeconds: 5, Probes: []applicationSettings{slow}},
+		protectedSettings{},
+	}.validate()
+	require.Equal(t, errProbeTimeoutExceedsInterval, errors.Cause(err))
+	require.Contains(t, err.Error(), `probe "slow"`)
+
+	err = handlerSettings{
+		publicSettings{IntervalInSeconds: 10, Probes: []applicationSettings{{Name: "fast", Protocol: "tcp", Port: 80, IntervalInSeconds: 5}}},
+		protectedSettings{},
+	}.validate()
+	require.Equal(t, errIntervalShorterThanTopLevel, errors.Cause(err))
+	require.Contains(t, err.Error(), `probe "fast"`)
+}
+
+func Test_applicationSettings_probeOptions(t *testing.T) {
+	parent := &handlerSettings{publicSettings: publicSettings{ProbeTimeoutInSeconds: 5, NumberOfProbes: 2, HealthyThreshold: 2}}
+
+	s := applicationSettings{Protocol: "tcp", Port: 80}.settings(parent)
+	require.Equal(t, 5*time.Second, s.probeTimeout())
+	require.Equal(t, 2, s.numberOfProbes())
+	require.Equal(t, 2, s.healthyThreshold())
+
+	s = applicationSettings{Protocol: "tcp", Port: 80, ProbeTimeoutInSeconds: 1, NumberOfProbes: 4, HealthyThreshold: 3}.settings(parent)
+	require.Equal(t, time.Second, s.probeTimeout())
+	require.Equal(t, 4, s.numberOfProbes())
+	require.Equal(t, 3, s.healthyThreshold())
+}
+
+func Test_applicationSettings_intervalOverride(t *testing.T) {
+	parent := &handlerSettings{publicSettings: publicSettings{IntervalInSeconds: 10}}
+
+	s := applicationSettings{Protocol: "tcp", Port: 80}.settings(parent)
+	require.Equal(t, 10*time.Second, s.interval())
+	s = applicationSettings{Protocol: "tcp", Port: 80, IntervalInSeconds: 30}.settings(parent)
+	require.Equal(t, 30*time.Second, s.interval())
+}
+
+func Test_applicationSettings_gracePeriodOverride(t *testing.T) {
+	parent := &handlerSettings{publicSettings: publicSettings{GracePeriodInSeconds: 60}}
+
+	s := applicationSettings{Protocol: "tcp", Port: 80}.settings(parent)
+	require.Equal(t, time.Minute, s.gracePeriod())
+	s = applicationSettings{Protocol: "tcp", Port: 80, GracePeriodInSeconds: 300}.settings(parent)
+	require.Equal(t, 5*time.Minute, s.gracePeriod())
+}
+
+func Test_handlerSettingsValidate_weights(t *testing.T) {
+	web := applicationSettings{Name: "web", Protocol: "http", RequestPath: "health", Weight: 9}
+	sidecar := applicationSettings{Name: "sidecar", Protocol: "tcp", Port: 9000}
+
+	require.Nil(t, handlerSettings{
+		publicSettings{Probes: []applicationSettings{web, sidecar}, Aggregation: policyWeighted, HealthyScoreThreshold: 90},
+		protectedSettings{},
+	}.validate())
+
+	require.Equal(t, errWeightedRequiresScoreThreshold, handlerSettings{
+		publicSettings{Probes: []applicationSettings{web, sidecar}, Aggregation: policyWeighted},
+		protectedSettings{},
+	}.validate())
+	require.Equal(t, errScoreThresholdRequiresWeighted, handlerSettings{
+		publicSettings{Probes: []applicationSettings{sidecar}, HealthyScoreThreshold: 90},
+		protectedSettings{},
+	}.validate())
+	require.Equal(t, errScoreThresholdRequiresWeighted, handlerSettings{
+		publicSettings{Protocol: "tcp", Port: 80, HealthyScoreThreshold: 90},
+		protectedSettings{},
+	}.validate())
+	err := handlerSettings{
+		publicSettings{Probes: []applicationSettings{web, sidecar}, Aggregation: policyAny},
+		protectedSettings{},
+	}.validate()
+	require.Equal(t, errWeightRequiresWeightedAggregation, errors.Cause(err))
+	err = handlerSettings{
+		publicSettings{Applications: []applicationSettings{web}},
+		protectedSettings{},
+	}.validate()
+	require.Equal(t, errWeightRequiresWeightedAggregation, errors.Cause(err))
+	err = handlerSettings{
+		publicSettings{Protocol: "tcp", Port: 80, ReadinessProbe: &web},
+		protectedSettings{},
+	}.validate()
+	require.Equal(t, errWeightRequiresWeightedAggregation, errors.Cause(err))
+}
+
+func Test_aggregateWeightedHealth(t *testing.T) {
+	weights := []int{9, 1}
+	require.Equal(t, Healthy, aggregateWeightedHealth(90, []HealthStatus{Healthy, Healthy}, weights))
+	require.Equal(t, Healthy, aggregateWeightedHealth(90, []HealthStatus{Healthy, Unhealthy}, weights), "sidecar failing")
+	require.Equal(t, Unhealthy, aggregateWeightedHealth(90, []HealthStatus{Unhealthy, Healthy}, weights), "main application failing")
+	require.Equal(t, Unknown, aggregateWeightedHealth(90, []HealthStatus{Unknown, Healthy}, weights))
+	require.Equal(t, Degraded, aggregateWeightedHealth(90, []HealthStatus{Degraded, Unhealthy}, weights))
+	require.Equal(t, Unhealthy, aggregateWeightedHealth(100, []HealthStatus{Healthy, Unhealthy}, weights))
+	require.Equal(t, Healthy, aggregateWeightedHealth(50, []HealthStatus{Healthy, Unhealthy, Healthy}, []int{1, 1, 1}))
+}
+
+func Test_handlerSettings_healthPolicy(t *testing.T) {
+	require.Equal(t, policyAll, (&handlerSettings{}).healthPolicy())
+	require.Equal(t, policyAny, (&handlerSettings{publicSettings: publicSettings{ApplicationsPolicy: policyAny}}).healthPolicy())
+	probes := []applicationSettings{{Protocol: "tcp", Port: 80}}
+	require.Equal(t, policyAll, (&handlerSettings{publicSettings: publicSettings{Probes: probes}}).healthPolicy())
+	require.Equal(t, policyAny, (&handlerSettings{publicSettings: publicSettings{Probes: probes, Aggregation: policyAny}}).healthPolicy())
+}
+
+func Test_monitor_probes(t *testing.T) {
+	now := time.Now()
+	cfg := &handlerSettings{publicSettings: publicSettings{Probes: []applicationSettings{
+		{Name: "web", Protocol: "http", RequestPath: "health"},
+		{Protocol: "tcp", Port: 9000},
+	}}}
+	m := newMonitor(cfg, now, newExtensionMetrics(now, 0))
+	require.Len(t, m.groups, 2)
+
+	st, err := m.observe(now, Healthy, Unhealthy)
+	require.Nil(t, err)
+	require.Equal(t, Unhealthy, st.state)
+	require.Len(t, st.substatuses, 2, "no substatus of each probe")
+	require.Equal(t, substatusName, st.substatuses[0].Name)
+	require.Equal(t, StatusError, st.substatuses[0].Status)
+
+	cfg.publicSettings.Aggregation = policyAny
+	require.Equal(t, Healthy, m.state())
+
+	h := m.history()
+	require.Len(t, h, 2)
+	require.Equal(t, "web", h[0].Application)
+	require.Equal(t, "probe 2", h[1].Application)
+}
+
+func Test_monitor_weightedProbes(t *testing.T) {
+	now := time.Now()
+	cfg := &handlerSettings{publicSettings: publicSettings{
+		Probes: []applicationSettings{
+			{Name: "web", Protocol: "http", RequestPath: "health", Weight: 9},
+			{Name: "sidecar", Protocol: "tcp", Port: 9000},
+		},
+		Aggregation:           policyWeighted,
+		HealthyScoreThreshold: 90,
+	}}
+	m := newMonitor(cfg, now, newExtensionMetrics(now, 0))
+
+	st, err := m.observe(now, Healthy, Unhealthy)
+	require.Nil(t, err)
+	require.Equal(t, Healthy, st.state)
+	require.Equal(t, Healthy, m.state())
+
+	st, err = m.observe(now, Unhealthy, Healthy)
+	require.Nil(t, err)
+	require.Equal(t, Unhealthy, st.state)
+}
+
+func Test_monitor_probeThresholds(t *testing.T) {
+	now := time.Now()
+	cfg := &handlerSettings{publicSettings: publicSettings{Probes: []applicationSettings{
+		{Name: "web", Protocol: "http", RequestPath: "health"},
+		{Name: "flaky", Protocol: "tcp", Port: 9000, NumberOfProbes: 2},
+	}}}
+	m := newMonitor(cfg, now, newExtensionMetrics(now, 0))
+
+	st, err := m.observe(now, Healthy, Healthy)
+	require.Nil(t, err)
+	require.Equal(t, Healthy, st.state)
+
+	st, err = m.observe(now.Add(5*time.Second), Healthy, Unhealthy)
+	require.Nil(t, err)
+	require.Equal(t, Healthy, st.state, "a single failure of the flaky probe is not confirmed")
+
+	st, err = m.observe(now.Add(10*time.Second), Healthy, Unhealthy)
+	require.Nil(t, err)
+	require.Equal(t, Unhealthy, st.state)
+}
+
+func Test_monitor_probeGracePeriods(t *testing.T) {
+	now := time.Now()
+	cfg := &handlerSettings{publicSettings: publicSettings{Probes: []applicationSettings{
+		{Name: "web", Protocol: "http", RequestPath: "health"},
+		{Name: "slow", Protocol: "tcp", Port: 9000, GracePeriodInSeconds: 60},
+	}}}
+	m := newMonitor(cfg, now, newExtensionMetrics(now, 0))
+
+	st, err := m.observe(now.Add(5*time.Second), Healthy, Unhealthy)
+	require.Nil(t, err)
+	require.Equal(t, Initializing, st.state, "the slow probe is within its grace period")
+
+	st, err = m.observe(now.Add(5*time.Second), Unhealthy, Healthy)
+	require.Nil(t, err)
+	require.Equal(t, Unhealthy, st.state, "the web probe has no grace period")
+}
+
+func Test_handlerSettingsValidate_probesHttpRequest(t *testing.T) {
+	web := applicationSettings{Name: "web", Protocol: "http", RequestPath: "health"}
+	sidecar := applicationSettings{Name: "sidecar", Protocol: "tcp", Port: 9000}
+	cfg := handlerSettings{publicSettings{
+		Probes:              []applicationSettings{web, sidecar},
+		RequestHeaders:      map[string]string{"X-Probe": "azure"},
+		ExpectedStatusCodes: []interface{}{float64(204)},
+		ResponseBodyRegex:   "UP",
+	}, protectedSettings{}}
+	require.Nil(t, cfg.validate(), "top level defaults of the http probe only")
+	s := web.settings(&cfg)
+	require.Equal(t, "azure", s.requestHeaders().Get("X-Probe"))
+	require.Equal(t, "UP", s.publicSettings.ResponseBodyRegex)
+	s = sidecar.settings(&cfg)
+	require.Nil(t, s.requestHeaders())
+	require.Empty(t, s.publicSettings.ExpectedStatusCodes)
+	require.Empty(t, s.publicSettings.ResponseBodyRegex)
+
+	web.RequestHeaders = map[string]string{"X-Probe": "web"}
+	web.FollowRedirects = true
+	s = web.settings(&cfg)
+	require.Equal(t, "web", s.requestHeaders().Get("X-Probe"))
+	require.Equal(t, defaultMaxRedirects, s.maxRedirects())
+
+	sidecar.RequestHeaders = map[string]string{"X-Probe": "sidecar"}
+	err := handlerSettings{publicSettings{Probes: []applicationSettings{web, sidecar}}, protectedSettings{}}.validate()
+	require.Equal(t, errRequestHeadersRequireHttp, errors.Cause(err))
+	require.Contains(t, err.Error(), `probe "sidecar"`)
+
+	web.ResponseBodyRegex = "("
+	err = handlerSettings{publicSettings{Probes: []applicationSettings{web}}, protectedSettings{}}.validate()
+	require.Equal(t, errInvalidResponseBodyRegex, errors.Cause(err))
+}
+
+func Test_parseAndValidateSettings_probeHttpRequest(t *testing.T) {
+	cfg := parseTestSettings(t, `{"probes":[
+		{"protocol":"http","port":8080,"requestPath":"health","requestHeaders":{"X-Probe":"web"},"expectedStatusCodes":["200-299"]},
+		{"protocol":"tcp","port":9000}
+	],"requestHeaders":{"X-Probe":"azure"}}`)
+	settings := monitoredSettings(&cfg)
+	require.Len(t, settings, 2)
+	require.Equal(t, "web", settings[0].cfg.requestHeaders().Get("X-Probe"))
+	require.Equal(t, []interface{}{"200-299"}, settings[0].cfg.publicSettings.ExpectedStatusCodes)
+	require.Nil(t, settings[1].cfg.requestHeaders())
+}
@@ -0,0 +1,144 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"io/ioutil"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/go-kit/kit/log"
+	"github.com/pkg/errors"
+)
+
+const (
+	// procDir is where the process information is read from.
+	procDir = "/proc"
+)
+
+var (
+	errProcessRequiresTarget        = errors.New("either 'pidFile' or 'processPattern' must be specified when using 'process' protocol")
+	errProcessTargetTwice           = errors.New("only one of 'pidFile' and 'processPattern' can be specified")
+	errProcessTargetRequiresProcess = errors.New("'pidFile' and 'processPattern' can only be specified when using 'process' protocol")
+	errPidFileNotAbsolute           = errors.New("'pidFile' must be an absolute path")
+	errInvalidProcessPattern        = errors.New("'processPattern' is not a valid regular expression")
+	errProcessWithPort              = errors.New("'host', 'port', 'requestPath', 'systemdSocket', 'portFile' and 'unixSocketPath' cannot be specified when using 'process' protocol")
+)
+
+// ProcessHealthProbe reports the application healthy while its process is
+// running, found through its pid file or by matching the command lines of the
+// running processes.
+type ProcessHealthProbe struct {
+	PidFile string
+	Pattern *regexp.Regexp
+	ProcDir string // procDir if empty
+}
+
+func (p *ProcessHealthProbe) evaluate(probeCtx context.Context, ctx *log.Context) (HealthStatus, error) {
+	dir := p.ProcDir
+	if dir == "" {
+		dir = procDir
+	}
+	if p.PidFile != "" {
+		b, err := ioutil.ReadFile(p.PidFile)
+		if err != nil {
+			ctx.Log("event", "failed to read pid file", "path", p.PidFile, "error", err)
+			return Unhealthy, nil
+		}
+		pid, err := strconv.Atoi(strings.TrimSpace(string(b)))
+		if err != nil || pid < 1 {
+			ctx.Log("event", "pid file does not contain a valid process ID", "path", p.PidFile)
+			return Unhealthy, nil
+		}
+		if !processRunning(dir, pid) {
+			ctx.Log("event", "process of pid file is gone", "path", p.PidFile, "pid", pid)
+			return Unhealthy, nil
+		}
+		return Healthy, nil
+	}
+
+	entries, err := ioutil.ReadDir(dir)
+	if err != nil {
+		return Unknown, errors.Wrap(err, "failed to list processes")
+	}
+	for _, e := range entries {
+		pid, err := strconv.Atoi(e.Name())
+		if err != nil {
+			continue
+		}
+		cmdline, err := ioutil.ReadFile(filepath.Join(dir, e.Name(), "cmdline"))
+		if err != nil || len(cmdline) == 0 {
+			continue // exited, or a kernel thread
+		}
+		cmdline = bytes.TrimRight(cmdline, "\x00")
+		if p.Pattern.Match(bytes.Replace(cmdline, []byte{0}, []byte{' '}, -1)) && processRunning(dir, pid) {
+			return Healthy, nil
+		}
+	}
+	ctx.Log("event", "no running process matches pattern", "pattern", p.Pattern.String())
+	return Unhealthy, nil
+}
+
+func (p *ProcessHealthProbe) address() string {
+	if p.PidFile != "" {
+		return p.PidFile
+	}
+	return p.Pattern.String()
+}
+
+// processRunning reports whether the process exists and is not a zombie.
+func processRunning(dir string, pid int) bool {
+	stat, err := ioutil.ReadFile(filepath.Join(dir, strconv.Itoa(pid), "stat"))
+	if err != nil {
+		return false
+	}
+	// the state follows the parenthesized command name, which may contain
+	// spaces and parentheses itself
+	i := bytes.LastIndexByte(stat, ')')
+	if i < 0 || i+2 >= len(stat) {
+		return true
+	}
+	state := stat[i+2]
+	return state != 'Z' && state != 'X'
+}
+
+// validateProcess makes logical validation of the settings of the process
+// probe.
+func (h handlerSettings) validateProcess() error {
+	pidFile, pattern := h.publicSettings.PidFile, h.publicSettings.ProcessPattern
+	if h.protocol() != "process" {
+		if pidFile != "" || pattern != "" {
+			return errProcessTargetRequiresProcess
+		}
+		return nil
+	}
+	if pidFile == "" && pattern == "" {
+		return errProcessRequiresTarget
+	}
+	if pidFile != "" && pattern != "" {
+		return errProcessTargetTwice
+	}
+	if pidFile != "" && !filepath.IsAbs(pidFile) {
+		return errPidFileNotAbsolute
+	}
+	if pattern != "" {
+		if _, err := regexp.Compile(pattern); err != nil {
+			return errors.Wrap(errInvalidProcessPattern, err.Error())
+		}
+	}
+	if h.publicSettings.Host != "" || h.port() != 0 || h.requestPath() != "" || h.systemdSocket() != "" || h.portFile() != "" || h.unixSocketPath() != "" {
+		return errProcessWithPort
+	}
+	return nil
+}
+
+// process returns the pid file of the process checked by the process probe,
+// or the pattern its command line matches.
+func (s *handlerSettings) process() (pidFile string, pattern *regexp.Regexp) {
+	if s.publicSettings.ProcessPattern != "" {
+		pattern, _ = regexp.Compile(s.publicSettings.ProcessPattern) // checked by validate
+	}
+	return s.publicSettings.PidFile, pattern
+}
@@ -0,0 +1,93 @@
+package main
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/go-kit/kit/log"
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/require"
+)
+
+// writeProc writes the cmdline and stat of a fake process into the proc
+// directory dir.
+func writeProc(t *testing.T, dir string, pid int, state string, args ...string) {
+	p := filepath.Join(dir, strconv.Itoa(pid))
+	require.Nil(t, os.MkdirAll(p, 0755))
+	require.Nil(t, os.WriteFile(filepath.Join(p, "cmdline"), []byte(strings.Join(args, "\x00")+"\x00"), 0644))
+	require.Nil(t, os.WriteFile(filepath.Join(p, "stat"), []byte(strconv.Itoa(pid)+" (my (daemon)) "+state+" 1 0 0"), 0644))
+}
+
+func Test_ProcessHealthProbe(t *testing.T) {
+	ctx := log.NewContext(log.NewNopLogger())
+	dir := t.TempDir()
+	writeProc(t, dir, 100, "S", "/usr/sbin/mydaemon", "--config", "/etc/my.conf")
+	writeProc(t, dir, 200, "Z", "/usr/bin/zombie")
+	require.Nil(t, os.MkdirAll(filepath.Join(dir, "2"), 0755)) // kernel thread, empty cmdline
+	require.Nil(t, os.WriteFile(filepath.Join(dir, "2", "cmdline"), nil, 0644))
+	require.Nil(t, os.MkdirAll(filepath.Join(dir, "self"), 0755))
+
+	probe := func(p *ProcessHealthProbe) HealthStatus {
+		p.ProcDir = dir
+		state, err := p.evaluate(context.Background(), ctx)
+		require.Nil(t, err)
+		return state
+	}
+	pidFile := func(content string) string {
+		path := filepath.Join(t.TempDir(), "app.pid")
+		require.Nil(t, os.WriteFile(path, []byte(content), 0644))
+		return path
+	}
+
+	require.Equal(t, Healthy, probe(&ProcessHealthProbe{PidFile: pidFile("100\n")}))
+	require.Equal(t, Unhealthy, probe(&ProcessHealthProbe{PidFile: pidFile("300\n")}), "gone")
+	require.Equal(t, Unhealthy, probe(&ProcessHealthProbe{PidFile: pidFile("200\n")}), "zombie")
+	require.Equal(t, Unhealthy, probe(&ProcessHealthProbe{PidFile: pidFile("not a pid")}))
+	require.Equal(t, Unhealthy, probe(&ProcessHealthProbe{PidFile: filepath.Join(dir, "missing.pid")}))
+
+	require.Equal(t, Healthy, probe(&ProcessHealthProbe{Pattern: regexp.MustCompile(`mydaemon --config /etc/my\.conf$`)}))
+	require.Equal(t, Unhealthy, probe(&ProcessHealthProbe{Pattern: regexp.MustCompile(`otherdaemon`)}))
+	require.Equal(t, Unhealthy, probe(&ProcessHealthProbe{Pattern: regexp.MustCompile(`zombie`)}))
+
+	state, err := (&ProcessHealthProbe{Pattern: regexp.MustCompile(`.`), ProcDir: filepath.Join(dir, "missing")}).evaluate(context.Background(), ctx)
+	require.Equal(t, Unknown, state)
+	require.NotNil(t, err)
+}
+
+func Test_ProcessHealthProbe_self(t *testing.T) {
+	ctx := log.NewContext(log.NewNopLogger())
+	path := filepath.Join(t.TempDir(), "self.pid")
+	require.Nil(t, os.WriteFile(path, []byte(strconv.Itoa(os.Getpid())), 0644))
+	state, err := (&ProcessHealthProbe{PidFile: path}).evaluate(context.Background(), ctx)
+	require.Nil(t, err)
+	require.Equal(t, Healthy, state)
+}
+
+func Test_NewHealthProbe_process(t *testing.T) {
+	ctx := log.NewContext(log.NewNopLogger())
+	p := NewHealthProbe(ctx, &handlerSettings{publicSettings: publicSettings{Protocol: "process", PidFile: "/run/app.pid"}})
+	require.IsType(t, &ProcessHealthProbe{}, p)
+	require.Equal(t, "/run/app.pid", p.address())
+
+	p = NewHealthProbe(ctx, &handlerSettings{publicSettings: publicSettings{Protocol: "process", ProcessPattern: "^/usr/sbin/mydaemon"}})
+	require.Equal(t, "^/usr/sbin/mydaemon", p.address())
+}
+
+func Test_handlerSettingsValidate_process(t *testing.T) {
+	validate := func(p publicSettings) error { return handlerSettings{p, protectedSettings{}}.validate() }
+
+	require.Nil(t, validate(publicSettings{Protocol: "process", PidFile: "/run/app.pid"}))
+	require.Nil(t, validate(publicSettings{Protocol: "process", ProcessPattern: "mydaemon"}))
+	require.Equal(t, errProcessRequiresTarget, validate(publicSettings{Protocol: "process"}))
+	require.Equal(t, errProcessTargetTwice, validate(publicSettings{Protocol: "process", PidFile: "/run/app.pid", ProcessPattern: "mydaemon"}))
+	require.Equal(t, errPidFileNotAbsolute, validate(publicSettings{Protocol: "process", PidFile: "app.pid"}))
+	require.Equal(t, errInvalidProcessPattern, errors.Cause(validate(publicSettings{Protocol: "process", ProcessPattern: "("})))
+	require.Equal(t, errProcessWithPort, validate(publicSettings{Protocol: "process", PidFile: "/run/app.pid", Port: 80}))
+	require.Equal(t, errProcessTargetRequiresProcess, validate(publicSettings{Protocol: "tcp", Port: 80, PidFile: "/run/app.pid"}))
+	require.Equal(t, errIPVersionUnsupported, validate(publicSettings{Protocol: "process", PidFile: "/run/app.pid", IPVersion: ipVersion4}))
+}
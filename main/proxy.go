@@ -0,0 +1,53 @@
+package main
+
+import (
+	"net/http"
+	"net/url"
+
+	"github.com/pkg/errors"
+)
+
+var (
+	errProxyRequiresHttp = errors.New("'proxyUrl' and 'proxyFromEnvironment' can only be specified when using 'http' or 'https' protocol")
+	errProxyTwice        = errors.New("only one of 'proxyUrl' and 'proxyFromEnvironment' can be specified")
+	errProxyUnixSocket   = errors.New("'proxyUrl' and 'proxyFromEnvironment' cannot be used together with 'unixSocketPath'")
+	errInvalidProxyUrl   = errors.New("'proxyUrl' is not a valid http or https URL")
+)
+
+// proxy returns the function selecting the proxy of the requests of http
+// probes, or nil if they are sent directly.
+func (s *handlerSettings) proxy() func(*http.Request) (*url.URL, error) {
+	if s.publicSettings.ProxyFromEnvironment {
+		// HTTP_PROXY, HTTPS_PROXY and NO_PROXY, which never proxy localhost
+		return http.ProxyFromEnvironment
+	}
+	if s.publicSettings.ProxyURL == "" {
+		return nil
+	}
+	u, _ := url.Parse(s.publicSettings.ProxyURL) // checked by validate
+	return http.ProxyURL(u)
+}
+
+// validateProxy makes logical validation of the proxy of http probes.
+func (h handlerSettings) validateProxy() error {
+	p := h.publicSettings
+	if p.ProxyURL == "" && !p.ProxyFromEnvironment {
+		return nil
+	}
+	if h.protocol() != "http" && h.protocol() != "https" {
+		return errProxyRequiresHttp
+	}
+	if p.ProxyURL != "" && p.ProxyFromEnvironment {
+		return errProxyTwice
+	}
+	if h.unixSocketPath() != "" {
+		return errProxyUnixSocket
+	}
+	if p.ProxyURL != "" {
+		u, err := url.Parse(p.ProxyURL)
+		if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			return errInvalidProxyUrl
+		}
+	}
+	return nil
+}
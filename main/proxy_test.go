@@ -0,0 +1,52 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/go-kit/kit/log"
+	"github.com/stretchr/testify/require"
+)
+
+func Test_HttpHealthProbe_proxy(t *testing.T) {
+	var proxied string
+	proxy := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// a proxy receives the absolute URL
+		proxied = r.URL.String()
+	}))
+	defer proxy.Close()
+
+	ctx := log.NewContext(log.NewNopLogger())
+	cfg := &handlerSettings{publicSettings{Protocol: "http", Port: 8080, RequestPath: "health", ProxyURL: proxy.URL}, protectedSettings{}}
+	require.Nil(t, cfg.validate())
+	state, err := newProbe(ctx, cfg, 8080).evaluate(context.Background(), ctx)
+	require.Nil(t, err)
+	require.Equal(t, Healthy, state)
+	require.Equal(t, "http://localhost:8080/health", proxied)
+}
+
+func Test_handlerSettingsValidate_proxy(t *testing.T) {
+	require.Nil(t, (&handlerSettings{}).proxy())
+	cfg := handlerSettings{publicSettings{Protocol: "https", ProxyFromEnvironment: true}, protectedSettings{}}
+	require.Nil(t, cfg.validate())
+	require.NotNil(t, cfg.proxy())
+
+	require.Equal(t, errProxyRequiresHttp, handlerSettings{
+		publicSettings{Protocol: "tcp", Port: 80, ProxyURL: "http://proxy:3128"},
+		protectedSettings{},
+	}.validate())
+	require.Equal(t, errProxyTwice, handlerSettings{
+		publicSettings{Protocol: "http", ProxyURL: "http://proxy:3128", ProxyFromEnvironment: true},
+		protectedSettings{},
+	}.validate())
+	require.Equal(t, errProxyUnixSocket, handlerSettings{
+		publicSettings{Protocol: "http", UnixSocketPath: "/run/app.sock", ProxyURL: "http://proxy:3128"},
+		protectedSettings{},
+	}.validate())
+	require.Equal(t, errInvalidProxyUrl, handlerSettings{
+		publicSettings{Protocol: "http", ProxyURL: "http://"},
+		protectedSettings{},
+	}.validate())
+}
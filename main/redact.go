@@ -0,0 +1,166 @@
+package main
+
+import (
+	"encoding/base64"
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/go-kit/kit/log"
+)
+
+const (
+	// minSecretLength is the length below which configured secrets are not
+	// redacted, as they would garble unrelated text.
+	minSecretLength = 4
+
+	// maxRedactedTokens bounds the access tokens obtained at run time that
+	// are redacted, the oldest having expired long ago.
+	maxRedactedTokens = 4
+)
+
+var (
+	// secretPatterns match credentials in text regardless of the settings,
+	// e.g. in the error strings of failed requests.
+	secretPatterns = []*regexp.Regexp{
+		// password of the user info of a URL
+		regexp.MustCompile(`(://[^/\s:@]+:)[^/\s@]+(@)`),
+		// credentials of an Authorization header
+		regexp.MustCompile(`(?i)(authorization"?\s*[:=]\s*"?(?:bearer|basic)\s+)[^\s"]+()`),
+		// values of URL query parameters commonly holding credentials
+		regexp.MustCompile(`(?i)([?&](?:[a-z_-]*(?:token|secret|key)|password|passwd|pwd|sig|signature|code)=)[^&\s"]+()`),
+	}
+
+	// sensitiveHeaderNames are the parts of the names of the request headers
+	// whose values are redacted.
+	sensitiveHeaderNames = []string{"auth", "token", "key", "secret", "cookie", "password"}
+
+	// secrets holds the credentials of the settings redacted from the log and
+	// the status.
+	secrets = &secretSet{}
+)
+
+// secretSet is the set of secret values to redact.
+type secretSet struct {
+	mu     sync.RWMutex
+	values []string // configured, longest first
+	tokens []string // obtained at run time, newest last
+}
+
+// set replaces the configured secrets.
+func (s *secretSet) set(values ...string) {
+	var out []string
+	for _, v := range values {
+		if len(v) >= minSecretLength {
+			out = append(out, v)
+		}
+	}
+	sort.Slice(out, func(i, j int) bool { return len(out[i]) > len(out[j]) })
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.values = out
+}
+
+// addToken adds a credential obtained at run time, e.g. an access token.
+func (s *secretSet) addToken(t string) {
+	if len(t) < minSecretLength {
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.tokens = append(s.tokens, t)
+	if over := len(s.tokens) - maxRedactedTokens; over > 0 {
+		s.tokens = s.tokens[over:]
+	}
+}
+
+// redact replaces the secrets and the credentials matching secretPatterns in
+// text.
+func (s *secretSet) redact(text string) string {
+	for _, p := range secretPatterns {
+		text = p.ReplaceAllString(text, "${1}"+redactedValue+"${2}")
+	}
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	for _, v := range s.tokens {
+		text = strings.Replace(text, v, redactedValue, -1)
+	}
+	for _, v := range s.values {
+		text = strings.Replace(text, v, redactedValue, -1)
+	}
+	return text
+}
+
+// wrap returns a logger redacting the values of the records before passing
+// them on to next.
+func (s *secretSet) wrap(next log.Logger) log.Logger {
+	return log.LoggerFunc(func(keyvals ...interface{}) error {
+		out := make([]interface{}, len(keyvals))
+		copy(out, keyvals)
+		for i := 1; i < len(out); i += 2 {
+			if out[i] == nil {
+				continue
+			}
+			text := fmt.Sprint(out[i])
+			if r := s.redact(text); r != text {
+				out[i] = r
+			}
+		}
+		return next.Log(out...)
+	})
+}
+
+// secretValues returns the credentials of the settings: the protected settings
+// and the values of sensitive request headers.
+func (s *handlerSettings) secretValues() []string {
+	p := s.protectedSettings
+	out := []string{p.Password, p.BearerToken, p.SshPrivateKey, p.ClientKey}
+	if p.Username != "" {
+		out = append(out, base64.StdEncoding.EncodeToString([]byte(p.Username+":"+p.Password)))
+	}
+	if p.OAuth2 != nil {
+		out = append(out, p.OAuth2.ClientSecret)
+	}
+	for _, headers := range s.allRequestHeaders() {
+		for name, value := range headers {
+			if isSensitiveHeader(name) {
+				out = append(out, value)
+			}
+		}
+	}
+	return out
+}
+
+// allRequestHeaders returns the request headers of the top level and of each
+// probe, application and readiness probe.
+func (s *handlerSettings) allRequestHeaders() []map[string]string {
+	out := []map[string]string{s.publicSettings.RequestHeaders}
+	for _, a := range s.probes() {
+		out = append(out, a.RequestHeaders)
+	}
+	for _, a := range s.applications() {
+		out = append(out, a.RequestHeaders)
+	}
+	if r := s.readinessProbe(); r != nil {
+		out = append(out, r.RequestHeaders)
+	}
+	return out
+}
+
+func isSensitiveHeader(name string) bool {
+	name = strings.ToLower(name)
+	for _, part := range sensitiveHeaderNames {
+		if strings.Contains(name, part) {
+			return true
+		}
+	}
+	return false
+}
+
+// configureRedaction redacts the credentials of the settings from the log and
+// the status.
+func configureRedaction(cfg *handlerSettings) {
+	secrets.set(cfg.secretValues()...)
+}
@@ -1,7 +1,10 @@
 package main
 
 import (
-	"github.com/Azure/azure-docker-extension/pkg/vmextension"
+	"os"
+	"sync"
+	"time"
+
 	"github.com/go-kit/kit/log"
 	"github.com/pkg/errors"
 )
@@ -11,12 +14,13 @@ import (
 // status.
 //
 // If an error occurs reporting the status, it will be logged and returned.
-func reportStatus(ctx *log.Context, hEnv vmextension.HandlerEnvironment, seqNum int, t StatusType, c cmd, msg string) error {
+func reportStatus(ctx *log.Context, hEnv HandlerEnvironment, seqNum int, t StatusType, c cmd, msg string) error {
 	if !c.shouldReportStatus {
 		ctx.Log("status", "not reported for operation (by design)")
 		return nil
 	}
 	s := NewStatus(t, c.name, statusMsg(c, t, msg))
+	defaultStatusOptions.apply(s)
 	if err := s.Save(hEnv.HandlerEnvironment.StatusFolder, seqNum); err != nil {
 		ctx.Log("event", "failed to save handler status", "error", err)
 		return errors.Wrap(err, "failed to save handler status")
@@ -24,16 +28,97 @@ func reportStatus(ctx *log.Context, hEnv vmextension.HandlerEnvironment, seqNum
 	return nil
 }
 
-func reportStatusWithSubstatus(ctx *log.Context, hEnv vmextension.HandlerEnvironment, seqNum int, t StatusType, op string, msg string, subType StatusType, subName string, subMessage string) error {
-	s := NewStatus(t, op, msg)
-	s.AddSubstatus(subType, subName, subMessage)
-	if err := s.Save(hEnv.HandlerEnvironment.StatusFolder, seqNum); err != nil {
+// statusOptions control how the messages of a status report are rendered.
+type statusOptions struct {
+	maxMessageLength int
+	formatVersion    int // stamped on the report unless legacy
+
+	// heartbeat is how often a report identical to the previous one is
+	// written again, zero to write every report.
+	heartbeat time.Duration
+}
+
+var defaultStatusOptions = statusOptions{
+	maxMessageLength: defaultMaxMessageLength,
+}
+
+func newStatusOptions(cfg *handlerSettings) statusOptions {
+	return statusOptions{
+		maxMessageLength: cfg.maxMessageLength(),
+		formatVersion:    cfg.statusFormatVersion(),
+		heartbeat:        cfg.statusHeartbeat(),
+	}
+}
+
+// apply renders the messages of the status report according to the options.
+func (o statusOptions) apply(r StatusReport) {
+	r.RedactMessages(secrets.redact)
+	r.TruncateMessages(o.maxMessageLength)
+	if o.formatVersion > legacyStatusFormatVersion {
+		for i := range r {
+			r[i].FormatVersion = o.formatVersion
+		}
+	}
+}
+
+// reportStatusWithSubstatus saves the status of the given operation along with
+// the given substatus items to the status file for the extension handler,
+// rendered with the given options.
+//
+// If an error occurs reporting the status, it will be logged and returned.
+func reportStatusWithSubstatus(ctx *log.Context, hEnv HandlerEnvironment, seqNum int, opts statusOptions, t StatusType, op string, msg FormattedMessage, substatuses ...SubstatusItem) error {
+	s := NewFormattedStatus(t, op, msg)
+	s.AddSubstatusItems(substatuses...)
+	opts.apply(s)
+	folder := hEnv.HandlerEnvironment.StatusFolder
+	now := time.Now()
+	fingerprint := s.fingerprint()
+	if !lastStatusWrite.due(folder, seqNum, fingerprint, now, opts.heartbeat) {
+		return nil
+	}
+	if err := s.Save(folder, seqNum); err != nil {
 		ctx.Log("event", "failed to save handler status", "error", err)
 		return errors.Wrap(err, "failed to save handler status")
 	}
+	lastStatusWrite.written(folder, seqNum, fingerprint, now)
 	return nil
 }
 
+// lastStatusWrite is the status report last written by the probe loop.
+var lastStatusWrite = &statusWriteCache{}
+
+// statusWriteCache remembers the status report last written, so that the
+// probe loop does not rewrite the status file every interval while nothing
+// changes.
+type statusWriteCache struct {
+	mu          sync.Mutex
+	path        string
+	fingerprint string
+	at          time.Time
+}
+
+// due tells whether the report with the fingerprint must be written at now:
+// if it changed, the heartbeat elapsed or the status file is gone.
+func (c *statusWriteCache) due(folder string, seqNum int, fingerprint string, now time.Time, heartbeat time.Duration) bool {
+	if heartbeat == 0 {
+		return true
+	}
+	path := statusFilePath(folder, seqNum)
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.path != path || c.fingerprint != fingerprint || now.Sub(c.at) >= heartbeat {
+		return true
+	}
+	_, err := os.Stat(path)
+	return err != nil
+}
+
+func (c *statusWriteCache) written(folder string, seqNum int, fingerprint string, now time.Time) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.path, c.fingerprint, c.at = statusFilePath(folder, seqNum), fingerprint, now
+}
+
 // statusMsg creates the reported status message based on the provided operation
 // type and the given message string.
 //
@@ -5,8 +5,8 @@ import (
 	"os"
 	"path/filepath"
 	"testing"
+	"time"
 
-	"github.com/Azure/azure-docker-extension/pkg/vmextension"
 	"github.com/go-kit/kit/log"
 	"github.com/stretchr/testify/require"
 )
@@ -23,7 +23,7 @@ func Test_statusMsg(t *testing.T) {
 }
 
 func Test_reportStatus_fails(t *testing.T) {
-	fakeEnv := vmextension.HandlerEnvironment{}
+	fakeEnv := HandlerEnvironment{}
 	fakeEnv.HandlerEnvironment.StatusFolder = "/non-existing/dir/"
 
 	err := reportStatus(log.NewContext(log.NewNopLogger()), fakeEnv, 1, StatusSuccess, cmdEnable, "")
@@ -36,7 +36,7 @@ func Test_reportStatus_fileExists(t *testing.T) {
 	require.Nil(t, err)
 	defer os.RemoveAll(tmpDir)
 
-	fakeEnv := vmextension.HandlerEnvironment{}
+	fakeEnv := HandlerEnvironment{}
 	fakeEnv.HandlerEnvironment.StatusFolder = tmpDir
 
 	require.Nil(t, reportStatus(log.NewContext(log.NewNopLogger()), fakeEnv, 1, StatusError, cmdEnable, "FOO ERROR"))
@@ -53,7 +53,7 @@ func Test_reportStatus_checksIfShouldBeReported(t *testing.T) {
 		require.Nil(t, err)
 		defer os.RemoveAll(tmpDir)
 
-		fakeEnv := vmextension.HandlerEnvironment{}
+		fakeEnv := HandlerEnvironment{}
 		fakeEnv.HandlerEnvironment.StatusFolder = tmpDir
 		require.Nil(t, reportStatus(log.NewContext(log.NewNopLogger()), fakeEnv, 2, StatusSuccess, c, ""))
 
@@ -71,3 +71,72 @@ func Test_reportStatus_checksIfShouldBeReported(t *testing.T) {
 		}
 	}
 }
+
+func Test_reportStatusWithSubstatus_multiple(t *testing.T) {
+	tmpDir, err := ioutil.TempDir("", "")
+	require.Nil(t, err)
+	defer os.RemoveAll(tmpDir)
+
+	fakeEnv := HandlerEnvironment{}
+	fakeEnv.HandlerEnvironment.StatusFolder = tmpDir
+
+	require.Nil(t, reportStatusWithSubstatus(log.NewContext(log.NewNopLogger()), fakeEnv, 1, statusOptions{maxMessageLength: 64}, StatusSuccess, "enable", FormattedMessage{Lang: "de-DE", Message: "msg"},
+		NewSubstatus(StatusSuccess, "first", "a"),
+		NewSubstatus(StatusError, "second", "b")))
+
+	b, err := ioutil.ReadFile(filepath.Join(tmpDir, "1.status"))
+	require.Nil(t, err)
+	require.Contains(t, string(b), `"name": "first"`)
+	require.Contains(t, string(b), `"name": "second"`)
+	require.Contains(t, string(b), `"lang": "de-DE"`)
+}
+
+func Test_reportStatusWithSubstatus_skipsUnchanged(t *testing.T) {
+	defer func(c *statusWriteCache) { lastStatusWrite = c }(lastStatusWrite)
+	lastStatusWrite = &statusWriteCache{}
+	tmpDir, err := ioutil.TempDir("", "")
+	require.Nil(t, err)
+	defer os.RemoveAll(tmpDir)
+
+	ctx := log.NewContext(log.NewNopLogger())
+	fakeEnv := HandlerEnvironment{}
+	fakeEnv.HandlerEnvironment.StatusFolder = tmpDir
+	path := filepath.Join(tmpDir, "3.status")
+	opts := defaultStatusOptions
+	opts.heartbeat = time.Hour
+	report := func(msg, uptime string) {
+		require.Nil(t, reportStatusWithSubstatus(ctx, fakeEnv, 3, opts, StatusSuccess, "enable", FormattedMessage{},
+			NewSubstatus(StatusSuccess, substatusName, msg), NewSubstatus(StatusSuccess, extensionMetricsSubstatusName, uptime)))
+	}
+
+	report("Application found to be healthy", "uptime=1s")
+	require.Nil(t, ioutil.WriteFile(path, []byte("marker"), 0644))
+	report("Application found to be healthy", "uptime=6s")
+	requireFile(t, path, "marker")
+
+	report("Application found to be unhealthy", "uptime=11s")
+	b, err := ioutil.ReadFile(path)
+	require.Nil(t, err)
+	require.Contains(t, string(b), "unhealthy")
+
+	require.Nil(t, os.Remove(path))
+	report("Application found to be unhealthy", "uptime=16s")
+	_, err = os.Stat(path)
+	require.Nil(t, err, "rewritten once removed")
+}
+
+func Test_statusWriteCache_heartbeat(t *testing.T) {
+	dir, err := ioutil.TempDir("", "")
+	require.Nil(t, err)
+	defer os.RemoveAll(dir)
+	require.Nil(t, ioutil.WriteFile(filepath.Join(dir, "1.status"), nil, 0644))
+
+	c := &statusWriteCache{}
+	now := time.Now()
+	require.True(t, c.due(dir, 1, "a", now, time.Minute))
+	c.written(dir, 1, "a", now)
+	require.False(t, c.due(dir, 1, "a", now.Add(59*time.Second), time.Minute))
+	require.True(t, c.due(dir, 1, "a", now.Add(time.Minute), time.Minute))
+	require.True(t, c.due(dir, 2, "a", now, time.Minute), "other sequence number")
+	require.True(t, c.due(dir, 1, "a", now, 0), "no heartbeat")
+}
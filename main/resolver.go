@@ -0,0 +1,30 @@
+package main
+
+import (
+	"net"
+
+	"github.com/go-kit/kit/log"
+)
+
+// cgoResolverAvailable tells whether the binary is built with cgo, in which
+// case the Go runtime may resolve names through the system resolver (glibc
+// NSS) instead of its own.
+var cgoResolverAvailable = false
+
+// configureResolver selects the DNS resolver used by the probes and logs the
+// choice.
+func configureResolver(ctx *log.Context, cfg *handlerSettings) {
+	net.DefaultResolver.PreferGo = cfg.pureGoResolver()
+	ctx.Log("event", "using dns resolver", "resolver", resolverName())
+}
+
+// resolverName describes the DNS resolver in use.
+func resolverName() string {
+	if !cgoResolverAvailable {
+		return "go (cgo-free build)"
+	}
+	if net.DefaultResolver.PreferGo {
+		return "go (forced by pureGoResolver)"
+	}
+	return "go or cgo (chosen by the go runtime)"
+}
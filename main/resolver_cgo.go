@@ -0,0 +1,8 @@
+//go:build cgo
+// +build cgo
+
+package main
+
+func init() {
+	cgoResolverAvailable = true
+}
@@ -0,0 +1,21 @@
+package main
+
+import (
+	"net"
+	"testing"
+
+	"github.com/go-kit/kit/log"
+	"github.com/stretchr/testify/require"
+)
+
+func Test_configureResolver(t *testing.T) {
+	ctx := log.NewContext(log.NewNopLogger())
+	defer func() { net.DefaultResolver.PreferGo = false }()
+
+	configureResolver(ctx, &handlerSettings{publicSettings{PureGoResolver: true}, protectedSettings{}})
+	require.True(t, net.DefaultResolver.PreferGo)
+	require.Contains(t, resolverName(), "go")
+
+	configureResolver(ctx, &handlerSettings{})
+	require.False(t, net.DefaultResolver.PreferGo)
+}
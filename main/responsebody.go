@@ -0,0 +1,112 @@
+package main
+
+import (
+	"encoding/json"
+	"io"
+	"io/ioutil"
+	"strings"
+
+	"github.com/pkg/errors"
+	"github.com/xeipuuv/gojsonschema"
+)
+
+const (
+	// maxResponseBodySize bounds how much of the response body of the health
+	// endpoint is read for inspection.
+	maxResponseBodySize = 1 << 20
+
+	// applicationHealthStateField is the field of a JSON response body through
+	// which the application reports its own health state.
+	applicationHealthStateField = "ApplicationHealthState"
+)
+
+var (
+	errInvalidResponseBodySchema  = errors.New("'responseBodySchema' is not a valid JSON Schema")
+	errResponseSchemaRequiresHttp = errors.New("'responseBodySchema' can only be specified when using 'http' or 'https' protocol")
+	errInvalidResponseBodyRegex   = errors.New("'responseBodyRegex' is not a valid regular expression")
+	errResponseRegexRequiresHttp  = errors.New("'responseBodyRegex' can only be specified when using 'http' or 'https' protocol")
+)
+
+// compileResponseBodySchema compiles the JSON Schema the response body of the
+// health endpoint is validated against, or returns nil if raw is empty.
+func compileResponseBodySchema(raw json.RawMessage) (*gojsonschema.Schema, error) {
+	if len(raw) == 0 {
+		return nil, nil
+	}
+	schema, err := gojsonschema.NewSchema(gojsonschema.NewStringLoader(string(raw)))
+	if err != nil {
+		return nil, errors.Wrap(errInvalidResponseBodySchema, err.Error())
+	}
+	return schema, nil
+}
+
+// readResponseBody reads the response body up to maxResponseBodySize.
+func readResponseBody(r io.Reader) ([]byte, error) {
+	return ioutil.ReadAll(io.LimitReader(r, maxResponseBodySize))
+}
+
+// validateResponseBody validates body against schema and returns the first
+// violation, or nil if the body is valid.
+func validateResponseBody(schema *gojsonschema.Schema, body []byte) error {
+	res, err := schema.Validate(gojsonschema.NewStringLoader(string(body)))
+	if err != nil {
+		return errors.Wrap(err, "response body is not valid JSON")
+	}
+	if !res.Valid() {
+		return errors.Errorf("response body does not match the schema: %s", res.Errors()[0])
+	}
+	return nil
+}
+
+// inspectsBody tells whether the response body of the probe is checked.
+func (p *HttpHealthProbe) inspectsBody() bool {
+	return p.ResponseSchema != nil || p.ResponseRegex != nil || p.ResponseJsonPath != nil
+}
+
+// checkResponseBody checks body against the schema, regular expression and
+// JSONPath assertion of the probe, and returns the first failed check, or nil
+// if the body passed.
+func (p *HttpHealthProbe) checkResponseBody(body []byte) error {
+	if p.ResponseSchema != nil {
+		if err := validateResponseBody(p.ResponseSchema, body); err != nil {
+			return err
+		}
+	}
+	if p.ResponseRegex != nil && !p.ResponseRegex.Match(body) {
+		return errors.Errorf("response body does not match %q", p.ResponseRegex)
+	}
+	if p.ResponseJsonPath != nil {
+		return checkJsonPath(p.ResponseJsonPath, p.ExpectedValue, body)
+	}
+	return nil
+}
+
+// reportedStates are the states an application can report through
+// applicationHealthStateField, matched case-insensitively.
+var reportedStates = map[string]HealthStatus{
+	"healthy":   Healthy,
+	"unhealthy": Unhealthy,
+	"degraded":  Degraded,
+}
+
+// parseReportedState returns the health state the application reports in the
+// response body, or false if the body does not report one.
+func parseReportedState(body []byte) (HealthStatus, bool, error) {
+	var fields map[string]json.RawMessage
+	if json.Unmarshal(body, &fields) != nil {
+		return "", false, nil
+	}
+	raw, ok := fields[applicationHealthStateField]
+	if !ok {
+		return "", false, nil
+	}
+	var v string
+	if err := json.Unmarshal(raw, &v); err != nil {
+		return "", true, errors.Errorf("%s is not a string", applicationHealthStateField)
+	}
+	state, ok := reportedStates[strings.ToLower(v)]
+	if !ok {
+		return "", true, errors.Errorf("unknown %s %q", applicationHealthStateField, v)
+	}
+	return state, true, nil
+}
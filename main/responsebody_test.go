@@ -0,0 +1,80 @@
+package main
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+const testResponseBodySchema = `{
+  "type": "object",
+  "properties": {
+    "status": {"type": "string", "enum": ["ok", "warn"]}
+  },
+  "required": ["status"]
+}`
+
+func Test_compileResponseBodySchema(t *testing.T) {
+	schema, err := compileResponseBodySchema(nil)
+	require.Nil(t, err)
+	require.Nil(t, schema)
+
+	_, err = compileResponseBodySchema(json.RawMessage(`{"type": "nope"}`))
+	require.NotNil(t, err)
+	require.Contains(t, err.Error(), errInvalidResponseBodySchema.Error())
+
+	schema, err = compileResponseBodySchema(json.RawMessage(testResponseBodySchema))
+	require.Nil(t, err)
+	require.NotNil(t, schema)
+}
+
+func Test_validateResponseBody(t *testing.T) {
+	schema, err := compileResponseBodySchema(json.RawMessage(testResponseBodySchema))
+	require.Nil(t, err)
+
+	require.Nil(t, validateResponseBody(schema, []byte(`{"status": "ok", "uptime": 12}`)))
+
+	err = validateResponseBody(schema, []byte(`{"status": "broken"}`))
+	require.NotNil(t, err)
+	require.Contains(t, err.Error(), "response body does not match the schema: status")
+
+	err = validateResponseBody(schema, []byte(`{}`))
+	require.NotNil(t, err)
+	require.Contains(t, err.Error(), "status is required")
+
+	err = validateResponseBody(schema, []byte(`<html>OK</html>`))
+	require.NotNil(t, err)
+	require.Contains(t, err.Error(), "response body is not valid JSON")
+}
+
+func Test_readResponseBody(t *testing.T) {
+	b, err := readResponseBody(strings.NewReader(strings.Repeat("x", maxResponseBodySize+10)))
+	require.Nil(t, err)
+	require.Len(t, b, maxResponseBodySize)
+}
+
+func Test_parseReportedState(t *testing.T) {
+	for _, tc := range []struct {
+		body     string
+		state    HealthStatus
+		reported bool
+		err      bool
+	}{
+		{`{"ApplicationHealthState": "Healthy"}`, Healthy, true, false},
+		{`{"ApplicationHealthState": "unhealthy", "detail": "db down"}`, Unhealthy, true, false},
+		{`{"ApplicationHealthState": "DEGRADED"}`, Degraded, true, false},
+		{`{"ApplicationHealthState": "Sick"}`, "", true, true},
+		{`{"ApplicationHealthState": 1}`, "", true, true},
+		{`{"status": "ok"}`, "", false, false},
+		{`["Healthy"]`, "", false, false},
+		{`OK`, "", false, false},
+		{``, "", false, false},
+	} {
+		state, reported, err := parseReportedState([]byte(tc.body))
+		require.Equal(t, tc.state, state, tc.body)
+		require.Equal(t, tc.reported, reported, tc.body)
+		require.Equal(t, tc.err, err != nil, tc.body)
+	}
+}
@@ -16,12 +16,17 @@ const (
   "type": "object",
   "properties": {
     "protocol": {
-      "description": "Required - can be 'tcp', 'http', or 'https'.",
+      "description": "Required - can be 'tcp', 'udp', 'http', 'https', 'tls', 'grpc', 'icmp', 'dns', 'exec', 'file', 'systemd', 'docker' or 'process'.",
       "type": "string",
-      "enum": ["tcp", "http", "https"]
+      "enum": ["tcp", "udp", "http", "https", "tls", "grpc", "icmp", "dns", "exec", "file", "systemd", "docker", "process"]
+    },
+    "host": {
+      "description": "Optional - hostname or IP address 'tcp', 'udp', 'http', 'https', 'tls' and 'grpc' probes connect to, or of the DNS server 'dns' probes query, e.g. the address of a secondary network interface the application is bound to. Defaults to 'localhost'.",
+      "type": "string",
+      "pattern": "^[0-9A-Za-z.:%-]+$"
     },
 	  "port": {
-	    "description": "Required when the protocol is 'tcp'. Optional when the protocol is 'http' or 'https'.",
+	    "description": "Required when the protocol is 'tcp', 'udp', 'tls' or 'grpc'. Optional when the protocol is 'http', 'https' or 'dns'.",
       "type": "integer",
       "minimum": 1,
       "maximum": 65535
@@ -29,6 +34,1183 @@ const (
     "requestPath": {
       "description": "Path on which the web request should be sent. Required when the protocol is 'http' or 'https'.",
       "type": "string"
+    },
+    "udpPayload": {
+      "description": "Required when the protocol is 'udp' - base64 encoded datagram sent by the probe. The application is healthy when a response is received before the probe timeout.",
+      "type": "string",
+      "pattern": "^[A-Za-z0-9+/]*={0,2}$"
+    },
+    "udpExpectedResponse": {
+      "description": "Optional - base64 encoded bytes the response to 'udpPayload' must contain. By default any response is accepted.",
+      "type": "string",
+      "pattern": "^[A-Za-z0-9+/]*={0,2}$"
+    },
+    "icmpAddress": {
+      "description": "Required when the protocol is 'icmp' - hostname or IP address, e.g. of a gateway or a dependency, whose reachability is checked with ICMP echo requests. It is healthy when any of the requests is answered.",
+      "type": "string",
+      "minLength": 1
+    },
+    "icmpCount": {
+      "description": "Optional - number of ICMP echo requests sent by each probe until one is answered. Defaults to 3.",
+      "type": "integer",
+      "minimum": 1,
+      "maximum": 10
+    },
+    "icmpTimeoutInMilliseconds": {
+      "description": "Optional - how long the reply to each ICMP echo request is waited for. Defaults to 1000.",
+      "type": "integer",
+      "minimum": 10,
+      "maximum": 10000
+    },
+    "dnsName": {
+      "description": "Required when the protocol is 'dns' - name resolved by the probe against the DNS server at 'host' and 'port', 53 unless specified. It is healthy when the name resolves to an address, and unhealthy on NXDOMAIN, other errors or no answer. Names in /etc/hosts are not sent to the server.",
+      "type": "string",
+      "minLength": 1
+    },
+    "grpcService": {
+      "description": "Optional - service whose health is checked through the gRPC Health Checking Protocol when the protocol is 'grpc'. Defaults to '', the overall health of the server.",
+      "type": "string"
+    },
+    "command": {
+      "description": "Required when the protocol is 'exec' - command run by the probe, given as the absolute path of the executable followed by its arguments. The application is healthy when the command exits with status 0 before the probe timeout.",
+      "type": "array",
+      "minItems": 1,
+      "items": {
+        "type": "string",
+        "minLength": 1
+      }
+    },
+    "runAsUser": {
+      "description": "Optional - name of the user the command of 'exec' probes runs as, e.g. a dedicated unprivileged user, instead of root.",
+      "type": "string",
+      "pattern": "^[a-z_][a-z0-9_.-]*\\$?$"
+    },
+    "commandEnvironment": {
+      "description": "Optional - names of the environment variables of the extension passed to the command of 'exec' probes. Defaults to passing all of them.",
+      "type": "array",
+      "items": {
+        "type": "string",
+        "pattern": "^[A-Za-z_][A-Za-z0-9_]*$"
+      }
+    },
+    "captureCommandOutput": {
+      "description": "Optional - when true, the end of the output of the last failed run of the command of 'exec' probes is reported in the AppHealthCommandOutput substatus for debugging.",
+      "type": "boolean"
+    },
+    "passiveListenCheck": {
+      "description": "Optional - when true, 'tcp' probes check that a socket listens on the port by reading /proc/net/tcp and /proc/net/tcp6 rather than connecting to it, so that probes do not show up in the logs or connection limits of the application. The address the socket is bound to is not checked.",
+      "type": "boolean"
+    },
+    "pidFile": {
+      "description": "Optional when the protocol is 'process' - absolute path of the file the daemon writes its process ID into. The application is healthy while that process is running. Cannot be used together with 'processPattern'.",
+      "type": "string",
+      "pattern": "^/"
+    },
+    "processPattern": {
+      "description": "Optional when the protocol is 'process' - regular expression matched against the command line of every running process, its arguments separated by spaces. The application is healthy while a matching process is running. Cannot be used together with 'pidFile'.",
+      "type": "string",
+      "minLength": 1
+    },
+    "containerName": {
+      "description": "Required when the protocol is 'docker' - name or ID of the container whose state is checked through the Docker Engine API. The application is healthy while the container is running and, if it has a healthcheck, reported healthy by it.",
+      "type": "string",
+      "pattern": "^/?[0-9A-Za-z][0-9A-Za-z_.-]*$"
+    },
+    "dockerSocket": {
+      "description": "Optional - absolute path of the unix socket of the Docker Engine API, or of a compatible one such as Podman's, when the protocol is 'docker'. Defaults to '/var/run/docker.sock'.",
+      "type": "string",
+      "pattern": "^/"
+    },
+    "systemdUnit": {
+      "description": "Required when the protocol is 'systemd' - name of the systemd unit, e.g. 'app.service', whose state is checked. The application is healthy while the unit is active or reloading, and unhealthy when it is failed or inactive.",
+      "type": "string",
+      "pattern": "^[0-9A-Za-z:_.@\\\\-]+$"
+    },
+    "filePath": {
+      "description": "Required when the protocol is 'file' - absolute path of a heartbeat file the application writes periodically. The application is healthy when the file exists and, if 'fileMaxAgeInSeconds' is specified, was modified within that time.",
+      "type": "string",
+      "pattern": "^/"
+    },
+    "fileMaxAgeInSeconds": {
+      "description": "Optional - time since the last modification of 'filePath' after which the application is found unhealthy when the protocol is 'file'. Defaults to only checking that the file exists.",
+      "type": "integer",
+      "minimum": 1,
+      "maximum": 86400
+    },
+    "systemdSocket": {
+      "description": "Optional - name of a systemd socket unit, e.g. 'app.socket', whose listening port is probed. Cannot be used together with 'port'.",
+      "type": "string",
+      "pattern": "^[^/]+\\.socket$"
+    },
+    "portFile": {
+      "description": "Optional - absolute path of a file the application writes its listening port into. The file is read again when the application is found unhealthy. Cannot be used together with 'port' or 'systemdSocket'.",
+      "type": "string",
+      "pattern": "^/"
+    },
+    "unixSocketPath": {
+      "description": "Optional - absolute path of a unix socket 'tcp', 'http', 'https', 'tls' and 'grpc' probes connect to instead of a TCP port, e.g. '/var/run/app.sock'. Cannot be used together with 'port', 'systemdSocket' or 'portFile'.",
+      "type": "string",
+      "pattern": "^/"
+    },
+    "sshTunnel": {
+      "description": "Optional - ssh relay probes are tunneled through, for applications not reachable from this VM. The probe target is resolved by the relay. The private key is given as 'sshPrivateKey' in protected settings.",
+      "type": "object",
+      "properties": {
+        "host": {
+          "description": "Required - hostname or IP address of the relay.",
+          "type": "string",
+          "minLength": 1
+        },
+        "port": {
+          "description": "Optional - ssh port of the relay. Defaults to 22.",
+          "type": "integer",
+          "minimum": 1,
+          "maximum": 65535
+        },
+        "user": {
+          "description": "Required - user to log in to the relay as.",
+          "type": "string",
+          "minLength": 1
+        },
+        "hostPublicKey": {
+          "description": "Required - public host key of the relay, e.g. 'ssh-ed25519 AAAA...', which the relay is verified against.",
+          "type": "string",
+          "pattern": "^[a-z0-9-]+(@[a-z0-9.-]+)? [A-Za-z0-9+/=]+$"
+        }
+      },
+      "required": ["host", "user", "hostPublicKey"],
+      "additionalProperties": false
+    },
+    "intervalInSeconds": {
+      "description": "Optional - time between two probes. Defaults to 5 seconds.",
+      "type": "integer",
+      "minimum": 5,
+      "maximum": 60
+    },
+    "numberOfProbes": {
+      "description": "Optional - number of consecutive unhealthy probe results required to report the application unhealthy. 'intervalInSeconds' multiplied by 'numberOfProbes' must not exceed 120 seconds. Defaults to 1.",
+      "type": "integer",
+      "minimum": 1,
+      "maximum": 24
+    },
+    "probeTimeoutInSeconds": {
+      "description": "Optional - time a single probe, e.g. a tcp connect or an http request, may take before the application is found unhealthy. Must not exceed 'intervalInSeconds'. A probe still running after its timeout is abandoned and found unhealthy. Defaults to 30 seconds, or 'intervalInSeconds' if shorter.",
+      "type": "integer",
+      "minimum": 1,
+      "maximum": 60
+    },
+    "healthyThreshold": {
+      "description": "Optional - number of consecutive healthy probe results required to report an unhealthy application healthy again. Defaults to 1.",
+      "type": "integer",
+      "minimum": 1,
+      "maximum": 24
+    },
+    "confirmationBurst": {
+      "description": "Optional - when a probe result contradicts the reported state, fire the given number of probes at a short interval to confirm the change quickly instead of waiting for the regular interval.",
+      "type": "object",
+      "properties": {
+        "probes": {
+          "description": "Required - number of confirmation probes.",
+          "type": "integer",
+          "minimum": 1,
+          "maximum": 10
+        },
+        "intervalInSeconds": {
+          "description": "Required - time between two confirmation probes.",
+          "type": "integer",
+          "minimum": 1,
+          "maximum": 30
+        }
+      },
+      "required": ["probes", "intervalInSeconds"],
+      "additionalProperties": false
+    },
+    "honorRetryAfter": {
+      "description": "Optional - when true, 429 and 503 responses with a Retry-After header are reported as degraded rather than unhealthy, and the application is not probed again before the requested time, up to 5 minutes.",
+      "type": "boolean"
+    },
+    "expectedAlpnProtocol": {
+      "description": "Optional - protocol the TLS handshake of 'https' probes must negotiate through ALPN, e.g. 'h2'. The application is unhealthy when another protocol is negotiated, e.g. by a proxy downgrading it to 'http/1.1'.",
+      "type": "string",
+      "enum": ["h2", "http/1.1"]
+    },
+    "caBundle": {
+      "description": "Optional - PEM encoded certificates of the authorities the server certificate of 'https' and 'tls' probes must chain to, e.g. an internal CA. When neither this nor 'caBundlePath' is specified, the certificate is verified against the system authorities if 'tlsSkipVerify' is false.",
+      "type": "string",
+      "minLength": 1
+    },
+    "caBundlePath": {
+      "description": "Optional - path of a file holding the PEM encoded certificates 'caBundle' would hold, read when the probe is created.",
+      "type": "string",
+      "pattern": "^/"
+    },
+    "tlsSkipVerify": {
+      "description": "Optional - whether 'https' and 'tls' probes accept any server certificate. When false, the certificate must chain to 'caBundle' or a system authority and name the probed host. Defaults to true, unless 'caBundle' or 'caBundlePath' is specified.",
+      "type": "boolean"
+    },
+    "tlsServerName": {
+      "description": "Optional - name 'https' and 'tls' probes send in the TLS handshake through SNI instead of the probed host, e.g. the virtual host whose certificate the application serves. The server certificate must name it unless 'tlsSkipVerify' is true.",
+      "type": "string",
+      "pattern": "^[A-Za-z0-9]([A-Za-z0-9.-]*[A-Za-z0-9])?$"
+    },
+    "reportCertificateExpiry": {
+      "description": "Optional - when true, the expiry of the server certificate of 'https' and 'tls' probes is reported in the 'AppHealthCertificateExpiry' substatus, e.g. 'localhost:443=2026-12-01T00:00:00Z (47 days)'.",
+      "type": "boolean"
+    },
+    "reportProbeLatency": {
+      "description": "Optional - when true, the round-trip time of the latest probe of each target and its average over the latest 10 probes are reported in the 'AppHealthProbeLatency' substatus, e.g. 'localhost:80 last=12ms average=15ms'.",
+      "type": "boolean"
+    },
+    "certificateExpiryThresholdInDays": {
+      "description": "Optional - the application is unhealthy when the server certificate of 'https' and 'tls' probes expires in fewer days, so that failures to rotate it surface before it expires.",
+      "type": "integer",
+      "minimum": 1,
+      "maximum": 365
+    },
+    "requestHeaders": {
+      "description": "Optional - headers sent with the requests of 'http' and 'https' probes, e.g. an API key required by the health endpoint. The 'Host' header is set by 'hostHeader'.",
+      "type": "object",
+      "patternProperties": {
+        "^[!#$%&'*+.^_\u0060|~0-9A-Za-z-]+$": { "type": "string" }
+      },
+      "additionalProperties": false
+    },
+    "hostHeader": {
+      "description": "Optional - Host header of the requests of 'http' and 'https' probes, e.g. the virtual host a reverse proxy routes health checks by. The probed address is still dialed. Unlike 'tlsServerName', it is not sent in the TLS handshake.",
+      "type": "string",
+      "pattern": "^[^\\s/]+$"
+    },
+    "followRedirects": {
+      "description": "Optional - whether 'http' and 'https' probes follow redirects and check the status code of the final response. By default, the status code of the redirect response is checked, so a 3xx code can be listed in 'expectedStatusCodes'.",
+      "type": "boolean"
+    },
+    "maxRedirects": {
+      "description": "Optional - how many redirects are followed when 'followRedirects' is true. The application is unhealthy when more are needed. Defaults to 10.",
+      "type": "integer",
+      "minimum": 1,
+      "maximum": 20
+    },
+    "httpMethod": {
+      "description": "Optional - method of the requests of 'http' and 'https' probes. Defaults to 'GET'.",
+      "type": "string",
+      "enum": ["GET", "HEAD", "POST"]
+    },
+    "requestBody": {
+      "description": "Optional - body sent with the requests of 'http' and 'https' probes when 'httpMethod' is 'POST'.",
+      "type": "string"
+    },
+    "expectedStatusCodes": {
+      "description": "Optional - status codes of the responses of 'http' and 'https' probes of a healthy application, given as codes, e.g. 204, or ranges, e.g. '200-299'. Defaults to 200.",
+      "type": "array",
+      "items": {
+        "oneOf": [
+          { "type": "integer", "minimum": 100, "maximum": 599 },
+          { "type": "string", "pattern": "^[1-5][0-9][0-9]-[1-5][0-9][0-9]$" }
+        ]
+      },
+      "minItems": 1
+    },
+    "responseBodySchema": {
+      "description": "Optional - JSON Schema the response body of 'http' and 'https' probes is validated against. A response with an expected status code whose body does not match is unhealthy.",
+      "type": "object"
+    },
+    "responseBodyRegex": {
+      "description": "Optional - regular expression, in the RE2 syntax, the response body of 'http' and 'https' probes must match, e.g. 'status.*UP'. A response with an expected status code whose body does not match is unhealthy.",
+      "type": "string",
+      "minLength": 1
+    },
+    "responseJsonPath": {
+      "description": "Optional - JSONPath, e.g. '$.components.db.status', of the value of the JSON response body of 'http' and 'https' probes which must equal 'expectedValue'. Only member names and array indexes are supported. A response with an expected status code whose value differs is unhealthy.",
+      "type": "string",
+      "pattern": "^\\$"
+    },
+    "expectedValue": {
+      "description": "Required when 'responseJsonPath' is specified - value expected at 'responseJsonPath', e.g. 'UP'.",
+      "type": ["string", "number", "boolean", "null"]
+    },
+    "allowedTargets": {
+      "description": "Optional - CIDRs, IP addresses and hostnames probes may connect to. Loopback addresses are always allowed. When specified, connections to any other address are refused.",
+      "type": "array",
+      "items": {
+        "type": "string",
+        "minLength": 1
+      },
+      "uniqueItems": true
+    },
+    "addressPolicy": {
+      "description": "Optional - how probes connect to a target resolving to several addresses: 'any' tries them in turn until one accepts the connection, 'all' requires every address to accept it, 'first' only connects to the first address. The address connected to is logged and reported in the 'AppHealthProbeAddresses' substatus. By default the choice is left to the system.",
+      "type": "string",
+      "enum": ["any", "all", "first"]
+    },
+    "pureGoResolver": {
+      "description": "Optional - when true, names are resolved by the built-in Go resolver instead of the system resolver (glibc NSS).",
+      "type": "boolean"
+    },
+    "ipVersion": {
+      "description": "Optional - IP version probes connect with: '4', '6', or 'any' to connect to the first address accepting the connection. Use '6' on IPv6-only networks so that probes do not depend on IPv4 addresses. Defaults to 'any'.",
+      "type": "string",
+      "enum": ["any", "4", "6"]
+    },
+    "proxyUrl": {
+      "description": "Optional - URL of the proxy the requests of 'http' and 'https' probes are sent through, e.g. 'http://10.0.0.4:3128'. Requests to localhost are proxied too. When 'allowedTargets' is specified, it must allow the proxy.",
+      "type": "string",
+      "pattern": "^https?://"
+    },
+    "proxyFromEnvironment": {
+      "description": "Optional - when true, the requests of 'http' and 'https' probes are sent through the proxy given by the HTTP_PROXY, HTTPS_PROXY and NO_PROXY environment variables of the extension. Requests to localhost are never proxied.",
+      "type": "boolean"
+    },
+    "restartOnResourceLeak": {
+      "description": "Optional - when true, the probe loop restarts itself when the goroutines, file descriptors or heap it holds keep growing over its baseline.",
+      "type": "boolean"
+    },
+    "reportVmMetadata": {
+      "description": "Optional - when true, the VM ID, scale set name, instance ID, region and zone queried from the Instance Metadata Service are reported in the 'AppHealthVMMetadata' substatus. They are always attached to the extension logs.",
+      "type": "boolean"
+    },
+    "provisioningGate": {
+      "description": "Optional - when true, enable reports 'transitioning' until the application is found healthy for the first time and fails if that does not happen before the gate timeout.",
+      "type": "boolean"
+    },
+    "provisioningGateTimeoutInSeconds": {
+      "description": "Optional - how long the provisioning gate waits for the first healthy evaluation. Defaults to 600 seconds.",
+      "type": "integer",
+      "minimum": 1,
+      "maximum": 900
+    },
+    "asyncEnable": {
+      "description": "Optional - when true, enable validates the settings, starts the probe loop as a detached background process and returns immediately.",
+      "type": "boolean"
+    },
+    "gracePeriodInSeconds": {
+      "description": "Optional - time after the probe loop starts during which the application is reported initializing rather than unhealthy, until found healthy. Unhealthy probe results during the grace period do not count towards 'numberOfProbes'. Defaults to no grace period.",
+      "type": "integer",
+      "minimum": 1,
+      "maximum": 14400
+    },
+    "excludeGracePeriodProbes": {
+      "description": "Optional - when true, probes executed during the grace period are recorded in the probe history but do not count towards 'numberOfProbes', which starts counting fresh when the grace period ends. A healthy result still ends the initializing state.",
+      "type": "boolean"
+    },
+    "passthrough": {
+      "description": "Optional - when true, every probe result is reported immediately as is, bypassing 'numberOfProbes' and the grace period. For users smoothing the health signal downstream.",
+      "type": "boolean"
+    },
+    "transitionCooldownInSeconds": {
+      "description": "Optional - minimum time between two changes of the health state reported in the 'AppHealthStatus' substatus. Changes within the cooldown are coalesced and the latest state is reported when it ends. Every change is still logged and recorded in the probe history.",
+      "type": "integer",
+      "minimum": 1,
+      "maximum": 3600
+    },
+    "persistState": {
+      "description": "Optional - when true, the derived health state, the consecutive probe counters and the grace period progress are saved and restored when the probe loop restarts, e.g. after a reboot, instead of starting over healthy.",
+      "type": "boolean"
+    },
+    "persistedStateMaxAgeInSeconds": {
+      "description": "Optional - age after which the persisted state is discarded and the probe loop starts over. By default the persisted state never expires.",
+      "type": "integer",
+      "minimum": 1,
+      "maximum": 2592000
+    },
+    "locale": {
+      "description": "Optional - language tag (e.g. 'fr-FR') of the status messages translated in 'messageCatalog'. The others are reported in 'en'. Defaults to 'en'.",
+      "type": "string",
+      "pattern": "^[a-zA-Z]{2,3}(-[a-zA-Z0-9]{2,8})*$"
+    },
+    "messageCatalog": {
+      "description": "Optional - translations of the status messages in 'locale'. Messages not translated are reported in English.",
+      "type": "object",
+      "properties": {
+        "polling": { "type": "string" },
+        "waitingForHealthy": { "type": "string" },
+        "healthy": { "type": "string" },
+        "unhealthy": { "type": "string" },
+        "degraded": { "type": "string" },
+        "initializing": { "type": "string" },
+        "unknown": { "type": "string" },
+        "ready": { "type": "string" },
+        "notReady": { "type": "string" },
+        "probingStopped": { "type": "string" }
+      },
+      "additionalProperties": false
+    },
+    "substatusName": {
+      "description": "Optional - name of the application health substatus. Defaults to 'AppHealthStatus'.",
+      "type": "string",
+      "minLength": 1
+    },
+    "additionalSubstatusNames": {
+      "description": "Optional - additional names the application health substatus is also reported under.",
+      "type": "array",
+      "items": {
+        "type": "string",
+        "minLength": 1
+      },
+      "uniqueItems": true
+    },
+    "suppressSubstatus": {
+      "description": "Optional - when true, no substatus is reported.",
+      "type": "boolean"
+    },
+    "maxMessageLength": {
+      "description": "Optional - maximum length of status and substatus messages. Longer messages are truncated in the middle. Defaults to 2048.",
+      "type": "integer",
+      "minimum": 64,
+      "maximum": 32768
+    },
+    "statusHeartbeatInSeconds": {
+      "description": "Optional - the status file is only rewritten when the status changes, or once this period elapsed since it was last written. Defaults to 60.",
+      "type": "integer",
+      "minimum": 1,
+      "maximum": 3600
+    },
+    "minStatusWriteIntervalInSeconds": {
+      "description": "Optional - minimum time between two writes of the status file. A status changing sooner is held and only the latest one is written once the time elapsed. Defaults to 5.",
+      "type": "integer",
+      "minimum": 1,
+      "maximum": 300
+    },
+    "statusFormatVersion": {
+      "description": "Optional - version of the status structure to emit. 1 is the legacy structure with a single application health substatus, 2 (default) adds the extension metrics substatus and custom-named substatuses.",
+      "type": "integer",
+      "enum": [1, 2]
+    },
+    "logLevel": {
+      "description": "Optional - verbosity of the extension log: 'error', 'info' (default) or 'debug', which adds the details of every probe request and response and the time taken by the DNS lookup, connection, TLS handshake and first response byte of http probes. The APPHEALTH_LOG_LEVEL environment variable takes precedence.",
+      "type": "string",
+      "enum": ["error", "info", "debug"]
+    },
+    "logRotation": {
+      "description": "Optional - limits of the extension log written to /var/log/azure/applicationhealth-extension/handler.log. The log is rotated to handler.log.1 once it reaches its maximum size.",
+      "type": "object",
+      "properties": {
+        "maxSizeInMB": {
+          "description": "Optional - size the log is rotated at, defaults to 10.",
+          "type": "integer",
+          "minimum": 1,
+          "maximum": 1024
+        },
+        "maxFiles": {
+          "description": "Optional - number of rotated logs kept, defaults to 5.",
+          "type": "integer",
+          "minimum": 1,
+          "maximum": 100
+        }
+      },
+      "additionalProperties": false
+    },
+    "syslog": {
+      "description": "Optional - mirror the changes of the health state and the errors of the extension log to syslog, and so journald, with the identifier 'applicationhealth-extension'. Errors are logged with priority err, changes to unhealthy with warning and other changes with notice.",
+      "type": "boolean"
+    },
+    "applications": {
+      "description": "Optional - applications monitored independently of each other, each with its own probe and state reported in its own substatus. Cannot be used together with the top level probe settings.",
+      "type": "array",
+      "minItems": 1,
+      "items": {
+        "type": "object",
+        "properties": {
+          "name": {
+            "description": "Required - name of the application.",
+            "type": "string",
+            "minLength": 1
+          },
+          "protocol": {
+            "description": "Required - can be 'tcp', 'udp', 'http', 'https', 'tls', 'grpc', 'icmp', 'dns', 'exec', 'file', 'systemd', 'docker' or 'process'.",
+            "type": "string",
+            "enum": ["tcp", "udp", "http", "https", "tls", "grpc", "icmp", "dns", "exec", "file", "systemd", "docker", "process"]
+          },
+          "host": {
+            "description": "Optional - hostname or IP address the probe connects to. Defaults to 'localhost'.",
+            "type": "string",
+            "pattern": "^[0-9A-Za-z.:%-]+$"
+          },
+          "port": {
+            "description": "Required when the protocol is 'tcp', 'udp', 'tls' or 'grpc'. Optional when the protocol is 'http', 'https' or 'dns'.",
+            "type": "integer",
+            "minimum": 1,
+            "maximum": 65535
+          },
+          "requestPath": {
+            "description": "Path on which the web request should be sent. Required when the protocol is 'http' or 'https'.",
+            "type": "string"
+          },
+          "udpPayload": {
+            "description": "Required when the protocol is 'udp' - base64 encoded datagram sent by the probe.",
+            "type": "string",
+            "pattern": "^[A-Za-z0-9+/]*={0,2}$"
+          },
+          "udpExpectedResponse": {
+            "description": "Optional - base64 encoded bytes the response to 'udpPayload' must contain.",
+            "type": "string",
+            "pattern": "^[A-Za-z0-9+/]*={0,2}$"
+          },
+          "icmpAddress": {
+            "description": "Required when the protocol is 'icmp' - hostname or IP address pinged by the probe.",
+            "type": "string",
+            "minLength": 1
+          },
+          "icmpCount": {
+            "description": "Optional - number of ICMP echo requests sent by each probe. Defaults to 3.",
+            "type": "integer",
+            "minimum": 1,
+            "maximum": 10
+          },
+          "icmpTimeoutInMilliseconds": {
+            "description": "Optional - how long the reply to each ICMP echo request is waited for. Defaults to 1000.",
+            "type": "integer",
+            "minimum": 10,
+            "maximum": 10000
+          },
+          "dnsName": {
+            "description": "Required when the protocol is 'dns' - name resolved by the probe against the DNS server at 'host' and 'port'.",
+            "type": "string",
+            "minLength": 1
+          },
+          "grpcService": {
+            "description": "Optional - service checked when the protocol is 'grpc'. Defaults to the overall health of the server.",
+            "type": "string"
+          },
+          "command": {
+            "description": "Required when the protocol is 'exec' - absolute path of the executable followed by its arguments.",
+            "type": "array",
+            "minItems": 1,
+            "items": {
+              "type": "string",
+              "minLength": 1
+            }
+          },
+          "runAsUser": {
+            "description": "Optional - name of the user the command runs as.",
+            "type": "string",
+            "pattern": "^[a-z_][a-z0-9_.-]*\\$?$"
+          },
+          "commandEnvironment": {
+            "description": "Optional - names of the environment variables passed to the command. Defaults to all of them.",
+            "type": "array",
+            "items": {
+              "type": "string",
+              "pattern": "^[A-Za-z_][A-Za-z0-9_]*$"
+            }
+          },
+          "captureCommandOutput": {
+            "description": "Optional - when true, the end of the output of the last failed run of the command is reported in the AppHealthCommandOutput substatus.",
+            "type": "boolean"
+          },
+          "passiveListenCheck": {
+            "description": "Optional - when true, the 'tcp' probe checks that a socket listens on the port without connecting to it.",
+            "type": "boolean"
+          },
+          "pidFile": {
+            "description": "Optional when the protocol is 'process' - absolute path of the pid file of the daemon.",
+            "type": "string",
+            "pattern": "^/"
+          },
+          "processPattern": {
+            "description": "Optional when the protocol is 'process' - regular expression matched against the command line of the running processes.",
+            "type": "string",
+            "minLength": 1
+          },
+          "containerName": {
+            "description": "Required when the protocol is 'docker' - name or ID of the container whose state is checked.",
+            "type": "string",
+            "pattern": "^/?[0-9A-Za-z][0-9A-Za-z_.-]*$"
+          },
+          "dockerSocket": {
+            "description": "Optional - absolute path of the unix socket of the Docker Engine API. Defaults to '/var/run/docker.sock'.",
+            "type": "string",
+            "pattern": "^/"
+          },
+          "systemdUnit": {
+            "description": "Required when the protocol is 'systemd' - name of the systemd unit whose state is checked.",
+            "type": "string",
+            "pattern": "^[0-9A-Za-z:_.@\\\\-]+$"
+          },
+          "filePath": {
+            "description": "Required when the protocol is 'file' - absolute path of the heartbeat file checked by the probe.",
+            "type": "string",
+            "pattern": "^/"
+          },
+          "fileMaxAgeInSeconds": {
+            "description": "Optional - time since the last modification of 'filePath' after which the probe is unhealthy.",
+            "type": "integer",
+            "minimum": 1,
+            "maximum": 86400
+          },
+          "systemdSocket": {
+            "description": "Optional - name of a systemd socket unit whose listening port is probed.",
+            "type": "string",
+            "pattern": "^[^/]+\\.socket$"
+          },
+          "portFile": {
+            "description": "Optional - absolute path of a file the application writes its listening port into.",
+            "type": "string",
+            "pattern": "^/"
+          },
+          "unixSocketPath": {
+            "description": "Optional - absolute path of a unix socket probes connect to instead of a TCP port.",
+            "type": "string",
+            "pattern": "^/"
+          },
+          "offsetInMilliseconds": {
+            "description": "Optional - delay of the probe of the application after the start of each probe interval, to spread the probes of several applications over the interval. Must be less than the interval.",
+            "type": "integer",
+            "minimum": 0,
+            "maximum": 3600000
+          },
+          "substatusName": {
+            "description": "Optional - name of the substatus the application health is reported in. Defaults to the application name.",
+            "type": "string",
+            "minLength": 1
+          },
+          "gracePeriodInSeconds": {
+            "description": "Optional - overrides the top level 'gracePeriodInSeconds' for this application, e.g. for one slower to start than the others.",
+            "type": "integer",
+            "minimum": 1,
+            "maximum": 14400
+          }
+        },
+        "required": ["name", "protocol"],
+        "additionalProperties": false
+      }
+    },
+    "probes": {
+      "description": "Optional - probes of several local services, e.g. a web server, a worker and a cache, whose health is aggregated according to 'aggregation' into the application health. Unlike 'applications', their health is not reported in substatuses of their own. Cannot be used together with 'applications' or the top level probe settings. The top level options of the requests of 'http' and 'https' probes, e.g. 'requestHeaders', are defaults for the 'http' and 'https' probes only.",
+      "type": "array",
+      "minItems": 1,
+      "items": {
+        "type": "object",
+        "properties": {
+          "name": {
+            "description": "Optional - name of the probe in logs and the probe history. Defaults to 'probe <position>', e.g. 'probe 1'.",
+            "type": "string",
+            "minLength": 1
+          },
+          "protocol": {
+            "description": "Required - can be 'tcp', 'udp', 'http', 'https', 'tls', 'grpc', 'icmp', 'dns', 'exec', 'file', 'systemd', 'docker' or 'process'.",
+            "type": "string",
+            "enum": ["tcp", "udp", "http", "https", "tls", "grpc", "icmp", "dns", "exec", "file", "systemd", "docker", "process"]
+          },
+          "host": {
+            "description": "Optional - hostname or IP address the probe connects to. Defaults to 'localhost'.",
+            "type": "string",
+            "pattern": "^[0-9A-Za-z.:%-]+$"
+          },
+          "port": {
+            "description": "Required when the protocol is 'tcp', 'udp', 'tls' or 'grpc'. Optional when the protocol is 'http', 'https' or 'dns'.",
+            "type": "integer",
+            "minimum": 1,
+            "maximum": 65535
+          },
+          "requestPath": {
+            "description": "Path on which the web request should be sent. Required when the protocol is 'http' or 'https'.",
+            "type": "string"
+          },
+          "udpPayload": {
+            "description": "Required when the protocol is 'udp' - base64 encoded datagram sent by the probe.",
+            "type": "string",
+            "pattern": "^[A-Za-z0-9+/]*={0,2}$"
+          },
+          "udpExpectedResponse": {
+            "description": "Optional - base64 encoded bytes the response to 'udpPayload' must contain.",
+            "type": "string",
+            "pattern": "^[A-Za-z0-9+/]*={0,2}$"
+          },
+          "icmpAddress": {
+            "description": "Required when the protocol is 'icmp' - hostname or IP address pinged by the probe.",
+            "type": "string",
+            "minLength": 1
+          },
+          "icmpCount": {
+            "description": "Optional - number of ICMP echo requests sent by each probe. Defaults to 3.",
+            "type": "integer",
+            "minimum": 1,
+            "maximum": 10
+          },
+          "icmpTimeoutInMilliseconds": {
+            "description": "Optional - how long the reply to each ICMP echo request is waited for. Defaults to 1000.",
+            "type": "integer",
+            "minimum": 10,
+            "maximum": 10000
+          },
+          "dnsName": {
+            "description": "Required when the protocol is 'dns' - name resolved by the probe against the DNS server at 'host' and 'port'.",
+            "type": "string",
+            "minLength": 1
+          },
+          "grpcService": {
+            "description": "Optional - service checked when the protocol is 'grpc'. Defaults to the overall health of the server.",
+            "type": "string"
+          },
+          "command": {
+            "description": "Required when the protocol is 'exec' - absolute path of the executable followed by its arguments.",
+            "type": "array",
+            "minItems": 1,
+            "items": {
+              "type": "string",
+              "minLength": 1
+            }
+          },
+          "runAsUser": {
+            "description": "Optional - name of the user the command runs as.",
+            "type": "string",
+            "pattern": "^[a-z_][a-z0-9_.-]*\\$?$"
+          },
+          "commandEnvironment": {
+            "description": "Optional - names of the environment variables passed to the command. Defaults to all of them.",
+            "type": "array",
+            "items": {
+              "type": "string",
+              "pattern": "^[A-Za-z_][A-Za-z0-9_]*$"
+            }
+          },
+          "captureCommandOutput": {
+            "description": "Optional - when true, the end of the output of the last failed run of the command is reported in the AppHealthCommandOutput substatus.",
+            "type": "boolean"
+          },
+          "passiveListenCheck": {
+            "description": "Optional - when true, the 'tcp' probe checks that a socket listens on the port without connecting to it.",
+            "type": "boolean"
+          },
+          "pidFile": {
+            "description": "Optional when the protocol is 'process' - absolute path of the pid file of the daemon.",
+            "type": "string",
+            "pattern": "^/"
+          },
+          "processPattern": {
+            "description": "Optional when the protocol is 'process' - regular expression matched against the command line of the running processes.",
+            "type": "string",
+            "minLength": 1
+          },
+          "containerName": {
+            "description": "Required when the protocol is 'docker' - name or ID of the container whose state is checked.",
+            "type": "string",
+            "pattern": "^/?[0-9A-Za-z][0-9A-Za-z_.-]*$"
+          },
+          "dockerSocket": {
+            "description": "Optional - absolute path of the unix socket of the Docker Engine API. Defaults to '/var/run/docker.sock'.",
+            "type": "string",
+            "pattern": "^/"
+          },
+          "systemdUnit": {
+            "description": "Required when the protocol is 'systemd' - name of the systemd unit whose state is checked.",
+            "type": "string",
+            "pattern": "^[0-9A-Za-z:_.@\\\\-]+$"
+          },
+          "filePath": {
+            "description": "Required when the protocol is 'file' - absolute path of the heartbeat file checked by the probe.",
+            "type": "string",
+            "pattern": "^/"
+          },
+          "fileMaxAgeInSeconds": {
+            "description": "Optional - time since the last modification of 'filePath' after which the probe is unhealthy.",
+            "type": "integer",
+            "minimum": 1,
+            "maximum": 86400
+          },
+          "systemdSocket": {
+            "description": "Optional - name of a systemd socket unit whose listening port is probed.",
+            "type": "string",
+            "pattern": "^[^/]+\\.socket$"
+          },
+          "portFile": {
+            "description": "Optional - absolute path of a file the application writes its listening port into.",
+            "type": "string",
+            "pattern": "^/"
+          },
+          "unixSocketPath": {
+            "description": "Optional - absolute path of a unix socket probes connect to instead of a TCP port.",
+            "type": "string",
+            "pattern": "^/"
+          },
+          "requestHeaders": {
+            "description": "Optional - overrides the top level 'requestHeaders' for this 'http' or 'https' probe.",
+            "type": "object",
+            "patternProperties": {
+              "^[!#$%&'*+.^_\u0060|~0-9A-Za-z-]+$": { "type": "string" }
+            },
+            "additionalProperties": false
+          },
+          "hostHeader": {
+            "description": "Optional - overrides the top level 'hostHeader' for this 'http' or 'https' probe.",
+            "type": "string",
+            "pattern": "^[^\\s/]+$"
+          },
+          "followRedirects": {
+            "description": "Optional - overrides the top level 'followRedirects' for this 'http' or 'https' probe.",
+            "type": "boolean"
+          },
+          "maxRedirects": {
+            "description": "Optional - overrides the top level 'maxRedirects' for this 'http' or 'https' probe.",
+            "type": "integer",
+            "minimum": 1,
+            "maximum": 20
+          },
+          "httpMethod": {
+            "description": "Optional - overrides the top level 'httpMethod' for this 'http' or 'https' probe.",
+            "type": "string",
+            "enum": ["GET", "HEAD", "POST"]
+          },
+          "requestBody": {
+            "description": "Optional - overrides the top level 'requestBody' for this 'http' or 'https' probe.",
+            "type": "string"
+          },
+          "expectedStatusCodes": {
+            "description": "Optional - overrides the top level 'expectedStatusCodes' for this 'http' or 'https' probe.",
+            "type": "array",
+            "items": {
+              "oneOf": [
+                { "type": "integer", "minimum": 100, "maximum": 599 },
+                { "type": "string", "pattern": "^[1-5][0-9][0-9]-[1-5][0-9][0-9]$" }
+              ]
+            },
+            "minItems": 1
+          },
+          "responseBodySchema": {
+            "description": "Optional - overrides the top level 'responseBodySchema' for this 'http' or 'https' probe.",
+            "type": "object"
+          },
+          "responseBodyRegex": {
+            "description": "Optional - overrides the top level 'responseBodyRegex' for this 'http' or 'https' probe.",
+            "type": "string",
+            "minLength": 1
+          },
+          "responseJsonPath": {
+            "description": "Optional - overrides the top level 'responseJsonPath' for this 'http' or 'https' probe.",
+            "type": "string",
+            "pattern": "^\\$"
+          },
+          "expectedValue": {
+            "description": "Required when 'responseJsonPath' is specified for this probe - value expected at 'responseJsonPath'.",
+            "type": ["string", "number", "boolean", "null"]
+          },
+          "offsetInMilliseconds": {
+            "description": "Optional - delay of the probe after the start of each probe interval, to spread the probes over the interval. Must be less than the interval.",
+            "type": "integer",
+            "minimum": 0,
+            "maximum": 3600000
+          },
+          "weight": {
+            "description": "Optional - weight of the probe in the health score when 'aggregation' is 'weighted'. Defaults to 1.",
+            "type": "integer",
+            "minimum": 1,
+            "maximum": 1000
+          },
+          "probeTimeoutInSeconds": {
+            "description": "Optional - overrides the top level 'probeTimeoutInSeconds' for this probe.",
+            "type": "integer",
+            "minimum": 1,
+            "maximum": 60
+          },
+          "numberOfProbes": {
+            "description": "Optional - overrides the top level 'numberOfProbes' for this probe.",
+            "type": "integer",
+            "minimum": 1,
+            "maximum": 24
+          },
+          "healthyThreshold": {
+            "description": "Optional - overrides the top level 'healthyThreshold' for this probe.",
+            "type": "integer",
+            "minimum": 1,
+            "maximum": 24
+          },
+          "intervalInSeconds": {
+            "description": "Optional - overrides the top level 'intervalInSeconds' for this probe, which is then probed every 'intervalInSeconds' rather than at every interval. Cannot be shorter than the top level 'intervalInSeconds'.",
+            "type": "integer",
+            "minimum": 5,
+            "maximum": 60
+          },
+          "gracePeriodInSeconds": {
+            "description": "Optional - overrides the top level 'gracePeriodInSeconds' for this probe.",
+            "type": "integer",
+            "minimum": 1,
+            "maximum": 14400
+          }
+        },
+        "required": ["protocol"],
+        "additionalProperties": false
+      }
+    },
+    "readinessProbe": {
+      "description": "Optional - probe telling whether the application is ready to receive traffic, reported in the 'AppReadinessStatus' substatus apart from the application health. Cannot be used together with 'applications'.",
+      "type": "object",
+      "properties": {
+        "protocol": {
+          "description": "Required - can be 'tcp', 'udp', 'http', 'https', 'tls', 'grpc', 'icmp', 'dns', 'exec', 'file', 'systemd', 'docker' or 'process'.",
+          "type": "string",
+          "enum": ["tcp", "udp", "http", "https", "tls", "grpc", "icmp", "dns", "exec", "file", "systemd", "docker", "process"]
+        },
+        "host": {
+          "description": "Optional - hostname or IP address the probe connects to. Defaults to 'localhost'.",
+          "type": "string",
+          "pattern": "^[0-9A-Za-z.:%-]+$"
+        },
+        "port": {
+          "description": "Required when the protocol is 'tcp', 'udp', 'tls' or 'grpc'. Optional when the protocol is 'http', 'https' or 'dns'.",
+          "type": "integer",
+          "minimum": 1,
+          "maximum": 65535
+        },
+        "requestPath": {
+          "description": "Path on which the web request should be sent. Required when the protocol is 'http' or 'https'.",
+          "type": "string"
+        },
+        "udpPayload": {
+          "description": "Required when the protocol is 'udp' - base64 encoded datagram sent by the probe.",
+          "type": "string",
+          "pattern": "^[A-Za-z0-9+/]*={0,2}$"
+        },
+        "udpExpectedResponse": {
+          "description": "Optional - base64 encoded bytes the response to 'udpPayload' must contain.",
+          "type": "string",
+          "pattern": "^[A-Za-z0-9+/]*={0,2}$"
+        },
+        "icmpAddress": {
+          "description": "Required when the protocol is 'icmp' - hostname or IP address pinged by the probe.",
+          "type": "string",
+          "minLength": 1
+        },
+        "icmpCount": {
+          "description": "Optional - number of ICMP echo requests sent by each probe. Defaults to 3.",
+          "type": "integer",
+          "minimum": 1,
+          "maximum": 10
+        },
+        "icmpTimeoutInMilliseconds": {
+          "description": "Optional - how long the reply to each ICMP echo request is waited for. Defaults to 1000.",
+          "type": "integer",
+          "minimum": 10,
+          "maximum": 10000
+        },
+        "dnsName": {
+          "description": "Required when the protocol is 'dns' - name resolved by the probe against the DNS server at 'host' and 'port'.",
+          "type": "string",
+          "minLength": 1
+        },
+        "grpcService": {
+          "description": "Optional - service checked when the protocol is 'grpc'. Defaults to the overall health of the server.",
+          "type": "string"
+        },
+        "command": {
+          "description": "Required when the protocol is 'exec' - absolute path of the executable followed by its arguments.",
+          "type": "array",
+          "minItems": 1,
+          "items": {
+            "type": "string",
+            "minLength": 1
+          }
+        },
+        "runAsUser": {
+          "description": "Optional - name of the user the command runs as.",
+          "type": "string",
+          "pattern": "^[a-z_][a-z0-9_.-]*\\$?$"
+        },
+        "commandEnvironment": {
+          "description": "Optional - names of the environment variables passed to the command. Defaults to all of them.",
+          "type": "array",
+          "items": {
+            "type": "string",
+            "pattern": "^[A-Za-z_][A-Za-z0-9_]*$"
+          }
+        },
+        "captureCommandOutput": {
+          "description": "Optional - when true, the end of the output of the last failed run of the command is reported in the AppHealthCommandOutput substatus.",
+          "type": "boolean"
+        },
+        "passiveListenCheck": {
+          "description": "Optional - when true, the 'tcp' probe checks that a socket listens on the port without connecting to it.",
+          "type": "boolean"
+        },
+        "pidFile": {
+          "description": "Optional when the protocol is 'process' - absolute path of the pid file of the daemon.",
+          "type": "string",
+          "pattern": "^/"
+        },
+        "processPattern": {
+          "description": "Optional when the protocol is 'process' - regular expression matched against the command line of the running processes.",
+          "type": "string",
+          "minLength": 1
+        },
+        "containerName": {
+          "description": "Required when the protocol is 'docker' - name or ID of the container whose state is checked.",
+          "type": "string",
+          "pattern": "^/?[0-9A-Za-z][0-9A-Za-z_.-]*$"
+        },
+        "dockerSocket": {
+          "description": "Optional - absolute path of the unix socket of the Docker Engine API. Defaults to '/var/run/docker.sock'.",
+          "type": "string",
+          "pattern": "^/"
+        },
+        "systemdUnit": {
+          "description": "Required when the protocol is 'systemd' - name of the systemd unit whose state is checked.",
+          "type": "string",
+          "pattern": "^[0-9A-Za-z:_.@\\\\-]+$"
+        },
+        "filePath": {
+          "description": "Required when the protocol is 'file' - absolute path of the heartbeat file checked by the probe.",
+          "type": "string",
+          "pattern": "^/"
+        },
+        "fileMaxAgeInSeconds": {
+          "description": "Optional - time since the last modification of 'filePath' after which the probe is unhealthy.",
+          "type": "integer",
+          "minimum": 1,
+          "maximum": 86400
+        },
+        "systemdSocket": {
+          "description": "Optional - name of a systemd socket unit whose listening port is probed.",
+          "type": "string",
+          "pattern": "^[^/]+\\.socket$"
+        },
+        "portFile": {
+          "description": "Optional - absolute path of a file the application writes its listening port into.",
+          "type": "string",
+          "pattern": "^/"
+        },
+        "unixSocketPath": {
+          "description": "Optional - absolute path of a unix socket probes connect to instead of a TCP port.",
+          "type": "string",
+          "pattern": "^/"
+        },
+        "offsetInMilliseconds": {
+          "description": "Optional - delay of the readiness probe after the start of each probe interval. Must be less than the interval.",
+          "type": "integer",
+          "minimum": 0,
+          "maximum": 3600000
+        }
+      },
+      "required": ["protocol"],
+      "additionalProperties": false
+    },
+    "applicationsPolicy": {
+      "description": "Optional - 'all' (default) reports the VM healthy when every application is healthy, 'any' when at least one application is healthy.",
+      "type": "string",
+      "enum": ["all", "any"]
+    },
+    "aggregation": {
+      "description": "Optional - 'all' (default) reports the VM healthy when every probe of 'probes' is healthy, 'any' when at least one is healthy, 'weighted' when the weights of the healthy probes reach 'healthyScoreThreshold' percent of the total weight.",
+      "type": "string",
+      "enum": ["all", "any", "weighted"]
+    },
+    "healthyScoreThreshold": {
+      "description": "Required when 'aggregation' is 'weighted' - percentage of the total weight of the probes that must be healthy for the VM to be reported healthy.",
+      "type": "integer",
+      "minimum": 1,
+      "maximum": 100
+    },
+    "onUnhealthyCommand": {
+      "description": "Optional - command run in the background whenever the application becomes unhealthy, e.g. to collect logs or restart a service, given as the absolute path of the executable followed by its arguments. The previous and new states are passed in the APPHEALTH_OLD_STATE and APPHEALTH_NEW_STATE environment variables. It is killed after 5 minutes.",
+      "type": "array",
+      "minItems": 1,
+      "items": {
+        "type": "string",
+        "minLength": 1
+      }
+    },
+    "onHealthyCommand": {
+      "description": "Optional - command run in the background whenever the application becomes healthy again after being unhealthy, unknown or initializing, like 'onUnhealthyCommand'.",
+      "type": "array",
+      "minItems": 1,
+      "items": {
+        "type": "string",
+        "minLength": 1
+      }
+    },
+    "notification": {
+      "description": "Optional - notifications sent whenever the health state of the application changes.",
+      "type": "object",
+      "properties": {
+        "webhookUrl": {
+          "description": "Required - http or https URL a JSON object with 'oldState', 'newState', 'timestamp' and 'vmName' is posted to on every health state transition. Notifications are delivered in order, and dropped if the webhook fails.",
+          "type": "string",
+          "pattern": "^https?://[^\\s]+$"
+        }
+      },
+      "required": ["webhookUrl"],
+      "additionalProperties": false
+    },
+    "applicationInsights": {
+      "description": "Optional - Application Insights resource the availability of the application and its health state transitions are pushed to, as availability results named 'ApplicationHealth' and 'HealthStateChanged' custom events.",
+      "type": "object",
+      "properties": {
+        "connectionString": {
+          "description": "Required - connection string of the Application Insights resource, containing at least its 'InstrumentationKey'.",
+          "type": "string",
+          "minLength": 1
+        }
+      },
+      "required": ["connectionString"],
+      "additionalProperties": false
+    },
+    "adminApi": {
+      "description": "Optional - HTTP API listening on the loopback interface only, returning the current health state, the latest probe results, the effective configuration and the uptime of the probe loop as a JSON object on 'GET /'. The values of protected settings are redacted.",
+      "type": "object",
+      "properties": {
+        "port": {
+          "description": "Required - port on 127.0.0.1 the API listens on.",
+          "type": "integer",
+          "minimum": 1,
+          "maximum": 65535
+        },
+        "historySize": {
+          "description": "Optional - number of latest probe results returned, defaults to 20.",
+          "type": "integer",
+          "minimum": 1,
+          "maximum": 100
+        }
+      },
+      "required": ["port"],
+      "additionalProperties": false
+    },
+    "systemChecks": {
+      "description": "Optional - checks of the resources of the VM run alongside the probe. While any check fails, an application found healthy is reported degraded.",
+      "type": "object",
+      "properties": {
+        "maxCpuPercent": {
+          "description": "Optional - the check fails when the CPU usage of the VM averaged since the previous probe exceeds this percentage.",
+          "type": "integer",
+          "minimum": 1,
+          "maximum": 100
+        },
+        "minAvailableMemoryInMB": {
+          "description": "Optional - the check fails when the memory available to start new applications without swapping is below this size.",
+          "type": "integer",
+          "minimum": 1
+        },
+        "maxPressurePercent": {
+          "description": "Optional - the check fails when the share of time some tasks stalled on CPU, memory or IO in the last 10 seconds exceeds this percentage. Ignored on kernels without pressure stall information.",
+          "type": "integer",
+          "minimum": 1,
+          "maximum": 100
+        }
+      },
+      "minProperties": 1,
+      "additionalProperties": false
+    },
+    "faultInjection": {
+      "description": "Debug only - injects artificial probe failures, timeouts and latency to rehearse the handling of an unhealthy application. Requires 'allowFaultInjection' in the protected settings. Never use in production.",
+      "type": "object",
+      "properties": {
+        "failureRate": {
+          "description": "Fraction of probes (0 to 1) reported unhealthy without being executed.",
+          "type": "number",
+          "minimum": 0,
+          "maximum": 1
+        },
+        "timeoutRate": {
+          "description": "Fraction of probes (0 to 1) that hang for the probe timeout and are then reported unhealthy.",
+          "type": "number",
+          "minimum": 0,
+          "maximum": 1
+        },
+        "latencyInMilliseconds": {
+          "description": "Delay added before every probe.",
+          "type": "integer",
+          "minimum": 0,
+          "maximum": 60000
+        }
+      },
+      "additionalProperties": false
     }
   },
   "additionalProperties": false
@@ -39,6 +1221,77 @@ const (
   "title": "Application Health - Protected Settings",
   "type": "object",
   "properties": {
+    "sshPrivateKey": {
+      "description": "Optional - PEM or OpenSSH encoded private key to log in to the 'sshTunnel' relay with.",
+      "type": "string",
+      "minLength": 1
+    },
+    "username": {
+      "description": "Optional - user name 'http' and 'https' probes authenticate with using basic auth.",
+      "type": "string",
+      "minLength": 1,
+      "pattern": "^[^:]*$"
+    },
+    "password": {
+      "description": "Required when 'username' is specified - password 'http' and 'https' probes authenticate with using basic auth.",
+      "type": "string",
+      "minLength": 1
+    },
+    "bearerToken": {
+      "description": "Optional - static bearer token sent in the Authorization header of the requests of 'http' and 'https' probes.",
+      "type": "string",
+      "minLength": 1
+    },
+    "oauth2": {
+      "description": "Optional - OAuth2 client credentials grant the bearer token of the requests of 'http' and 'https' probes is requested with. The token is cached and requested again before it expires.",
+      "type": "object",
+      "properties": {
+        "tokenUrl": {
+          "description": "Required - token endpoint, e.g. 'https://login.microsoftonline.com/<tenant>/oauth2/v2.0/token'.",
+          "type": "string",
+          "pattern": "^https?://"
+        },
+        "clientId": {
+          "description": "Required - client identifier.",
+          "type": "string",
+          "minLength": 1
+        },
+        "clientSecret": {
+          "description": "Required - client secret.",
+          "type": "string",
+          "minLength": 1
+        },
+        "scope": {
+          "description": "Optional - scope requested, e.g. 'api://app/.default'.",
+          "type": "string"
+        },
+        "resource": {
+          "description": "Optional - resource the token is requested for by token endpoints not supporting scopes, e.g. the v1 endpoint of Azure Active Directory.",
+          "type": "string"
+        }
+      },
+      "required": ["tokenUrl", "clientId", "clientSecret"],
+      "additionalProperties": false
+    },
+    "clientCertificate": {
+      "description": "Optional - PEM encoded certificate 'https' and 'tls' probes present to complete mutual TLS handshakes. Intermediate certificates can follow it.",
+      "type": "string",
+      "minLength": 1
+    },
+    "clientKey": {
+      "description": "Required when 'clientCertificate' is specified - PEM encoded private key of 'clientCertificate'.",
+      "type": "string",
+      "minLength": 1
+    },
+    "clientCertificateThumbprint": {
+      "description": "Optional - SHA-1 thumbprint of a certificate deployed to the VM by the guest agent, presented by 'https' and 'tls' probes instead of 'clientCertificate'.",
+      "type": "string",
+      "pattern": "^[0-9A-Fa-f]{40}$"
+    },
+    "allowFaultInjection": {
+      "description": "Optional - allows the 'faultInjection' public setting, so that faults cannot be injected by whoever can only change the public settings.",
+      "type": "boolean"
+    }
   },
   "additionalProperties": false
 }`
@@ -0,0 +1,136 @@
+package main
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os/exec"
+	"path/filepath"
+
+	"github.com/Azure/azure-docker-extension/pkg/vmextension"
+	"github.com/pkg/errors"
+)
+
+const (
+	settingsFileSuffix = ".settings"
+)
+
+type handlerSettingsFile struct {
+	RuntimeSettings []struct {
+		HandlerSettings runtimeHandlerSettings `json:"handlerSettings"`
+	} `json:"runtimeSettings"`
+}
+
+type runtimeHandlerSettings struct {
+	PublicSettings          map[string]interface{} `json:"publicSettings"`
+	ProtectedSettingsBase64 string                 `json:"protectedSettings"`
+	SettingsCertThumbprint  string                 `json:"protectedSettingsCertThumbprint"`
+}
+
+// readSettingsFile locates the .settings file with the highest sequence number
+// in configFolder and returns the public settings JSON and the protected
+// settings JSON, decrypted with the handler certificates.
+func readSettingsFile(configFolder string) (public, protected map[string]interface{}, _ error) {
+	seq, err := vmextension.FindSeqNumConfig(configFolder)
+	if err != nil {
+		return nil, nil, errors.Wrap(err, "cannot find seqnum")
+	}
+	hs, err := parseHandlerSettingsFile(filepath.Join(configFolder, fmt.Sprintf("%d%s", seq, settingsFileSuffix)))
+	if err != nil {
+		return nil, nil, errors.Wrap(err, "error parsing settings file")
+	}
+
+	public = hs.PublicSettings
+	if hs.ProtectedSettingsBase64 == "" {
+		return public, nil, nil
+	}
+	if hs.SettingsCertThumbprint == "" {
+		return nil, nil, errors.New("HandlerSettings has protected settings but no cert thumbprint")
+	}
+	encrypted, err := base64.StdEncoding.DecodeString(hs.ProtectedSettingsBase64)
+	if err != nil {
+		return nil, nil, errors.Wrap(err, "failed to decode base64 protected settings")
+	}
+
+	// certificates are placed two levels up (/var/lib/waagent)
+	certDir := filepath.Join(configFolder, "..", "..")
+	b, err := decryptProtectedSettings(
+		filepath.Join(certDir, hs.SettingsCertThumbprint+".crt"),
+		filepath.Join(certDir, hs.SettingsCertThumbprint+".prv"),
+		encrypted)
+	if err != nil {
+		return nil, nil, err
+	}
+	if err := json.Unmarshal(b, &protected); err != nil {
+		return nil, nil, errors.Wrap(err, "failed to unmarshal decrypted settings json")
+	}
+	return public, protected, nil
+}
+
+// parseHandlerSettingsFile parses a handler settings file (e.g. 0.settings).
+func parseHandlerSettingsFile(path string) (h runtimeHandlerSettings, _ error) {
+	b, err := ioutil.ReadFile(path)
+	if err != nil {
+		return h, errors.Wrapf(err, "error reading %s", path)
+	}
+	if len(b) == 0 { // if no config is specified, we get an empty file
+		return h, nil
+	}
+
+	var f handlerSettingsFile
+	if err := json.Unmarshal(b, &f); err != nil {
+		return h, errors.Wrap(err, "error parsing json")
+	}
+	if len(f.RuntimeSettings) != 1 {
+		return h, errors.Errorf("wrong runtimeSettings count. expected:1, got:%d", len(f.RuntimeSettings))
+	}
+	return f.RuntimeSettings[0].HandlerSettings, nil
+}
+
+// decryptProtectedSettings decrypts the DER encoded CMS envelope with the
+// handler certificate and its private key. Unlike 'openssl smime', 'openssl
+// cms' handles EC keys and RSA keys of any size, and the key is read in
+// PKCS#1, PKCS#8 or SEC1 form, PEM or DER encoded. 'openssl smime' is used as
+// a fallback for openssl builds without cms support.
+func decryptProtectedSettings(crt, prv string, encrypted []byte) ([]byte, error) {
+	keyForm, err := privateKeyForm(prv)
+	if err != nil {
+		return nil, err
+	}
+
+	out, cmsErr := runOpenssl(encrypted, "cms", "-decrypt", "-inform", "DER", "-recip", crt, "-inkey", prv, "-keyform", keyForm)
+	if cmsErr == nil {
+		return out, nil
+	}
+	out, err = runOpenssl(encrypted, "smime", "-decrypt", "-inform", "DER", "-recip", crt, "-inkey", prv, "-keyform", keyForm)
+	if err != nil {
+		return nil, errors.Errorf("decrypting protected settings failed: cms: %v; smime: %v", cmsErr, err)
+	}
+	return out, nil
+}
+
+// privateKeyForm returns the openssl key form of the private key file.
+func privateKeyForm(prv string) (string, error) {
+	b, err := ioutil.ReadFile(prv)
+	if err != nil {
+		return "", errors.Wrap(err, "failed to read private key")
+	}
+	if bytes.Contains(b, []byte("-----BEGIN")) {
+		return "PEM", nil
+	}
+	return "DER", nil
+}
+
+func runOpenssl(stdin []byte, args ...string) ([]byte, error) {
+	cmd := exec.Command("openssl", args...)
+	var bOut, bErr bytes.Buffer
+	cmd.Stdin = bytes.NewReader(stdin)
+	cmd.Stdout = &bOut
+	cmd.Stderr = &bErr
+	if err := cmd.Run(); err != nil {
+		return nil, errors.Errorf("error=%v stderr=%s", err, bytes.TrimSpace(bErr.Bytes()))
+	}
+	return bOut.Bytes(), nil
+}
@@ -0,0 +1,131 @@
+package main
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/base64"
+	"encoding/pem"
+	"fmt"
+	"io/ioutil"
+	"math/big"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+// writeHandlerCert writes a self-signed certificate for key as <thumb>.crt and
+// the private key encoded by encodeKey as <thumb>.prv to dir.
+func writeHandlerCert(t *testing.T, dir, thumb string, key crypto.Signer, encodeKey func() []byte) {
+	tmpl := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: "test"},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, key.Public(), key)
+	require.Nil(t, err)
+	crt := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})
+	require.Nil(t, ioutil.WriteFile(filepath.Join(dir, thumb+".crt"), crt, 0600))
+	require.Nil(t, ioutil.WriteFile(filepath.Join(dir, thumb+".prv"), encodeKey(), 0600))
+}
+
+// encryptSettings encrypts b for the certificate like the guest agent does.
+func encryptSettings(t *testing.T, crt string, b []byte) []byte {
+	cmd := exec.Command("openssl", "cms", "-encrypt", "-binary", "-outform", "DER", "-aes256", crt)
+	cmd.Stdin = bytes.NewReader(b)
+	out, err := cmd.Output()
+	require.Nil(t, err)
+	return out
+}
+
+func Test_decryptProtectedSettings_keyFormats(t *testing.T) {
+	if _, err := exec.LookPath("openssl"); err != nil {
+		t.Skip("openssl not available")
+	}
+	dir, err := ioutil.TempDir("", "")
+	require.Nil(t, err)
+	defer os.RemoveAll(dir)
+
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 3072)
+	require.Nil(t, err)
+	ecKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.Nil(t, err)
+
+	for _, c := range []struct {
+		name      string
+		key       crypto.Signer
+		encodeKey func() []byte
+	}{
+		{"rsa-pkcs1", rsaKey, func() []byte {
+			return pem.EncodeToMemory(&pem.Block{Type: "RSA PRIVATE KEY", Bytes: x509.MarshalPKCS1PrivateKey(rsaKey)})
+		}},
+		{"rsa-pkcs8", rsaKey, func() []byte {
+			b, err := x509.MarshalPKCS8PrivateKey(rsaKey)
+			require.Nil(t, err)
+			return pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: b})
+		}},
+		{"ec-pkcs8", ecKey, func() []byte {
+			b, err := x509.MarshalPKCS8PrivateKey(ecKey)
+			require.Nil(t, err)
+			return pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: b})
+		}},
+		{"ec-sec1-der", ecKey, func() []byte {
+			b, err := x509.MarshalECPrivateKey(ecKey)
+			require.Nil(t, err)
+			return b
+		}},
+	} {
+		writeHandlerCert(t, dir, c.name, c.key, c.encodeKey)
+		crt, prv := filepath.Join(dir, c.name+".crt"), filepath.Join(dir, c.name+".prv")
+		encrypted := encryptSettings(t, crt, []byte(`{"secret":"s3cr3t"}`))
+
+		out, err := decryptProtectedSettings(crt, prv, encrypted)
+		require.Nil(t, err, c.name)
+		require.Equal(t, `{"secret":"s3cr3t"}`, string(out), c.name)
+	}
+}
+
+func Test_readSettingsFile(t *testing.T) {
+	if _, err := exec.LookPath("openssl"); err != nil {
+		t.Skip("openssl not available")
+	}
+	dir, err := ioutil.TempDir("", "")
+	require.Nil(t, err)
+	defer os.RemoveAll(dir)
+	configFolder := filepath.Join(dir, "ext", "config")
+	require.Nil(t, os.MkdirAll(configFolder, 0700))
+
+	key, err := ecdsa.GenerateKey(elliptic.P384(), rand.Reader)
+	require.Nil(t, err)
+	writeHandlerCert(t, dir, "THUMB", key, func() []byte {
+		b, err := x509.MarshalPKCS8PrivateKey(key)
+		require.Nil(t, err)
+		return pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: b})
+	})
+	encrypted := encryptSettings(t, filepath.Join(dir, "THUMB.crt"), []byte(`{"secret":"s3cr3t"}`))
+	settings := fmt.Sprintf(`{"runtimeSettings":[{"handlerSettings":{"publicSettings":{"protocol":"tcp","port":80},"protectedSettings":%q,"protectedSettingsCertThumbprint":"THUMB"}}]}`,
+		base64.StdEncoding.EncodeToString(encrypted))
+	require.Nil(t, ioutil.WriteFile(filepath.Join(configFolder, "3.settings"), []byte(settings), 0600))
+
+	public, protected, err := readSettingsFile(configFolder)
+	require.Nil(t, err)
+	require.Equal(t, "tcp", public["protocol"])
+	require.Equal(t, "s3cr3t", protected["secret"])
+
+	// no protected settings
+	require.Nil(t, ioutil.WriteFile(filepath.Join(configFolder, "4.settings"), []byte(`{"runtimeSettings":[{"handlerSettings":{"publicSettings":{"protocol":"http"}}}]}`), 0600))
+	public, protected, err = readSettingsFile(configFolder)
+	require.Nil(t, err)
+	require.Equal(t, "http", public["protocol"])
+	require.Nil(t, protected)
+}
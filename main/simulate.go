@@ -0,0 +1,143 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"time"
+
+	"github.com/Azure/azure-docker-extension/pkg/vmextension"
+	"github.com/go-kit/kit/log"
+	"github.com/pkg/errors"
+)
+
+var (
+	errSimulateUsage = errors.New("usage: simulate <scenario.json>")
+)
+
+// simulationScenario describes probe results to be replayed offline. Results
+// are either listed as states spaced by the probe interval, or as a probe
+// history with timestamps as recorded by the extension.
+type simulationScenario struct {
+	Settings          map[string]interface{} `json:"settings"`
+	IntervalInSeconds int                    `json:"intervalInSeconds"`
+	Results           []HealthStatus         `json:"results"`
+	History           []probeRecord          `json:"history"`
+}
+
+// simulate replays the probe results of the scenario file given as argument
+// through the state machine and prints the derived states and status payloads.
+func simulate(runCtx context.Context, ctx *log.Context, h HandlerEnvironment, seqNum int) (string, error) {
+	if len(os.Args) != 3 {
+		return "", errSimulateUsage
+	}
+	b, err := ioutil.ReadFile(os.Args[2])
+	if err != nil {
+		return "", errors.Wrap(err, "failed to read scenario")
+	}
+	s, err := parseSimulationScenario(b)
+	if err != nil {
+		return "", err
+	}
+	return "", runSimulation(os.Stdout, s)
+}
+
+// parseSimulationScenario parses a scenario object, or a bare probe history
+// array which is replayed with the default settings.
+func parseSimulationScenario(b []byte) (s simulationScenario, _ error) {
+	if bytes.HasPrefix(bytes.TrimSpace(b), []byte("[")) {
+		err := json.Unmarshal(b, &s.History)
+		return s, errors.Wrap(err, "failed to parse probe history")
+	}
+	if err := json.Unmarshal(b, &s); err != nil {
+		return s, errors.Wrap(err, "failed to parse scenario")
+	}
+	if len(s.Results) != 0 && len(s.History) != 0 {
+		return s, errors.New("scenario cannot have both 'results' and 'history'")
+	}
+	return s, nil
+}
+
+// records returns the probe results of the scenario with their timestamps.
+func (s simulationScenario) records(start time.Time, interval time.Duration) ([]probeRecord, error) {
+	records := s.History
+	if len(s.Results) != 0 {
+		if s.IntervalInSeconds > 0 {
+			interval = time.Duration(s.IntervalInSeconds) * time.Second
+		}
+		records = nil
+		for i, r := range s.Results {
+			records = append(records, probeRecord{Time: start.Add(time.Duration(i) * interval), State: r})
+		}
+	}
+	for i, r := range records {
+		if _, ok := healthStatusToStatusType[r.State]; !ok {
+			return nil, errors.Errorf("result #%d: unknown state %q", i, r.State)
+		}
+	}
+	return records, nil
+}
+
+// settings validates and parses the public settings of the scenario.
+func (s simulationScenario) settings() (h handlerSettings, _ error) {
+	if err := validateSettingsSchema(s.Settings, nil); err != nil {
+		return h, errors.Wrap(err, "json validation error")
+	}
+	if err := vmextension.UnmarshalHandlerSettings(s.Settings, nil, &h.publicSettings, &h.protectedSettings); err != nil {
+		return h, errors.Wrap(err, "json parsing error")
+	}
+	if err := h.validate(); err != nil {
+		return h, errors.Wrap(err, "invalid configuration")
+	}
+	if len(h.applications()) != 0 || len(h.probes()) != 0 {
+		return h, errors.New("simulating 'applications' and 'probes' is not supported")
+	}
+	return h, nil
+}
+
+// runSimulation feeds the probe results of the scenario to a monitor and
+// writes the derived state and status payload of every step to w.
+func runSimulation(w io.Writer, s simulationScenario) error {
+	cfg, err := s.settings()
+	if err != nil {
+		return err
+	}
+	records, err := s.records(time.Now().UTC(), cfg.interval())
+	if err != nil {
+		return err
+	}
+	if len(records) == 0 {
+		return errors.New("scenario has no probe results")
+	}
+
+	start := records[0].Time
+	metrics := newExtensionMetrics(start, 0)
+	metrics.configLoaded(start)
+	mon := newMonitor(&cfg, start, metrics)
+
+	var prevState HealthStatus
+	for _, r := range records {
+		offset := r.Time.Sub(start)
+		st, err := mon.observe(r.Time, r.State)
+		if err != nil {
+			fmt.Fprintf(w, "+%s result=%s enable fails: %v\n", offset, r.State, err)
+			return nil
+		}
+
+		changed := ""
+		if st.state != prevState {
+			changed = " (changed)"
+			prevState = st.state
+		}
+		payload, err := json.Marshal(mon.report(st))
+		if err != nil {
+			return errors.Wrap(err, "failed to marshal status")
+		}
+		fmt.Fprintf(w, "+%s result=%s state=%s%s status=%s\n  %s\n", offset, r.State, st.state, changed, st.statusType, payload)
+	}
+	return nil
+}
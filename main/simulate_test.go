@@ -0,0 +1,56 @@
+package main
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func Test_parseSimulationScenario(t *testing.T) {
+	s, err := parseSimulationScenario([]byte(`[{"time": "2017-01-01T00:00:00Z", "state": "healthy"}]`))
+	require.Nil(t, err)
+	require.Len(t, s.History, 1)
+	require.Nil(t, s.Settings)
+
+	s, err = parseSimulationScenario([]byte(`{"settings": {"protocol": "tcp", "port": 80}, "results": ["healthy", "unhealthy"]}`))
+	require.Nil(t, err)
+	require.Equal(t, []HealthStatus{Healthy, Unhealthy}, s.Results)
+
+	_, err = parseSimulationScenario([]byte(`{"results": ["healthy"], "history": [{"state": "healthy"}]}`))
+	require.NotNil(t, err)
+}
+
+func Test_runSimulation(t *testing.T) {
+	s, err := parseSimulationScenario([]byte(`{
+		"settings": {"provisioningGate": true},
+		"intervalInSeconds": 10,
+		"results": ["unhealthy", "healthy", "healthy", "unhealthy"]
+	}`))
+	require.Nil(t, err)
+
+	var out bytes.Buffer
+	require.Nil(t, runSimulation(&out, s))
+
+	lines := strings.Split(strings.TrimSpace(out.String()), "\n")
+	require.Len(t, lines, 8) // a state line and a payload line per result
+	require.Equal(t, "+0s result=unhealthy state=unhealthy (changed) status=transitioning", lines[0])
+	require.Equal(t, "+10s result=healthy state=healthy (changed) status=success", lines[2])
+	require.Equal(t, "+20s result=healthy state=healthy status=success", lines[4])
+	require.Equal(t, "+30s result=unhealthy state=unhealthy (changed) status=success", lines[6])
+	require.Contains(t, lines[7], "Application found to be unhealthy")
+}
+
+func Test_runSimulation_invalid(t *testing.T) {
+	err := runSimulation(&bytes.Buffer{}, simulationScenario{Settings: map[string]interface{}{"alien": 1}, Results: []HealthStatus{Healthy}})
+	require.NotNil(t, err)
+	require.Contains(t, err.Error(), "json validation error")
+
+	err = runSimulation(&bytes.Buffer{}, simulationScenario{Results: []HealthStatus{"sick"}})
+	require.NotNil(t, err)
+	require.Contains(t, err.Error(), `unknown state "sick"`)
+
+	err = runSimulation(&bytes.Buffer{}, simulationScenario{})
+	require.NotNil(t, err)
+}
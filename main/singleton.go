@@ -0,0 +1,76 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"syscall"
+	"time"
+
+	"github.com/go-kit/kit/log"
+	"github.com/pkg/errors"
+)
+
+const (
+	// probeLoopLockFile is the file under dataRoot locked by the running
+	// probe loop, so that a single loop of any version probes and reports at
+	// a time.
+	probeLoopLockFile = dataDirName + "-probeloop.lock"
+)
+
+var (
+	errProbeLoopRunning = errors.New("another probe loop is still running")
+)
+
+// probeLoopLockPath returns the path of the lock file of the probe loop.
+func probeLoopLockPath() string {
+	return filepath.Join(dataRoot, probeLoopLockFile)
+}
+
+// tryLock takes the exclusive lock of f, or returns false if it is held.
+func tryLock(f *os.File) (bool, error) {
+	err := syscall.Flock(int(f.Fd()), syscall.LOCK_EX|syscall.LOCK_NB)
+	if err == syscall.EWOULDBLOCK {
+		return false, nil
+	}
+	return err == nil, err
+}
+
+// lockProbeLoop takes the lock of the probe loop at lockPath, held until the
+// returned file is closed or the process exits. The loop holding it already
+// is stopped through its pid file at pidPath for the new one to take over,
+// waiting for it at most timeout.
+func lockProbeLoop(ctx *log.Context, lockPath, pidPath string, timeout time.Duration) (*os.File, error) {
+	f, err := os.OpenFile(lockPath, os.O_RDWR|os.O_CREATE, 0600)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to open lock file")
+	}
+	if ok, err := tryLock(f); ok || err != nil {
+		if err != nil {
+			f.Close()
+			return nil, errors.Wrap(err, "failed to lock")
+		}
+		return f, nil
+	}
+
+	ctx.Log("event", "another probe loop is running, taking over")
+	if pid, ok := readPidFile(pidPath); ok && pid != os.Getpid() {
+		if _, err := stopProbeLoop(ctx, pidPath, procDir); err != nil {
+			f.Close()
+			return nil, err
+		}
+	}
+	for deadline := time.Now().Add(timeout); ; time.Sleep(stopPollInterval) {
+		ok, err := tryLock(f)
+		if err != nil {
+			f.Close()
+			return nil, errors.Wrap(err, "failed to lock")
+		}
+		if ok {
+			return f, nil
+		}
+		if !time.Now().Before(deadline) {
+			f.Close()
+			return nil, errProbeLoopRunning
+		}
+	}
+}
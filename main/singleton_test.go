@@ -0,0 +1,40 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/go-kit/kit/log"
+	"github.com/stretchr/testify/require"
+)
+
+func Test_lockProbeLoop(t *testing.T) {
+	dir, err := ioutil.TempDir("", "")
+	require.Nil(t, err)
+	defer os.RemoveAll(dir)
+	ctx := log.NewContext(log.NewNopLogger())
+	lockPath, pidPath := filepath.Join(dir, probeLoopLockFile), filepath.Join(dir, probeLoopPidFile)
+
+	first, err := lockProbeLoop(ctx, lockPath, pidPath, time.Second)
+	require.Nil(t, err)
+
+	// the holder cannot be stopped, e.g. its pid file is gone
+	_, err = lockProbeLoop(ctx, lockPath, pidPath, 200*time.Millisecond)
+	require.Equal(t, errProbeLoopRunning, err)
+
+	// the holder terminates while waiting
+	time.AfterFunc(200*time.Millisecond, func() { first.Close() })
+	second, err := lockProbeLoop(ctx, lockPath, pidPath, 5*time.Second)
+	require.Nil(t, err)
+	second.Close()
+}
+
+func Test_probeLoopPaths(t *testing.T) {
+	// shared by all versions, so that an update takes over from the loop of
+	// the previous version
+	require.Equal(t, dataRoot, filepath.Dir(probeLoopLockPath()))
+	require.Equal(t, dataRoot, filepath.Dir(probeLoopPidPath()))
+}
@@ -0,0 +1,204 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+const (
+	defaultSshPort = 22
+
+	// sshTunnelSettle is how long a new tunnel connection is watched for the
+	// ssh client exiting because the target could not be connected.
+	sshTunnelSettle = time.Second
+
+	// sshControlPersist keeps the ssh master connection open between probes so
+	// that every probe does not go through a full ssh handshake.
+	sshControlPersist = 60 * time.Second
+
+	sshKeyFile        = "ssh-tunnel.key"
+	sshKnownHostsFile = "ssh-tunnel.known_hosts"
+)
+
+var (
+	errSshTunnelRequiresKey    = errors.New("'sshPrivateKey' must be specified in protected settings when using 'sshTunnel'")
+	errSshKeyRequiresTunnel    = errors.New("'sshPrivateKey' cannot be specified unless 'sshTunnel' is configured")
+	errSshTunnelHostNotAllowed = errors.New("'sshTunnel' host is not in 'allowedTargets'")
+	errSshTunnelWithPortSource = errors.New("'sshTunnel' cannot be used together with 'systemdSocket', 'portFile' or 'unixSocketPath', which refer to this VM")
+
+	// sshCommand is the ssh client executable.
+	sshCommand = "ssh"
+)
+
+// sshTunnelSettings configure the ssh relay probes are tunneled through.
+type sshTunnelSettings struct {
+	Host          string `json:"host"`
+	Port          int    `json:"port,int"`
+	User          string `json:"user"`
+	HostPublicKey string `json:"hostPublicKey"`
+}
+
+// sshTunnel connects probes to their target through an ssh relay, using the
+// system ssh client to forward the connection (ssh -W). The target address is
+// resolved by the relay, so 'localhost' is the relay itself.
+type sshTunnel struct {
+	settings   sshTunnelSettings
+	keyFile    string
+	knownHosts string
+	dir        string
+}
+
+// newSshTunnel writes the private key and the host key of the relay to dir
+// and returns the tunnel.
+func newSshTunnel(s sshTunnelSettings, privateKey, dir string) (*sshTunnel, error) {
+	if s.Port == 0 {
+		s.Port = defaultSshPort
+	}
+	t := &sshTunnel{
+		settings:   s,
+		keyFile:    filepath.Join(dir, sshKeyFile),
+		knownHosts: filepath.Join(dir, sshKnownHostsFile),
+		dir:        dir,
+	}
+	if !strings.HasSuffix(privateKey, "\n") {
+		privateKey += "\n" // ssh rejects keys without final newline
+	}
+	if err := ioutil.WriteFile(t.keyFile, []byte(privateKey), 0600); err != nil {
+		return nil, errors.Wrap(err, "failed to write ssh private key")
+	}
+	if err := ioutil.WriteFile(t.knownHosts, []byte(t.knownHostsLine()), 0600); err != nil {
+		return nil, errors.Wrap(err, "failed to write ssh known hosts")
+	}
+	return t, nil
+}
+
+// knownHostsLine returns the known_hosts entry pinning the host key of the
+// relay.
+func (t *sshTunnel) knownHostsLine() string {
+	host := t.settings.Host
+	if t.settings.Port != defaultSshPort {
+		host = fmt.Sprintf("[%s]:%d", host, t.settings.Port)
+	}
+	return host + " " + strings.TrimSpace(t.settings.HostPublicKey) + "\n"
+}
+
+// args returns the arguments of the ssh client forwarding to target.
+func (t *sshTunnel) args(target string, timeout time.Duration) []string {
+	return []string{
+		"-i", t.keyFile,
+		"-p", strconv.Itoa(t.settings.Port),
+		"-o", "BatchMode=yes",
+		"-o", "IdentitiesOnly=yes",
+		"-o", "StrictHostKeyChecking=yes",
+		"-o", "UserKnownHostsFile=" + t.knownHosts,
+		"-o", "ControlMaster=auto",
+		"-o", "ControlPath=" + filepath.Join(t.dir, "ssh-%C"),
+		"-o", fmt.Sprintf("ControlPersist=%d", int(sshControlPersist/time.Second)),
+		"-o", fmt.Sprintf("ConnectTimeout=%d", int(timeout/time.Second)+1),
+		"-W", target,
+		t.settings.User + "@" + t.settings.Host,
+	}
+}
+
+// dialContext connects to addr through the relay. The connection is only
+// returned once the ssh client did not fail within sshTunnelSettle, so that
+// a target refusing the connection is told apart from a healthy one.
+func (t *sshTunnel) dialContext(ctx context.Context, network, addr string) (net.Conn, error) {
+	timeout := defaultProbeTimeout
+	if d, ok := ctx.Deadline(); ok {
+		timeout = time.Until(d)
+	}
+
+	inR, inW, err := os.Pipe()
+	if err != nil {
+		return nil, err
+	}
+	outR, outW, err := os.Pipe()
+	if err != nil {
+		inR.Close()
+		inW.Close()
+		return nil, err
+	}
+	var stderr bytes.Buffer
+	cmd := exec.Command(sshCommand, t.args(addr, timeout)...)
+	cmd.Stdin, cmd.Stdout, cmd.Stderr = inR, outW, &stderr
+	err = cmd.Start()
+	inR.Close()
+	outW.Close()
+	if err != nil {
+		inW.Close()
+		outR.Close()
+		return nil, errors.Wrap(err, "failed to start ssh")
+	}
+
+	c := &sshConn{cmd: cmd, in: inW, out: outR, exited: make(chan struct{})}
+	go func() {
+		c.waitErr = cmd.Wait()
+		close(c.exited)
+	}()
+
+	select {
+	case <-c.exited:
+		c.Close()
+		return nil, errors.Errorf("ssh tunnel to %s failed: %v: %s", addr, c.waitErr, bytes.TrimSpace(stderr.Bytes()))
+	case <-ctx.Done():
+		c.Close()
+		return nil, ctx.Err()
+	case <-time.After(sshTunnelSettle):
+		return c, nil
+	}
+}
+
+// sshConn is a connection forwarded through the stdin and stdout of an ssh
+// client process.
+type sshConn struct {
+	cmd     *exec.Cmd
+	in      *os.File
+	out     *os.File
+	exited  chan struct{}
+	waitErr error
+	once    sync.Once
+}
+
+func (c *sshConn) Read(b []byte) (int, error)  { return c.out.Read(b) }
+func (c *sshConn) Write(b []byte) (int, error) { return c.in.Write(b) }
+
+func (c *sshConn) Close() error {
+	c.once.Do(func() {
+		c.in.Close()
+		c.out.Close()
+		c.cmd.Process.Kill()
+		<-c.exited
+	})
+	return nil
+}
+
+func (c *sshConn) LocalAddr() net.Addr  { return sshAddr{} }
+func (c *sshConn) RemoteAddr() net.Addr { return sshAddr{} }
+
+func (c *sshConn) SetDeadline(t time.Time) error {
+	if err := c.in.SetWriteDeadline(t); err != nil {
+		return err
+	}
+	return c.out.SetReadDeadline(t)
+}
+
+func (c *sshConn) SetReadDeadline(t time.Time) error  { return c.out.SetReadDeadline(t) }
+func (c *sshConn) SetWriteDeadline(t time.Time) error { return c.in.SetWriteDeadline(t) }
+
+type sshAddr struct{}
+
+func (sshAddr) Network() string { return "ssh" }
+func (sshAddr) String() string  { return "ssh" }
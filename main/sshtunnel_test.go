@@ -0,0 +1,72 @@
+package main
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func Test_sshTunnel_files(t *testing.T) {
+	dir, err := ioutil.TempDir("", "")
+	require.Nil(t, err)
+	defer os.RemoveAll(dir)
+
+	tun, err := newSshTunnel(sshTunnelSettings{Host: "relay", User: "probe", HostPublicKey: "ssh-ed25519 AAAAC3Nz"}, "KEY", dir)
+	require.Nil(t, err)
+	b, err := ioutil.ReadFile(tun.knownHosts)
+	require.Nil(t, err)
+	require.Equal(t, "relay ssh-ed25519 AAAAC3Nz\n", string(b))
+	fi, err := os.Stat(tun.keyFile)
+	require.Nil(t, err)
+	require.Equal(t, os.FileMode(0600), fi.Mode().Perm())
+
+	tun, err = newSshTunnel(sshTunnelSettings{Host: "10.0.0.4", Port: 2222, User: "probe", HostPublicKey: "ssh-ed25519 AAAAC3Nz"}, "KEY", dir)
+	require.Nil(t, err)
+	require.Equal(t, "[10.0.0.4]:2222 ssh-ed25519 AAAAC3Nz\n", tun.knownHostsLine())
+	args := tun.args("localhost:8080", 30*time.Second)
+	require.Equal(t, []string{"-W", "localhost:8080", "probe@10.0.0.4"}, args[len(args)-3:])
+}
+
+// fakeSsh replaces the ssh client with a shell script for the test.
+func fakeSsh(t *testing.T, dir, script string) func() {
+	path := filepath.Join(dir, "ssh")
+	require.Nil(t, ioutil.WriteFile(path, []byte("#!/bin/sh\n"+script+"\n"), 0700))
+	prev := sshCommand
+	sshCommand = path
+	return func() { sshCommand = prev }
+}
+
+func Test_sshTunnel_dialContext(t *testing.T) {
+	dir, err := ioutil.TempDir("", "")
+	require.Nil(t, err)
+	defer os.RemoveAll(dir)
+	tun, err := newSshTunnel(sshTunnelSettings{Host: "relay", User: "probe", HostPublicKey: "ssh-ed25519 AAAA"}, "KEY", dir)
+	require.Nil(t, err)
+
+	// forwarded connection echoes back
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	restore := fakeSsh(t, dir, "exec cat")
+	conn, err := tun.dialContext(ctx, "tcp", "localhost:8080")
+	require.Nil(t, err)
+	_, err = conn.Write([]byte("ping"))
+	require.Nil(t, err)
+	b := make([]byte, 4)
+	require.Nil(t, conn.SetReadDeadline(time.Now().Add(5*time.Second)))
+	_, err = conn.Read(b)
+	require.Nil(t, err)
+	require.Equal(t, "ping", string(b))
+	require.Nil(t, conn.Close())
+	restore()
+
+	// target refuses the connection
+	defer fakeSsh(t, dir, "echo 'channel 0: open failed: connect failed: Connection refused' >&2; exit 255")()
+	_, err = tun.dialContext(ctx, "tcp", "localhost:8080")
+	require.NotNil(t, err)
+	require.Contains(t, err.Error(), "Connection refused")
+}
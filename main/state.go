@@ -0,0 +1,143 @@
+package main
+
+import (
+	"time"
+)
+
+const (
+	// defaultNumberOfProbes is the number of consecutive probe results
+	// contradicting the current state required to change the state.
+	defaultNumberOfProbes = 1
+
+	// defaultHealthyThreshold is the number of consecutive healthy probe
+	// results required to recover from an unhealthy or unknown state.
+	defaultHealthyThreshold = 1
+
+	// probeHistorySize is the number of most recent probe results kept.
+	probeHistorySize = 100
+)
+
+// probeRecord is a single probe result kept in the probe history.
+type probeRecord struct {
+	Time  time.Time    `json:"time"`
+	State HealthStatus `json:"state"`
+
+	// Counted tells whether the result counted towards numberOfProbes.
+	Counted bool `json:"counted"`
+
+	// Application is the name of the application probed, if applications
+	// are configured.
+	Application string `json:"application,omitempty"`
+}
+
+// healthStateMachine derives the reported health state from the individual
+// probe results: the state changes to unhealthy or unknown only after
+// numberOfProbes consecutive results contradicting it, and never during the
+// grace period. It recovers from those to healthy only after healthyThreshold
+// consecutive healthy results. Otherwise a single healthy or degraded result
+// changes the state immediately. With a grace period, the state is
+// initializing until the first healthy result, or until numberOfProbes failures
+// after the end of the grace period.
+type healthStateMachine struct {
+	numberOfProbes     int
+	healthyThreshold   int
+	graceEnd           time.Time
+	excludeGraceProbes bool // probes in grace period are not counted
+	passthrough        bool // every result is reported as is
+
+	state       HealthStatus // "" until the first state is derived
+	consecutive int          // consecutive counted results contradicting state
+	healthy     int          // consecutive counted healthy results
+	graceOver   bool
+	history     []probeRecord
+}
+
+func newHealthStateMachine(cfg *handlerSettings, now time.Time) *healthStateMachine {
+	m := &healthStateMachine{
+		numberOfProbes:     cfg.numberOfProbes(),
+		healthyThreshold:   cfg.healthyThreshold(),
+		graceEnd:           now.Add(cfg.gracePeriod()),
+		excludeGraceProbes: cfg.excludeGracePeriodProbes(),
+		passthrough:        cfg.passthrough(),
+	}
+	if !m.passthrough && m.inGracePeriod(now) {
+		m.state = Initializing
+	}
+	return m
+}
+
+// inGracePeriod reports whether the grace period is still running at now.
+func (m *healthStateMachine) inGracePeriod(now time.Time) bool {
+	return now.Before(m.graceEnd)
+}
+
+// observe records the probe result made at now and returns the derived state.
+func (m *healthStateMachine) observe(now time.Time, result HealthStatus) HealthStatus {
+	if m.passthrough {
+		// no smoothing at all; thresholds and grace period do not apply
+		m.record(probeRecord{Time: now, State: result})
+		m.state = result
+		return result
+	}
+
+	inGrace := m.inGracePeriod(now)
+	if !inGrace && !m.graceOver {
+		m.graceOver = true
+		if m.excludeGraceProbes {
+			// counting starts fresh once the grace period is over
+			m.consecutive = 0
+		}
+	}
+
+	counted := !(inGrace && m.excludeGraceProbes)
+	m.record(probeRecord{Time: now, State: result, Counted: counted})
+	if !counted {
+		if result == Healthy && m.state == Initializing {
+			// still ends initializing, only the counting is excluded
+			m.state = Healthy
+		}
+		return m.current()
+	}
+
+	if result == Healthy {
+		m.healthy++
+	} else {
+		m.healthy = 0
+	}
+
+	if result == m.state {
+		m.consecutive = 0
+		return m.current()
+	}
+	if inGrace && (result == Unhealthy || result == Unknown) {
+		// the application is not held accountable during the grace period
+		return m.current()
+	}
+	m.consecutive++
+
+	if (result == Unhealthy || result == Unknown) && m.consecutive < m.numberOfProbes {
+		return m.current()
+	}
+	if result == Healthy && (m.state == Unhealthy || m.state == Unknown) && m.healthy < m.healthyThreshold {
+		return m.current()
+	}
+	m.state = result
+	m.consecutive = 0
+	return m.current()
+}
+
+// current returns the derived state. Until a state is derived the application
+// is given the benefit of the doubt and considered healthy.
+func (m *healthStateMachine) current() HealthStatus {
+	if m.state == "" {
+		return Healthy
+	}
+	return m.state
+}
+
+func (m *healthStateMachine) record(r probeRecord) {
+	m.history = append(m.history, r)
+	if over := len(m.history) - probeHistorySize; over > 0 {
+		m.history = append([]probeRecord(nil), m.history[over:]...)
+	}
+}
@@ -0,0 +1,175 @@
+package main
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func observeAll(m *healthStateMachine, start time.Time, interval time.Duration, results ...HealthStatus) []HealthStatus {
+	var out []HealthStatus
+	for i, r := range results {
+		out = append(out, m.observe(start.Add(time.Duration(i)*interval), r))
+	}
+	return out
+}
+
+func Test_healthStateMachine_defaults(t *testing.T) {
+	now := time.Now()
+	m := newHealthStateMachine(&handlerSettings{}, now)
+
+	require.Equal(t, []HealthStatus{Unhealthy, Healthy, Unhealthy},
+		observeAll(m, now, time.Second, Unhealthy, Healthy, Unhealthy))
+}
+
+func Test_newHealthStateMachine_numberOfProbes(t *testing.T) {
+	now := time.Now()
+	m := newHealthStateMachine(&handlerSettings{publicSettings: publicSettings{NumberOfProbes: 2}}, now)
+
+	require.Equal(t, []HealthStatus{Healthy, Healthy, Unhealthy},
+		observeAll(m, now, time.Second, Healthy, Unhealthy, Unhealthy))
+}
+
+func Test_healthStateMachine_numberOfProbes(t *testing.T) {
+	now := time.Now()
+	m := &healthStateMachine{numberOfProbes: 3}
+
+	require.Equal(t, []HealthStatus{Healthy, Healthy, Healthy, Unhealthy, Healthy, Healthy, Healthy, Healthy},
+		observeAll(m, now, time.Second, Healthy, Unhealthy, Unhealthy, Unhealthy, Healthy, Unhealthy, Unhealthy, Healthy))
+}
+
+func Test_healthStateMachine_gracePeriodNotCounted(t *testing.T) {
+	now := time.Now()
+	m := &healthStateMachine{numberOfProbes: 2, graceEnd: now.Add(12 * time.Second)}
+
+	// unhealthy results during the grace period neither count nor change
+	// the state, so numberOfProbes results after the grace period flip it
+	require.Equal(t, []HealthStatus{Healthy, Healthy, Healthy, Healthy, Unhealthy},
+		observeAll(m, now, 5*time.Second, Healthy, Unhealthy, Unhealthy, Unhealthy, Unhealthy))
+}
+
+func Test_healthStateMachine_gracePeriodExcluded(t *testing.T) {
+	now := time.Now()
+	m := &healthStateMachine{numberOfProbes: 2, graceEnd: now.Add(12 * time.Second), excludeGraceProbes: true}
+
+	// counting starts fresh after the grace period
+	require.Equal(t, []HealthStatus{Healthy, Healthy, Healthy, Healthy, Unhealthy},
+		observeAll(m, now, 5*time.Second, Unhealthy, Unhealthy, Unhealthy, Unhealthy, Unhealthy))
+
+	require.Len(t, m.history, 5)
+	require.False(t, m.history[0].Counted)
+	require.False(t, m.history[2].Counted)
+	require.True(t, m.history[3].Counted)
+	require.True(t, m.history[4].Counted)
+}
+
+func Test_healthStateMachine_historyBounded(t *testing.T) {
+	now := time.Now()
+	m := &healthStateMachine{numberOfProbes: 1}
+	for i := 0; i < probeHistorySize+10; i++ {
+		m.observe(now.Add(time.Duration(i)*time.Second), Healthy)
+	}
+	require.Len(t, m.history, probeHistorySize)
+	require.Equal(t, now.Add(10*time.Second), m.history[0].Time)
+}
+
+func Test_healthStateMachine_passthrough(t *testing.T) {
+	now := time.Now()
+	m := &healthStateMachine{numberOfProbes: 3, graceEnd: now.Add(time.Hour), passthrough: true}
+
+	require.Equal(t, []HealthStatus{Unhealthy, Healthy, Unhealthy},
+		observeAll(m, now, time.Second, Unhealthy, Healthy, Unhealthy))
+	require.Len(t, m.history, 3)
+}
+
+func Test_healthStateMachine_degraded(t *testing.T) {
+	now := time.Now()
+	m := &healthStateMachine{numberOfProbes: 2}
+
+	// degraded is not held back like unhealthy, and does not count towards it
+	require.Equal(t, []HealthStatus{Degraded, Degraded, Unhealthy, Degraded, Healthy},
+		observeAll(m, now, time.Second, Degraded, Unhealthy, Unhealthy, Degraded, Healthy))
+}
+
+func Test_healthStateMachine_initializing(t *testing.T) {
+	now := time.Now()
+	m := &healthStateMachine{numberOfProbes: 3, graceEnd: now.Add(12 * time.Second), state: Initializing}
+
+	// initializing until found healthy, then held back as usual
+	require.Equal(t, []HealthStatus{Initializing, Initializing, Healthy, Healthy},
+		observeAll(m, now, 5*time.Second, Unhealthy, Unhealthy, Healthy, Unhealthy))
+
+	// an application not found healthy in the grace period is unhealthy
+	// after numberOfProbes failures past it
+	m = &healthStateMachine{numberOfProbes: 3, graceEnd: now.Add(12 * time.Second), state: Initializing}
+	require.Equal(t, []HealthStatus{Initializing, Initializing, Initializing, Initializing, Initializing, Unhealthy},
+		observeAll(m, now, 5*time.Second, Unhealthy, Unhealthy, Unhealthy, Unhealthy, Unhealthy, Unhealthy))
+}
+
+func Test_healthStateMachine_unknown(t *testing.T) {
+	now := time.Now()
+	m := &healthStateMachine{numberOfProbes: 2}
+
+	// held back like unhealthy, and counted together with it
+	require.Equal(t, []HealthStatus{Healthy, Healthy, Unknown, Unknown, Unhealthy, Healthy},
+		observeAll(m, now, time.Second, Healthy, Unknown, Unknown, Unhealthy, Unhealthy, Healthy))
+}
+
+func Test_healthStateMachine_healthyThreshold(t *testing.T) {
+	now := time.Now()
+	m := &healthStateMachine{numberOfProbes: 1, healthyThreshold: 3}
+
+	// the first healthy result is not a recovery
+	require.Equal(t, []HealthStatus{Healthy, Unhealthy, Unhealthy, Unhealthy, Unhealthy, Unhealthy, Unhealthy, Unhealthy},
+		observeAll(m, now, time.Second, Healthy, Unhealthy, Healthy, Healthy, Unhealthy, Healthy, Healthy, Unhealthy))
+	m.observe(now.Add(8*time.Second), Healthy)
+	m.observe(now.Add(9*time.Second), Healthy)
+	require.Equal(t, Healthy, m.observe(now.Add(10*time.Second), Healthy))
+
+	// a degraded application recovers immediately
+	m = &healthStateMachine{numberOfProbes: 1, healthyThreshold: 3}
+	require.Equal(t, []HealthStatus{Degraded, Healthy},
+		observeAll(m, now, time.Second, Degraded, Healthy))
+}
+
+func Test_newHealthStateMachine_gracePeriod(t *testing.T) {
+	now := time.Now()
+	cfg := &handlerSettings{publicSettings: publicSettings{GracePeriodInSeconds: 12, NumberOfProbes: 2}}
+	m := newHealthStateMachine(cfg, now)
+
+	require.Equal(t, Initializing, m.current())
+	require.Equal(t, []HealthStatus{Initializing, Initializing, Initializing, Initializing, Unhealthy},
+		observeAll(m, now, 5*time.Second, Unhealthy, Unhealthy, Unhealthy, Unhealthy, Unhealthy))
+
+	// failures within the grace period do not count towards numberOfProbes
+	m = newHealthStateMachine(cfg, now)
+	require.Equal(t, []HealthStatus{Initializing, Initializing},
+		observeAll(m, now.Add(10*time.Second), 5*time.Second, Unhealthy, Unhealthy))
+
+	m = newHealthStateMachine(cfg, now)
+	require.Equal(t, []HealthStatus{Initializing, Healthy, Healthy},
+		observeAll(m, now, 5*time.Second, Unhealthy, Healthy, Unhealthy))
+}
+
+func Test_excludeGracePeriodProbes_settings(t *testing.T) {
+	now := time.Now()
+	observe := func(settings string, results ...HealthStatus) []HealthStatus {
+		cfg := parseTestSettings(t, settings)
+		m := newMonitor(&cfg, now, newExtensionMetrics(now, 0))
+		var out []HealthStatus
+		for i, r := range results {
+			st, err := m.observe(now.Add(time.Duration(i)*5*time.Second), r)
+			require.Nil(t, err)
+			out = append(out, st.state)
+		}
+		return out
+	}
+
+	require.Equal(t, []HealthStatus{Healthy, Healthy, Healthy, Healthy, Unhealthy},
+		observe(`{"protocol": "tcp", "port": 80, "gracePeriodInSeconds": 12, "numberOfProbes": 2}`,
+			Healthy, Unhealthy, Unhealthy, Unhealthy, Unhealthy))
+	require.Equal(t, []HealthStatus{Initializing, Healthy, Healthy, Healthy, Unhealthy},
+		observe(`{"protocol": "tcp", "port": 80, "gracePeriodInSeconds": 12, "numberOfProbes": 2, "excludeGracePeriodProbes": true}`,
+			Unhealthy, Healthy, Unhealthy, Unhealthy, Unhealthy), "a healthy result within the grace period ends initializing")
+}
@@ -0,0 +1,159 @@
+package main
+
+import (
+	"encoding/json"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"github.com/go-kit/kit/log"
+)
+
+const redactedValue = "[redacted]"
+
+// stateDump is a snapshot of the probe loop written to the log on SIGUSR1 for
+// live debugging.
+type stateDump struct {
+	State        HealthStatus           `json:"state"`
+	GatePassed   bool                   `json:"gatePassed"`
+	Applications []applicationDump      `json:"applications"`
+	Metrics      string                 `json:"metrics"`
+	Loop         loopTiming             `json:"loop"`
+	Settings     map[string]interface{} `json:"settings"`
+	History      []probeRecord          `json:"history"`
+}
+
+// applicationDump is the state machine of a monitored application.
+type applicationDump struct {
+	Name        string       `json:"name,omitempty"`
+	State       HealthStatus `json:"state"`
+	Consecutive int          `json:"consecutive"`
+	InGrace     bool         `json:"inGracePeriod"`
+}
+
+// loopTiming describes the timing of the probe loop iterations.
+type loopTiming struct {
+	Iterations   int           `json:"iterations"`
+	LastStart    time.Time     `json:"lastStart"`
+	LastDuration time.Duration `json:"lastDuration"`
+	Interval     time.Duration `json:"interval"`
+}
+
+// dump takes a snapshot of the monitor at now.
+func (m *monitor) dump(now time.Time) stateDump {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	d := stateDump{
+		State:      m.currentState(),
+		GatePassed: m.gate.passed,
+		Metrics:    m.metrics.message(now),
+		Settings:   redactedSettings(m.cfg),
+	}
+	for _, g := range m.groups {
+		d.Applications = append(d.Applications, applicationDump{
+			Name:        g.name,
+			State:       g.machine.current(),
+			Consecutive: g.machine.consecutive,
+			InGrace:     g.machine.inGracePeriod(now),
+		})
+	}
+	return d
+}
+
+// redactedSettings returns the effective settings with the values of the
+// protected settings and of the sensitive request headers replaced so that
+// secrets do not end up in the log.
+func redactedSettings(cfg *handlerSettings) map[string]interface{} {
+	out := make(map[string]interface{})
+	toMap(cfg.publicSettings, out)
+	redactHeaders(out)
+	for _, key := range []string{"probes", "applications"} {
+		entries, _ := out[key].([]interface{})
+		for _, e := range entries {
+			if m, ok := e.(map[string]interface{}); ok {
+				redactHeaders(m)
+			}
+		}
+	}
+	if m, ok := out["readinessProbe"].(map[string]interface{}); ok {
+		redactHeaders(m)
+	}
+	protected := make(map[string]interface{})
+	toMap(cfg.protectedSettings, protected)
+	for k := range protected {
+		out[k] = redactedValue
+	}
+	return out
+}
+
+// redactHeaders replaces the values of the sensitive 'requestHeaders' of the
+// settings m.
+func redactHeaders(m map[string]interface{}) {
+	headers, _ := m["requestHeaders"].(map[string]interface{})
+	for name := range headers {
+		if isSensitiveHeader(name) {
+			headers[name] = redactedValue
+		}
+	}
+}
+
+// toMap adds the JSON fields of v to m.
+func toMap(v interface{}, m map[string]interface{}) {
+	if b, err := json.Marshal(v); err == nil {
+		json.Unmarshal(b, &m)
+	}
+}
+
+// handleStateDumpSignal logs a snapshot of the probe loop controlled by c each
+// time the process receives SIGUSR1, until the returned function is called.
+func handleStateDumpSignal(ctx *log.Context, c *loopControl) (stop func()) {
+	sigs := make(chan os.Signal, 1)
+	signal.Notify(sigs, syscall.SIGUSR1)
+	done := make(chan struct{})
+	go func() {
+		for {
+			select {
+			case <-sigs:
+				logStateDump(ctx, c)
+			case <-done:
+				return
+			}
+		}
+	}()
+	return func() {
+		signal.Stop(sigs)
+		close(done)
+	}
+}
+
+// logStateDump writes a snapshot of the probe loop controlled by c to the log.
+func logStateDump(ctx *log.Context, c *loopControl) {
+	d, ok := c.snapshot(time.Now())
+	if !ok {
+		return
+	}
+	b, err := json.Marshal(d)
+	if err != nil {
+		ctx.Log("event", "failed to dump state", "error", err)
+		return
+	}
+	ctx.Log("event", "state dump", "state", string(b))
+}
+
+// snapshot takes a snapshot of the probe loop at now, or returns false if it
+// has not started monitoring yet.
+func (c *loopControl) snapshot(now time.Time) (stateDump, bool) {
+	c.mu.Lock()
+	mon, timing := c.mon, c.timing
+	c.mu.Unlock()
+	if mon == nil {
+		return stateDump{}, false
+	}
+
+	d := mon.dump(now)
+	d.Loop = timing
+	d.Loop.Interval = mon.cfg.interval()
+	d.History = mon.history()
+	return d, true
+}
@@ -0,0 +1,85 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"strings"
+	"sync"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/go-kit/kit/log"
+	"github.com/stretchr/testify/require"
+)
+
+func Test_monitor_dump(t *testing.T) {
+	now := time.Now()
+	cfg := &handlerSettings{publicSettings: publicSettings{Protocol: "tcp", Port: 8080}}
+	m := newMonitor(cfg, now, newExtensionMetrics(now, 0))
+	m.groups[0].machine.numberOfProbes = 3
+	_, err := m.observe(now, Unhealthy)
+	require.Nil(t, err)
+
+	d := m.dump(now)
+	require.Equal(t, Healthy, d.State)
+	require.Len(t, d.Applications, 1)
+	require.Equal(t, 1, d.Applications[0].Consecutive)
+	require.Equal(t, "tcp", d.Settings["protocol"])
+	require.Equal(t, float64(8080), d.Settings["port"])
+}
+
+func Test_handleStateDumpSignal(t *testing.T) {
+	var buf syncBuffer
+	ctx := log.NewContext(log.NewLogfmtLogger(&buf))
+	now := time.Now()
+	c := &loopControl{mon: newMonitor(&handlerSettings{}, now, newExtensionMetrics(now, 0))}
+	c.iterationDone(now, 20*time.Millisecond)
+
+	stop := handleStateDumpSignal(ctx, c)
+	defer stop()
+	require.Nil(t, syscall.Kill(syscall.Getpid(), syscall.SIGUSR1))
+	for i := 0; i < 100 && !strings.Contains(buf.String(), "state dump"); i++ {
+		time.Sleep(10 * time.Millisecond)
+	}
+	out := buf.String()
+	require.Contains(t, out, "event=\"state dump\"")
+	require.Contains(t, out, `\"iterations\":1`)
+}
+
+func Test_redactedSettings(t *testing.T) {
+	s := redactedSettings(&handlerSettings{publicSettings{Locale: "de"}, protectedSettings{SshPrivateKey: "secret key"}})
+	require.Equal(t, "de", s["locale"])
+	require.Equal(t, redactedValue, s["sshPrivateKey"])
+	b, err := json.Marshal(s)
+	require.Nil(t, err)
+	require.NotContains(t, string(b), "secret key")
+
+	s = redactedSettings(&handlerSettings{publicSettings: publicSettings{RequestHeaders: map[string]string{"Authorization": "Basic dXNlcjpwYXNz"}}})
+	require.Equal(t, map[string]interface{}{"Authorization": redactedValue}, s["requestHeaders"])
+
+	s = redactedSettings(&handlerSettings{publicSettings: publicSettings{Probes: []applicationSettings{
+		{Protocol: "http", RequestHeaders: map[string]string{"X-Api-Key": "probe-key"}},
+	}}})
+	b, err = json.Marshal(s)
+	require.Nil(t, err)
+	require.NotContains(t, string(b), "probe-key")
+}
+
+// syncBuffer is a bytes.Buffer safe for concurrent use.
+type syncBuffer struct {
+	mu  sync.Mutex
+	buf bytes.Buffer
+}
+
+func (b *syncBuffer) Write(p []byte) (int, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.Write(p)
+}
+
+func (b *syncBuffer) String() string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.String()
+}
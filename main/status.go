@@ -3,8 +3,6 @@ package main
 import (
 	"encoding/json"
 	"fmt"
-	"io/ioutil"
-	"os"
 	"path/filepath"
 	"time"
 )
@@ -15,8 +13,22 @@ type StatusItem struct {
 	Version      float64 `json:"version"`
 	TimestampUTC string  `json:"timestampUTC"`
 	Status       Status  `json:"status"`
+
+	// FormatVersion is the version of the status/substatus structure produced
+	// by the probe loop. It is omitted in the legacy format.
+	FormatVersion int `json:"formatVersion,omitempty"`
 }
 
+const (
+	// legacyStatusFormatVersion is the original structure: a single
+	// application health substatus.
+	legacyStatusFormatVersion = 1
+
+	// currentStatusFormatVersion adds the extension metrics substatus and
+	// custom-named substatuses.
+	currentStatusFormatVersion = 2
+)
+
 type StatusType string
 
 const (
@@ -44,6 +56,12 @@ type SubstatusItem struct {
 }
 
 func NewStatus(t StatusType, operation, message string) StatusReport {
+	return NewFormattedStatus(t, operation, FormattedMessage{Lang: defaultLang, Message: message})
+}
+
+// NewFormattedStatus creates a status report with the given type, operation
+// and message in the language of the message.
+func NewFormattedStatus(t StatusType, operation string, message FormattedMessage) StatusReport {
 	now := time.Now().UTC().Format(time.RFC3339)
 	return []StatusItem{
 		{
@@ -52,27 +70,81 @@ func NewStatus(t StatusType, operation, message string) StatusReport {
 			Status: Status{
 				Operation:                   operation,
 				ConfigurationAppliedTimeUTC: now,
-				Status: t,
-				FormattedMessage: FormattedMessage{
-					Lang:    "en",
-					Message: message},
+				Status:                      t,
+				FormattedMessage:            message,
 			},
 		},
 	}
 }
 
+// NewSubstatus creates a substatus item with the given type, name and message.
+func NewSubstatus(t StatusType, name, message string) SubstatusItem {
+	return SubstatusItem{
+		Name:   name,
+		Status: t,
+		FormattedMessage: FormattedMessage{
+			Lang:    defaultLang,
+			Message: message,
+		},
+	}
+}
+
+// TruncateMessages shortens the formatted messages of the status report and
+// all of its substatus items to at most max characters.
+func (r StatusReport) TruncateMessages(max int) {
+	for i := range r {
+		m := &r[i].Status.FormattedMessage
+		m.Message = truncateMiddle(m.Message, max)
+		for j := range r[i].Status.SubstatusList {
+			m := &r[i].Status.SubstatusList[j].FormattedMessage
+			m.Message = truncateMiddle(m.Message, max)
+		}
+	}
+}
+
+// RedactMessages replaces the formatted messages of the status report and all
+// of its substatus items with their redacted version.
+func (r StatusReport) RedactMessages(redact func(string) string) {
+	for i := range r {
+		m := &r[i].Status.FormattedMessage
+		m.Message = redact(m.Message)
+		for j := range r[i].Status.SubstatusList {
+			m := &r[i].Status.SubstatusList[j].FormattedMessage
+			m.Message = redact(m.Message)
+		}
+	}
+}
+
+// truncateMiddle shortens s to at most max characters by replacing its middle
+// with an indicator of how many characters were left out, so that both the
+// beginning and the end of the message are preserved.
+func truncateMiddle(s string, max int) string {
+	r := []rune(s)
+	if len(r) <= max {
+		return s
+	}
+	indicator := fmt.Sprintf("...[%d characters truncated]...", len(r)-max)
+	keep := max - len([]rune(indicator))
+	if keep < 2 {
+		return string(r[:max])
+	}
+	// account for the truncated count being of the final message length
+	indicator = fmt.Sprintf("...[%d characters truncated]...", len(r)-keep)
+	keep = max - len([]rune(indicator))
+	head := (keep + 1) / 2
+	tail := keep - head
+	return string(r[:head]) + indicator + string(r[len(r)-tail:])
+}
+
+// AddSubstatus appends a substatus item to the status report.
 func (r StatusReport) AddSubstatus(t StatusType, name, message string) {
+	r.AddSubstatusItems(NewSubstatus(t, name, message))
+}
+
+// AddSubstatusItems appends the given substatus items to the status report.
+func (r StatusReport) AddSubstatusItems(items ...SubstatusItem) {
 	if len(r) > 0 {
-		r[0].Status.SubstatusList = []SubstatusItem{
-			{
-				Name:   name,
-				Status: t,
-				FormattedMessage: FormattedMessage{
-					Lang:    "en",
-					Message: message,
-				},
-			},
-		}
+		r[0].Status.SubstatusList = append(r[0].Status.SubstatusList, items...)
 	}
 }
 
@@ -80,28 +152,41 @@ func (r StatusReport) marshal() ([]byte, error) {
 	return json.MarshalIndent(r, "", "\t")
 }
 
-// Save persists the status message to the specified status folder using the
-// sequence number. The operation consists of writing to a temporary file in the
-// same folder and moving it to the final destination for atomicity.
-func (r StatusReport) Save(statusFolder string, seqNum int) error {
-	fn := fmt.Sprintf("%d.status", seqNum)
-	path := filepath.Join(statusFolder, fn)
-	tmpFile, err := ioutil.TempFile(statusFolder, fn)
-	if err != nil {
-		return fmt.Errorf("status: failed to create temporary file: %v", err)
+// fingerprint identifies the content of the status report, leaving out its
+// timestamps and the extension metrics whose uptime changes on every report.
+func (r StatusReport) fingerprint() string {
+	out := make(StatusReport, len(r))
+	for i, item := range r {
+		item.TimestampUTC = ""
+		item.Status.ConfigurationAppliedTimeUTC = ""
+		var subs []SubstatusItem
+		for _, sub := range item.Status.SubstatusList {
+			if sub.Name != extensionMetricsSubstatusName {
+				subs = append(subs, sub)
+			}
+		}
+		item.Status.SubstatusList = subs
+		out[i] = item
 	}
-	tmpFile.Close()
+	b, _ := json.Marshal(out)
+	return string(b)
+}
+
+func statusFilePath(statusFolder string, seqNum int) string {
+	return filepath.Join(statusFolder, fmt.Sprintf("%d.status", seqNum))
+}
 
+// Save persists the status message to the specified status folder using the
+// sequence number. The status file is replaced atomically and flushed to disk
+// so that the agent never reads a partial report.
+func (r StatusReport) Save(statusFolder string, seqNum int) error {
+	path := statusFilePath(statusFolder, seqNum)
 	b, err := r.marshal()
 	if err != nil {
 		return fmt.Errorf("status: failed to marshal into json: %v", err)
 	}
-	if err := ioutil.WriteFile(tmpFile.Name(), b, 0644); err != nil {
-		return fmt.Errorf("status: failed to path=%s error=%v", tmpFile.Name(), err)
-	}
-
-	if err := os.Rename(tmpFile.Name(), path); err != nil {
-		return fmt.Errorf("status: failed to move to path=%s error=%v", path, err)
+	if err := writeFileAtomic(path, b, 0644); err != nil {
+		return fmt.Errorf("status: failed to write path=%s error=%v", path, err)
 	}
 	return nil
 }
@@ -0,0 +1,46 @@
+package main
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func Test_truncateMiddle(t *testing.T) {
+	require.Equal(t, "short", truncateMiddle("short", 64))
+
+	s := strings.Repeat("a", 100) + strings.Repeat("b", 100)
+	out := truncateMiddle(s, 64)
+	require.Len(t, out, 64)
+	require.True(t, strings.HasPrefix(out, "aaaa"))
+	require.True(t, strings.HasSuffix(out, "bbbb"))
+	require.Contains(t, out, "...[168 characters truncated]...")
+
+	// multi-byte characters are never split
+	out = truncateMiddle(strings.Repeat("é", 100), 64)
+	require.Len(t, []rune(out), 64)
+}
+
+func Test_StatusReport_TruncateMessages(t *testing.T) {
+	s := NewStatus(StatusError, "Enable", strings.Repeat("x", 100))
+	s.AddSubstatus(StatusError, "sub", strings.Repeat("y", 100))
+	s.TruncateMessages(64)
+	require.Len(t, s[0].Status.FormattedMessage.Message, 64)
+	require.Len(t, s[0].Status.SubstatusList[0].FormattedMessage.Message, 64)
+}
+
+func Test_StatusReport_RedactMessages(t *testing.T) {
+	s := NewStatus(StatusError, "Enable", "failed with hunter22")
+	s.AddSubstatus(StatusError, "sub", "output: hunter22")
+	s.RedactMessages(func(m string) string { return strings.Replace(m, "hunter22", redactedValue, -1) })
+	require.Equal(t, "failed with [redacted]", s[0].Status.FormattedMessage.Message)
+	require.Equal(t, "output: [redacted]", s[0].Status.SubstatusList[0].FormattedMessage.Message)
+}
+
+func Test_NewFormattedStatus(t *testing.T) {
+	s := NewFormattedStatus(StatusSuccess, "Enable", FormattedMessage{Lang: "fr", Message: "msg"})
+	s.AddSubstatus(StatusSuccess, "sub", "msg")
+	require.Equal(t, "fr", s[0].Status.FormattedMessage.Lang)
+	require.Equal(t, "en", s[0].Status.SubstatusList[0].FormattedMessage.Lang)
+}
@@ -0,0 +1,83 @@
+package main
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+var (
+	errStatusCodesRequireHttp = errors.New("'expectedStatusCodes' can only be specified when using 'http' or 'https' protocol")
+	errInvalidStatusCodeRange = errors.New("'expectedStatusCodes' ranges must be given as 'low-high' with low not greater than high")
+)
+
+// statusCodeRange is an inclusive range of HTTP status codes.
+type statusCodeRange struct {
+	low, high int
+}
+
+// statusCodes are the HTTP status codes an application is found healthy with.
+type statusCodes []statusCodeRange
+
+// defaultStatusCodes are the status codes expected unless configured.
+var defaultStatusCodes = statusCodes{{http.StatusOK, http.StatusOK}}
+
+// parseStatusCodes parses the status codes given as numbers, e.g. 200, or
+// ranges, e.g. "300-399".
+func parseStatusCodes(entries []interface{}) (statusCodes, error) {
+	var out statusCodes
+	for _, e := range entries {
+		switch v := e.(type) {
+		case float64:
+			out = append(out, statusCodeRange{int(v), int(v)})
+		case string:
+			parts := strings.SplitN(v, "-", 2)
+			if len(parts) != 2 {
+				return nil, errors.Wrap(errInvalidStatusCodeRange, v)
+			}
+			low, err1 := strconv.Atoi(parts[0])
+			high, err2 := strconv.Atoi(parts[1])
+			if err1 != nil || err2 != nil || low > high {
+				return nil, errors.Wrap(errInvalidStatusCodeRange, v)
+			}
+			out = append(out, statusCodeRange{low, high})
+		default:
+			return nil, errors.Wrapf(errInvalidStatusCodeRange, "%v", e)
+		}
+	}
+	return out, nil
+}
+
+// contains reports whether code is one of the status codes.
+func (c statusCodes) contains(code int) bool {
+	for _, r := range c {
+		if code >= r.low && code <= r.high {
+			return true
+		}
+	}
+	return false
+}
+
+// expectedStatusCodes returns the status codes http probes find the
+// application healthy with.
+func (s *handlerSettings) expectedStatusCodes() statusCodes {
+	if len(s.publicSettings.ExpectedStatusCodes) == 0 {
+		return defaultStatusCodes
+	}
+	c, _ := parseStatusCodes(s.publicSettings.ExpectedStatusCodes) // checked by validate
+	return c
+}
+
+// validateStatusCodes makes logical validation of the expected status codes.
+func (h handlerSettings) validateStatusCodes() error {
+	if len(h.publicSettings.ExpectedStatusCodes) == 0 {
+		return nil
+	}
+	if !h.allowsHttpRequest() {
+		return errStatusCodesRequireHttp
+	}
+	_, err := parseStatusCodes(h.publicSettings.ExpectedStatusCodes)
+	return err
+}
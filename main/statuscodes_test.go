@@ -0,0 +1,51 @@
+package main
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func Test_parseStatusCodes(t *testing.T) {
+	var entries []interface{}
+	require.Nil(t, json.Unmarshal([]byte(`[200, 204, "300-399"]`), &entries))
+	c, err := parseStatusCodes(entries)
+	require.Nil(t, err)
+	require.Equal(t, statusCodes{{200, 200}, {204, 204}, {300, 399}}, c)
+
+	for _, code := range []int{200, 204, 300, 302, 399} {
+		require.True(t, c.contains(code), "%d", code)
+	}
+	for _, code := range []int{201, 299, 400, 500} {
+		require.False(t, c.contains(code), "%d", code)
+	}
+
+	_, err = parseStatusCodes([]interface{}{"399-300"})
+	require.NotNil(t, err)
+	require.Contains(t, err.Error(), errInvalidStatusCodeRange.Error())
+	_, err = parseStatusCodes([]interface{}{"300"})
+	require.NotNil(t, err)
+}
+
+func Test_handlerSettingsValidate_expectedStatusCodes(t *testing.T) {
+	require.Equal(t, defaultStatusCodes, (&handlerSettings{}).expectedStatusCodes())
+
+	cfg := handlerSettings{
+		publicSettings{Protocol: "http", ExpectedStatusCodes: []interface{}{float64(401), "200-299"}},
+		protectedSettings{},
+	}
+	require.Nil(t, cfg.validate())
+	require.Equal(t, statusCodes{{401, 401}, {200, 299}}, cfg.expectedStatusCodes())
+
+	require.Equal(t, errStatusCodesRequireHttp, handlerSettings{
+		publicSettings{Protocol: "tcp", Port: 80, ExpectedStatusCodes: []interface{}{float64(200)}},
+		protectedSettings{},
+	}.validate())
+	err := handlerSettings{
+		publicSettings{Protocol: "http", ExpectedStatusCodes: []interface{}{"299-200"}},
+		protectedSettings{},
+	}.validate()
+	require.NotNil(t, err)
+	require.Contains(t, err.Error(), errInvalidStatusCodeRange.Error())
+}
@@ -0,0 +1,127 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/go-kit/kit/log"
+	"github.com/pkg/errors"
+)
+
+const (
+	// probeLoopPidFile is the file under dataRoot holding the pid of the
+	// running probe loop of any version, for disable to stop it.
+	probeLoopPidFile = dataDirName + "-probeloop.pid"
+
+	// stopTimeout is how long disable waits for the probe loop to terminate
+	// before killing it. The loop terminates after its current probe or wait.
+	stopTimeout = 60 * time.Second
+
+	stopPollInterval = 100 * time.Millisecond
+)
+
+// probeLoopPidPath returns the path of the pid file of the probe loop.
+func probeLoopPidPath() string {
+	return filepath.Join(dataRoot, probeLoopPidFile)
+}
+
+// writePidFile records the running process as the probe loop.
+func writePidFile(path string) error {
+	return errors.Wrap(writeFileAtomic(path, []byte(strconv.Itoa(os.Getpid())+"\n"), 0644), "failed to write pid file")
+}
+
+// removePidFile removes the pid file unless it was taken over by another
+// process.
+func removePidFile(path string) {
+	if pid, ok := readPidFile(path); ok && pid == os.Getpid() {
+		os.Remove(path)
+	}
+}
+
+// readPidFile returns the pid recorded at path, or false if none.
+func readPidFile(path string) (int, bool) {
+	b, err := ioutil.ReadFile(path)
+	if err != nil {
+		return 0, false
+	}
+	pid, err := strconv.Atoi(strings.TrimSpace(string(b)))
+	if err != nil || pid < 1 {
+		return 0, false
+	}
+	return pid, true
+}
+
+// isProbeLoop reports whether the process is running the enable command, so
+// that a stale pid file reused by an unrelated process is not acted upon.
+func isProbeLoop(dir string, pid int) bool {
+	if !processRunning(dir, pid) {
+		return false
+	}
+	cmdline, err := ioutil.ReadFile(filepath.Join(dir, strconv.Itoa(pid), "cmdline"))
+	if err != nil {
+		return false
+	}
+	args := bytes.Split(bytes.TrimRight(cmdline, "\x00"), []byte{0})
+	return len(args) >= 2 && string(args[1]) == "enable"
+}
+
+// stopProcess terminates the process, waiting for it at most timeout before
+// killing it.
+func stopProcess(dir string, pid int, timeout time.Duration) error {
+	if err := syscall.Kill(pid, syscall.SIGTERM); err != nil {
+		if err == syscall.ESRCH {
+			return nil
+		}
+		return errors.Wrap(err, "failed to signal process")
+	}
+	for deadline := time.Now().Add(timeout); time.Now().Before(deadline); time.Sleep(stopPollInterval) {
+		if !processRunning(dir, pid) {
+			return nil
+		}
+	}
+	if err := syscall.Kill(pid, syscall.SIGKILL); err != nil && err != syscall.ESRCH {
+		return errors.Wrap(err, "failed to kill process")
+	}
+	return nil
+}
+
+// stopProbeLoop terminates the probe loop recorded in the pid file at path, if
+// running. It returns the pid of the loop stopped, or 0 if none was running.
+func stopProbeLoop(ctx *log.Context, path, dir string) (int, error) {
+	pid, ok := readPidFile(path)
+	if !ok {
+		return 0, nil
+	}
+	if !isProbeLoop(dir, pid) {
+		ctx.Log("event", "removing stale pid file", "pid", pid)
+		os.Remove(path)
+		return 0, nil
+	}
+	ctx.Log("event", "stopping probe loop", "pid", pid)
+	if err := stopProcess(dir, pid, stopTimeout); err != nil {
+		return 0, err
+	}
+	os.Remove(path)
+	return pid, nil
+}
+
+func disable(runCtx context.Context, ctx *log.Context, h HandlerEnvironment, seqNum int) (string, error) {
+	pid, err := stopProbeLoop(ctx, probeLoopPidPath(), procDir)
+	if err != nil {
+		return "", errors.Wrap(err, "failed to stop probe loop")
+	}
+	if pid == 0 {
+		ctx.Log("event", "no probe loop running")
+		return "", nil
+	}
+	ctx.Log("event", "stopped probe loop", "pid", pid)
+	return fmt.Sprintf("probe loop stopped (pid %d)", pid), nil
+}
@@ -0,0 +1,95 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/go-kit/kit/log"
+	"github.com/stretchr/testify/require"
+)
+
+func Test_pidFile(t *testing.T) {
+	dir, err := ioutil.TempDir("", "")
+	require.Nil(t, err)
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, probeLoopPidFile)
+
+	_, ok := readPidFile(path)
+	require.False(t, ok)
+	require.Nil(t, writePidFile(path))
+	pid, ok := readPidFile(path)
+	require.True(t, ok)
+	require.Equal(t, os.Getpid(), pid)
+
+	removePidFile(path)
+	_, err = os.Stat(path)
+	require.True(t, os.IsNotExist(err))
+
+	// taken over by another process
+	require.Nil(t, ioutil.WriteFile(path, []byte("1\n"), 0644))
+	removePidFile(path)
+	_, ok = readPidFile(path)
+	require.True(t, ok)
+}
+
+func Test_isProbeLoop(t *testing.T) {
+	dir, err := ioutil.TempDir("", "")
+	require.Nil(t, err)
+	defer os.RemoveAll(dir)
+	proc := func(pid int, cmdline string) {
+		p := filepath.Join(dir, strconv.Itoa(pid))
+		require.Nil(t, os.MkdirAll(p, 0755))
+		require.Nil(t, ioutil.WriteFile(filepath.Join(p, "stat"), []byte(strconv.Itoa(pid)+" (applicationhea) S 1"), 0644))
+		require.Nil(t, ioutil.WriteFile(filepath.Join(p, "cmdline"), []byte(cmdline), 0644))
+	}
+	proc(10, "bin/applicationhealth-extension\x00enable\x00")
+	proc(11, "bin/applicationhealth-extension\x00disable\x00")
+	proc(12, "sleep\x0060\x00")
+
+	require.True(t, isProbeLoop(dir, 10))
+	require.False(t, isProbeLoop(dir, 11))
+	require.False(t, isProbeLoop(dir, 12), "pid reused")
+	require.False(t, isProbeLoop(dir, 13), "gone")
+}
+
+func Test_stopProcess(t *testing.T) {
+	if _, err := os.Stat(procDir); err != nil {
+		t.Skip("no " + procDir)
+	}
+	c := exec.Command("sleep", "60")
+	require.Nil(t, c.Start())
+	exited := make(chan struct{})
+	go func() { c.Wait(); close(exited) }()
+
+	require.Nil(t, stopProcess(procDir, c.Process.Pid, 10*time.Second))
+	select {
+	case <-exited:
+	case <-time.After(5 * time.Second):
+		t.Fatal("process not terminated")
+	}
+	require.Nil(t, stopProcess(procDir, c.Process.Pid, time.Second), "already gone")
+}
+
+func Test_stopProbeLoop_stalePidFile(t *testing.T) {
+	dir, err := ioutil.TempDir("", "")
+	require.Nil(t, err)
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, probeLoopPidFile)
+	ctx := log.NewContext(log.NewNopLogger())
+
+	pid, err := stopProbeLoop(ctx, path, dir)
+	require.Nil(t, err)
+	require.Equal(t, 0, pid, "no pid file")
+
+	require.Nil(t, ioutil.WriteFile(path, []byte("123\n"), 0644))
+	pid, err = stopProbeLoop(ctx, path, dir)
+	require.Nil(t, err)
+	require.Equal(t, 0, pid)
+	_, err = os.Stat(path)
+	require.True(t, os.IsNotExist(err), "stale pid file removed")
+}
@@ -0,0 +1,119 @@
+package main
+
+import (
+	"bytes"
+	"log/syslog"
+	"strings"
+	"sync"
+
+	"github.com/go-kit/kit/log"
+)
+
+const syslogTag = "applicationhealth-extension"
+
+// syslogWriter writes messages at the syslog priorities used by the mirror.
+type syslogWriter interface {
+	Err(m string) error
+	Warning(m string) error
+	Notice(m string) error
+	Close() error
+}
+
+// dialSyslog connects to the local syslog daemon, i.e. journald on systemd
+// distributions.
+var dialSyslog = func() (syslogWriter, error) {
+	return syslog.New(syslog.LOG_NOTICE|syslog.LOG_DAEMON, syslogTag)
+}
+
+// syslogSink mirrors the state changes and errors logged by this process to
+// syslog once enabled by the settings.
+var syslogSink = &syslogMirror{}
+
+// syslogMirror writes the log records worth the attention of the standard
+// Linux log tooling to syslog.
+type syslogMirror struct {
+	mu sync.Mutex
+	w  syslogWriter // nil while disabled
+}
+
+// wrap returns a logger mirroring the records to syslog before passing them
+// on to next.
+func (m *syslogMirror) wrap(next log.Logger) log.Logger {
+	return log.LoggerFunc(func(keyvals ...interface{}) error {
+		m.mirror(keyvals)
+		return next.Log(keyvals...)
+	})
+}
+
+// mirror writes the record to syslog if it is a state change or an error.
+func (m *syslogMirror) mirror(keyvals []interface{}) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.w == nil {
+		return
+	}
+	write := syslogPriority(m.w, keyvals)
+	if write == nil {
+		return
+	}
+	var b bytes.Buffer
+	log.NewLogfmtLogger(&b).Log(keyvals...)
+	write(strings.TrimSuffix(b.String(), "\n"))
+}
+
+// syslogPriority returns the function writing the record to w at its
+// priority, or nil if the record is not mirrored: errors are written as
+// err, changes of the health state to unhealthy as warning and other changes
+// as notice.
+func syslogPriority(w syslogWriter, keyvals []interface{}) func(string) error {
+	if recordLevel(keyvals) == levelError {
+		return w.Err
+	}
+	for i := 0; i+1 < len(keyvals); i += 2 {
+		if keyvals[i] != "event" {
+			continue
+		}
+		for state, event := range stateChangeLogMap {
+			if keyvals[i+1] != event {
+				continue
+			}
+			if state == Unhealthy {
+				return w.Warning
+			}
+			return w.Notice
+		}
+	}
+	return nil
+}
+
+// enable connects to syslog, or disconnects if on is false.
+func (m *syslogMirror) enable(on bool) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if !on {
+		if m.w != nil {
+			m.w.Close()
+			m.w = nil
+		}
+		return nil
+	}
+	if m.w != nil {
+		return nil
+	}
+	w, err := dialSyslog()
+	if err != nil {
+		return err
+	}
+	m.w = w
+	return nil
+}
+
+// configureSyslog mirrors the log to syslog if the settings ask for it.
+func configureSyslog(ctx *log.Context, cfg *handlerSettings) {
+	on := cfg.publicSettings.Syslog
+	if err := syslogSink.enable(on); err != nil {
+		ctx.Log("event", "failed to connect to syslog", "error", err)
+		return
+	}
+	ctx.Log("event", "mirroring log to syslog", "enabled", on)
+}
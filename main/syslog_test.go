@@ -0,0 +1,64 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"testing"
+
+	"github.com/go-kit/kit/log"
+	"github.com/stretchr/testify/require"
+)
+
+type fakeSyslog struct {
+	messages []string
+	closed   bool
+}
+
+func (f *fakeSyslog) write(priority, m string) error {
+	f.messages = append(f.messages, priority+": "+m)
+	return nil
+}
+
+func (f *fakeSyslog) Err(m string) error     { return f.write("err", m) }
+func (f *fakeSyslog) Warning(m string) error { return f.write("warning", m) }
+func (f *fakeSyslog) Notice(m string) error  { return f.write("notice", m) }
+func (f *fakeSyslog) Close() error           { f.closed = true; return nil }
+
+func Test_syslogMirror(t *testing.T) {
+	fake := &fakeSyslog{}
+	defer func(d func() (syslogWriter, error)) { dialSyslog = d }(dialSyslog)
+	dialSyslog = func() (syslogWriter, error) { return fake, nil }
+
+	var buf bytes.Buffer
+	m := &syslogMirror{}
+	ctx := log.NewContext(m.wrap(log.NewLogfmtLogger(&buf))).With("seq", 1)
+
+	ctx.Log("event", stateChangeLogMap[Unhealthy])
+	require.Empty(t, fake.messages, "not mirrored until enabled")
+
+	require.Nil(t, m.enable(true))
+	ctx.Log("event", "start")
+	ctx.Log("event", stateChangeLogMap[Unhealthy])
+	ctx.Log("event", stateChangeLogMap[Healthy])
+	ctx.Log("event", "failed to report status", "error", errors.New("disk full"))
+	require.Equal(t, []string{
+		`warning: seq=1 event="state changed to unhealthy"`,
+		`notice: seq=1 event="state changed to healthy"`,
+		`err: seq=1 event="failed to report status" error="disk full"`,
+	}, fake.messages)
+	require.Contains(t, buf.String(), "event=start", "every record passed on")
+
+	require.Nil(t, m.enable(false))
+	require.True(t, fake.closed)
+	ctx.Log("event", stateChangeLogMap[Healthy])
+	require.Len(t, fake.messages, 3)
+}
+
+func Test_syslogMirror_unavailable(t *testing.T) {
+	defer func(d func() (syslogWriter, error)) { dialSyslog = d }(dialSyslog)
+	dialSyslog = func() (syslogWriter, error) { return nil, errors.New("no syslog") }
+
+	m := &syslogMirror{}
+	require.NotNil(t, m.enable(true))
+	require.Nil(t, m.w)
+}
@@ -0,0 +1,176 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/go-kit/kit/log"
+	"github.com/pkg/errors"
+)
+
+// systemChecksSettings configure checks of the resources of the VM that
+// degrade the health of an otherwise healthy application.
+type systemChecksSettings struct {
+	MaxCpuPercent          int `json:"maxCpuPercent,int"`
+	MinAvailableMemoryInMB int `json:"minAvailableMemoryInMB,int"`
+	MaxPressurePercent     int `json:"maxPressurePercent,int"`
+}
+
+// systemChecks returns the system checks, or nil if the resources of the VM
+// are not checked.
+func (s *handlerSettings) systemChecks() *systemChecksSettings {
+	return s.publicSettings.SystemChecks
+}
+
+// cpuSample is the cumulative CPU time in /proc/stat, in clock ticks.
+type cpuSample struct {
+	busy, total uint64
+}
+
+// systemCheckingProbe wraps a HealthProbe and reports a healthy application
+// degraded while the VM is short of CPU or memory.
+type systemCheckingProbe struct {
+	HealthProbe
+	checks  systemChecksSettings
+	procDir string
+
+	lastCpu *cpuSample
+}
+
+func newSystemCheckingProbe(p HealthProbe, c *systemChecksSettings) *systemCheckingProbe {
+	return &systemCheckingProbe{HealthProbe: p, checks: *c, procDir: procDir}
+}
+
+func (p *systemCheckingProbe) evaluate(probeCtx context.Context, ctx *log.Context) (HealthStatus, error) {
+	state, err := p.HealthProbe.evaluate(probeCtx, ctx)
+	// the CPU usage is measured between consecutive probes
+	cpu := p.cpuPercent(ctx)
+	if state != Healthy || err != nil {
+		return state, err
+	}
+
+	if max := p.checks.MaxCpuPercent; max != 0 && cpu > float64(max) {
+		ctx.Log("event", "system check failed", "check", "cpu", "percent", fmt.Sprintf("%.1f", cpu), "max", max)
+		return Degraded, nil
+	}
+	if min := p.checks.MinAvailableMemoryInMB; min != 0 {
+		if mb, err := p.availableMemoryMB(); err != nil {
+			ctx.Log("event", "failed to read available memory", "error", err)
+		} else if mb < min {
+			ctx.Log("event", "system check failed", "check", "memory", "availableMB", mb, "min", min)
+			return Degraded, nil
+		}
+	}
+	if max := p.checks.MaxPressurePercent; max != 0 {
+		for _, resource := range []string{"cpu", "memory", "io"} {
+			pressure, err := p.pressurePercent(resource)
+			if err != nil {
+				continue // kernel without pressure stall information
+			}
+			if pressure > float64(max) {
+				ctx.Log("event", "system check failed", "check", resource+" pressure", "percent", fmt.Sprintf("%.1f", pressure), "max", max)
+				return Degraded, nil
+			}
+		}
+	}
+	return Healthy, nil
+}
+
+// cpuPercent returns the CPU usage since the previous call, 0 on the first
+// call or if the CPU is not checked.
+func (p *systemCheckingProbe) cpuPercent(ctx *log.Context) float64 {
+	if p.checks.MaxCpuPercent == 0 {
+		return 0
+	}
+	b, err := ioutil.ReadFile(filepath.Join(p.procDir, "stat"))
+	if err != nil {
+		ctx.Log("event", "failed to read cpu usage", "error", err)
+		return 0
+	}
+	cur, ok := parseCpuSample(string(b))
+	if !ok {
+		return 0
+	}
+	prev := p.lastCpu
+	p.lastCpu = &cur
+	if prev == nil || cur.total <= prev.total {
+		return 0
+	}
+	return 100 * float64(cur.busy-prev.busy) / float64(cur.total-prev.total)
+}
+
+// parseCpuSample parses the aggregated 'cpu' line of /proc/stat, where idle
+// and iowait are the fourth and fifth values.
+func parseCpuSample(stat string) (cpuSample, bool) {
+	line := stat
+	if i := strings.IndexByte(stat, '\n'); i >= 0 {
+		line = stat[:i]
+	}
+	fields := strings.Fields(line)
+	if len(fields) < 6 || fields[0] != "cpu" {
+		return cpuSample{}, false
+	}
+	var s cpuSample
+	var idle uint64
+	for i, f := range fields[1:] {
+		v, err := strconv.ParseUint(f, 10, 64)
+		if err != nil {
+			return cpuSample{}, false
+		}
+		if i >= 8 {
+			break // guest time is already included in user time
+		}
+		s.total += v
+		if i == 3 || i == 4 {
+			idle += v
+		}
+	}
+	s.busy = s.total - idle
+	return s, true
+}
+
+// availableMemoryMB returns MemAvailable of /proc/meminfo.
+func (p *systemCheckingProbe) availableMemoryMB() (int, error) {
+	b, err := ioutil.ReadFile(filepath.Join(p.procDir, "meminfo"))
+	if err != nil {
+		return 0, err
+	}
+	s := bufio.NewScanner(bytes.NewReader(b))
+	for s.Scan() {
+		fields := strings.Fields(s.Text())
+		if len(fields) >= 2 && fields[0] == "MemAvailable:" {
+			kb, err := strconv.Atoi(fields[1])
+			if err != nil {
+				return 0, err
+			}
+			return kb / 1024, nil
+		}
+	}
+	return 0, errors.New("no MemAvailable in meminfo")
+}
+
+// pressurePercent returns the share of time in the last 10 seconds some tasks
+// stalled on the resource, from /proc/pressure.
+func (p *systemCheckingProbe) pressurePercent(resource string) (float64, error) {
+	b, err := ioutil.ReadFile(filepath.Join(p.procDir, "pressure", resource))
+	if err != nil {
+		return 0, err
+	}
+	s := bufio.NewScanner(bytes.NewReader(b))
+	for s.Scan() {
+		fields := strings.Fields(s.Text())
+		if len(fields) < 2 || fields[0] != "some" {
+			continue
+		}
+		if v := strings.TrimPrefix(fields[1], "avg10="); v != fields[1] {
+			return strconv.ParseFloat(v, 64)
+		}
+	}
+	return 0, errors.Errorf("no avg10 in %s pressure", resource)
+}
@@ -0,0 +1,99 @@
+package main
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/go-kit/kit/log"
+	"github.com/stretchr/testify/require"
+)
+
+// writeProcFile writes a file into the proc directory dir.
+func writeProcFile(t *testing.T, dir, name, content string) {
+	path := filepath.Join(dir, name)
+	require.Nil(t, os.MkdirAll(filepath.Dir(path), 0755))
+	require.Nil(t, os.WriteFile(path, []byte(content), 0644))
+}
+
+func Test_systemCheckingProbe_cpu(t *testing.T) {
+	ctx := log.NewContext(log.NewNopLogger())
+	dir := t.TempDir()
+	p := newSystemCheckingProbe(DefaultHealthProbe{}, &systemChecksSettings{MaxCpuPercent: 90})
+	p.procDir = dir
+	state := func(stat string) HealthStatus {
+		writeProcFile(t, dir, "stat", stat+"\ncpu0 0 0 0 0 0 0 0 0 0 0\n")
+		s, err := p.evaluate(context.Background(), ctx)
+		require.Nil(t, err)
+		return s
+	}
+
+	require.Equal(t, Healthy, state("cpu  100 0 100 800 0 0 0 0 0 0"), "no previous sample")
+	require.Equal(t, Healthy, state("cpu  150 0 150 1700 0 0 0 0 0 0"), "10% busy")
+	require.Equal(t, Degraded, state("cpu  650 0 600 1700 50 0 0 0 0 0"), "95% busy")
+	require.Equal(t, Healthy, state("cpu  650 0 600 2700 50 0 0 0 0 0"), "idle again")
+
+	p.HealthProbe = &scriptedProbe{results: []HealthStatus{Unhealthy}}
+	require.Equal(t, Unhealthy, state("cpu  1650 0 600 2700 50 0 0 0 0 0"), "unhealthy is not improved")
+}
+
+func Test_systemCheckingProbe_memory(t *testing.T) {
+	ctx := log.NewContext(log.NewNopLogger())
+	dir := t.TempDir()
+	p := newSystemCheckingProbe(DefaultHealthProbe{}, &systemChecksSettings{MinAvailableMemoryInMB: 512})
+	p.procDir = dir
+
+	writeProcFile(t, dir, "meminfo", "MemTotal:        8000000 kB\nMemFree:          100000 kB\nMemAvailable:    1048576 kB\n")
+	s, err := p.evaluate(context.Background(), ctx)
+	require.Nil(t, err)
+	require.Equal(t, Healthy, s)
+
+	writeProcFile(t, dir, "meminfo", "MemTotal:        8000000 kB\nMemAvailable:     262144 kB\n")
+	s, err = p.evaluate(context.Background(), ctx)
+	require.Nil(t, err)
+	require.Equal(t, Degraded, s)
+
+	require.Nil(t, os.Remove(filepath.Join(dir, "meminfo")))
+	s, err = p.evaluate(context.Background(), ctx)
+	require.Nil(t, err)
+	require.Equal(t, Healthy, s, "unreadable meminfo is ignored")
+}
+
+func Test_systemCheckingProbe_pressure(t *testing.T) {
+	ctx := log.NewContext(log.NewNopLogger())
+	dir := t.TempDir()
+	p := newSystemCheckingProbe(DefaultHealthProbe{}, &systemChecksSettings{MaxPressurePercent: 20})
+	p.procDir = dir
+
+	s, err := p.evaluate(context.Background(), ctx)
+	require.Nil(t, err)
+	require.Equal(t, Healthy, s, "no pressure stall information")
+
+	writeProcFile(t, dir, "pressure/cpu", "some avg10=5.00 avg60=3.00 avg300=1.00 total=1000\n")
+	writeProcFile(t, dir, "pressure/memory", "some avg10=1.00 avg60=0.00 avg300=0.00 total=10\nfull avg10=0.00 avg60=0.00 avg300=0.00 total=0\n")
+	s, err = p.evaluate(context.Background(), ctx)
+	require.Nil(t, err)
+	require.Equal(t, Healthy, s)
+
+	writeProcFile(t, dir, "pressure/io", "some avg10=35.50 avg60=10.00 avg300=2.00 total=5000\nfull avg10=30.00 avg60=8.00 avg300=1.00 total=4000\n")
+	s, err = p.evaluate(context.Background(), ctx)
+	require.Nil(t, err)
+	require.Equal(t, Degraded, s)
+}
+
+func Test_parseCpuSample(t *testing.T) {
+	s, ok := parseCpuSample("cpu  10 1 5 100 4 1 1 2 7 0\ncpu0 10 1 5 100 4 1 1 2 7 0\n")
+	require.True(t, ok)
+	require.Equal(t, cpuSample{busy: 20, total: 124}, s, "guest time not counted twice")
+
+	_, ok = parseCpuSample("intr 1 2 3")
+	require.False(t, ok)
+}
+
+func Test_NewHealthProbe_systemChecks(t *testing.T) {
+	ctx := log.NewContext(log.NewNopLogger())
+	p := NewHealthProbe(ctx, &handlerSettings{publicSettings: publicSettings{Protocol: "tcp", Port: 80, SystemChecks: &systemChecksSettings{MaxCpuPercent: 90}}})
+	require.IsType(t, &systemCheckingProbe{}, p)
+	require.Equal(t, "localhost:80", p.address())
+}
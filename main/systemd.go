@@ -0,0 +1,98 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"os/exec"
+	"strings"
+	"time"
+
+	"github.com/go-kit/kit/log"
+	"github.com/pkg/errors"
+)
+
+var (
+	errSystemdRequiresUnit        = errors.New("'systemdUnit' must be specified when using 'systemd' protocol")
+	errSystemdUnitRequiresSystemd = errors.New("'systemdUnit' can only be specified when using 'systemd' protocol")
+	errSystemdWithPort            = errors.New("'host', 'port', 'requestPath', 'systemdSocket', 'portFile' and 'unixSocketPath' cannot be specified when using 'systemd' protocol")
+)
+
+// SystemdHealthProbe reports the application healthy while its systemd unit
+// is active, as seen by the service manager.
+type SystemdHealthProbe struct {
+	Unit    string
+	Timeout time.Duration
+	// Show returns the output of 'systemctl show' for the unit, systemctl
+	// if nil.
+	Show func(ctx context.Context, unit string) ([]byte, error)
+}
+
+func (p *SystemdHealthProbe) evaluate(probeCtx context.Context, ctx *log.Context) (HealthStatus, error) {
+	showCtx, cancel := context.WithTimeout(probeCtx, p.Timeout)
+	defer cancel()
+	show := p.Show
+	if show == nil {
+		show = systemctlShow
+	}
+	out, err := show(showCtx, p.Unit)
+	if err != nil {
+		return Unknown, errors.Wrapf(err, "failed to query systemd unit %s", p.Unit)
+	}
+	active, sub := parseUnitState(string(out))
+	switch active {
+	case "active", "reloading":
+		return Healthy, nil
+	case "failed", "inactive":
+		ctx.Log("event", "systemd unit is not running", "unit", p.Unit, "state", active, "substate", sub)
+		return Unhealthy, nil
+	default: // activating, deactivating
+		ctx.Log("event", "systemd unit is changing state", "unit", p.Unit, "state", active, "substate", sub)
+		return Unknown, nil
+	}
+}
+
+func (p *SystemdHealthProbe) address() string {
+	return p.Unit
+}
+
+func systemctlShow(ctx context.Context, unit string) ([]byte, error) {
+	return exec.CommandContext(ctx, "systemctl", "show", "--property=ActiveState,SubState", "--", unit).Output()
+}
+
+// parseUnitState returns the active state and sub state of a unit in the
+// output of 'systemctl show --property=ActiveState,SubState'.
+func parseUnitState(out string) (active, sub string) {
+	s := bufio.NewScanner(strings.NewReader(out))
+	for s.Scan() {
+		line := strings.TrimSpace(s.Text())
+		if v := strings.TrimPrefix(line, "ActiveState="); v != line {
+			active = v
+		} else if v := strings.TrimPrefix(line, "SubState="); v != line {
+			sub = v
+		}
+	}
+	return active, sub
+}
+
+// validateSystemd makes logical validation of the settings of the systemd
+// probe.
+func (h handlerSettings) validateSystemd() error {
+	if h.protocol() != "systemd" {
+		if h.systemdUnit() != "" {
+			return errSystemdUnitRequiresSystemd
+		}
+		return nil
+	}
+	if h.systemdUnit() == "" {
+		return errSystemdRequiresUnit
+	}
+	if h.publicSettings.Host != "" || h.port() != 0 || h.requestPath() != "" || h.systemdSocket() != "" || h.portFile() != "" || h.unixSocketPath() != "" {
+		return errSystemdWithPort
+	}
+	return nil
+}
+
+// systemdUnit returns the unit whose state the systemd probe checks.
+func (s *handlerSettings) systemdUnit() string {
+	return s.publicSettings.SystemdUnit
+}
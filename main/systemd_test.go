@@ -0,0 +1,69 @@
+package main
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/go-kit/kit/log"
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/require"
+)
+
+func Test_SystemdHealthProbe(t *testing.T) {
+	ctx := log.NewContext(log.NewNopLogger())
+	probe := func(out string, err error) (HealthStatus, error) {
+		p := &SystemdHealthProbe{Unit: "app.service", Timeout: time.Second, Show: func(_ context.Context, unit string) ([]byte, error) {
+			require.Equal(t, "app.service", unit)
+			return []byte(out), err
+		}}
+		return p.evaluate(context.Background(), ctx)
+	}
+	state := func(out string) HealthStatus {
+		s, err := probe(out, nil)
+		require.Nil(t, err)
+		return s
+	}
+
+	require.Equal(t, Healthy, state("ActiveState=active\nSubState=running\n"))
+	require.Equal(t, Healthy, state("ActiveState=reloading\nSubState=reload\n"))
+	require.Equal(t, Unhealthy, state("ActiveState=failed\nSubState=failed\n"))
+	require.Equal(t, Unhealthy, state("ActiveState=inactive\nSubState=dead\n"))
+	require.Equal(t, Unknown, state("ActiveState=activating\nSubState=start-pre\n"))
+
+	s, err := probe("", errors.New("exit status 1"))
+	require.Equal(t, Unknown, s)
+	require.NotNil(t, err)
+}
+
+func Test_parseUnitState(t *testing.T) {
+	active, sub := parseUnitState("SubState=running\nActiveState=active\n")
+	require.Equal(t, "active", active)
+	require.Equal(t, "running", sub)
+
+	active, sub = parseUnitState("")
+	require.Equal(t, "", active)
+	require.Equal(t, "", sub)
+}
+
+func Test_NewHealthProbe_systemd(t *testing.T) {
+	ctx := log.NewContext(log.NewNopLogger())
+	p := NewHealthProbe(ctx, &handlerSettings{publicSettings: publicSettings{Protocol: "systemd", SystemdUnit: "app.service"}})
+	require.IsType(t, &SystemdHealthProbe{}, p)
+	require.Equal(t, "app.service", p.address())
+}
+
+func Test_handlerSettingsValidate_systemd(t *testing.T) {
+	validate := func(p publicSettings) error { return handlerSettings{p, protectedSettings{}}.validate() }
+
+	require.Nil(t, validate(publicSettings{Protocol: "systemd", SystemdUnit: "app.service"}))
+	require.Equal(t, errSystemdRequiresUnit, validate(publicSettings{Protocol: "systemd"}))
+	require.Equal(t, errSystemdWithPort, validate(publicSettings{Protocol: "systemd", SystemdUnit: "app.service", Port: 80}))
+	require.Equal(t, errSystemdWithPort, validate(publicSettings{Protocol: "systemd", SystemdUnit: "app.service", SystemdSocket: "app.socket"}))
+	require.Equal(t, errSystemdUnitRequiresSystemd, validate(publicSettings{Protocol: "tcp", Port: 80, SystemdUnit: "app.service"}))
+	require.Equal(t, errIPVersionUnsupported, validate(publicSettings{Protocol: "systemd", SystemdUnit: "app.service", IPVersion: ipVersion6}))
+
+	require.Nil(t, validate(publicSettings{Applications: []applicationSettings{
+		{Name: "app", Protocol: "systemd", SystemdUnit: "app.service"},
+	}}))
+}
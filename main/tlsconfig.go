@@ -0,0 +1,114 @@
+package main
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"io/ioutil"
+
+	"github.com/pkg/errors"
+)
+
+var (
+	errCABundleRequiresHttps      = errors.New("'caBundle' and 'caBundlePath' can only be specified when using 'https' or 'tls' protocol")
+	errCABundleTwice              = errors.New("only one of 'caBundle' and 'caBundlePath' can be specified")
+	errInvalidCABundle            = errors.New("'caBundle' contains no PEM encoded certificate")
+	errTLSSkipVerifyRequiresHttps = errors.New("'tlsSkipVerify' can only be specified when using 'https' or 'tls' protocol")
+	errTLSSkipVerifyWithCABundle  = errors.New("'tlsSkipVerify' cannot be true when 'caBundle' or 'caBundlePath' is specified")
+	errTLSServerNameRequiresHttps = errors.New("'tlsServerName' can only be specified when using 'https' or 'tls' protocol")
+)
+
+// usesTLS reports whether the probe makes a TLS handshake.
+func (s *handlerSettings) usesTLS() bool {
+	return s.protocol() == "https" || s.protocol() == "tls"
+}
+
+// tlsSkipVerify returns whether https and tls probes accept any server
+// certificate. By default they do, as applications often serve self-signed
+// certificates on localhost, unless a CA bundle to verify against is specified.
+func (s *handlerSettings) tlsSkipVerify() bool {
+	if v := s.publicSettings.TLSSkipVerify; v != nil {
+		return *v
+	}
+	return s.publicSettings.CABundle == "" && s.publicSettings.CABundlePath == ""
+}
+
+// validateTLSSkipVerify makes logical validation of 'tlsSkipVerify' and
+// 'tlsServerName'.
+func (h handlerSettings) validateTLSSkipVerify() error {
+	if h.publicSettings.TLSServerName != "" && !h.usesTLS() {
+		return errTLSServerNameRequiresHttps
+	}
+	v := h.publicSettings.TLSSkipVerify
+	if v == nil {
+		return nil
+	}
+	if !h.usesTLS() {
+		return errTLSSkipVerifyRequiresHttps
+	}
+	if *v && (h.publicSettings.CABundle != "" || h.publicSettings.CABundlePath != "") {
+		return errTLSSkipVerifyWithCABundle
+	}
+	return nil
+}
+
+// caBundle returns the certificate authorities the server certificate of https
+// and tls probes is verified against, or nil if the system ones are.
+func (s *handlerSettings) caBundle() (*x509.CertPool, error) {
+	b := []byte(s.publicSettings.CABundle)
+	if path := s.publicSettings.CABundlePath; path != "" {
+		var err error
+		if b, err = ioutil.ReadFile(path); err != nil {
+			return nil, errors.Wrap(err, "failed to read 'caBundlePath'")
+		}
+	} else if len(b) == 0 {
+		return nil, nil
+	}
+	roots := x509.NewCertPool()
+	if !roots.AppendCertsFromPEM(b) {
+		return nil, errInvalidCABundle
+	}
+	return roots, nil
+}
+
+// validateCABundle makes logical validation of the CA bundle of https and tls
+// probes.
+// A bundle given as a path is only read when the probe is created.
+func (h handlerSettings) validateCABundle() error {
+	p := h.publicSettings
+	if p.CABundle == "" && p.CABundlePath == "" {
+		return nil
+	}
+	if !h.usesTLS() {
+		return errCABundleRequiresHttps
+	}
+	if p.CABundle != "" && p.CABundlePath != "" {
+		return errCABundleTwice
+	}
+	if p.CABundle != "" {
+		if _, err := h.caBundle(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// configureTLS applies the TLS settings of https and tls probes to c. Unless
+// verification is skipped, the server certificate must chain to the CA bundle
+// and name the probed host, or the server name if one is specified.
+func (s *handlerSettings) configureTLS(c *tls.Config) error {
+	// sent in the ClientHello, so that virtual hosts select their certificate
+	c.ServerName = s.publicSettings.TLSServerName
+	cert, err := s.clientCertificate()
+	if err != nil {
+		return err
+	}
+	if cert != nil {
+		c.Certificates = []tls.Certificate{*cert}
+	}
+	c.InsecureSkipVerify = s.tlsSkipVerify()
+	if c.InsecureSkipVerify {
+		return nil
+	}
+	c.RootCAs, err = s.caBundle()
+	return err
+}
@@ -0,0 +1,115 @@
+package main
+
+import (
+	"context"
+	"crypto/tls"
+	"encoding/pem"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/go-kit/kit/log"
+	"github.com/stretchr/testify/require"
+)
+
+func Test_HttpHealthProbe_caBundle(t *testing.T) {
+	srv := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer srv.Close()
+	dir, err := ioutil.TempDir("", "")
+	require.Nil(t, err)
+	defer os.RemoveAll(dir)
+	ca := string(pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: srv.Certificate().Raw}))
+	otherCA, _ := writeClientCert(t, dir)
+	require.Nil(t, ioutil.WriteFile(filepath.Join(dir, "ca.pem"), []byte(ca), 0600))
+
+	ctx := log.NewContext(log.NewNopLogger())
+	skip, verify := true, false
+	for _, c := range []struct {
+		name     string
+		settings publicSettings
+		address  string
+		expected HealthStatus
+	}{
+		{"not verified", publicSettings{Protocol: "https"}, srv.URL, Healthy},
+		{"skipped", publicSettings{Protocol: "https", TLSSkipVerify: &skip}, srv.URL, Healthy},
+		{"system authorities", publicSettings{Protocol: "https", TLSSkipVerify: &verify}, srv.URL, Unhealthy},
+		{"inline", publicSettings{Protocol: "https", CABundle: ca}, srv.URL, Healthy},
+		{"path", publicSettings{Protocol: "https", CABundlePath: filepath.Join(dir, "ca.pem"), TLSSkipVerify: &verify}, srv.URL, Healthy},
+		{"other authority", publicSettings{Protocol: "https", CABundle: otherCA}, srv.URL, Unhealthy},
+		// the test certificate names 127.0.0.1 and example.com only
+		{"other host", publicSettings{Protocol: "https", CABundle: ca}, strings.Replace(srv.URL, "127.0.0.1", "localhost", 1), Unhealthy},
+	} {
+		cfg := &handlerSettings{c.settings, protectedSettings{}}
+		require.Nil(t, cfg.validate(), c.name)
+		p := newProbe(ctx, cfg, 0).(*HttpHealthProbe)
+		p.Address = c.address
+		state, _ := p.evaluate(context.Background(), ctx)
+		require.Equal(t, c.expected, state, c.name)
+	}
+
+	cfg := &handlerSettings{publicSettings{Protocol: "https", CABundlePath: filepath.Join(dir, "missing.pem")}, protectedSettings{}}
+	require.Nil(t, cfg.validate())
+	_, err = newProbe(ctx, cfg, 0).evaluate(context.Background(), ctx)
+	require.NotNil(t, err)
+	require.Contains(t, err.Error(), "failed to read 'caBundlePath'")
+}
+
+func Test_handlerSettingsValidate_caBundle(t *testing.T) {
+	require.Equal(t, errCABundleRequiresHttps, handlerSettings{
+		publicSettings{Protocol: "http", CABundlePath: "/etc/ssl/ca.pem"}, protectedSettings{},
+	}.validate())
+	require.Equal(t, errCABundleTwice, handlerSettings{
+		publicSettings{Protocol: "https", CABundle: "ca", CABundlePath: "/etc/ssl/ca.pem"}, protectedSettings{},
+	}.validate())
+	require.Equal(t, errInvalidCABundle, handlerSettings{
+		publicSettings{Protocol: "https", CABundle: "not a certificate"}, protectedSettings{},
+	}.validate())
+}
+
+func Test_handlerSettings_tlsSkipVerify(t *testing.T) {
+	skip, verify := true, false
+	require.True(t, (&handlerSettings{publicSettings{Protocol: "https"}, protectedSettings{}}).tlsSkipVerify())
+	require.False(t, (&handlerSettings{publicSettings{Protocol: "https", CABundlePath: "/etc/ssl/ca.pem"}, protectedSettings{}}).tlsSkipVerify())
+	require.False(t, (&handlerSettings{publicSettings{Protocol: "https", TLSSkipVerify: &verify}, protectedSettings{}}).tlsSkipVerify())
+
+	require.Equal(t, errTLSSkipVerifyRequiresHttps, handlerSettings{
+		publicSettings{Protocol: "http", TLSSkipVerify: &verify}, protectedSettings{},
+	}.validate())
+	require.Equal(t, errTLSSkipVerifyWithCABundle, handlerSettings{
+		publicSettings{Protocol: "https", CABundlePath: "/etc/ssl/ca.pem", TLSSkipVerify: &skip}, protectedSettings{},
+	}.validate())
+	require.Nil(t, handlerSettings{
+		publicSettings{Protocol: "https", CABundlePath: "/etc/ssl/ca.pem", TLSSkipVerify: &verify}, protectedSettings{},
+	}.validate())
+}
+
+func Test_HttpHealthProbe_tlsServerName(t *testing.T) {
+	var sni string
+	srv := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	srv.TLS = &tls.Config{GetConfigForClient: func(hello *tls.ClientHelloInfo) (*tls.Config, error) {
+		sni = hello.ServerName
+		return nil, nil
+	}}
+	srv.StartTLS()
+	defer srv.Close()
+	ca := string(pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: srv.Certificate().Raw}))
+
+	ctx := log.NewContext(log.NewNopLogger())
+	cfg := &handlerSettings{publicSettings{Protocol: "https", CABundle: ca, TLSServerName: "example.com"}, protectedSettings{}}
+	require.Nil(t, cfg.validate())
+	p := newProbe(ctx, cfg, 0).(*HttpHealthProbe)
+	// the test certificate names example.com, but not localhost
+	p.Address = strings.Replace(srv.URL, "127.0.0.1", "localhost", 1)
+	state, err := p.evaluate(context.Background(), ctx)
+	require.Nil(t, err)
+	require.Equal(t, Healthy, state)
+	require.Equal(t, "example.com", sni)
+
+	require.Equal(t, errTLSServerNameRequiresHttps, handlerSettings{
+		publicSettings{Protocol: "http", TLSServerName: "example.com"}, protectedSettings{},
+	}.validate())
+}
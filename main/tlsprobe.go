@@ -0,0 +1,79 @@
+package main
+
+import (
+	"context"
+	"crypto/tls"
+	"net"
+	"time"
+
+	"github.com/go-kit/kit/log"
+	"github.com/pkg/errors"
+)
+
+var (
+	errTlsConfigurationMustIncludePort = errors.New("'port', 'systemdSocket', 'portFile' or 'unixSocketPath' must be specified when using 'tls' protocol")
+	errTlsMustNotIncludeRequestPath    = errors.New("'requestPath' cannot be specified when using 'tls' protocol")
+)
+
+// TlsHealthProbe connects to a port and reports the application healthy if a
+// TLS handshake completes, without sending any request over the connection.
+type TlsHealthProbe struct {
+	Address string
+	Dial    dialFunc
+	Config  *tls.Config
+	Timeout time.Duration
+	// ExpiryThreshold is how long the server certificate must remain valid
+	// for, or 0 if its expiry is not checked.
+	ExpiryThreshold time.Duration
+}
+
+func (p *TlsHealthProbe) evaluate(probeCtx context.Context, ctx *log.Context) (HealthStatus, error) {
+	dialCtx, cancel := context.WithTimeout(probeCtx, p.Timeout)
+	defer cancel()
+	dial := p.Dial
+	if dial == nil {
+		dial = (&net.Dialer{}).DialContext
+	}
+	conn, err := dial(dialCtx, "tcp", p.Address)
+	if err != nil {
+		if err := resolutionError(err); err != nil {
+			return Unknown, err
+		}
+		return Unhealthy, nil
+	}
+	defer conn.Close()
+
+	config := p.Config.Clone()
+	if config.ServerName == "" {
+		// verified against the certificate unless verification is skipped
+		config.ServerName, _, _ = net.SplitHostPort(p.Address)
+	}
+	tlsConn := tls.Client(conn, config)
+	if err := tlsConn.HandshakeContext(dialCtx); err != nil {
+		ctx.Log("event", "tls handshake failed", "error", err)
+		return Unhealthy, nil
+	}
+	cs := tlsConn.ConnectionState()
+	if !checkCertificateExpiry(ctx, p.Address, &cs, p.ExpiryThreshold) {
+		return Unhealthy, nil
+	}
+	return Healthy, nil
+}
+
+func (p *TlsHealthProbe) address() string {
+	return p.Address
+}
+
+// validateTls makes logical validation of the settings of the tls probe.
+func (h handlerSettings) validateTls(portSources int) error {
+	if h.protocol() != "tls" {
+		return nil
+	}
+	if portSources == 0 {
+		return errTlsConfigurationMustIncludePort
+	}
+	if h.requestPath() != "" {
+		return errTlsMustNotIncludeRequestPath
+	}
+	return nil
+}
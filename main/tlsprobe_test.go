@@ -0,0 +1,53 @@
+package main
+
+import (
+	"context"
+	"encoding/pem"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/go-kit/kit/log"
+	"github.com/stretchr/testify/require"
+)
+
+func Test_TlsHealthProbe(t *testing.T) {
+	srv := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer srv.Close()
+	port := srv.Listener.Addr().(*net.TCPAddr).Port
+	ca := string(pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: srv.Certificate().Raw}))
+	plain := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer plain.Close()
+
+	ctx := log.NewContext(log.NewNopLogger())
+	for _, c := range []struct {
+		name     string
+		settings publicSettings
+		expected HealthStatus
+	}{
+		{"not verified", publicSettings{Protocol: "tls", Port: port}, Healthy},
+		// the test certificate names 127.0.0.1 and example.com only
+		{"verified", publicSettings{Protocol: "tls", Host: "127.0.0.1", Port: port, CABundle: ca}, Healthy},
+		{"other host", publicSettings{Protocol: "tls", Port: port, CABundle: ca}, Unhealthy},
+		{"server name", publicSettings{Protocol: "tls", Port: port, CABundle: ca, TLSServerName: "example.com"}, Healthy},
+		{"not tls", publicSettings{Protocol: "tls", Port: plain.Listener.Addr().(*net.TCPAddr).Port}, Unhealthy},
+		{"refused", publicSettings{Protocol: "tls", Port: 1}, Unhealthy},
+	} {
+		cfg := &handlerSettings{c.settings, protectedSettings{}}
+		require.Nil(t, cfg.validate(), c.name)
+		p := NewHealthProbe(ctx, cfg)
+		require.IsType(t, &TlsHealthProbe{}, p)
+		state, err := p.evaluate(context.Background(), ctx)
+		require.Nil(t, err, c.name)
+		require.Equal(t, c.expected, state, c.name)
+	}
+}
+
+func Test_handlerSettingsValidate_tls(t *testing.T) {
+	validate := func(p publicSettings) error { return handlerSettings{p, protectedSettings{}}.validate() }
+	require.Equal(t, errTlsConfigurationMustIncludePort, validate(publicSettings{Protocol: "tls"}))
+	require.Equal(t, errTlsMustNotIncludeRequestPath, validate(publicSettings{Protocol: "tls", Port: 636, RequestPath: "health"}))
+	require.Equal(t, errALPNRequiresHttps, validate(publicSettings{Protocol: "tls", Port: 636, ExpectedALPNProtocol: "h2"}))
+	require.Nil(t, validate(publicSettings{Protocol: "tls", Port: 636, CABundlePath: "/etc/ssl/ca.pem", TLSServerName: "ldap.contoso.com"}))
+}
@@ -0,0 +1,117 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"net"
+	"time"
+
+	"github.com/go-kit/kit/log"
+	"github.com/pkg/errors"
+)
+
+const (
+	// maxUdpResponseSize is the largest UDP response read.
+	maxUdpResponseSize = 65535
+)
+
+var (
+	errUdpConfigurationMustIncludePort = errors.New("'port', 'systemdSocket' or 'portFile' must be specified when using 'udp' protocol")
+	errUdpMustNotIncludeRequestPath    = errors.New("'requestPath' cannot be specified when using 'udp' protocol")
+	errUdpPayloadRequiresUdp           = errors.New("'udpPayload' and 'udpExpectedResponse' can only be specified when using 'udp' protocol")
+	errUdpRequiresPayload              = errors.New("'udpPayload' must be specified when using 'udp' protocol")
+	errUdpNotTunneled                  = errors.New("'udp' protocol cannot be used together with 'sshTunnel' or 'unixSocketPath'")
+	errInvalidUdpPayload               = errors.New("'udpPayload' and 'udpExpectedResponse' must be base64 encoded")
+)
+
+// UdpHealthProbe sends a datagram and reports the application healthy if a
+// response, containing the expected bytes if any, is received before the
+// timeout.
+type UdpHealthProbe struct {
+	Address  string
+	Dial     dialFunc
+	Payload  []byte
+	Expected []byte // nil accepts any response
+	Timeout  time.Duration
+}
+
+func (p *UdpHealthProbe) evaluate(probeCtx context.Context, ctx *log.Context) (HealthStatus, error) {
+	dialCtx, cancel := context.WithTimeout(probeCtx, p.Timeout)
+	defer cancel()
+	dial := p.Dial
+	if dial == nil {
+		dial = (&net.Dialer{}).DialContext
+	}
+	conn, err := dial(dialCtx, "udp", p.Address)
+	if err != nil {
+		if err := resolutionError(err); err != nil {
+			return Unknown, err
+		}
+		return Unhealthy, nil
+	}
+	defer conn.Close()
+
+	deadline, _ := dialCtx.Deadline()
+	conn.SetDeadline(deadline)
+	if _, err := conn.Write(p.Payload); err != nil {
+		return Unhealthy, nil
+	}
+	buf := make([]byte, maxUdpResponseSize)
+	for {
+		n, err := conn.Read(buf)
+		if err != nil {
+			// timed out, or refused by an ICMP port unreachable
+			return Unhealthy, nil
+		}
+		if p.Expected == nil || bytes.Contains(buf[:n], p.Expected) {
+			return Healthy, nil
+		}
+		ctx.Log("event", "unexpected udp response", "size", n)
+	}
+}
+
+func (p *UdpHealthProbe) address() string {
+	return p.Address
+}
+
+// validateUdp makes logical validation of the settings of the udp probe.
+func (h handlerSettings) validateUdp(portSources int) error {
+	if h.protocol() != "udp" {
+		if h.publicSettings.UdpPayload != "" || h.publicSettings.UdpExpectedResponse != "" {
+			return errUdpPayloadRequiresUdp
+		}
+		return nil
+	}
+	if h.sshTunnel() != nil || h.unixSocketPath() != "" {
+		return errUdpNotTunneled
+	}
+	if portSources == 0 {
+		return errUdpConfigurationMustIncludePort
+	}
+	if h.requestPath() != "" {
+		return errUdpMustNotIncludeRequestPath
+	}
+	if h.publicSettings.UdpPayload == "" {
+		return errUdpRequiresPayload
+	}
+	if _, _, err := h.udpPayload(); err != nil {
+		return err
+	}
+	return nil
+}
+
+// udpPayload returns the datagram sent by the udp probe and the bytes the
+// response must contain, nil if any response is accepted.
+func (s *handlerSettings) udpPayload() (payload, expected []byte, err error) {
+	payload, err = base64.StdEncoding.DecodeString(s.publicSettings.UdpPayload)
+	if err != nil {
+		return nil, nil, errInvalidUdpPayload
+	}
+	if s.publicSettings.UdpExpectedResponse != "" {
+		if expected, err = base64.StdEncoding.DecodeString(s.publicSettings.UdpExpectedResponse); err != nil {
+			return nil, nil, errInvalidUdpPayload
+		}
+	}
+	return payload, expected, nil
+}
@@ -0,0 +1,76 @@
+package main
+
+import (
+	"context"
+	"net"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/go-kit/kit/log"
+	"github.com/stretchr/testify/require"
+)
+
+// serveUdpEcho answers every datagram received on conn with reply.
+func serveUdpEcho(conn net.PacketConn, reply []byte) {
+	buf := make([]byte, 1024)
+	for {
+		_, addr, err := conn.ReadFrom(buf)
+		if err != nil {
+			return
+		}
+		conn.WriteTo(reply, addr)
+	}
+}
+
+func Test_UdpHealthProbe(t *testing.T) {
+	ctx := log.NewContext(log.NewNopLogger())
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	require.Nil(t, err)
+	defer conn.Close()
+	go serveUdpEcho(conn, []byte("status: pong"))
+
+	probe := func(addr string, expected []byte) HealthStatus {
+		p := &UdpHealthProbe{Address: addr, Payload: []byte("ping"), Expected: expected, Timeout: 200 * time.Millisecond}
+		state, err := p.evaluate(context.Background(), ctx)
+		require.Nil(t, err)
+		return state
+	}
+	require.Equal(t, Healthy, probe(conn.LocalAddr().String(), nil))
+	require.Equal(t, Healthy, probe(conn.LocalAddr().String(), []byte("pong")))
+	require.Equal(t, Unhealthy, probe(conn.LocalAddr().String(), []byte("ready")), "no matching response")
+
+	silent, err := net.ListenPacket("udp", "127.0.0.1:0")
+	require.Nil(t, err)
+	defer silent.Close()
+	require.Equal(t, Unhealthy, probe(silent.LocalAddr().String(), nil), "no response")
+}
+
+func Test_NewHealthProbe_udp(t *testing.T) {
+	ctx := log.NewContext(log.NewNopLogger())
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	require.Nil(t, err)
+	defer conn.Close()
+	go serveUdpEcho(conn, []byte("pong"))
+
+	port := conn.LocalAddr().(*net.UDPAddr).Port
+	cfg := &handlerSettings{publicSettings: publicSettings{Protocol: "udp", Port: port, UdpPayload: "cGluZw==", UdpExpectedResponse: "cG9uZw=="}}
+	require.Nil(t, cfg.validate())
+	p := NewHealthProbe(ctx, cfg)
+	require.Equal(t, "localhost:"+strconv.Itoa(port), p.address())
+	up := p.(*UdpHealthProbe)
+	require.Equal(t, []byte("ping"), up.Payload)
+	require.Equal(t, []byte("pong"), up.Expected)
+}
+
+func Test_handlerSettingsValidate_udp(t *testing.T) {
+	validate := func(p publicSettings) error { return handlerSettings{p, protectedSettings{}}.validate() }
+
+	require.Nil(t, validate(publicSettings{Protocol: "udp", Port: 53, UdpPayload: "cGluZw=="}))
+	require.Equal(t, errUdpConfigurationMustIncludePort, validate(publicSettings{Protocol: "udp", UdpPayload: "cGluZw=="}))
+	require.Equal(t, errUdpRequiresPayload, validate(publicSettings{Protocol: "udp", Port: 53}))
+	require.Equal(t, errUdpMustNotIncludeRequestPath, validate(publicSettings{Protocol: "udp", Port: 53, UdpPayload: "cGluZw==", RequestPath: "x"}))
+	require.Equal(t, errInvalidUdpPayload, validate(publicSettings{Protocol: "udp", Port: 53, UdpPayload: "cGluZw==", UdpExpectedResponse: "%%"}))
+	require.Equal(t, errUdpNotTunneled, validate(publicSettings{Protocol: "udp", UnixSocketPath: "/run/app.sock", UdpPayload: "cGluZw=="}))
+	require.Equal(t, errUdpPayloadRequiresUdp, validate(publicSettings{Protocol: "tcp", Port: 53, UdpPayload: "cGluZw=="}))
+}
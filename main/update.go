@@ -0,0 +1,130 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/go-kit/kit/log"
+	"github.com/pkg/errors"
+)
+
+const (
+	// dataRoot is where the data dirs of all versions are.
+	dataRoot = "/var/lib/waagent"
+	// dataDirName is the data dir of the versions predating versioned data
+	// dirs, and the prefix of the versioned ones.
+	dataDirName = "apphealth"
+)
+
+// migratedFiles are the files under dataDir carried over from the previous
+// version on an update.
+var migratedFiles = []string{healthStateFile, probeJournalFile, startCountFile}
+
+// versionedDataDir returns the data dir of the version under root.
+func versionedDataDir(root, version string) string {
+	if version == "" {
+		version = "dev"
+	}
+	return filepath.Join(root, dataDirName+"-"+version)
+}
+
+// previousDataDir returns the most recently changed data dir under root other
+// than current, or false if there is none.
+func previousDataDir(root, current string) (string, bool) {
+	candidates, _ := filepath.Glob(filepath.Join(root, dataDirName+"-*"))
+	candidates = append(candidates, filepath.Join(root, dataDirName))
+	var out string
+	var latest time.Time
+	for _, dir := range candidates {
+		if filepath.Clean(dir) == filepath.Clean(current) {
+			continue
+		}
+		fi, err := os.Stat(dir)
+		if err != nil || !fi.IsDir() {
+			continue
+		}
+		if out == "" || fi.ModTime().After(latest) {
+			out, latest = dir, fi.ModTime()
+		}
+	}
+	return out, out != ""
+}
+
+// migrateDataDir copies the migrated files found in from to to, keeping those
+// already in to. It returns the names of the files copied.
+func migrateDataDir(from, to string) ([]string, error) {
+	if err := os.MkdirAll(to, 0755); err != nil {
+		return nil, errors.Wrap(err, "failed to create data dir")
+	}
+	var copied []string
+	for _, name := range migratedFiles {
+		if _, err := os.Stat(filepath.Join(to, name)); err == nil {
+			continue
+		}
+		src := filepath.Join(from, name)
+		fi, err := os.Stat(src)
+		if os.IsNotExist(err) {
+			continue
+		} else if err != nil {
+			return copied, errors.Wrapf(err, "failed to read %s", name)
+		}
+		b, err := ioutil.ReadFile(src)
+		if err != nil {
+			return copied, errors.Wrapf(err, "failed to read %s", name)
+		}
+		if err := writeFileAtomic(filepath.Join(to, name), b, fi.Mode().Perm()); err != nil {
+			return copied, errors.Wrapf(err, "failed to copy %s", name)
+		}
+		copied = append(copied, name)
+	}
+	return copied, nil
+}
+
+// checkResume makes sure the health state carried over can be resumed from
+// with the settings, discarding it otherwise so that the new version does not
+// fail on it.
+func checkResume(ctx *log.Context, cfg *handlerSettings, dir string) {
+	path := filepath.Join(dir, healthStateFile)
+	s, ok, err := loadHealthState(path)
+	if err != nil {
+		ctx.Log("event", "health state of the previous version cannot be resumed, discarding it", "error", err)
+		os.Remove(path)
+		return
+	}
+	if !ok || !cfg.persistState() {
+		return
+	}
+	now := time.Now()
+	m := newMonitor(cfg, now, newExtensionMetrics(now, 0))
+	if !m.restore(s, now, cfg.persistedStateMaxAge()) {
+		ctx.Log("event", "health state of the previous version expired", "savedAt", s.SavedAt)
+		return
+	}
+	ctx.Log("event", "probing resumes from the health state of the previous version", "state", m.state())
+}
+
+func update(runCtx context.Context, ctx *log.Context, h HandlerEnvironment, seqNum int) (string, error) {
+	// fail the update, keeping the previous version, if the new one cannot
+	// probe with the current settings
+	cfg, err := parseAndValidateSettings(ctx, h.HandlerEnvironment.ConfigFolder)
+	if err != nil {
+		return "", errors.Wrap(err, "failed to get configuration")
+	}
+
+	from, ok := previousDataDir(dataRoot, dataDir)
+	if !ok {
+		ctx.Log("event", "no data of a previous version")
+		return "", errors.Wrap(os.MkdirAll(dataDir, 0755), "failed to create data dir")
+	}
+	copied, err := migrateDataDir(from, dataDir)
+	if err != nil {
+		return "", errors.Wrap(err, "failed to migrate data of the previous version")
+	}
+	ctx.Log("event", "migrated data of the previous version", "from", from, "to", dataDir, "files", fmt.Sprint(copied))
+	checkResume(ctx, &cfg, dataDir)
+	return "", nil
+}
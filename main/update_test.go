@@ -0,0 +1,93 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/go-kit/kit/log"
+	"github.com/stretchr/testify/require"
+)
+
+func Test_versionedDataDir(t *testing.T) {
+	require.Equal(t, "/var/lib/waagent/apphealth-1.0.1", versionedDataDir("/var/lib/waagent", "1.0.1"))
+	require.Equal(t, "/var/lib/waagent/apphealth-dev", versionedDataDir("/var/lib/waagent", ""))
+}
+
+func Test_previousDataDir(t *testing.T) {
+	root, err := ioutil.TempDir("", "")
+	require.Nil(t, err)
+	defer os.RemoveAll(root)
+	current := versionedDataDir(root, "1.0.2")
+	require.Nil(t, os.Mkdir(current, 0755))
+
+	_, ok := previousDataDir(root, current)
+	require.False(t, ok, "only the current one")
+
+	legacy := filepath.Join(root, dataDirName)
+	require.Nil(t, os.Mkdir(legacy, 0755))
+	dir, ok := previousDataDir(root, current)
+	require.True(t, ok)
+	require.Equal(t, legacy, dir)
+
+	previous := versionedDataDir(root, "1.0.1")
+	require.Nil(t, os.Mkdir(previous, 0755))
+	require.Nil(t, os.Chtimes(legacy, time.Now().Add(-time.Hour), time.Now().Add(-time.Hour)))
+	dir, ok = previousDataDir(root, current)
+	require.True(t, ok)
+	require.Equal(t, previous, dir, "most recently changed")
+}
+
+func Test_migrateDataDir(t *testing.T) {
+	root, err := ioutil.TempDir("", "")
+	require.Nil(t, err)
+	defer os.RemoveAll(root)
+	from, to := filepath.Join(root, "from"), filepath.Join(root, "to")
+	require.Nil(t, os.Mkdir(from, 0755))
+	require.Nil(t, ioutil.WriteFile(filepath.Join(from, healthStateFile), []byte("old"), 0600))
+	require.Nil(t, ioutil.WriteFile(filepath.Join(from, startCountFile), []byte("3"), 0644))
+	require.Nil(t, ioutil.WriteFile(filepath.Join(from, controlSocketFile), nil, 0600))
+
+	copied, err := migrateDataDir(from, to)
+	require.Nil(t, err)
+	require.Equal(t, []string{healthStateFile, startCountFile}, copied)
+	b, err := ioutil.ReadFile(filepath.Join(to, healthStateFile))
+	require.Nil(t, err)
+	require.Equal(t, "old", string(b))
+	fi, err := os.Stat(filepath.Join(to, healthStateFile))
+	require.Nil(t, err)
+	require.Equal(t, os.FileMode(0600), fi.Mode().Perm())
+	_, err = os.Stat(filepath.Join(to, controlSocketFile))
+	require.True(t, os.IsNotExist(err), "not migrated")
+
+	// existing files are kept
+	require.Nil(t, ioutil.WriteFile(filepath.Join(from, healthStateFile), []byte("older"), 0600))
+	copied, err = migrateDataDir(from, to)
+	require.Nil(t, err)
+	require.Empty(t, copied)
+	b, err = ioutil.ReadFile(filepath.Join(to, healthStateFile))
+	require.Nil(t, err)
+	require.Equal(t, "old", string(b))
+}
+
+func Test_checkResume(t *testing.T) {
+	dir, err := ioutil.TempDir("", "")
+	require.Nil(t, err)
+	defer os.RemoveAll(dir)
+	ctx := log.NewContext(log.NewNopLogger())
+	cfg := &handlerSettings{publicSettings: publicSettings{PersistState: true}}
+	path := filepath.Join(dir, healthStateFile)
+
+	require.Nil(t, saveHealthState(path, persistedState{SavedAt: time.Now()}))
+	checkResume(ctx, cfg, dir)
+	_, ok, err := loadHealthState(path)
+	require.Nil(t, err)
+	require.True(t, ok, "kept")
+
+	require.Nil(t, ioutil.WriteFile(path, []byte("{"), 0600))
+	checkResume(ctx, cfg, dir)
+	_, err = os.Stat(path)
+	require.True(t, os.IsNotExist(err), "unreadable state discarded")
+}
@@ -0,0 +1,121 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"os"
+	"time"
+
+	"github.com/go-kit/kit/log"
+	"github.com/pkg/errors"
+)
+
+const (
+	webhookTimeout = 10 * time.Second
+
+	// webhookQueueSize bounds the notifications waiting for delivery, newer
+	// ones are dropped while the webhook is slow.
+	webhookQueueSize = 16
+)
+
+// notificationSettings configure the notifications sent on health state
+// transitions.
+type notificationSettings struct {
+	WebhookURL string `json:"webhookUrl"`
+}
+
+// webhookURL returns the URL health state transitions are posted to, or "" if
+// they are not.
+func (s *handlerSettings) webhookURL() string {
+	if s.publicSettings.Notification == nil {
+		return ""
+	}
+	return s.publicSettings.Notification.WebhookURL
+}
+
+// transitionNotification is the payload posted to the webhook.
+type transitionNotification struct {
+	OldState  HealthStatus `json:"oldState"`
+	NewState  HealthStatus `json:"newState"`
+	Timestamp string       `json:"timestamp"`
+	VMName    string       `json:"vmName"`
+}
+
+type webhookDelivery struct {
+	url string
+	n   transitionNotification
+}
+
+// webhookNotifier posts health state transitions to a webhook in order, in the
+// background so that the probe loop never waits on it.
+type webhookNotifier struct {
+	client *http.Client
+	vmName func() string
+	queue  chan webhookDelivery
+}
+
+// newWebhookNotifier starts delivering notifications until closed. vmName
+// returns the name of the VM reported in the notifications.
+func newWebhookNotifier(ctx *log.Context, vmName func() string) *webhookNotifier {
+	n := &webhookNotifier{
+		client: &http.Client{Timeout: webhookTimeout},
+		vmName: vmName,
+		queue:  make(chan webhookDelivery, webhookQueueSize),
+	}
+	go func() {
+		for d := range n.queue {
+			if err := n.post(d); err != nil {
+				ctx.Log("event", "failed to notify webhook of health state transition", "error", err)
+			}
+		}
+	}()
+	return n
+}
+
+// notify queues the notification of the transition at t to the webhook at url.
+func (n *webhookNotifier) notify(ctx *log.Context, url string, from, to HealthStatus, t time.Time) {
+	d := webhookDelivery{url, transitionNotification{
+		OldState:  from,
+		NewState:  to,
+		Timestamp: t.UTC().Format(time.RFC3339),
+		VMName:    n.vmName(),
+	}}
+	select {
+	case n.queue <- d:
+	default:
+		ctx.Log("event", "webhook notification dropped, too many pending", "oldState", from, "newState", to)
+	}
+}
+
+func (n *webhookNotifier) post(d webhookDelivery) error {
+	body, err := json.Marshal(d.n)
+	if err != nil {
+		return err
+	}
+	resp, err := n.client.Post(d.url, "application/json", bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return errors.Errorf("webhook responded with %s", resp.Status)
+	}
+	return nil
+}
+
+func (n *webhookNotifier) Close() {
+	close(n.queue)
+}
+
+// vmNameFunc returns a function returning the name of the VM from IMDS, or
+// the hostname until IMDS is reached.
+func vmNameFunc(vm *vmMetadataCache) func() string {
+	return func() string {
+		if m := vm.get(); m != nil && m.VMName != "" {
+			return m.VMName
+		}
+		name, _ := os.Hostname()
+		return name
+	}
+}
@@ -0,0 +1,61 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/go-kit/kit/log"
+	"github.com/stretchr/testify/require"
+)
+
+func Test_webhookNotifier(t *testing.T) {
+	ctx := log.NewContext(log.NewNopLogger())
+	received := make(chan transitionNotification, 4)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		require.Equal(t, "POST", r.Method)
+		require.Equal(t, "application/json", r.Header.Get("Content-Type"))
+		var n transitionNotification
+		require.Nil(t, json.NewDecoder(r.Body).Decode(&n))
+		received <- n
+	}))
+	defer srv.Close()
+
+	n := newWebhookNotifier(ctx, func() string { return "web_3" })
+	defer n.Close()
+	at := time.Date(2026, 10, 15, 12, 0, 0, 0, time.FixedZone("CEST", 2*60*60))
+	n.notify(ctx, srv.URL, Healthy, Unhealthy, at)
+	n.notify(ctx, srv.URL, Unhealthy, Healthy, at.Add(time.Minute))
+
+	select {
+	case got := <-received:
+		require.Equal(t, transitionNotification{OldState: Healthy, NewState: Unhealthy, Timestamp: "2026-10-15T10:00:00Z", VMName: "web_3"}, got)
+	case <-time.After(5 * time.Second):
+		t.Fatal("no notification")
+	}
+	select {
+	case got := <-received:
+		require.Equal(t, Healthy, got.NewState, "in order")
+	case <-time.After(5 * time.Second):
+		t.Fatal("no notification")
+	}
+}
+
+func Test_webhookNotifier_post(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer srv.Close()
+
+	n := &webhookNotifier{client: http.DefaultClient}
+	require.NotNil(t, n.post(webhookDelivery{url: srv.URL}))
+	require.NotNil(t, n.post(webhookDelivery{url: "http://127.0.0.1:1/"}))
+}
+
+func Test_handlerSettings_webhookURL(t *testing.T) {
+	require.Equal(t, "", (&handlerSettings{}).webhookURL())
+	cfg := &handlerSettings{publicSettings: publicSettings{Notification: &notificationSettings{WebhookURL: "https://hooks.example.com/health"}}}
+	require.Equal(t, "https://hooks.example.com/health", cfg.webhookURL())
+}